@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// approveCmd represents the approve command
+var approveCmd = &cobra.Command{
+	Use:   "approve ID",
+	Short: "Approve the high-risk task requested by another user",
+	Long: `
+Approve the high-risk task requested by another user.
+
+Tasks that match the 'approval' section of the policy file('--run.policy-file'
+or /etc/gossh/policy.yaml) need approval of a second user, and the requester runs
+the task again after it is approved. Requester and approver are recorded by the
+audit events of syslog.
+
+The ID is the hash of the task, target hosts and the content of the script or
+push files, so a task changed after approval needs a new approval. The sha256 of
+the script content is shown as by 'sha256sum' to be compared with the reviewed one.
+
+The approval is a file created in the approval dir by the approver, and it is
+verified by the owner of the file, so the approval dir should be writable by
+all the users and sticky(chmod 1777). Approvals expire after 24 hours. It is not
+supported on windows, and root or ssh without gossh can still bypass it.`,
+	Example: `
+  # Approve the task requested by another user.
+  $ gossh approve 3f9a1c2b7d4e --run.policy-file /etc/gossh/policy.yaml`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		approvalDir, err := sshtask.ApprovalDir(configflags.Config.Run.PolicyFile)
+		if err != nil {
+			util.CheckErr(err)
+		}
+
+		request, err := sshtask.Approve(approvalDir, args[0])
+		if err != nil {
+			util.CheckErr(err)
+		}
+
+		fmt.Printf(
+			"approved '%s' on %d hosts(sudo: %v), requested by '%s' at %s\n",
+			request.Task,
+			request.Hosts,
+			request.Sudo,
+			request.Requester,
+			request.RequestedAt.Format("2006-01-02 15:04:05"),
+		)
+
+		if request.ContentHash != "" {
+			fmt.Printf("content sha256: %s\n", request.ContentHash)
+		}
+	},
+}
+
+func init() {
+	approveCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
+		util.CobraMarkHiddenGlobalFlagsExcept(rootCmd, "run.policy-file", "config")
+		command.Parent().HelpFunc()(command, strings)
+	})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var taskIDRegexp = regexp.MustCompile(`^[0-9]+$`)
+
+// attachCmd represents the attach command
+var attachCmd = &cobra.Command{
+	Use:   "attach TASK_ID [HOST...]",
+	Short: "Collect the status and output of commands detached by '--run.detach'",
+	Long: `
+Collect the status and output of commands detached by '--run.detach'.
+
+The status of each target host is one of 'running', 'exited: CODE' and
+'killed', followed by the output of the commands so far. Target hosts fail
+if the job is not found, exited with non-zero code or killed.
+
+The '--run.sudo', '--run.as-user' and '--run.tmp-dir' should be the same as
+the detached task.`,
+	Example: `
+  # Start a long-running job on target hosts in background.
+  $ gossh command -H hosts.txt -e "/opt/backup.sh" --run.detach -k
+  host1 | 2022-01-01 10:00:00.000000 | SUCCESS >>
+  detached, task id: 20220101100000, pid: 12345
+
+  # Collect the status and output of the job later.
+  $ gossh attach 20220101100000 -H hosts.txt -k`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			util.CobraCheckErrWithHelp(cmd, "need task id")
+		}
+
+		return nil
+	},
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if !taskIDRegexp.MatchString(args[0]) {
+			util.CheckErr(fmt.Sprintf("invalid task id: '%s'", args[0]))
+		}
+
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		task := sshtask.NewTask(sshtask.AttachTask, configflags.Config)
+
+		task.SetTargetHosts(args[1:])
+		task.SetAttachTaskID(args[0])
+
+		task.Start()
+
+		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	checkFile     string
+	checkContains []string
+	checkSHA256   string
+	checkMode     string
+	checkOwner    string
+)
+
+var (
+	checkSHA256Regexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	checkModeRegexp   = regexp.MustCompile(`^[0-7]{3,4}$`)
+	checkOwnerRegexp  = regexp.MustCompile(`^[A-Za-z0-9_.-]+(:[A-Za-z0-9_.-]+)?$`)
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Assert the state of a file on target hosts without modifying anything",
+	Long: `
+Assert the state of a file on target hosts without modifying anything, e.g. for
+compliance scans. The file must exist, and each assertion is reported as PASS or
+FAIL, target hosts fail if any of the assertions failed.`,
+	Example: `
+  # Check the nameservers of target hosts.
+  $ gossh check --file /etc/resolv.conf --contains 'nameserver 10.' -H hosts.txt -c 100 -k
+
+  # Check the content, permissions and owner of sshd config.
+  $ gossh check --file /etc/ssh/sshd_config --contains 'PermitRootLogin no' \
+      --sha256 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 \
+      --mode 0600 --owner root:root -H hosts.txt -c 100 -s -k`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+
+		if checkFile == "" {
+			util.CobraCheckErrWithHelp(cmd, "need flag '--file'")
+		}
+
+		// The commands are in single quotes of 'sudo bash -c'.
+		for _, v := range append([]string{checkFile}, checkContains...) {
+			if strings.Contains(v, "'") {
+				util.CheckErr(fmt.Sprintf("invalid value: %s - can not contain single quotes", v))
+			}
+		}
+
+		if checkSHA256 != "" && !checkSHA256Regexp.MatchString(checkSHA256) {
+			util.CheckErr(fmt.Sprintf("invalid sha256: '%s' - need 64 hex digits", checkSHA256))
+		}
+
+		if checkMode != "" && !checkModeRegexp.MatchString(checkMode) {
+			util.CheckErr(fmt.Sprintf("invalid mode: '%s' - need octal permissions, e.g. 0644", checkMode))
+		}
+
+		if checkOwner != "" && !checkOwnerRegexp.MatchString(checkOwner) {
+			util.CheckErr(fmt.Sprintf("invalid owner: '%s' - need format 'user[:group]'", checkOwner))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runCommandTask(cmd, args, checkCommand())
+	},
+}
+
+// checkCommand generates the commands that output PASS or FAIL for each assertion.
+func checkCommand() string {
+	commands := []string{
+		fmt.Sprintf("f=%s;r=0", util.ShellDoubleQuote(checkFile)),
+		`[ -f "$f" ] || { echo "FAIL: $f is not a regular file";exit 1; }`,
+		`pass(){ echo "PASS: $1"; };fail(){ echo "FAIL: $1";r=1; }`,
+	}
+
+	for _, s := range checkContains {
+		quoted := util.ShellDoubleQuote(s)
+		commands = append(commands, fmt.Sprintf(
+			`if grep -qF -- %s "$f";then pass "contains "%s;else fail "does not contain "%s;fi`,
+			quoted, quoted, quoted,
+		))
+	}
+
+	if checkSHA256 != "" {
+		want := strings.ToLower(checkSHA256)
+		commands = append(commands, fmt.Sprintf(
+			`set -- $(sha256sum "$f");if [ "$1" = %s ];then pass "sha256 is %s";else fail "sha256 is $1, not %s";fi`,
+			want, want, want,
+		))
+	}
+
+	if checkMode != "" {
+		// Compare without leading zeros, 'stat -c %a' outputs e.g. 644.
+		want := strings.TrimLeft(checkMode, "0")
+		if want == "" {
+			want = "0"
+		}
+		commands = append(commands, fmt.Sprintf(
+			`m=$(stat -c %%a "$f");if [ "$m" = %s ];then pass "mode is %s";else fail "mode is $m, not %s";fi`,
+			want, checkMode, checkMode,
+		))
+	}
+
+	if checkOwner != "" {
+		format := "%U"
+		if strings.Contains(checkOwner, ":") {
+			format = "%U:%G"
+		}
+		commands = append(commands, fmt.Sprintf(
+			`o=$(stat -c %s "$f");if [ "$o" = %s ];then pass "owner is %s";else fail "owner is $o, not %s";fi`,
+			format, checkOwner, checkOwner, checkOwner,
+		))
+	}
+
+	return strings.Join(append(commands, "exit $r"), "\n")
+}
+
+func init() {
+	checkCmd.Flags().StringVarP(&checkFile, "file", "f", "", "file to be checked on target hosts")
+	checkCmd.Flags().StringArrayVarP(&checkContains, "contains", "", nil,
+		"assert that the file contains this string, can be repeated")
+	checkCmd.Flags().StringVarP(&checkSHA256, "sha256", "", "", "assert the sha256 checksum of the file")
+	checkCmd.Flags().StringVarP(&checkMode, "mode", "", "", "assert the permissions of the file, e.g. 0644")
+	checkCmd.Flags().StringVarP(&checkOwner, "owner", "", "", "assert the owner of the file, in format 'user[:group]'")
+}
@@ -0,0 +1,260 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+
+	"github.com/windvalley/gossh/internal/cmd/vault"
+	"github.com/windvalley/gossh/internal/pkg/aes"
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// maskedSecret replaces the plain text passwords/passphrases in the effective configuration.
+const maskedSecret = "******"
+
+// configCheckCmd represents the config check command
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check configuration file and show the effective configuration",
+	Long: `
+Check configuration file for unknown keys, type errors, mutually exclusive options
+and vaulted values that can not be decrypted, and show the effective configuration
+merged from the configuration file, the profile by '--profile' and flags.
+
+Plain text passwords and passphrases are masked in the effective configuration.`,
+	Example: `
+  # Check the default configuration file.
+  $ gossh config check
+
+  # Check a configuration file with profile 'prod', and decrypt vaulted values by vault password file.
+  $ gossh config check --config ./gossh.yaml --profile prod -V /path/vault-password-file`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var errs []error
+
+		file := viper.ConfigFileUsed()
+		if file == "" {
+			fmt.Printf("Config file: none\n")
+		} else {
+			fmt.Printf("Config file: %s\n", file)
+			errs = append(errs, checkConfigFile(file)...)
+		}
+
+		if profile != "" {
+			fmt.Printf("Profile: %s\n", profile)
+		}
+
+		effective, err := effectiveConfig()
+		util.CheckErr(err)
+
+		fmt.Printf("\n%s\n", effective)
+
+		vaultErrs := checkVaultedValues()
+		if len(vaultErrs) == 0 {
+			// Validates the plain texts of the vaulted values, e.g. of 'run.workdir'.
+			_ = configflags.Config.DecryptVaultedValues(vault.Decrypt, isSecretValueKey)
+		}
+
+		errs = append(errs, configflags.Config.Validate()...)
+		errs = append(errs, vaultErrs...)
+
+		if len(errs) == 0 {
+			fmt.Printf("Config is valid\n")
+			return
+		}
+
+		for _, err := range errs {
+			util.PrintErr(err)
+		}
+
+		os.Exit(1)
+	},
+}
+
+func init() {
+	// Not the help function of 'config', which hides the global flags for generating config file.
+	configCheckCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
+		rootCmd.HelpFunc()(command, strings)
+	})
+}
+
+// checkConfigFile checks the top-level settings and each profile of config file
+// for unknown keys and type errors.
+func checkConfigFile(file string) (errs []error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return []error{fmt.Errorf("read config file '%s' failed: %s", file, err)}
+	}
+
+	settings := v.AllSettings()
+	profiles := v.GetStringMap("profiles")
+	delete(settings, "profiles")
+
+	errs = append(errs, decodeConfig("", settings)...)
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		errs = append(errs, decodeConfig(fmt.Sprintf("profile '%s': ", name), v.GetStringMap("profiles."+name))...)
+	}
+
+	return errs
+}
+
+// decodeConfig decodes settings exactly into the config flags, and splits the errors of decoding,
+// e.g. "'output' has invalid keys: quite", "cannot parse 'timeout.conn' as int".
+func decodeConfig(prefix string, settings map[string]interface{}) (errs []error) {
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return []error{fmt.Errorf("%s%s", prefix, err)}
+	}
+
+	err := v.UnmarshalExact(configflags.New())
+	if err == nil {
+		return nil
+	}
+
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.HasPrefix(line, "* ") {
+			errs = append(errs, fmt.Errorf("%s%s", prefix, strings.TrimPrefix(line, "* ")))
+		}
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("%s%s", prefix, err))
+	}
+
+	return errs
+}
+
+// effectiveConfig returns the effective configuration in yaml format, with the plain text
+// passwords/passphrases masked.
+func effectiveConfig() (string, error) {
+	out, err := yaml.Marshal(configSettings(reflect.ValueOf(configflags.Config)))
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// configSettings converts v to settings keyed by the json tags in the order of fields,
+// durations are in format like '10s', and the plain text values of the keys like
+// 'password' and 'passphrase' are masked, while the vaulted values are kept.
+func configSettings(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+
+		return configSettings(v.Elem())
+	case reflect.Struct:
+		settings := yaml.MapSlice{}
+		for i := 0; i < v.NumField(); i++ {
+			key := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+			value := configSettings(v.Field(i))
+
+			if isSecretKey(key) && !isEmptySetting(value) {
+				if s, ok := value.(string); !ok || !aes.IsCipherText(s) {
+					value = maskedSecret
+				}
+			}
+
+			settings = append(settings, yaml.MapItem{Key: key, Value: value})
+		}
+
+		return settings
+	}
+
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	return v.Interface()
+}
+
+func isEmptySetting(value interface{}) bool {
+	v := reflect.ValueOf(value)
+
+	return v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0)
+}
+
+func isSecretKey(key string) bool {
+	return strings.HasSuffix(key, "password") || strings.HasSuffix(key, "passphrase") ||
+		strings.HasSuffix(key, "passphrases")
+}
+
+// isSecretValueKey reports whether the key of a value is of passwords/passphrases,
+// e.g. 'auth.password' or 'auth.key-passphrases[0]'.
+func isSecretValueKey(key string) bool {
+	return isSecretKey(strings.Split(key, "[")[0])
+}
+
+// checkVaultedValues decrypts the vaulted values of the effective configuration,
+// and the vault password is only asked if there are vaulted values not encrypted to recipients.
+func checkVaultedValues() (errs []error) {
+	vaulted := configflags.Config.VaultedValues()
+
+	if len(vaulted) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(vaulted))
+	for key := range vaulted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, err := vault.Decrypt(vaulted[key]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: decrypt vaulted value failed: %s", key, err))
+		}
+	}
+
+	return errs
+}
+
+// isConfigCheck reports whether the command being executed is 'config check',
+// which reports the errors of loading config file rather than exiting on them.
+func isConfigCheck() bool {
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+
+	return err == nil && cmd == configCheckCmd
+}
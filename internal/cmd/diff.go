@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	diffCommand  string
+	baselineHost string
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Detect drift of command outputs across target hosts",
+	Long: `
+Detect drift of command outputs across target hosts.
+
+It executes commands on target hosts, and compares the outputs with that of
+the baseline host, which is specified by '--baseline' or has the most common
+output. Hosts that deviate from the baseline are reported as failed with
+unified diffs.`,
+	Example: `
+  # Detect configuration drift, the most common output is the baseline.
+  $ gossh diff -H hosts.txt -e "cat /etc/ntp.conf" -k
+
+  # Compare with a known good host.
+  $ gossh diff -H hosts.txt -e "sysctl -a 2>/dev/null | sort" --baseline host1 -k
+
+  # Use sudo to read files with no permission.
+  $ gossh diff -H hosts.txt -e "cat /etc/sudoers" -s`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		task := sshtask.NewTask(sshtask.DiffTask, configflags.Config)
+
+		task.SetTargetHosts(args)
+		task.SetCommand(diffCommand)
+		task.SetBaseline(baselineHost)
+
+		task.Start()
+
+		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffCommand, "execute", "e", "",
+		"commands to be executed on target hosts",
+	)
+
+	diffCmd.Flags().StringVarP(&baselineHost, "baseline", "", "",
+		"host with which outputs of other hosts are compared (default the host of the most common output)",
+	)
+}
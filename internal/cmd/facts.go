@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	factsFile   string
+	factsFormat string
+)
+
+// factsCmd represents the facts command
+var factsCmd = &cobra.Command{
+	Use:   "facts",
+	Short: "Gather facts of target hosts into a document",
+	Long: `
+Gather facts(os, kernel, cpus, memory, disks, ips, uptime) of target hosts
+into a json/yaml document keyed by host, which can be used as inventory
+variables or CMDB input.`,
+	Example: `
+  # Gather facts of target hosts into a json document.
+  $ gossh facts -H hosts.txt -c 100 -d facts.json -k
+
+  # Gather facts into a yaml document.
+  $ gossh facts host1 host2 -d facts.yaml --format yaml -k
+
+  # Gather facts into '--hosts.facts-file' as a cache, and the facts of other hosts in it are kept.
+  $ gossh facts -H hosts.txt --hosts.facts-file ~/.gossh/facts.json -k
+
+  # Run on the hosts of which the cached facts match.
+  $ gossh command -H hosts.txt --hosts.facts-file ~/.gossh/facts.json --hosts.where facts_os=Ubuntu* -e uptime`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		task := sshtask.NewTask(sshtask.FactsTask, configflags.Config)
+
+		task.SetTargetHosts(args)
+		task.SetFactsOptions(factsFile, factsFormat)
+
+		task.Start()
+
+		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+func init() {
+	factsCmd.Flags().StringVarP(&factsFile, "dest-file", "d", "",
+		`local file to which the facts of target hosts are written, default to
+'--hosts.facts-file' into which the facts are merged`,
+	)
+
+	factsCmd.Flags().StringVarP(&factsFormat, "format", "", sshtask.FactsFormatJSON,
+		"format of the facts document, json or yaml",
+	)
+}
@@ -23,6 +23,10 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/spf13/cobra"
 
 	"github.com/windvalley/gossh/internal/pkg/configflags"
@@ -34,6 +38,11 @@ var (
 	srcFiles    []string
 	localDstDir string
 	tmpDir      string
+
+	fetchPattern string
+	fetchLatest  int
+	fetchMaxSize string
+	fetchExclude []string
 )
 
 // fetchCmd represents the fetch command
@@ -61,6 +70,12 @@ Copy files/dirs from target hosts to local.`,
   # NOTE: If the tmp dir not exist, it will auto create it.
   $ gossh fetch host1 -f /path/foo.txt -d ./backup/ -t /home/user/tmp/
 
+  # Copy the newest 3 files matching the pattern on each target host, e.g. to collect recent logs.
+  $ gossh fetch host1 host2 --fetch.pattern '/var/log/app/*.gz' --fetch.latest 3 -d ./logs
+
+  # Skip the files larger than 100MiB, e.g. core dumps, and the files/dirs named 'cache' or ending with '.tmp'.
+  $ gossh fetch host1 -f /var/lib/app/ -d ./backup --fetch.max-size 100M --fetch.exclude cache,'*.tmp'
+
   # Use sudo as root to copy no permission files.
   $ gossh fetch host1 -f /root/foo.txt -d ./backup/ -s
 
@@ -70,17 +85,55 @@ Copy files/dirs from target hosts to local.`,
 		if errs := configflags.Config.Validate(); len(errs) != 0 {
 			util.CheckErr(errs)
 		}
+
+		if fetchPattern != "" {
+			if err := sshtask.CheckFetchPattern(fetchPattern); err != nil {
+				util.CheckErr(err)
+			}
+		}
+
+		if fetchLatest < 0 {
+			util.CheckErr(fmt.Sprintf("invalid --fetch.latest: %d - need >= 0", fetchLatest))
+		}
+
+		if fetchLatest > 0 && fetchPattern == "" {
+			util.CheckErr("--fetch.latest need --fetch.pattern")
+		}
+
+		if fetchMaxSize != "" {
+			if _, err := util.ParseSize(fetchMaxSize); err != nil {
+				util.CheckErr(fmt.Sprintf("invalid --fetch.max-size: %s - need bytes with optional unit K/M/G/T", err))
+			}
+		}
+
+		for _, e := range fetchExclude {
+			if e == "" || strings.Contains(e, "'") {
+				util.CheckErr(fmt.Sprintf("invalid --fetch.exclude: '%s' - need glob pattern without single quotes", e))
+			}
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("tmp-dir") && configflags.Config.Run.TmpDir != "" {
+			tmpDir = configflags.Config.Run.TmpDir
+		}
+
 		task := sshtask.NewTask(sshtask.FetchTask, configflags.Config)
 
 		task.SetTargetHosts(args)
 		task.SetFetchFiles(srcFiles)
+		task.SetFetchPattern(fetchPattern, fetchLatest)
+
+		maxSize, _ := util.ParseSize(fetchMaxSize)
+		task.SetFetchFilter(maxSize, fetchExclude)
 		task.SetFetchOptions(localDstDir, tmpDir)
 
 		task.Start()
 
 		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
 	},
 }
 
@@ -96,4 +149,21 @@ func init() {
 	fetchCmd.Flags().StringVarP(&tmpDir, "tmp-dir", "t", "/tmp",
 		"directory of target hosts for storing temporary zip file",
 	)
+
+	fetchCmd.Flags().StringVarP(&fetchPattern, "fetch.pattern", "", "",
+		"glob pattern of files on target hosts to be copied, e.g. '/var/log/app/*.gz'",
+	)
+
+	fetchCmd.Flags().IntVarP(&fetchLatest, "fetch.latest", "", 0,
+		"copy only the newest N files matching '--fetch.pattern' by modification time, 0 means all",
+	)
+
+	fetchCmd.Flags().StringVarP(&fetchMaxSize, "fetch.max-size", "", "",
+		"skip the files larger than this size(e.g. 100M), empty means no limit",
+	)
+
+	fetchCmd.Flags().StringSliceVarP(&fetchExclude, "fetch.exclude", "", nil,
+		`glob patterns of files/dirs to be skipped, matching their names if without '/'
+(e.g. 'core.*'), otherwise their full paths (e.g. '/var/lib/app/cache')`,
+	)
 }
@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	grepIgnoreCase   bool
+	grepFixedStrings bool
+	grepMaxCount     int
+)
+
+// grepCmd represents the grep command
+var grepCmd = &cobra.Command{
+	Use:   "grep PATTERN FILE... [HOST...]",
+	Short: "Search files on target hosts without fetching them",
+	Long: `
+Search files on target hosts without fetching them.
+
+The PATTERN is an extended regular expression of grep, and the FILEs are
+absolute paths on target hosts, shell patterns are supported if quoted.
+The arguments after PATTERN that are not absolute paths are target hosts.
+
+The matched lines are output in format 'HOST:FILE:LINE:TEXT', binary files are
+skipped, and the counts of the matched lines are summarized at last.`,
+	Example: `
+  # Search errors in the logs of target hosts.
+  $ gossh grep 'ERROR|panic' '/var/log/app/*.log' -H hosts.txt -c 100
+
+  # Search a fixed string ignoring case, at most 10 lines of each file.
+  $ gossh grep 'connection reset' /var/log/app.log host1 host2 -F --ignore-case -m 10
+
+  # Use sudo to search files with no permission.
+  $ gossh grep 'Failed password' /var/log/secure -H hosts.txt -s`,
+	Args: cobra.MinimumNArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+
+		// The command is in single quotes of 'sudo bash -c'.
+		for _, v := range args {
+			if strings.Contains(v, "'") {
+				util.CheckErr(fmt.Sprintf("invalid argument: %s - can not contain single quotes", v))
+			}
+		}
+
+		if grepMaxCount < 0 {
+			util.CheckErr(fmt.Sprintf("invalid --max-count: %d - need >= 0", grepMaxCount))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		pattern := args[0]
+
+		var files, hosts []string
+		for _, v := range args[1:] {
+			if strings.HasPrefix(v, "/") {
+				files = append(files, v)
+			} else {
+				hosts = append(hosts, v)
+			}
+		}
+
+		options := []string{"-E"}
+		if grepFixedStrings {
+			options = []string{"-F"}
+		}
+		if grepIgnoreCase {
+			options = append(options, "-i")
+		}
+		if grepMaxCount > 0 {
+			options = append(options, "-m", strconv.Itoa(grepMaxCount))
+		}
+
+		task := sshtask.NewTask(sshtask.GrepTask, configflags.Config)
+
+		task.SetTargetHosts(hosts)
+		task.SetGrepOptions(pattern, files, options)
+
+		task.Start()
+
+		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+func init() {
+	grepCmd.Flags().BoolVarP(&grepIgnoreCase, "ignore-case", "", false,
+		"ignore case distinctions in PATTERN and the files",
+	)
+
+	grepCmd.Flags().BoolVarP(&grepFixedStrings, "fixed-strings", "F", false,
+		"interpret PATTERN as a fixed string instead of a regular expression",
+	)
+
+	grepCmd.Flags().IntVarP(&grepMaxCount, "max-count", "m", 0,
+		"stop reading each file after N matched lines, 0 means no limit",
+	)
+}
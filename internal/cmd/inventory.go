@@ -0,0 +1,125 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	inventoryGroup  string
+	inventoryFormat string
+)
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Show resolved target hosts, groups and variables",
+	Long: `
+Show resolved target hosts, groups and variables without connecting them,
+so that the targeting can be verified before running anything.
+
+Target hosts are resolved the same way as other commands: host patterns are
+expanded, hosts of hosts file and discovered hosts are merged, and then the
+selectors like '--hosts.tags' and '--hosts.limit' are applied. The groups
+of a host are its tags of hosts file or the discovered services/clouds.`,
+}
+
+var inventoryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List resolved target hosts with their address, port, user, groups and variables",
+	Example: `
+  # List target hosts of hosts file and their groups and variables.
+  $ gossh inventory list -H hosts.txt
+
+  # List target hosts of group web in json format.
+  $ gossh inventory list -H hosts.txt --group web --format json
+
+  # Verify the hosts discovered from EC2 before running anything.
+  $ gossh inventory list --hosts.provider ec2 --hosts.provider-filters tag.role=web`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateInventoryFlags()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runInventory(cmd, args, sshtask.InventoryViewList)
+	},
+}
+
+var inventoryGraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Show resolved target hosts by groups",
+	Example: `
+  # Show target hosts of hosts file by groups.
+  $ gossh inventory graph -H hosts.txt
+
+  # Show the groups of target hosts in json format.
+  $ gossh inventory graph -H hosts.txt --format json`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateInventoryFlags()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runInventory(cmd, args, sshtask.InventoryViewGraph)
+	},
+}
+
+func validateInventoryFlags() {
+	if errs := configflags.Config.Validate(); len(errs) != 0 {
+		util.CheckErr(errs)
+	}
+
+	if inventoryFormat != sshtask.InventoryFormatText && inventoryFormat != sshtask.InventoryFormatJSON {
+		util.CheckErr(fmt.Sprintf(
+			"invalid format: %s - available values: %s, %s",
+			inventoryFormat,
+			sshtask.InventoryFormatText,
+			sshtask.InventoryFormatJSON,
+		))
+	}
+}
+
+func runInventory(cmd *cobra.Command, args []string, view string) {
+	task := sshtask.NewTask(sshtask.InventoryTask, configflags.Config)
+
+	task.SetTargetHosts(args)
+
+	util.CobraCheckErrWithHelp(cmd, task.ShowInventory(view, inventoryGroup, inventoryFormat))
+}
+
+func init() {
+	for _, c := range []*cobra.Command{inventoryListCmd, inventoryGraphCmd} {
+		c.Flags().StringVarP(&inventoryGroup, "group", "g", "",
+			`only keep target hosts of the group, ',' means OR and '+' means AND like '--hosts.tags'`,
+		)
+		c.Flags().StringVarP(&inventoryFormat, "format", "", sshtask.InventoryFormatText,
+			"output format, text or json",
+		)
+
+		inventoryCmd.AddCommand(c)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	jobsFormat   string
+	jobsDestPath string
+)
+
+// jobsCmd represents the jobs command
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Check and collect the jobs detached by '--run.detach'",
+	Long: `
+Check and collect the jobs detached by '--run.detach'.
+
+The task id, target hosts and sudo options of the detached tasks are saved
+under $HOME/.gossh/jobs, so that the jobs are checked and collected by the
+task id only, without giving the target hosts again.`,
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved jobs",
+	Example: `
+  # List the saved jobs.
+  $ gossh jobs list
+
+  # List the saved jobs in json format.
+  $ gossh jobs list --format json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if jobsFormat != sshtask.InventoryFormatText && jobsFormat != sshtask.InventoryFormatJSON {
+			util.CheckErr(fmt.Sprintf(
+				"invalid format: %s - available values: %s, %s",
+				jobsFormat,
+				sshtask.InventoryFormatText,
+				sshtask.InventoryFormatJSON,
+			))
+		}
+
+		util.CheckErr(sshtask.ShowJobs(jobsFormat))
+	},
+}
+
+var jobsStatusCmd = &cobra.Command{
+	Use:   "status TASK_ID",
+	Short: "Show the status of the job on its target hosts",
+	Long: `
+Show the status of the job on its target hosts, one of 'running',
+'exited: CODE' and 'killed'. Target hosts fail if the job is not found,
+exited with non-zero code or killed.`,
+	Example: `
+  # Show the status of the job.
+  $ gossh jobs status 20220101100000 -k`,
+	Args: cobra.ExactArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if !taskIDRegexp.MatchString(args[0]) {
+			util.CheckErr(fmt.Sprintf("invalid task id: '%s'", args[0]))
+		}
+
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runJobTask(cmd, sshtask.JobStatusTask, args[0])
+	},
+}
+
+var jobsCollectCmd = &cobra.Command{
+	Use:   "collect TASK_ID",
+	Short: "Collect the output and exit code of the job from its target hosts",
+	Long: `
+Collect the output and exit code of the job from its target hosts to
+the local directory 'DEST_PATH/TASK_ID/HOST', as files 'output' and 'exit'.
+The output of the running jobs is collected so far, without file 'exit'.`,
+	Example: `
+  # Collect the output and exit code of the job to ./20220101100000/HOST/.
+  $ gossh jobs collect 20220101100000 -k
+
+  # Collect to /tmp/backup/20220101100000/HOST/.
+  $ gossh jobs collect 20220101100000 -d /tmp/backup -k`,
+	Args: cobra.ExactArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if !taskIDRegexp.MatchString(args[0]) {
+			util.CheckErr(fmt.Sprintf("invalid task id: '%s'", args[0]))
+		}
+
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runJobTask(cmd, sshtask.JobCollectTask, args[0])
+	},
+}
+
+func runJobTask(cmd *cobra.Command, taskType sshtask.TaskType, taskID string) {
+	task := sshtask.NewTask(taskType, configflags.Config)
+
+	if err := task.SetJob(taskID, jobsDestPath); err != nil {
+		util.CheckErr(err)
+	}
+
+	task.Start()
+
+	util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+	if code := task.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
+}
+
+func init() {
+	jobsListCmd.Flags().StringVarP(&jobsFormat, "format", "", sshtask.InventoryFormatText,
+		"output format, text or json",
+	)
+
+	jobsCollectCmd.Flags().StringVarP(&jobsDestPath, "dest-path", "d", ".",
+		"local directory to which the job files are collected",
+	)
+
+	jobsCmd.AddCommand(jobsListCmd, jobsStatusCmd, jobsCollectCmd)
+
+	jobsListCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
+		util.CobraMarkHiddenGlobalFlagsExcept(rootCmd)
+		rootCmd.HelpFunc()(command, strings)
+	})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package key
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// deployCmd represents the key deploy command
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Append public keys to authorized_keys of target hosts",
+	Long: `
+Append public keys to authorized_keys of target hosts if they are not there yet,
+and create the .ssh directory(0700) and authorized_keys(0600) if they do not exist.`,
+	Example: `
+  # Deploy the public key to the authorized_keys of the login user.
+  $ gossh key deploy --pubkey ~/.ssh/id_ed25519.pub -H hosts.txt -k
+
+  # Deploy the public key to the authorized_keys of user deploy.
+  $ gossh key deploy --pubkey deploy.pub --user deploy -H hosts.txt -s -k`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keys := validateFlags()
+
+		commands := []string{
+			checkUserCommand(),
+			fmt.Sprintf(`d=%s;f="$d/authorized_keys"`, authorizedKeysDir()),
+			`mkdir -p "$d" && chmod 700 "$d" && touch "$f" && chmod 600 "$f" || exit 1`,
+		}
+
+		if keyUser != "" {
+			commands = append(commands, fmt.Sprintf(`chown %s: "$d" "$f" || exit 1`, keyUser))
+		}
+
+		// Terminates the last line, otherwise the first key appended is joined to it.
+		commands = append(commands, `if [ -s "$f" ] && [ -n "$(tail -c1 "$f")" ];then echo >> "$f" || exit 1;fi`)
+
+		for _, key := range keys {
+			commands = append(commands, fmt.Sprintf(
+				`if grep -qF %s "$f";then echo "key %s already deployed";`+
+					`else echo %s >> "$f" && echo "key %s deployed" || exit 1;fi`,
+				util.ShellDoubleQuote(key.match),
+				key.fingerprint,
+				util.ShellDoubleQuote(key.line),
+				key.fingerprint,
+			))
+		}
+
+		runCommand(cmd, args, strings.Join(commands, ";"))
+	},
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package key
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// Cmd represents the key command
+var Cmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage authorized_keys of target hosts",
+	Long: `
+Deploy or remove public keys to/from the authorized_keys of a user on target
+hosts idempotently, the keys are matched by their types and contents, and
+the comments are ignored.
+
+The authorized_keys of the login user is managed by default, and use sudo('-s')
+for the authorized_keys of another user specified by '--user'.`,
+}
+
+var (
+	pubkeyFile string
+	keyUser    string
+)
+
+// userNameRegexp is the portable user name of useradd.
+var userNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+
+func init() {
+	util.CobraAddSubCommandInOrder(Cmd, deployCmd, removeCmd)
+
+	for _, c := range []*cobra.Command{deployCmd, removeCmd} {
+		c.Flags().StringVarP(&pubkeyFile, "pubkey", "", "",
+			"file that holds the public keys in authorized_keys format, e.g. ~/.ssh/id_ed25519.pub")
+		c.Flags().StringVarP(&keyUser, "user", "", "",
+			"user whose authorized_keys is managed (default the login user)")
+	}
+}
+
+// authorizedKey is a public key of '--pubkey'.
+type authorizedKey struct {
+	// match is 'type base64' of the key.
+	match string
+	// line is appended to authorized_keys, with options and comment.
+	line string
+	// fingerprint is the SHA256 fingerprint of the key, e.g. 'SHA256:...'.
+	fingerprint string
+}
+
+func validateFlags() []authorizedKey {
+	if errs := configflags.Config.Validate(); len(errs) != 0 {
+		util.CheckErr(errs)
+	}
+
+	if keyUser != "" && !userNameRegexp.MatchString(keyUser) {
+		util.CheckErr(fmt.Sprintf("invalid user: '%s' - need a valid user name, e.g. 'alice'", keyUser))
+	}
+
+	if pubkeyFile == "" {
+		util.CheckErr("need flag '--pubkey'")
+	}
+
+	keys, err := readPubkeys(pubkeyFile)
+	if err != nil {
+		util.CheckErr(err)
+	}
+
+	return keys
+}
+
+func readPubkeys(file string) ([]authorizedKey, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read pubkey file failed: %s", err)
+	}
+
+	var keys []authorizedKey
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pubkey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key '%s' of '%s': %s", line, file, err)
+		}
+
+		// The command is in single quotes of 'sudo bash -c' with '-s/--run.sudo'.
+		if strings.Contains(line, "'") {
+			return nil, fmt.Errorf("invalid public key '%s' of '%s': can not contain single quotes", line, file)
+		}
+
+		keys = append(keys, authorizedKey{
+			match:       strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubkey))),
+			line:        line,
+			fingerprint: ssh.FingerprintSHA256(pubkey),
+		})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys in '%s'", file)
+	}
+
+	return keys, nil
+}
+
+// authorizedKeysDir is the .ssh directory of the user in shell.
+func authorizedKeysDir() string {
+	return "~" + keyUser + "/.ssh"
+}
+
+// checkUserCommand fails if '--user' does not exist, otherwise '~user' is not expanded.
+func checkUserCommand() string {
+	if keyUser == "" {
+		return "true"
+	}
+
+	return fmt.Sprintf(`id -u %s >/dev/null 2>&1 || { echo "user %s does not exist";exit 1; }`, keyUser, keyUser)
+}
+
+// runCommand executes the generated command on target hosts like subcommand 'command'.
+func runCommand(cmd *cobra.Command, hosts []string, command string) {
+	task := sshtask.NewTask(sshtask.CommandTask, configflags.Config)
+
+	task.SetTargetHosts(hosts)
+	task.SetCommand(command)
+
+	task.Start()
+
+	util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+	if code := task.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
+}
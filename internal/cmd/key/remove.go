@@ -0,0 +1,72 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package key
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// removeCmd represents the key remove command
+var removeCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove public keys from authorized_keys of target hosts",
+	Long: `
+Remove public keys from authorized_keys of target hosts, and the owner
+and permissions of authorized_keys are kept.`,
+	Example: `
+  # Remove the public key from the authorized_keys of the login user.
+  $ gossh key remove --pubkey old.pub -H hosts.txt -k
+
+  # Remove the public key from the authorized_keys of user deploy.
+  $ gossh key remove --pubkey old.pub --user deploy -H hosts.txt -s -k`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keys := validateFlags()
+
+		commands := []string{
+			checkUserCommand(),
+			fmt.Sprintf(`f=%s/authorized_keys;t="$f.gossh.tmp"`, authorizedKeysDir()),
+		}
+
+		for _, key := range keys {
+			match := util.ShellDoubleQuote(key.match)
+
+			// Rewrite by 'cat >' rather than 'mv' to keep the owner and permissions.
+			commands = append(commands, fmt.Sprintf(
+				`if [ -f "$f" ] && grep -qF %s "$f";then grep -vF %s "$f" > "$t";`+
+					`cat "$t" > "$f" && rm -f "$t" && echo "key %s removed" || exit 1;`+
+					`else echo "key %s not deployed";fi`,
+				match,
+				match,
+				key.fingerprint,
+				key.fingerprint,
+			))
+		}
+
+		runCommand(cmd, args, strings.Join(commands, ";"))
+	},
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// Actions of subcommand 'pkg'.
+const (
+	pkgInstall = "install"
+	pkgRemove  = "remove"
+	pkgVersion = "version"
+)
+
+var pkgNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+._-]*$`)
+
+// pkgCommandTemplate detects apt, dnf, yum or zypper, executes the action, and then
+// outputs the installed versions of the packages. The output of the package manager
+// is only shown if it failed, and only the installed packages are removed. It fails
+// if the packages are not installed after install and version, or not removed after remove.
+const pkgCommandTemplate = `p="%s";a=%s
+if command -v apt-get >/dev/null 2>&1;then m=apt
+elif command -v dnf >/dev/null 2>&1;then m=dnf
+elif command -v yum >/dev/null 2>&1;then m=yum
+elif command -v zypper >/dev/null 2>&1;then m=zypper
+else echo "no supported package manager(apt, dnf, yum, zypper)";exit 1
+fi
+ver(){
+  if [ $m = apt ];then
+    case $(dpkg-query -W -f=\${Status} "$1" 2>/dev/null) in
+      *" installed") dpkg-query -W -f=\${Version} "$1";;
+    esac
+  else
+    v=$(rpm -q --qf %%{VERSION}-%%{RELEASE} "$1" 2>/dev/null) && echo "$v"
+  fi
+}
+if [ "$a" = remove ];then
+  q=;for x in $p;do [ -n "$(ver "$x")" ] && q="$q $x";done
+else
+  q=$p
+fi
+if [ "$a" != version ] && [ -n "$q" ];then
+  case $m in
+    apt) o=$(DEBIAN_FRONTEND=noninteractive apt-get "$a" -y $q 2>&1);;
+    zypper) o=$(zypper -n "$a" $q 2>&1);;
+    *) o=$($m "$a" -y $q 2>&1);;
+  esac || { echo "$o";exit 1; }
+fi
+r=0
+for x in $p;do
+  v=$(ver "$x")
+  if [ -n "$v" ];then echo "$x: $v ($m)";[ "$a" = remove ] && r=1
+  else echo "$x: not installed ($m)";[ "$a" = remove ] || r=1
+  fi
+done
+exit $r`
+
+// pkgCmd represents the pkg command
+var pkgCmd = &cobra.Command{
+	Use:   "pkg",
+	Short: "Manage packages of target hosts by apt, dnf, yum or zypper",
+	Long: `
+Manage packages of target hosts, apt, dnf, yum or zypper is detected on each
+target host, and the installed versions of the packages are output after
+the action, for quick fleet-wide patching checks.
+
+Sudo is used for install/remove automatically if the login user is not root.`,
+}
+
+func newPkgActionCmd(action, short, example string) *cobra.Command {
+	return &cobra.Command{
+		Use:     action + " PKG[,PKG...] [HOST...]",
+		Short:   short,
+		Example: example,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				util.CobraCheckErrWithHelp(cmd, "need packages")
+			}
+
+			return nil
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			for _, pkg := range strings.Split(args[0], ",") {
+				if !pkgNameRegexp.MatchString(pkg) {
+					util.CheckErr(fmt.Sprintf("invalid package name: '%s'", pkg))
+				}
+			}
+
+			if action != pkgVersion && configflags.Config.Auth.User != "root" {
+				configflags.Config.Run.Sudo = true
+			}
+
+			if errs := configflags.Config.Validate(); len(errs) != 0 {
+				util.CheckErr(errs)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pkgs := strings.Join(strings.Split(args[0], ","), " ")
+
+			runCommandTask(cmd, args[1:], fmt.Sprintf(pkgCommandTemplate, pkgs, action))
+		},
+	}
+}
+
+func init() {
+	util.CobraAddSubCommandInOrder(pkgCmd,
+		newPkgActionCmd(pkgInstall, "Install packages on target hosts", `
+  # Install nginx and curl on target hosts.
+  $ gossh pkg install nginx,curl -H hosts.txt -c 10 -k`),
+		newPkgActionCmd(pkgRemove, "Remove packages from target hosts", `
+  # Remove telnet from target hosts.
+  $ gossh pkg remove telnet -H hosts.txt -c 10 -k`),
+		newPkgActionCmd(pkgVersion, "Show installed versions of packages on target hosts", `
+  # Show the installed versions of openssl, and hosts without it are failed.
+  $ gossh pkg version openssl -H hosts.txt -c 100 -k`),
+	)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var portcheckUDP bool
+
+// portcheckCmd represents the portcheck command
+var portcheckCmd = &cobra.Command{
+	Use:   "portcheck PORT[,PORT...] [HOST...]",
+	Short: "Check whether ports are listening on target hosts",
+	Long: `
+Check whether ports are listening on target hosts, e.g. for quick verification
+after deployment. Each port is reported as PASS with the listening addresses or
+FAIL, target hosts fail if any of the ports is not listening.
+
+The listening ports are read by 'ss', or 'netstat' if 'ss' is not found.`,
+	Example: `
+  # Check whether https is listening on target hosts.
+  $ gossh portcheck 443 -H hosts.txt -c 100 -k
+
+  # Check multiple ports of the given hosts.
+  $ gossh portcheck 80,443 host1 host2 -k
+
+  # Check udp ports.
+  $ gossh portcheck 53 -H hosts.txt --udp -k`,
+	Args: cobra.MinimumNArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+
+		for _, p := range strings.Split(args[0], ",") {
+			if port, err := strconv.Atoi(p); err != nil || port < 1 || port > 65535 {
+				util.CheckErr(fmt.Sprintf("invalid port: '%s' - need 1-65535", p))
+			}
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runCommandTask(cmd, args[1:], portcheckCommand(strings.Split(args[0], ",")))
+	},
+}
+
+// portcheckCommand generates the commands that output PASS or FAIL for each port.
+func portcheckCommand(ports []string) string {
+	proto := "t"
+	if portcheckUDP {
+		proto = "u"
+	}
+
+	commands := []string{
+		`r=0;pass(){ echo "PASS: $1"; };fail(){ echo "FAIL: $1";r=1; }`,
+		fmt.Sprintf(
+			`if command -v ss >/dev/null 2>&1;then l=$(ss -ln%s | awk "NR>1{print \$4}")
+elif command -v netstat >/dev/null 2>&1;then l=$(netstat -ln%s | awk "NR>2{print \$4}")
+else echo "need install 'ss' or 'netstat' command";exit 1
+fi`,
+			proto, proto,
+		),
+	}
+
+	for _, port := range ports {
+		commands = append(commands, fmt.Sprintf(
+			`a=$(echo "$l" | grep -E "[:.]%s\$" | sort -u | tr "\n" " ")
+if [ -n "$a" ];then pass "port %s is listening on ${a%% }";else fail "port %s is not listening";fi`,
+			port, port, port,
+		))
+	}
+
+	return strings.Join(append(commands, "exit $r"), "\n")
+}
+
+func init() {
+	portcheckCmd.Flags().BoolVarP(&portcheckUDP, "udp", "", false, "check udp ports instead of tcp ports")
+}
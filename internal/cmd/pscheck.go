@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var pscheckFull bool
+
+// pscheckCmd represents the pscheck command
+var pscheckCmd = &cobra.Command{
+	Use:   "pscheck NAME[,NAME...] [HOST...]",
+	Short: "Check whether processes are running on target hosts",
+	Long: `
+Check whether processes are running on target hosts, e.g. for quick verification
+after deployment. Each process is reported as PASS with its pids or FAIL, target
+hosts fail if any of the processes is not running.
+
+The processes are matched by their exact names with 'pgrep', or by patterns of
+their full command lines with '--full'.`,
+	Example: `
+  # Check whether nginx is running on target hosts.
+  $ gossh pscheck nginx -H hosts.txt -c 100 -k
+
+  # Check multiple processes of the given hosts.
+  $ gossh pscheck nginx,php-fpm host1 host2 -k
+
+  # Match the full command lines, e.g. java applications.
+  $ gossh pscheck 'java.*app.jar' -H hosts.txt --full -k`,
+	Args: cobra.MinimumNArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+
+		// The commands are in single quotes of 'sudo bash -c'.
+		for _, name := range strings.Split(args[0], ",") {
+			if name == "" || strings.Contains(name, "'") {
+				util.CheckErr(fmt.Sprintf("invalid process: '%s' - can not be empty or contain single quotes", name))
+			}
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runCommandTask(cmd, args[1:], pscheckCommand(strings.Split(args[0], ",")))
+	},
+}
+
+// pscheckMarker is in the command lines of the shells running the commands,
+// so that they are not matched by the patterns of '--full'.
+const pscheckMarker = "gossh-pscheck"
+
+// pscheckCommand generates the commands that output PASS or FAIL for each process.
+func pscheckCommand(names []string) string {
+	commands := []string{
+		`r=0;pass(){ echo "PASS: $1"; };fail(){ echo "FAIL: $1";r=1; }`,
+	}
+
+	if !pscheckFull {
+		commands = append(commands,
+			`command -v pgrep >/dev/null 2>&1 || { echo "need install 'pgrep' command";exit 1; }`,
+		)
+	}
+
+	for _, name := range names {
+		quoted := util.ShellDoubleQuote(name)
+
+		pids := fmt.Sprintf(`pgrep -x -- %s | tr "\n" " "`, quoted)
+		if pscheckFull {
+			pids = fmt.Sprintf(
+				`ps -eo pid=,args= | awk -v m=%s -v e=%s `+
+					`"{i=\$1;sub(/^ *[0-9]+ /,\"\")}index(\$0,m)==0&&\$0~e{printf \"%%s \",i}"`,
+				pscheckMarker,
+				quoted,
+			)
+		}
+
+		commands = append(commands, fmt.Sprintf(
+			`p=$(%s)
+if [ -n "$p" ];then pass "process "%s" is running, pids: ${p%% }";else fail "process "%s" is not running";fi`,
+			pids, quoted, quoted,
+		))
+	}
+
+	return strings.Join(append(commands, "exit $r"), "\n")
+}
+
+func init() {
+	pscheckCmd.Flags().BoolVarP(&pscheckFull, "full", "", false,
+		"match the patterns against the full command lines instead of the process names")
+}
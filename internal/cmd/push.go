@@ -41,6 +41,8 @@ var (
 	files          []string
 	fileDstPath    string
 	allowOverwrite bool
+	preservePaths  bool
+	remoteFetch    bool
 )
 
 // pushCmd represents the push command
@@ -64,6 +66,21 @@ Copy local files/dirs to target hosts.`,
   # Set timeout seconds for pushing files/dirs.
   $ gossh push host1 host2 -f /path/foo.txt,/path/bar/ --timeout.command 10
 
+  # Copy to /etc/app/conf.d/a.conf and /etc/app/certs/ca.pem instead of /etc/app/a.conf and /etc/app/ca.pem.
+  $ gossh push host1 -f conf.d/a.conf -f certs/ca.pem -d /etc/app --push.preserve-paths
+
+  # Download the artifact once on local and copy it to target hosts, and verify the checksum optionally.
+  $ gossh push -H hosts.txt -f https://artifacts.example.com/app.tar.gz#sha256=<hex> -d /opt
+
+  # Let target hosts download the artifact directly by curl or wget.
+  $ gossh push -H hosts.txt -f https://artifacts.example.com/app.tar.gz#sha256=<hex> -d /opt --push.remote-fetch
+
+  # Build the artifact on local first, and push it only if the build succeeded.
+  $ gossh push -H hosts.txt -f ./bin/app -d /usr/local/bin --run.local-before "make build"
+
+  # Push a large file over a link with high latency using more concurrent sftp requests.
+  $ gossh push host1 -f /path/foo.iso --transfer.chunk-size 64 --transfer.inflight 256
+
   # Provide a list of hosts at the same time in multiple ways.
   $ gossh push host1 foo[01-03].[beijing,wuhan].bar.com -H hosts.txt -f /path/foo.txt`,
 	PreRun: func(cmd *cobra.Command, args []string) {
@@ -71,37 +88,117 @@ Copy local files/dirs to target hosts.`,
 			util.CheckErr(errs)
 		}
 
+		hasURL := false
 		if len(files) != 0 {
 			for _, f := range files {
+				if sshtask.IsPushURL(f) {
+					if _, err := sshtask.ParsePushURL(f); err != nil {
+						util.CheckErr(err)
+					}
+
+					if preservePaths {
+						util.CheckErr(fmt.Sprintf("--push.preserve-paths can not be used with url '%s'", f))
+					}
+
+					hasURL = true
+
+					continue
+				}
+
 				_, err := os.Stat(f)
 				if err != nil {
 					util.CheckErr(err)
 				}
+
+				if _, ok := util.PreservedPath(f); preservePaths && !ok {
+					util.CheckErr(fmt.Sprintf("--push.preserve-paths can not be used with '%s' outside of '.'", f))
+				}
 			}
 		}
+
+		if remoteFetch && !hasURL {
+			util.CheckErr("--push.remote-fetch need urls in '-f/--files'")
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		task := sshtask.NewTask(sshtask.PushTask, configflags.Config)
 
-		var zipFiles []string
+		var (
+			localFiles  []string
+			zipFiles    []string
+			urls        []*sshtask.PushURL
+			downloadDir string
+		)
 
 		workDir, err := os.Getwd()
 		if err != nil {
 			util.CheckErr(err)
 		}
 
+		// The downloaded files are no longer needed once zipped.
+		removeDownloadDir := func() {
+			if downloadDir != "" {
+				if err := os.RemoveAll(downloadDir); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+		}
+
 		for _, f := range files {
-			fileName := filepath.Base(f)
+			src := f
+
+			if sshtask.IsPushURL(f) {
+				u, err := sshtask.ParsePushURL(f)
+				if err != nil {
+					util.CheckErr(err)
+				}
+
+				if remoteFetch {
+					urls = append(urls, u)
+					continue
+				}
+
+				if downloadDir == "" {
+					downloadDir, err = os.MkdirTemp("", "gossh-push-")
+					if err != nil {
+						util.CheckErr(err)
+					}
+				}
+
+				// Each url has its own dir in case of the same names.
+				dir, err := os.MkdirTemp(downloadDir, "")
+				if err != nil {
+					util.CheckErr(err)
+				}
+
+				if src, err = u.Download(dir); err != nil {
+					removeDownloadDir()
+					util.CheckErr(err)
+				}
+
+				f = u.Display
+			}
+
+			localFiles = append(localFiles, f)
+
+			fileName := filepath.Base(src)
 			zipName := "." + fileName + "." + fmt.Sprintf("%d", time.Now().UnixMicro())
 			zipFile := path.Join(workDir, zipName)
 
-			if err := util.Zip(strings.TrimSuffix(f, string(os.PathSeparator)), zipFile); err != nil {
+			zip := util.Zip
+			if preservePaths {
+				zip = util.ZipWithPath
+			}
+
+			if err := zip(strings.TrimSuffix(src, string(os.PathSeparator)), zipFile); err != nil {
 				util.CheckErr(err)
 			}
 
 			zipFiles = append(zipFiles, zipFile)
 		}
 
+		removeDownloadDir()
+
 		defer func() {
 			for _, f := range zipFiles {
 				if err := os.Remove(f); err != nil {
@@ -111,18 +208,24 @@ Copy local files/dirs to target hosts.`,
 		}()
 
 		task.SetTargetHosts(args)
-		task.SetPushfiles(files, zipFiles)
+		task.SetPushfiles(localFiles, zipFiles, preservePaths)
+		task.SetPushURLs(urls)
 		task.SetPushOptions(fileDstPath, allowOverwrite)
 
 		task.Start()
 
 		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
 	},
 }
 
 func init() {
 	pushCmd.Flags().StringSliceVarP(&files, "files", "f", nil,
-		"local files/dirs to be copied to target hosts",
+		`local files/dirs to be copied to target hosts, or http/https urls downloaded
+once on local and then copied (checksum verified if ending with '#sha256=<hex>')`,
 	)
 
 	pushCmd.Flags().StringVarP(&fileDstPath, "dest-path", "d", "/tmp",
@@ -137,12 +240,31 @@ func init() {
 		"allow overwrite files/dirs if they already exist on target hosts",
 	)
 
+	pushCmd.Flags().BoolVarP(
+		&preservePaths,
+		"push.preserve-paths",
+		"",
+		false,
+		`recreate the paths of files/dirs under the dest path(e.g. 'dir/a/b.conf' to
+'DEST/dir/a/b.conf', and the leading '/' of absolute paths is removed),
+instead of copying all of them into the dest path by their names`,
+	)
+
+	pushCmd.Flags().BoolVarP(
+		&remoteFetch,
+		"push.remote-fetch",
+		"",
+		false,
+		"let target hosts download the urls of '-f/--files' directly by curl or wget instead",
+	)
+
 	pushCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
 		util.CobraMarkHiddenGlobalFlags(
 			command,
 			"run.sudo",
 			"run.as-user",
 			"run.lang",
+			"preflight.sudo",
 		)
 
 		command.Parent().HelpFunc()(command, strings)
@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var quarantineFormat string
+
+// quarantineCmd represents the quarantine command
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "Manage the target hosts failed in their last runs",
+	Long: `
+Manage the target hosts failed in their last runs.
+
+The failed target hosts are recorded by the file of '--hosts.quarantine-file',
+and they are removed from it once they succeed. Flag '--hosts.skip-quarantined'
+excludes them from target hosts, so that the flaky hosts do not slow every batch.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if configflags.Config.Hosts.QuarantineFile == "" {
+			util.CobraCheckErrWithHelp(cmd, errors.New("need flag '--hosts.quarantine-file'"))
+		}
+	},
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the quarantined hosts",
+	Example: `
+  # List the quarantined hosts.
+  $ gossh quarantine list --hosts.quarantine-file ~/.gossh/quarantine.json
+
+  # List the quarantined hosts in json format.
+  $ gossh quarantine list --hosts.quarantine-file ~/.gossh/quarantine.json --format json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if quarantineFormat != sshtask.InventoryFormatText && quarantineFormat != sshtask.InventoryFormatJSON {
+			util.CheckErr(fmt.Sprintf(
+				"invalid format: %s - available values: %s, %s",
+				quarantineFormat,
+				sshtask.InventoryFormatText,
+				sshtask.InventoryFormatJSON,
+			))
+		}
+
+		util.CheckErr(sshtask.ShowQuarantine(configflags.Config.Hosts.QuarantineFile, quarantineFormat))
+	},
+}
+
+var quarantineClearCmd = &cobra.Command{
+	Use:   "clear [HOST...]",
+	Short: "Remove the hosts from quarantine, or all of them if no hosts are given",
+	Example: `
+  # Remove host1 and host2 from quarantine.
+  $ gossh quarantine clear host1 host2 --hosts.quarantine-file ~/.gossh/quarantine.json
+
+  # Remove all the quarantined hosts.
+  $ gossh quarantine clear --hosts.quarantine-file ~/.gossh/quarantine.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cleared, err := sshtask.ClearQuarantine(configflags.Config.Hosts.QuarantineFile, args)
+		if err != nil {
+			util.CheckErr(err)
+		}
+
+		fmt.Printf("removed %d hosts from quarantine\n", cleared)
+	},
+}
+
+func init() {
+	quarantineListCmd.Flags().StringVarP(&quarantineFormat, "format", "", sshtask.InventoryFormatText,
+		"output format, text or json",
+	)
+
+	quarantineCmd.AddCommand(quarantineListCmd, quarantineClearCmd)
+
+	for _, c := range []*cobra.Command{quarantineCmd, quarantineListCmd, quarantineClearCmd} {
+		c.SetHelpFunc(func(command *cobra.Command, strings []string) {
+			util.CobraMarkHiddenGlobalFlagsExcept(rootCmd, "hosts.quarantine-file", "config")
+			rootCmd.HelpFunc()(command, strings)
+		})
+	}
+}
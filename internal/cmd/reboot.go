@@ -0,0 +1,106 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	rebootWaitTimeout  time.Duration
+	rebootPollInterval time.Duration
+)
+
+// rebootCmd represents the reboot command
+var rebootCmd = &cobra.Command{
+	Use:   "reboot [HOST...]",
+	Short: "Reboot target hosts and wait for them to come back",
+	Long: `
+Reboot target hosts and wait for them to come back.
+
+After the reboot is issued, each target host is polled until ssh is back
+and its boot id is changed, and the downtime of the host is reported.
+Target hosts fail if they are not back within the wait timeout.
+
+The concurrency(-c) is the size of the rolling batch, the next host is not
+rebooted until one of the rebooting hosts is back. Sudo is used
+automatically if the login user is not root.
+
+Note that the '--timeout.command' should be 0 or greater than the
+'--wait-timeout', otherwise the waiting hosts will be timed out.`,
+	Example: `
+  # Reboot target hosts one by one.
+  $ gossh reboot -H hosts.txt -c 1 -k
+
+  # Reboot target hosts in rolling batches of 10 hosts, and a host fails
+  # if it is not back within 5 minutes.
+  $ gossh reboot -H hosts.txt -c 10 --wait-timeout 5m -k
+
+  # Reboot at most 1 host of each zone at the same time.
+  $ gossh reboot -H hosts.txt -c 10 --run.spread-by zone --run.spread-max 1 -k`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if rebootWaitTimeout <= 0 {
+			util.CobraCheckErrWithHelp(cmd, "--wait-timeout must be greater than 0")
+		}
+
+		if rebootPollInterval <= 0 {
+			util.CobraCheckErrWithHelp(cmd, "--poll-interval must be greater than 0")
+		}
+
+		if configflags.Config.Auth.User != "root" {
+			configflags.Config.Run.Sudo = true
+		}
+
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		task := sshtask.NewTask(sshtask.RebootTask, configflags.Config)
+
+		task.SetTargetHosts(args)
+		task.SetRebootOptions(rebootWaitTimeout, rebootPollInterval)
+
+		task.Start()
+
+		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+func init() {
+	rebootCmd.Flags().DurationVarP(&rebootWaitTimeout, "wait-timeout", "", 10*time.Minute,
+		"max time to wait for a rebooted host to come back")
+	rebootCmd.Flags().DurationVarP(&rebootPollInterval, "poll-interval", "", 5*time.Second,
+		"interval of polling whether a rebooted host is back")
+}
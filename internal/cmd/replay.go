@@ -0,0 +1,79 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	replaySpeed   float64
+	replayMaxIdle time.Duration
+)
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay FILE",
+	Short: "Replay the session output recorded by '--output.record'",
+	Long: `
+Replay the session output of a target host recorded by '--output.record'
+with the original timing.
+
+The records are in asciicast v2 format, so they can also be replayed by
+'asciinema play' or uploaded to an asciinema server.`,
+	Example: `
+  # Replay the session output of host1 of the task 20221015103000.
+  $ gossh replay /var/log/gossh/records/20221015103000/host1.cast
+
+  # Replay at double speed and cut idle time to 1 second.
+  $ gossh replay /var/log/gossh/records/20221015103000/host1.cast --speed 2 --max-idle 1s`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := os.Open(args[0])
+		if err != nil {
+			util.CheckErr(err)
+		}
+		defer file.Close()
+
+		if err := batchssh.Replay(file, os.Stdout, replaySpeed, replayMaxIdle); err != nil {
+			util.CheckErr(err)
+		}
+	},
+}
+
+func init() {
+	replayCmd.Flags().Float64VarP(&replaySpeed, "speed", "", 1, "playback speed, e.g. 2 for double speed")
+	replayCmd.Flags().DurationVarP(&replayMaxIdle, "max-idle", "", 0,
+		"max idle time between outputs, e.g. 1s, 0 means the recorded idle time")
+
+	replayCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
+		util.CobraMarkHiddenGlobalFlagsExcept(rootCmd)
+		command.Parent().HelpFunc()(command, strings)
+	})
+}
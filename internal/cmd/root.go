@@ -23,20 +23,39 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof" //nolint:gosec // only served by '--debug.pprof'
 	"os"
+	"runtime"
+	"strings"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/windvalley/gossh/internal/cmd/key"
+	"github.com/windvalley/gossh/internal/cmd/user"
 	"github.com/windvalley/gossh/internal/cmd/vault"
 	"github.com/windvalley/gossh/internal/pkg/configflags"
 	"github.com/windvalley/gossh/pkg/log"
 	"github.com/windvalley/gossh/pkg/util"
 )
 
-const cfgFileFlag = "config"
+const (
+	cfgFileFlag = "config"
+	profileFlag = "profile"
+)
+
+// envPrefix of the environment variables of flags, e.g. GOSSH_AUTH_USER for '--auth.user'.
+const envPrefix = "GOSSH"
 
-var cfgFile string
+var (
+	cfgFile string
+	profile string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -48,6 +67,10 @@ This tool can efficiently manage tens of thousands of Linux server clusters.
 It can efficiently execute commands or a local shell script on target hosts,
 push files and dirs to target hosts, and fetch files and dirs from target hosts to local.
 
+Each flag can also be set by environment variable GOSSH_<FLAG> with '.' and '-' replaced by '_',
+e.g. GOSSH_AUTH_PASSWORD for '--auth.password', and flags take precedence over environment variables,
+which take precedence over config file.
+
 Find more information at: https://github.com/windvalley/gossh`,
 }
 
@@ -58,7 +81,7 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig, initLogger, printDebugInfo)
+	cobra.OnInitialize(initConfig, initLogger, printDebugInfo, startPprof)
 
 	vault.SetHelpFunc(rootCmd)
 
@@ -67,9 +90,29 @@ func init() {
 		scriptCmd,
 		pushCmd,
 		fetchCmd,
+		pingCmd,
+		factsCmd,
+		diffCmd,
+		tailCmd,
+		grepCmd,
+		approveCmd,
+		replayCmd,
+		attachCmd,
+		jobsCmd,
+		inventoryCmd,
+		quarantineCmd,
+		user.Cmd,
+		key.Cmd,
+		serviceCmd,
+		pkgCmd,
+		checkCmd,
+		portcheckCmd,
+		pscheckCmd,
+		rebootCmd,
 		vault.Cmd,
 		configCmd,
 		versionCmd,
+		controlMasterCmd,
 	)
 
 	localFlags := rootCmd.Flags()
@@ -81,11 +124,23 @@ func init() {
 	configFlags := configflags.New()
 	configFlags.AddFlagsTo(persistentFlags)
 
-	persistentFlags.StringVarP(&cfgFile, cfgFileFlag, "", "", "config file (default {$PWD,$HOME}/.gossh.yaml)")
+	persistentFlags.StringVarP(&cfgFile, cfgFileFlag, "", "",
+		"config file (default $GOSSH_CONFIG or {$PWD,$HOME}/.gossh.yaml)")
+	persistentFlags.StringVarP(&profile, profileFlag, "", "",
+		`profile under 'profiles' of config file(e.g. prod), whose settings override the top-level ones
+(default $GOSSH_PROFILE)`)
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	if cfgFile == "" {
+		cfgFile = os.Getenv(envPrefix + "_CONFIG")
+	}
+
+	if profile == "" {
+		profile = os.Getenv(envPrefix + "_PROFILE")
+	}
+
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -101,32 +156,85 @@ func initConfig() {
 		viper.SetConfigName(".gossh")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// Read in environment variables that match, e.g. GOSSH_RUN_AS_USER for 'run.as-user'.
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	_ = viper.ReadInConfig()
 
+	if profile != "" {
+		if err := useProfile(profile); err != nil {
+			util.CheckErr(err)
+		}
+	}
+
 	if err := viper.BindPFlags(rootCmd.PersistentFlags()); err != nil {
 		util.CheckErr(err)
 	}
 
 	if err := viper.Unmarshal(&configflags.Config); err != nil {
-		util.CheckErr(err)
+		if !isConfigCheck() {
+			util.CheckErr(err)
+		}
+
+		// Keeps what can be decoded for 'config check', which reports the errors itself.
+		configflags.Config = configflags.New()
+		_ = viper.Unmarshal(configflags.Config)
 	}
 
+	decryptVaultedValues()
+
 	if err := configflags.Config.Complete(); err != nil {
 		util.CheckErr(err)
 	}
 }
 
+// useProfile merges the settings of the profile under 'profiles' of config file
+// over the top-level ones, and flags from command line still take precedence.
+func useProfile(name string) error {
+	settings := viper.Sub("profiles." + name)
+	if settings == nil {
+		if viper.ConfigFileUsed() == "" {
+			return fmt.Errorf("profile '%s' not found: no config file", name)
+		}
+
+		return fmt.Errorf("profile '%s' not found in config file '%s'", name, viper.ConfigFileUsed())
+	}
+
+	return viper.MergeConfigMap(settings.AllSettings())
+}
+
 func initLogger() {
+	color.NoColor = !configflags.Config.Output.Colorful()
+
+	opts := []log.InitOption{
+		log.WithRotation(
+			configflags.Config.Log.MaxSize,
+			configflags.Config.Log.MaxBackups,
+			configflags.Config.Log.MaxAge,
+		),
+	}
+
+	if configflags.Config.Output.Oneline {
+		opts = append(opts, log.WithOneline())
+	}
+
 	log.Init(
 		configflags.Config.Output.File,
 		configflags.Config.Output.JSON,
 		configflags.Config.Output.Verbose,
 		configflags.Config.Output.Quiet,
 		configflags.Config.Output.Condense,
+		opts...,
 	)
+
+	if configflags.Config.Log.Syslog {
+		if err := log.InitSyslog(configflags.Config.Log.SyslogFacility, "gossh"); err != nil {
+			util.CheckErr(err)
+		}
+	}
 }
 
 func printDebugInfo() {
@@ -139,3 +247,57 @@ func printDebugInfo() {
 
 	log.Debugf("Config contents: %s", configflags.Config.String())
 }
+
+// decryptVaultedValues of config file, flags and environment variables anywhere, e.g. the webhook
+// urls of '--notify.targets', before they are completed and used, e.g. '--output.file' by the logger,
+// while the passwords/passphrases are decrypted when they are used, so that the vault password is
+// only asked if needed. The commands vault and config keep them vaulted.
+func decryptVaultedValues() {
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+	if err != nil || cmd == rootCmd || cmd == versionCmd {
+		return
+	}
+
+	switch cmd.Name() {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return
+	}
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == vault.Cmd || c == configCmd {
+			return
+		}
+	}
+
+	if err := configflags.Config.DecryptVaultedValues(vault.Decrypt, isSecretValueKey); err != nil {
+		util.CheckErr(err)
+	}
+}
+
+// startPprof serves pprof and go runtime metrics on the address of '--debug.pprof',
+// e.g. 'go tool pprof http://127.0.0.1:6060/debug/pprof/heap' during a giant run.
+func startPprof() {
+	addr := configflags.Config.Debug.Pprof
+	if addr == "" {
+		return
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		util.CheckErr(fmt.Errorf("listen on '%s' for pprof failed: %s", addr, err))
+	}
+
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+
+	log.Infof("pprof is served on http://%s/debug/pprof/ and runtime metrics on http://%s/debug/vars",
+		listener.Addr(), listener.Addr())
+
+	go func() {
+		//nolint:gosec
+		if err := http.Serve(listener, nil); err != nil {
+			log.Warnf("serve pprof failed: %s", err)
+		}
+	}()
+}
@@ -24,6 +24,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -37,6 +38,7 @@ var (
 	destPath   string
 	remove     bool
 	force      bool
+	byStdin    bool
 )
 
 // scriptCmd represents the script command
@@ -60,6 +62,14 @@ Execute a local shell script on target hosts.`,
   # NOTE: This will prompt for a password(login user).
   $ gossh script host1 -e foo.sh -s -U zhangsan
 
+  # Copy foo.sh to another directory when /tmp is noexec, and remove the scripts
+  # left on the hosts that failed or timed out after the task.
+  $ gossh script -H hosts.txt -e foo.sh -r --run.tmp-dir /var/tmp --run.tmp-sweep
+
+  # Pipe foo.sh to 'bash -s' instead of copying it to target hosts,
+  # for hosts with read-only or noexec /tmp.
+  $ gossh script host1 -e foo.sh --stdin
+
   # Set timeout seconds for executing script on each target host.
   $ gossh script host1 host2 -e foo.sh --timeout.command 10
 
@@ -76,17 +86,30 @@ Execute a local shell script on target hosts.`,
 		if scriptFile != "" && !util.FileExists(scriptFile) {
 			util.CheckErr(fmt.Sprintf("script '%s' not found", scriptFile))
 		}
+
+		if byStdin && configflags.Config.Run.Raw {
+			util.CheckErr("--stdin can not be used with --run.raw")
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("dest-path") && configflags.Config.Run.TmpDir != "" {
+			destPath = configflags.Config.Run.TmpDir
+		}
+
 		task := sshtask.NewTask(sshtask.ScriptTask, configflags.Config)
 
 		task.SetTargetHosts(args)
 		task.SetScriptFile(scriptFile)
 		task.SetScriptOptions(destPath, remove, force)
+		task.SetScriptByStdin(byStdin)
 
 		task.Start()
 
 		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
 	},
 }
 
@@ -106,4 +129,9 @@ func init() {
 	scriptCmd.Flags().BoolVarP(&force, "force", "F", false,
 		"allow overwrite script file if it already exists on target hosts",
 	)
+
+	scriptCmd.Flags().BoolVarP(&byStdin, "stdin", "", false,
+		`pipe the script to 'bash -s' over the session stdin instead of copying it
+to target hosts, '-d/--dest-path', '-r/--remove' and '-F/--force' are ignored`,
+	)
 }
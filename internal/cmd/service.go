@@ -0,0 +1,130 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// Actions of subcommand 'service'.
+const (
+	serviceStart   = "start"
+	serviceStop    = "stop"
+	serviceRestart = "restart"
+	serviceStatus  = "status"
+)
+
+var serviceNameRegexp = regexp.MustCompile(`^[A-Za-z0-9@._:-]+$`)
+
+// serviceCommandTemplate detects systemd or sysvinit, executes the action, and
+// then outputs the normalized status: running, stopped, failed or unknown.
+// It fails if the status is not the expected one of the action.
+const serviceCommandTemplate = `n=%s;a=%s;w=%s
+if command -v systemctl >/dev/null 2>&1 && [ -d /run/systemd/system ];then
+  i=systemd
+  systemctl cat "$n" >/dev/null 2>&1 || { echo "service $n not found ($i)";exit 1; }
+  [ "$a" = status ] || systemctl "$a" "$n" || exit 1
+  case $(systemctl is-active "$n") in
+    active) s=running;; inactive) s=stopped;; failed) s=failed;; *) s=unknown;;
+  esac
+elif [ -x "/etc/init.d/$n" ];then
+  i=sysvinit
+  [ "$a" = status ] || "/etc/init.d/$n" "$a" >/dev/null || exit 1
+  "/etc/init.d/$n" status >/dev/null 2>&1
+  case $? in
+    0) s=running;; 1|2|3) s=stopped;; *) s=unknown;;
+  esac
+else
+  echo "service $n not found";exit 1
+fi
+echo "$n: $s ($i)"
+[ "$s" = "$w" ]`
+
+// serviceCmd represents the service command
+var serviceCmd = &cobra.Command{
+	Use:   "service NAME start|stop|restart|status [HOST...]",
+	Short: "Manage a service of target hosts by systemd or sysvinit",
+	Long: `
+Manage a service of target hosts, systemd or sysvinit is detected on each
+target host, and the normalized status(running, stopped, failed or unknown)
+of the service is output after the action.
+
+Target hosts fail if the service is not running after start/restart or status,
+or not stopped after stop. Sudo is used for start/stop/restart automatically
+if the login user is not root.`,
+	Example: `
+  # Restart nginx of target hosts.
+  $ gossh service nginx restart -H hosts.txt -c 10 -k
+
+  # Check whether nginx of target hosts is running.
+  $ gossh service nginx status web[01-10].bar.com -k`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			util.CobraCheckErrWithHelp(cmd, "need service name and action")
+		}
+
+		return nil
+	},
+	PreRun: func(cmd *cobra.Command, args []string) {
+		name, action := args[0], args[1]
+
+		if !serviceNameRegexp.MatchString(name) {
+			util.CheckErr(fmt.Sprintf("invalid service name: '%s'", name))
+		}
+
+		switch action {
+		case serviceStart, serviceStop, serviceRestart:
+			if configflags.Config.Auth.User != "root" {
+				configflags.Config.Run.Sudo = true
+			}
+		case serviceStatus:
+		default:
+			util.CheckErr(fmt.Sprintf(
+				"invalid action: '%s' - available actions: %s",
+				action,
+				strings.Join([]string{serviceStart, serviceStop, serviceRestart, serviceStatus}, ", "),
+			))
+		}
+
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		name, action := args[0], args[1]
+
+		want := "running"
+		if action == serviceStop {
+			want = "stopped"
+		}
+
+		runCommandTask(cmd, args[2:], fmt.Sprintf(serviceCommandTemplate, name, action, want))
+	},
+}
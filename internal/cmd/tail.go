@@ -0,0 +1,123 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	tailFiles     []string
+	tailLines     int
+	tailHighlight string
+)
+
+// tailCmd represents the tail command
+var tailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Follow files on target hosts like 'tail -F'",
+	Long: `
+Follow files on target hosts like 'tail -F'.
+
+The lines appended to the files on all target hosts are streamed at the same
+time, each prefixed with its host, until interrupted by Ctrl+C. The files are
+followed by name, so that tailing goes on after they are rotated.
+
+The concurrency(-c) is ignored, since all target hosts are followed at the
+same time. Use '--timeout.command' or '--timeout.task' to stop after a while.`,
+	Example: `
+  # Follow the log file on target hosts.
+  $ gossh tail -H hosts.txt -f /var/log/app.log
+
+  # Output the last 100 lines first, and highlight the errors.
+  $ gossh tail -H hosts.txt -f /var/log/app.log -n 100 --highlight 'ERROR|panic'
+
+  # Follow multiple files that need root privilege, shell patterns are supported.
+  $ gossh tail -H hosts.txt -f '/var/log/nginx/*.log',/var/log/messages -s
+
+  # Follow for 60 seconds only.
+  $ gossh tail -H hosts.txt -f /var/log/app.log --timeout.task 60`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if errs := configflags.Config.Validate(); len(errs) != 0 {
+			util.CheckErr(errs)
+		}
+
+		for _, f := range tailFiles {
+			if f == "" || strings.Contains(f, "'") {
+				util.CheckErr(fmt.Sprintf("invalid file: '%s' - need file path without single quotes", f))
+			}
+		}
+
+		if tailLines < 0 {
+			util.CheckErr(fmt.Sprintf("invalid --lines: %d - need >= 0", tailLines))
+		}
+
+		if tailHighlight != "" {
+			if _, err := regexp.Compile(tailHighlight); err != nil {
+				util.CheckErr(fmt.Sprintf("invalid --highlight: %s", err))
+			}
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		task := sshtask.NewTask(sshtask.TailTask, configflags.Config)
+
+		var highlight *regexp.Regexp
+		if tailHighlight != "" {
+			highlight = regexp.MustCompile(tailHighlight)
+		}
+
+		task.SetTargetHosts(args)
+		task.SetTailOptions(tailFiles, tailLines, highlight)
+
+		task.Start()
+
+		util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+		if code := task.ExitCode(); code != 0 {
+			os.Exit(code)
+		}
+	},
+}
+
+func init() {
+	tailCmd.Flags().StringSliceVarP(&tailFiles, "files", "f", nil,
+		"files on target hosts to be followed",
+	)
+
+	tailCmd.Flags().IntVarP(&tailLines, "lines", "n", 10,
+		"output the last N lines of each file first",
+	)
+
+	tailCmd.Flags().StringVarP(&tailHighlight, "highlight", "", "",
+		"regular expression of which the matches are highlighted",
+	)
+}
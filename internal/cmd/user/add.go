@@ -0,0 +1,92 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package user
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var (
+	userGroups  []string
+	userShell   string
+	setPassword bool
+)
+
+// addCmd represents the user add command
+var addCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a user to target hosts",
+	Long: `
+Add a user to target hosts with its home directory, and the hosts
+on which the user already exists are left as they are.`,
+	Example: `
+  # Add user alice with supplementary group wheel to target hosts.
+  $ gossh user add -n alice --groups wheel -H hosts.txt -s -k
+
+  # Add user alice and set its password which is asked for.
+  $ gossh user add -n alice --set-password -H hosts.txt -s -k
+
+  # Add user alice with a password hash generated beforehand.
+  $ gossh user add -n alice --password-hash "$(openssl passwd -6)" -H hosts.txt -s -k`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateFlags()
+
+		for _, group := range userGroups {
+			if !userNameRegexp.MatchString(group) {
+				util.CheckErr(fmt.Sprintf("invalid groups: '%s' - need valid group names", group))
+			}
+		}
+
+		if userShell != "" && !validShell(userShell) {
+			util.CheckErr(fmt.Sprintf("invalid shell: '%s' - need an absolute path, e.g. /bin/bash", userShell))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		options := "-m"
+		if len(userGroups) != 0 {
+			options += " -G " + strings.Join(userGroups, ",")
+		}
+		if userShell != "" {
+			options += " -s " + userShell
+		}
+		if setPassword || passwordHash != "" {
+			hash, err := getPasswordHash()
+			if err != nil {
+				util.CheckErr(fmt.Sprintf("get password failed: %s", err))
+			}
+
+			options += " -p " + util.ShellDoubleQuote(hash)
+		}
+
+		runCommand(cmd, args, fmt.Sprintf(
+			`if id -u %s >/dev/null 2>&1;then echo "user %s already exists";`+
+				`else useradd %s %s && echo "user %s added";fi`,
+			userName, userName, options, userName, userName,
+		))
+	},
+}
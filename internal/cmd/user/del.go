@@ -0,0 +1,61 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package user
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var removeHome bool
+
+// delCmd represents the user del command
+var delCmd = &cobra.Command{
+	Use:   "del",
+	Short: "Delete a user from target hosts",
+	Long: `
+Delete a user from target hosts, and the hosts on which the user
+does not exist are left as they are.`,
+	Example: `
+  # Delete user alice from target hosts.
+  $ gossh user del -n alice -H hosts.txt -s -k
+
+  # Delete user alice and its home directory and mail spool.
+  $ gossh user del -n alice --remove-home -H hosts.txt -s -k`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateFlags()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		options := ""
+		if removeHome {
+			options = "-r "
+		}
+
+		runCommand(cmd, args, fmt.Sprintf(
+			`if id -u %s >/dev/null 2>&1;then userdel %s%s && echo "user %s deleted";`+
+				`else echo "user %s does not exist";fi`,
+			userName, options, userName, userName, userName,
+		))
+	},
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package user
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// passwdCmd represents the user passwd command
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change the password of a user on target hosts",
+	Example: `
+  # Change the password of user alice, which is asked for.
+  $ gossh user passwd -n alice -H hosts.txt -s -k
+
+  # Change the password of user alice by a password hash generated beforehand.
+  $ gossh user passwd -n alice --password-hash "$(openssl passwd -6)" -H hosts.txt -s -k`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateFlags()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		hash, err := getPasswordHash()
+		if err != nil {
+			util.CheckErr(fmt.Sprintf("get password failed: %s", err))
+		}
+
+		runCommand(cmd, args, fmt.Sprintf(
+			`if id -u %s >/dev/null 2>&1;then usermod -p %s %s && echo "password of user %s changed";`+
+				`else echo "user %s does not exist";exit 1;fi`,
+			userName, util.ShellDoubleQuote(hash), userName, userName, userName,
+		))
+	},
+}
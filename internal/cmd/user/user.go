@@ -0,0 +1,172 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package user
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/sshtask"
+	"github.com/windvalley/gossh/pkg/sha512crypt"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// Cmd represents the user command
+var Cmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage users of target hosts",
+	Long: `
+Manage users of target hosts by useradd/userdel/usermod, which needs root
+privilege, so use sudo('-s') if the login user is not root.
+
+Passwords are hashed(SHA-512 crypt) locally, and only the hashes are sent to
+target hosts, so the plaintext passwords never appear in the commands, logs
+and audit events.`,
+}
+
+var (
+	userName     string
+	passwordHash string
+)
+
+// userNameRegexp is the portable user/group name of useradd.
+var userNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+
+func init() {
+	util.CobraAddSubCommandInOrder(Cmd, addCmd, delCmd, passwdCmd)
+
+	for _, c := range []*cobra.Command{addCmd, delCmd, passwdCmd} {
+		c.Flags().StringVarP(&userName, "name", "n", "", "name of the user")
+	}
+
+	addCmd.Flags().StringSliceVarP(&userGroups, "groups", "G", nil, "supplementary groups of the user")
+	addCmd.Flags().StringVarP(&userShell, "shell", "", "", "login shell of the user (default by useradd)")
+	addCmd.Flags().BoolVarP(&setPassword, "set-password", "", false, "ask for the password of the user")
+
+	delCmd.Flags().BoolVarP(&removeHome, "remove-home", "", false,
+		"remove the home directory and mail spool of the user (userdel -r)")
+
+	for _, c := range []*cobra.Command{addCmd, passwdCmd} {
+		c.Flags().StringVarP(&passwordHash, "password-hash", "", "",
+			`password hash in crypt(3) format (e.g. from 'openssl passwd -6'),
+instead of asking for the password`)
+	}
+}
+
+func validateFlags() {
+	if errs := configflags.Config.Validate(); len(errs) != 0 {
+		util.CheckErr(errs)
+	}
+
+	if !userNameRegexp.MatchString(userName) {
+		util.CheckErr(fmt.Sprintf("invalid name: '%s' - need a valid user name, e.g. 'alice'", userName))
+	}
+
+	if passwordHash != "" && !strings.HasPrefix(passwordHash, "$") {
+		util.CheckErr("invalid password-hash: need crypt(3) format, e.g. '$6$salt$hash'")
+	}
+}
+
+// runCommand executes the generated command on target hosts like subcommand 'command'.
+func runCommand(cmd *cobra.Command, hosts []string, command string) {
+	task := sshtask.NewTask(sshtask.CommandTask, configflags.Config)
+
+	task.SetTargetHosts(hosts)
+	task.SetCommand(command)
+
+	task.Start()
+
+	util.CobraCheckErrWithHelp(cmd, task.CheckErr())
+
+	if code := task.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// getPasswordHash returns '--password-hash', or hashes the password that is asked for.
+func getPasswordHash() (string, error) {
+	if passwordHash != "" {
+		return passwordHash, nil
+	}
+
+	password, err := getConfirmPasswordFromPrompt(fmt.Sprintf("New password of user '%s': ", userName))
+	if err != nil {
+		return "", err
+	}
+
+	return sha512crypt.Generate(password)
+}
+
+func getConfirmPasswordFromPrompt(prompt string) (string, error) {
+	var password string
+	for {
+		p, err := getPasswordFromPrompt(prompt)
+		if err != nil {
+			return "", err
+		}
+		if p != "" {
+			password = p
+			break
+		}
+
+		fmt.Println(color.YellowString("input can not be null, retry"))
+	}
+
+	passwordConfirm, err := getPasswordFromPrompt("Confirm " + strings.ToLower(prompt[:1]) + prompt[1:])
+	if err != nil {
+		return "", err
+	}
+
+	if password != passwordConfirm {
+		return "", errors.New("two inputs do not match")
+	}
+
+	return password, nil
+}
+
+func getPasswordFromPrompt(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	passwordByte, err := term.ReadPassword(0)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintln(os.Stderr, "")
+
+	return string(passwordByte), nil
+}
+
+// validShell checks the login shell which is put into the commands as it is.
+func validShell(shell string) bool {
+	return path.IsAbs(shell) && !strings.ContainsAny(shell, " \t'\"`$;&|<>\\")
+}
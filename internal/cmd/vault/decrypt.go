@@ -39,10 +39,10 @@ var decryptCmd = &cobra.Command{
 Decrypt content encrypted by vault.`,
 	Example: `
     # Decrypt cipher text by asking for vault password.
-    $ gossh vault decrypt GOSSH-AES256:a5c1b3c0cdad4669f84
+    $ gossh vault decrypt GOSSH-VAULT:v2:0100000003000100000442f7c5b4
 
     # Decrypt cipher text by vault password file.
-    $ gossh vault decrypt GOSSH-AES256:a5c1b3c0cdad4669f84 -V /path/vault-password-file`,
+    $ gossh vault decrypt GOSSH-VAULT:v2:0100000003000100000442f7c5b4 -V /path/vault-password-file`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			util.CobraCheckErrWithHelp(cmd, "requires one arg to represent the vault encrypted content")
@@ -52,15 +52,14 @@ Decrypt content encrypted by vault.`,
 			util.CobraCheckErrWithHelp(cmd, "to many args, only need one")
 		}
 
-		if !aes.IsAES256CipherText(args[0]) {
+		if !aes.IsCipherText(args[0]) {
 			util.CheckErr(fmt.Sprintf("'%s' is not vault encrypted content", args[0]))
 		}
 
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		vaultPass := GetVaultPassword()
-		plainText, err := aes.AES256Decode(args[0], vaultPass)
+		plainText, err := Decrypt(args[0])
 		if err != nil {
 			err = fmt.Errorf("decrypt failed: %w", err)
 		}
@@ -70,8 +70,6 @@ Decrypt vault encrypted file.`,
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		vaultPass := GetVaultPassword()
-
 		file := args[0]
 
 		p, err := ioutil.ReadFile(file)
@@ -79,11 +77,11 @@ Decrypt vault encrypted file.`,
 
 		content := string(p)
 
-		if !aes.IsAES256CipherText(content) {
+		if !aes.IsCipherText(content) {
 			util.CheckErr(fmt.Sprintf("'%s' is not vault encrypted file", file))
 		}
 
-		decryptContent, err := aes.AES256Decode(content, vaultPass)
+		decryptContent, err := Decrypt(content)
 		if err != nil {
 			err = fmt.Errorf("decrypt failed: %w", err)
 		}
@@ -27,7 +27,6 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"github.com/windvalley/gossh/internal/pkg/aes"
 	"github.com/windvalley/gossh/pkg/util"
 )
 
@@ -45,7 +44,13 @@ Encrypt sensitive content.`,
     $ gossh vault encrypt "your-sensitive-plaintext" -V /path/vault-password-file
 
 	# Encrypt plaintext from terminal prompt.
-	$ gossh vault encrypt -V /path/vault-password-file`,
+	$ gossh vault encrypt -V /path/vault-password-file
+
+    # Encrypt plaintext to the age public keys of the team, no vault password needed.
+    $ gossh vault encrypt "your-sensitive-plaintext" --age-recipient age1xxx,age1yyy
+
+    # Encrypt plaintext to the gpg public keys of the team.
+    $ gossh vault encrypt "your-sensitive-plaintext" --gpg-recipient alice@example.com,bob@example.com`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) > 1 {
 			util.CobraCheckErrWithHelp(cmd, "to many args, only need one")
@@ -54,7 +59,7 @@ Encrypt sensitive content.`,
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		vaultPass := getVaultConfirmPassword()
+		checkRecipientFlags(cmd)
 
 		plainPassword, err := getPlainPassword(args)
 		if err != nil {
@@ -62,7 +67,7 @@ Encrypt sensitive content.`,
 		}
 		util.CheckErr(err)
 
-		encryptContent, err := aes.AES256Encode(plainPassword, vaultPass)
+		encryptContent, err := encrypt(plainPassword)
 		if err != nil {
 			err = fmt.Errorf("encrypt failed: %w", err)
 		}
@@ -72,6 +77,11 @@ Encrypt sensitive content.`,
 	},
 }
 
+func init() {
+	addFormatFlag(encryptCmd)
+	addRecipientFlags(encryptCmd)
+}
+
 func getPlainPassword(args []string) (string, error) {
 	if len(args) == 1 {
 		return args[0], nil
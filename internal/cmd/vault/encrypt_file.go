@@ -53,7 +53,10 @@ Encrypt a file.`,
     $ gossh vault encrypt-file /path/auth.txt -O /path/encryption.txt
 
     # Output encrypted content to screen.
-    $ gossh vault encrypt-file /path/auth.txt -O -`,
+    $ gossh vault encrypt-file /path/auth.txt -O -
+
+    # Encrypt a file to the age public keys in file, no vault password needed.
+    $ gossh vault encrypt-file /path/auth.txt --age-recipient /path/team-age-keys.txt`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			util.CobraCheckErrWithHelp(cmd, "requires one arg to represent a file to be encrypted")
@@ -70,7 +73,7 @@ Encrypt a file.`,
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		vaultPass := getVaultConfirmPassword()
+		checkRecipientFlags(cmd)
 
 		file := args[0]
 
@@ -79,11 +82,11 @@ Encrypt a file.`,
 
 		content := string(p)
 
-		if aes.IsAES256CipherText(content) {
+		if aes.IsCipherText(content) {
 			util.CheckErr(fmt.Sprintf("file '%s' is already encrypted", file))
 		}
 
-		encryptContent, err := aes.AES256Encode(content, vaultPass)
+		encryptContent, err := encrypt(content)
 		if err != nil {
 			err = fmt.Errorf("encrypt failed: %w", err)
 		}
@@ -122,4 +125,7 @@ func init() {
 		"",
 		"file that encrypted content is written to (use - for stdout)",
 	)
+
+	addFormatFlag(encryptFileCmd)
+	addRecipientFlags(encryptFileCmd)
 }
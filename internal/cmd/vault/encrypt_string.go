@@ -0,0 +1,151 @@
+/*
+Copyright © 2021 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+var valueName string
+
+// encryptStringCmd represents the vault encrypt-string command
+var encryptStringCmd = &cobra.Command{
+	Use:   "encrypt-string",
+	Short: "Encrypt a value of config file inline",
+	Long: `
+Encrypt a value of config file, and output a yaml snippet with the cipher text
+under the key by '--name', ready to paste into config file.
+
+The vaulted values of any keys of config file are decrypted when they are loaded.`,
+	Example: `
+    # Encrypt the password of login user by asking for vault password.
+    $ gossh vault encrypt-string "your-password" --name auth.password
+
+    # Encrypt the webhook url of notifications from terminal prompt.
+    $ gossh vault encrypt-string --name notify.targets -V /path/vault-password-file
+
+    # Encrypt the password of login user of profile 'prod' to the age public keys of the team.
+    $ gossh vault encrypt-string "your-password" --name profiles.prod.auth.password --age-recipient age1xxx`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			util.CobraCheckErrWithHelp(cmd, "to many args, only need one")
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		checkRecipientFlags(cmd)
+
+		isList, err := checkValueName(cmd, valueName)
+		if err != nil {
+			util.CobraCheckErrWithHelp(cmd, err)
+		}
+
+		plainText, err := getPlainPassword(args)
+		if err != nil {
+			err = fmt.Errorf("get plaintext to be encrypted failed: %s", err)
+		}
+		util.CheckErr(err)
+
+		encryptContent, err := encrypt(plainText)
+		if err != nil {
+			err = fmt.Errorf("encrypt failed: %w", err)
+		}
+		util.CheckErr(err)
+
+		snippet, err := yamlSnippet(valueName, encryptContent, isList)
+		util.CheckErr(err)
+
+		fmt.Printf("\n%s", snippet)
+	},
+}
+
+func init() {
+	encryptStringCmd.Flags().StringVarP(
+		&valueName,
+		"name",
+		"n",
+		"",
+		`key of config file that the value is for(e.g. auth.password), or under a profile
+(e.g. profiles.prod.auth.password)`,
+	)
+
+	addFormatFlag(encryptStringCmd)
+	addRecipientFlags(encryptStringCmd)
+}
+
+// checkValueName that name is the key of a string flag or a list of strings, e.g. '--notify.targets'.
+func checkValueName(cmd *cobra.Command, name string) (isList bool, err error) {
+	if name == "" {
+		return false, fmt.Errorf("need flag '--name'")
+	}
+
+	key := name
+	if strings.HasPrefix(key, "profiles.") {
+		parts := strings.SplitN(key, ".", 3)
+		if len(parts) != 3 || parts[1] == "" {
+			return false, fmt.Errorf("invalid name '%s': need 'profiles.NAME.KEY'", name)
+		}
+		key = parts[2]
+	}
+
+	flag := cmd.Flag(key)
+	if flag == nil || !strings.Contains(key, ".") {
+		return false, fmt.Errorf("invalid name '%s': not a key of config file", name)
+	}
+
+	switch flag.Value.Type() {
+	case "string":
+		return false, nil
+	case "stringSlice", "stringArray":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid name '%s': the value is %s rather than string", name, flag.Value.Type())
+	}
+}
+
+// yamlSnippet of the value under the nested keys of name, e.g. 'auth.password'.
+func yamlSnippet(name, value string, isList bool) (string, error) {
+	var snippet interface{} = value
+	if isList {
+		snippet = []string{value}
+	}
+
+	keys := strings.Split(name, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		snippet = yaml.MapSlice{{Key: keys[i], Value: snippet}}
+	}
+
+	out, err := yaml.Marshal(snippet)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2021 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	"github.com/windvalley/gossh/internal/pkg/aes"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// v1CipherTextRegexp matches the cipher texts of format v1 embedded in files, e.g. config files.
+var v1CipherTextRegexp = regexp.MustCompile(`GOSSH-AES256:[0-9a-fA-F]+`)
+
+// upgradeCmd represents the vault upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade cipher texts to the latest format",
+	Long: `
+Upgrade the cipher texts of the old format v1(AES-256-CBC) to format v2(AES-256-GCM
+with Argon2id), which are re-encrypted by the same vault password. The args are cipher
+texts, or files encrypted by 'encrypt-file' or holding cipher texts such as config files,
+which are upgraded in place.`,
+	Example: `
+    # Upgrade the cipher texts in the config file and an encrypted file.
+    $ gossh vault upgrade ~/.gossh.yaml /path/auth.txt -V /path/vault-password-file
+
+    # Upgrade a cipher text, and output the new one to screen.
+    $ gossh vault upgrade GOSSH-AES256:a5c1b3c0cdad4669f84`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			util.CobraCheckErrWithHelp(cmd, "requires cipher texts or files to be upgraded")
+		}
+
+		for _, arg := range args {
+			if !aes.IsCipherText(arg) && !util.FileExists(arg) {
+				util.CheckErr(fmt.Sprintf("file '%s' not found", arg))
+			}
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		vaultPass := GetVaultPassword()
+
+		for _, arg := range args {
+			if aes.IsCipherText(arg) {
+				cipherText, err := upgradeCipherText(arg, vaultPass)
+				util.CheckErr(err)
+
+				fmt.Printf("\n%s\n", cipherText)
+				continue
+			}
+
+			count, err := upgradeFile(arg, vaultPass)
+			util.CheckErr(err)
+
+			if count == 0 {
+				fmt.Printf("no cipher texts of format %s in '%s'\n", aes.FormatV1, arg)
+			} else {
+				fmt.Printf("upgraded %d cipher texts in '%s'\n", count, arg)
+			}
+		}
+	},
+}
+
+// upgradeCipherText re-encrypts the cipher text of format v1 in format v2.
+func upgradeCipherText(cipherText, vaultPass string) (string, error) {
+	if aes.CipherTextFormat(cipherText) != aes.FormatV1 {
+		return cipherText, nil
+	}
+
+	plainText, err := aes.Decrypt(cipherText, vaultPass)
+	if err != nil {
+		return "", fmt.Errorf("decrypt failed: %w", err)
+	}
+
+	return aes.Encrypt(plainText, vaultPass, aes.FormatV2)
+}
+
+// upgradeFile upgrades the cipher texts in file, which is not written if any of them failed.
+func upgradeFile(file, vaultPass string) (int, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		count      int
+		upgradeErr error
+	)
+
+	upgraded := v1CipherTextRegexp.ReplaceAllStringFunc(string(content), func(cipherText string) string {
+		if upgradeErr != nil {
+			return cipherText
+		}
+
+		newCipherText, err := upgradeCipherText(cipherText, vaultPass)
+		if err != nil {
+			upgradeErr = fmt.Errorf("upgrade '%s' failed: %w", file, err)
+			return cipherText
+		}
+
+		count++
+
+		return newCipherText
+	})
+	if upgradeErr != nil {
+		return 0, upgradeErr
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	return count, ioutil.WriteFile(file, []byte(upgraded), info.Mode().Perm())
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 
+	"github.com/windvalley/gossh/internal/pkg/aes"
 	"github.com/windvalley/gossh/internal/pkg/configflags"
 	"github.com/windvalley/gossh/pkg/log"
 	"github.com/windvalley/gossh/pkg/util"
@@ -45,12 +46,92 @@ var Cmd = &cobra.Command{
 	Long: `
 Encrypt sensitive content such as passwords so you can protect it rather than 
 leaving it visible as plaintext in public place. To use vault you need another 
-password(vault-pass) to encrypt and decrypt the content.`,
+password(vault-pass) to encrypt and decrypt the content, or encrypt the content 
+to the public keys of the team by age or gpg.`,
 }
 
+var (
+	// vaultFormat of the cipher texts encrypted by flag '--format'.
+	vaultFormat string
+
+	// ageRecipients and gpgRecipients that the content is encrypted to instead of the vault password.
+	ageRecipients []string
+	gpgRecipients []string
+
+	// vaultPassword cached after asked from terminal prompt.
+	vaultPassword string
+)
+
 func init() {
 	util.CobraAddSubCommandInOrder(Cmd,
-		encryptCmd, decryptCmd, encryptFileCmd, decryptFileCmd, viewCmd)
+		encryptCmd, decryptCmd, encryptStringCmd, encryptFileCmd, decryptFileCmd, viewCmd, upgradeCmd)
+}
+
+// addFormatFlag to the commands that encrypt.
+func addFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&vaultFormat,
+		"format",
+		"",
+		aes.FormatV2,
+		fmt.Sprintf(
+			`format of the cipher text, available values:
+%s: AES-256-GCM with the key derived from the vault password by Argon2id
+%s: AES-256-CBC of the old versions, only for the old versions of gossh to decrypt`,
+			aes.FormatV2,
+			aes.FormatV1,
+		),
+	)
+}
+
+// addRecipientFlags to the commands that encrypt.
+func addRecipientFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(
+		&ageRecipients,
+		"age-recipient",
+		"",
+		nil,
+		`encrypt by age to the recipients instead of the vault password, which are age public keys,
+ssh public keys or files of them, decrypted by the identity file of '--auth.vault-identity-file'`,
+	)
+
+	cmd.Flags().StringSliceVarP(
+		&gpgRecipients,
+		"gpg-recipient",
+		"",
+		nil,
+		`encrypt by gpg to the recipients instead of the vault password, which are key ids,
+fingerprints or emails of the public keys in the gpg keyring, decrypted by the gpg keyring`,
+	)
+}
+
+// checkRecipientFlags that '--age-recipient' and '--gpg-recipient' are not used together.
+func checkRecipientFlags(cmd *cobra.Command) {
+	if len(ageRecipients) != 0 && len(gpgRecipients) != 0 {
+		util.CobraCheckErrWithHelp(cmd, "flags '--age-recipient' and '--gpg-recipient' can not be used together")
+	}
+}
+
+// encrypt the plain text to the recipients if any, or by the vault password.
+func encrypt(plainText string) (string, error) {
+	switch {
+	case len(ageRecipients) != 0:
+		return aes.EncryptToRecipients(plainText, aes.FormatAge, ageRecipients)
+	case len(gpgRecipients) != 0:
+		return aes.EncryptToRecipients(plainText, aes.FormatGPG, gpgRecipients)
+	default:
+		return aes.Encrypt(plainText, getVaultConfirmPassword(), vaultFormat)
+	}
+}
+
+// Decrypt the vaulted cipher text, the vault password is only asked if the cipher text
+// is not encrypted to recipients.
+func Decrypt(cipherText string) (string, error) {
+	if aes.IsRecipientCipherText(cipherText) {
+		return aes.DecryptByIdentity(cipherText, configflags.Config.Auth.VaultIDFile)
+	}
+
+	return aes.Decrypt(cipherText, GetVaultPassword())
 }
 
 // SetHelpFunc for vault command and its subcommands.
@@ -59,6 +140,7 @@ func SetHelpFunc(rootCmd *cobra.Command) {
 		util.CobraMarkHiddenGlobalFlagsExcept(
 			rootCmd,
 			"auth.vault-pass-file",
+			"auth.vault-identity-file",
 			"output.verbose",
 		)
 	}
@@ -78,6 +160,11 @@ func SetHelpFunc(rootCmd *cobra.Command) {
 		command.Parent().Parent().HelpFunc()(command, strings)
 	})
 
+	encryptStringCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
+		markHiddenGlobalFlagsExceptsForVault()
+		command.Parent().Parent().HelpFunc()(command, strings)
+	})
+
 	encryptFileCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
 		markHiddenGlobalFlagsExceptsForVault()
 		command.Parent().Parent().HelpFunc()(command, strings)
@@ -92,6 +179,11 @@ func SetHelpFunc(rootCmd *cobra.Command) {
 		markHiddenGlobalFlagsExceptsForVault()
 		command.Parent().Parent().HelpFunc()(command, strings)
 	})
+
+	upgradeCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {
+		markHiddenGlobalFlagsExceptsForVault()
+		command.Parent().Parent().HelpFunc()(command, strings)
+	})
 }
 
 func getVaultConfirmPassword() string {
@@ -120,6 +212,10 @@ func GetVaultPassword() string {
 		return password
 	}
 
+	if vaultPassword != "" {
+		return vaultPassword
+	}
+
 	prompt := "Vault password: "
 	for {
 		password, err = getPasswordFromPrompt(prompt)
@@ -135,6 +231,8 @@ func GetVaultPassword() string {
 
 	log.Debugf("read vault password from terminal prompt '%s'", prompt)
 
+	vaultPassword = password
+
 	return password
 }
 
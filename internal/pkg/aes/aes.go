@@ -24,10 +24,10 @@ package aes
 
 import (
 	"encoding/hex"
+	"errors"
 	"strings"
 
 	"github.com/windvalley/gossh/pkg/aes"
-	"github.com/windvalley/gossh/pkg/util"
 )
 
 const (
@@ -50,10 +50,10 @@ func AES256Encode(plainText, key string) (string, error) {
 }
 
 // AES256Decode ...
-func AES256Decode(hexCipherText, key string) (string, error) {
+func AES256Decode(hexCipherText, key string) (plainText string, err error) {
 	defer func() {
-		if err := recover(); err != nil {
-			util.CheckErr("decryption failed: wrong vault password")
+		if r := recover(); r != nil {
+			err = errors.New("wrong vault password")
 		}
 	}()
 
@@ -0,0 +1,134 @@
+/*
+Copyright © 2021 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package aes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// Formats of the cipher texts encrypted to the public keys of recipients, e.g. of
+// the team members, rather than a shared vault password, which are in format
+// 'GOSSH-VAULT:age:BASE64' and 'GOSSH-VAULT:gpg:BASE64'.
+const (
+	FormatAge = "age"
+	FormatGPG = "gpg"
+)
+
+// EncryptToRecipients encrypts plain text by age or gpg to the recipients, which are
+// age public keys(age1...), ssh public keys or files of them for age, and key ids,
+// fingerprints or emails of the keyring for gpg.
+func EncryptToRecipients(plainText, format string, recipients []string) (string, error) {
+	if len(recipients) == 0 {
+		return "", errors.New("need recipients")
+	}
+
+	var args []string
+	switch format {
+	case FormatAge:
+		args = []string{"--encrypt"}
+		for _, r := range recipients {
+			if util.FileExists(r) {
+				args = append(args, "--recipients-file", r)
+			} else {
+				args = append(args, "--recipient", r)
+			}
+		}
+	case FormatGPG:
+		args = []string{"--batch", "--yes", "--trust-model", "always", "--encrypt"}
+		for _, r := range recipients {
+			args = append(args, "--recipient", r)
+		}
+	default:
+		return "", fmt.Errorf("unknown recipient format '%s', available formats: %s, %s", format, FormatAge, FormatGPG)
+	}
+
+	cipherText, err := runCrypto(format, []byte(plainText), args...)
+	if err != nil {
+		return "", err
+	}
+
+	return vaultHead + format + ":" + base64.StdEncoding.EncodeToString(cipherText), nil
+}
+
+// DecryptByIdentity decrypts the cipher text of format FormatAge by the age identity
+// file, or FormatGPG by the keyring of gpg, which may ask for the passphrase of the key.
+func DecryptByIdentity(cipherText, identityFile string) (string, error) {
+	format := CipherTextFormat(cipherText)
+
+	payload, err := base64.StdEncoding.DecodeString(
+		strings.TrimPrefix(strings.TrimSpace(cipherText), vaultHead+format+":"),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var args []string
+	switch format {
+	case FormatAge:
+		if identityFile == "" {
+			return "", errors.New("need age identity file by '--auth.vault-identity-file'")
+		}
+		args = []string{"--decrypt", "--identity", identityFile}
+	case FormatGPG:
+		args = []string{"--quiet", "--decrypt"}
+	default:
+		return "", errors.New("not encrypted to recipients")
+	}
+
+	plainText, err := runCrypto(format, payload, args...)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plainText), nil
+}
+
+// IsRecipientCipherText reports whether text is encrypted to recipients rather than by vault password.
+func IsRecipientCipherText(text string) bool {
+	format := CipherTextFormat(text)
+
+	return format == FormatAge || format == FormatGPG
+}
+
+// runCrypto runs the cli of age or gpg with input as stdin.
+func runCrypto(name string, input []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("run %s failed: %s", name, strings.TrimSpace(err.Error()+"\n"+stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
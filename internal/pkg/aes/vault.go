@@ -0,0 +1,165 @@
+/*
+Copyright © 2021 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package aes
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/windvalley/gossh/pkg/aes"
+)
+
+// Formats of the vault cipher text.
+const (
+	// FormatV1 is AES-256-CBC with the padded vault password as the key,
+	// in format 'GOSSH-AES256:HEX', which is only kept for compatibility.
+	FormatV1 = "v1"
+	// FormatV2 is AES-256-GCM with the key derived from the vault password by Argon2id,
+	// in format 'GOSSH-VAULT:v2:HEX'.
+	FormatV2 = "v2"
+)
+
+const (
+	// vaultHead of the versioned envelope, followed by the format and ':'.
+	vaultHead = "GOSSH-VAULT:"
+
+	kdfArgon2id = 1
+
+	// Argon2id parameters of the new cipher texts, which are stored in the envelope,
+	// so that they can be raised later without breaking the existing cipher texts.
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	// argon2MaxMemory in KiB guards against the malformed cipher texts.
+	argon2MaxMemory = 4 * 1024 * 1024
+
+	saltLen = 16
+	// v2HeaderLen is the length of the kdf id, time, memory, threads and salt.
+	v2HeaderLen = 1 + 4 + 4 + 1 + saltLen
+)
+
+// Encrypt plain text by the vault password key in format FormatV1 or FormatV2.
+func Encrypt(plainText, key, format string) (string, error) {
+	switch format {
+	case FormatV1:
+		return AES256Encode(plainText, key)
+	case FormatV2:
+		return encryptV2(plainText, key)
+	default:
+		return "", fmt.Errorf("unknown vault format '%s', available formats: %s, %s", format, FormatV1, FormatV2)
+	}
+}
+
+// Decrypt the cipher text of format FormatV1 or FormatV2 by the vault password key.
+func Decrypt(cipherText, key string) (string, error) {
+	switch CipherTextFormat(cipherText) {
+	case FormatV1:
+		return AES256Decode(cipherText, key)
+	case FormatV2:
+		return decryptV2(cipherText, key)
+	case FormatAge, FormatGPG:
+		return "", errors.New("encrypted to recipients, need DecryptByIdentity")
+	default:
+		return "", errors.New("unknown vault format")
+	}
+}
+
+// IsCipherText of any format or not.
+func IsCipherText(text string) bool {
+	return CipherTextFormat(text) != ""
+}
+
+// CipherTextFormat returns the format of the cipher text, or "" if text is not encrypted by vault.
+func CipherTextFormat(text string) string {
+	if IsAES256CipherText(text) {
+		return FormatV1
+	}
+
+	for _, format := range []string{FormatV2, FormatAge, FormatGPG} {
+		if strings.HasPrefix(text, vaultHead+format+":") {
+			return format
+		}
+	}
+
+	return ""
+}
+
+func encryptV2(plainText, key string) (string, error) {
+	header := make([]byte, v2HeaderLen)
+	header[0] = kdfArgon2id
+	binary.BigEndian.PutUint32(header[1:5], argon2Time)
+	binary.BigEndian.PutUint32(header[5:9], argon2Memory)
+	header[9] = argon2Threads
+
+	salt := header[10:]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+
+	cipherText, err := aes.EncodeGCM(
+		[]byte(plainText),
+		argon2.IDKey([]byte(key), salt, argon2Time, argon2Memory, argon2Threads, 32),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return vaultHead + FormatV2 + ":" + hex.EncodeToString(append(header, cipherText...)), nil
+}
+
+func decryptV2(hexCipherText, key string) (string, error) {
+	payload, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(hexCipherText), vaultHead+FormatV2+":"))
+	if err != nil {
+		return "", err
+	}
+
+	if len(payload) < v2HeaderLen || payload[0] != kdfArgon2id {
+		return "", errors.New("invalid vault cipher text")
+	}
+
+	time := binary.BigEndian.Uint32(payload[1:5])
+	memory := binary.BigEndian.Uint32(payload[5:9])
+	threads := payload[9]
+	if time == 0 || memory == 0 || memory > argon2MaxMemory || threads == 0 {
+		return "", errors.New("invalid vault cipher text: bad argon2id parameters")
+	}
+
+	salt := payload[10:v2HeaderLen]
+
+	plainText, err := aes.DecodeGCM(
+		payload[v2HeaderLen:],
+		argon2.IDKey([]byte(key), salt, time, memory, threads, 32),
+	)
+	if err != nil {
+		return "", errors.New("wrong vault password")
+	}
+
+	return string(plainText), nil
+}
@@ -25,8 +25,11 @@ package configflags
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 
 	"github.com/windvalley/gossh/pkg/util"
 )
@@ -37,32 +40,47 @@ const (
 	flagAuthPassword      = "auth.password"
 	flagAuthAskPass       = "auth.ask-pass"
 	flagAuthPassFile      = "auth.pass-file"
+	flagAuthPassCmd       = "auth.pass-cmd"
 	flagAuthIdentityFiles = "auth.identity-files"
 	flagAuthPassphrase    = "auth.passphrase"
 	flagAuthVaultPassFile = "auth.vault-pass-file"
+	flagAuthVaultIDFile   = "auth.vault-identity-file"
+	flagAuthCacheTTL      = "auth.cache-ttl"
+	flagAuthPKCS11        = "auth.pkcs11-provider"
+	flagAuthKeyPass       = "auth.key-passphrases"
 )
 
 // Auth config.
 type Auth struct {
-	User          string   `json:"user" mapstructure:"user"`
-	Password      string   `json:"password" mapstructure:"password"`
-	AskPass       bool     `json:"ask-pass" mapstructure:"ask-pass"`
-	PassFile      string   `json:"pass-file" mapstructure:"pass-file"`
-	IdentityFiles []string `json:"identity-files" mapstructure:"identity-files"`
-	Passphrase    string   `json:"passphrase" mapstructure:"passphrase"`
-	VaultPassFile string   `json:"vault-pass-file" mapstructure:"vault-pass-file"`
+	User           string        `json:"user" mapstructure:"user"`
+	Password       string        `json:"password" mapstructure:"password"`
+	AskPass        bool          `json:"ask-pass" mapstructure:"ask-pass"`
+	PassFile       string        `json:"pass-file" mapstructure:"pass-file"`
+	PassCmd        string        `json:"pass-cmd" mapstructure:"pass-cmd"`
+	IdentityFiles  []string      `json:"identity-files" mapstructure:"identity-files"`
+	Passphrase     string        `json:"passphrase" mapstructure:"passphrase"`
+	VaultPassFile  string        `json:"vault-pass-file" mapstructure:"vault-pass-file"`
+	VaultIDFile    string        `json:"vault-identity-file" mapstructure:"vault-identity-file"`
+	CacheTTL       time.Duration `json:"cache-ttl" mapstructure:"cache-ttl"`
+	PKCS11         string        `json:"pkcs11-provider" mapstructure:"pkcs11-provider"`
+	KeyPassphrases []string      `json:"key-passphrases" mapstructure:"key-passphrases"`
 }
 
 // NewAuth ...
 func NewAuth() *Auth {
 	return &Auth{
-		User:          "",
-		Password:      "",
-		AskPass:       false,
-		PassFile:      "",
-		IdentityFiles: []string{},
-		Passphrase:    "",
-		VaultPassFile: "",
+		User:           "",
+		Password:       "",
+		AskPass:        false,
+		PassFile:       "",
+		PassCmd:        "",
+		IdentityFiles:  []string{},
+		Passphrase:     "",
+		VaultPassFile:  "",
+		VaultIDFile:    "",
+		CacheTTL:       0,
+		PKCS11:         "",
+		KeyPassphrases: []string{},
 	}
 }
 
@@ -73,12 +91,27 @@ func (a *Auth) AddFlagsTo(fs *pflag.FlagSet) {
 	fs.BoolVarP(&a.AskPass, flagAuthAskPass, "k", a.AskPass, "ask for the password of login user")
 	fs.StringVarP(&a.PassFile, flagAuthPassFile, "a", a.PassFile,
 		`file that holds the password of login user`)
+	fs.StringVarP(&a.PassCmd, flagAuthPassCmd, "", a.PassCmd,
+		`command that outputs the password of login user
+(e.g. 'op read op://vault/item/password')`)
 	fs.StringSliceVarP(&a.IdentityFiles, flagAuthIdentityFiles, "i", nil,
 		"identity files (default $HOME/.ssh/{id_rsa,id_dsa})")
 	fs.StringVarP(&a.Passphrase, flagAuthPassphrase, "K", a.Passphrase,
 		"passphrase of the identity files")
+	fs.StringArrayVarP(&a.KeyPassphrases, flagAuthKeyPass, "", nil,
+		`passphrase of a specific identity file in format 'identity-file=passphrase',
+can be repeated, and identity files not listed use '-K/--auth.passphrase'`)
 	fs.StringVarP(&a.VaultPassFile, flagAuthVaultPassFile, "V", a.VaultPassFile,
 		"file that holds the vault password for encryption and decryption")
+	fs.StringVarP(&a.VaultIDFile, flagAuthVaultIDFile, "", a.VaultIDFile,
+		`age identity file for decrypting the content encrypted by 'vault encrypt --age-recipient',
+and the content of '--gpg-recipient' is decrypted by the keyring of gpg`)
+	fs.DurationVarP(&a.CacheTTL, flagAuthCacheTTL, "", a.CacheTTL,
+		`cache the password entered from terminal prompt for this long(e.g. 10m)
+(encrypted under $HOME/.gossh/cache), 0 means no cache`)
+	fs.StringVarP(&a.PKCS11, flagAuthPKCS11, "", a.PKCS11,
+		`PKCS#11 shared library to load signers from smartcard or token
+(e.g. /usr/lib/x86_64-linux-gnu/opensc-pkcs11.so)`)
 }
 
 // Complete some flags value.
@@ -96,6 +129,12 @@ func (a *Auth) Complete() error {
 	return err
 }
 
+// UserIsSet reports whether the login user is given by flag or configuration file
+// rather than the default $USER.
+func (a *Auth) UserIsSet() bool {
+	return viper.IsSet(flagAuthUser)
+}
+
 // Validate flags.
 func (a *Auth) Validate() (errs []error) {
 	if a.PassFile != "" && !util.FileExists(a.PassFile) {
@@ -106,6 +145,28 @@ func (a *Auth) Validate() (errs []error) {
 		errs = append(errs, fmt.Errorf("invalid %s: %s not found", flagAuthVaultPassFile, a.VaultPassFile))
 	}
 
+	if a.VaultIDFile != "" && !util.FileExists(a.VaultIDFile) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s not found", flagAuthVaultIDFile, a.VaultIDFile))
+	}
+
+	if a.PKCS11 != "" && !util.FileExists(a.PKCS11) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s not found", flagAuthPKCS11, a.PKCS11))
+	}
+
+	for _, v := range a.KeyPassphrases {
+		if !strings.Contains(v, "=") {
+			errs = append(errs, fmt.Errorf(
+				"invalid %s: %s - need format 'identity-file=passphrase'",
+				flagAuthKeyPass,
+				v,
+			))
+		}
+	}
+
+	if a.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %s - must not be negative", flagAuthCacheTTL, a.CacheTTL))
+	}
+
 	return
 }
 
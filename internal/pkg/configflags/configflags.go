@@ -24,8 +24,14 @@ package configflags
 
 import (
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/spf13/pflag"
+
+	"github.com/windvalley/gossh/internal/pkg/aes"
+	"github.com/windvalley/gossh/pkg/batchssh"
 )
 
 // Config instance.
@@ -33,12 +39,18 @@ var Config *ConfigFlags
 
 // ConfigFlags is cli flags that also in config file.
 type ConfigFlags struct {
-	Auth    *Auth    `json:"auth" mapstructure:"auth"`
-	Hosts   *Hosts   `json:"hosts" mapstructure:"hosts"`
-	Run     *Run     `json:"run" mapstructure:"run"`
-	Output  *Output  `json:"output" mapstructure:"output"`
-	Proxy   *Proxy   `json:"proxy" mapstructure:"proxy"`
-	Timeout *Timeout `json:"timeout" mapstructure:"timeout"`
+	Auth      *Auth      `json:"auth" mapstructure:"auth"`
+	Hosts     *Hosts     `json:"hosts" mapstructure:"hosts"`
+	Run       *Run       `json:"run" mapstructure:"run"`
+	Output    *Output    `json:"output" mapstructure:"output"`
+	Proxy     *Proxy     `json:"proxy" mapstructure:"proxy"`
+	Timeout   *Timeout   `json:"timeout" mapstructure:"timeout"`
+	SSH       *SSH       `json:"ssh" mapstructure:"ssh"`
+	Log       *Log       `json:"log" mapstructure:"log"`
+	Transfer  *Transfer  `json:"transfer" mapstructure:"transfer"`
+	Preflight *Preflight `json:"preflight" mapstructure:"preflight"`
+	Notify    *Notify    `json:"notify" mapstructure:"notify"`
+	Debug     *Debug     `json:"debug" mapstructure:"debug"`
 }
 
 // New config flags.
@@ -50,6 +62,13 @@ func New() *ConfigFlags {
 		Output:  NewOutput(),
 		Proxy:   NewProxy(),
 		Timeout: NewTimeout(),
+		SSH:     NewSSH(),
+		Log:     NewLog(),
+
+		Transfer:  NewTransfer(),
+		Preflight: NewPreflight(),
+		Notify:    NewNotify(),
+		Debug:     NewDebug(),
 	}
 }
 
@@ -61,6 +80,12 @@ func (c *ConfigFlags) AddFlagsTo(flags *pflag.FlagSet) {
 	c.Output.AddFlagsTo(flags)
 	c.Proxy.AddFlagsTo(flags)
 	c.Timeout.AddFlagsTo(flags)
+	c.SSH.AddFlagsTo(flags)
+	c.Log.AddFlagsTo(flags)
+	c.Transfer.AddFlagsTo(flags)
+	c.Preflight.AddFlagsTo(flags)
+	c.Notify.AddFlagsTo(flags)
+	c.Debug.AddFlagsTo(flags)
 }
 
 // String ...
@@ -76,13 +101,72 @@ func (c *ConfigFlags) Complete() error {
 		return err
 	}
 
-	if err := c.Proxy.Complete(); err != nil {
-		return err
-	}
+	c.Proxy.Complete(c.Auth)
 
 	return nil
 }
 
+// VaultedValues returns the vaulted values of the string fields by their keys,
+// e.g. 'auth.password' or 'notify.targets[0]', the keys are the json tags of the fields.
+func (c *ConfigFlags) VaultedValues() map[string]string {
+	vaulted := make(map[string]string)
+
+	walkVaultedValues(reflect.ValueOf(c).Elem(), "", func(key string, v reflect.Value) {
+		vaulted[key] = v.String()
+	})
+
+	return vaulted
+}
+
+// DecryptVaultedValues replaces the vaulted values of the string fields by their plain texts,
+// except the keys that skip returns true for, and stops on the first failed one.
+func (c *ConfigFlags) DecryptVaultedValues(
+	decrypt func(cipherText string) (string, error),
+	skip func(key string) bool,
+) (err error) {
+	walkVaultedValues(reflect.ValueOf(c).Elem(), "", func(key string, v reflect.Value) {
+		if err != nil || skip(key) {
+			return
+		}
+
+		plainText, err1 := decrypt(v.String())
+		if err1 != nil {
+			err = fmt.Errorf("decrypt vaulted value of %s failed: %s", key, err1)
+			return
+		}
+
+		v.SetString(plainText)
+	})
+
+	return err
+}
+
+func walkVaultedValues(v reflect.Value, prefix string, fn func(key string, v reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkVaultedValues(v.Elem(), prefix, fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			key := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+
+			walkVaultedValues(v.Field(i), key, fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkVaultedValues(v.Index(i), fmt.Sprintf("%s[%d]", prefix, i), fn)
+		}
+	case reflect.String:
+		if aes.IsCipherText(v.String()) {
+			fn(prefix, v)
+		}
+	}
+}
+
 // Validate ...
 func (c *ConfigFlags) Validate() (errs []error) {
 	errs = append(errs, c.Auth.Validate()...)
@@ -91,6 +175,36 @@ func (c *ConfigFlags) Validate() (errs []error) {
 	errs = append(errs, c.Output.Validate()...)
 	errs = append(errs, c.Timeout.Validate()...)
 	errs = append(errs, c.Proxy.Validate()...)
+	errs = append(errs, c.SSH.Validate()...)
+	errs = append(errs, c.Log.Validate()...)
+	errs = append(errs, c.Transfer.Validate()...)
+	errs = append(errs, c.Preflight.Validate()...)
+	errs = append(errs, c.Notify.Validate()...)
+	errs = append(errs, c.Debug.Validate()...)
+
+	if c.Preflight.Sudo && !c.Run.Sudo {
+		errs = append(errs, fmt.Errorf("%s needs %s", flagPreflightSudo, flagRunSudo))
+	}
+
+	if c.Output.Streams != StreamsMerged && (len(c.Run.Responses) != 0 || c.Run.ResponsesFile != "") {
+		errs = append(errs, fmt.Errorf(
+			"%s %s can not be used with %s/%s that need pty",
+			flagOutputStreams,
+			c.Output.Streams,
+			flagRunResponses,
+			flagRunResponsesFile,
+		))
+	}
+
+	if c.Output.Streams != StreamsMerged && c.Run.Escalate == batchssh.EscalateSu {
+		errs = append(errs, fmt.Errorf(
+			"%s %s can not be used with %s %s that needs pty",
+			flagOutputStreams,
+			c.Output.Streams,
+			flagRunEscalate,
+			c.Run.Escalate,
+		))
+	}
 
 	return
 }
@@ -0,0 +1,69 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configflags
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagDebugPprof = "debug.pprof"
+)
+
+// Debug ...
+type Debug struct {
+	Pprof string `json:"pprof" mapstructure:"pprof"`
+}
+
+// NewDebug ...
+func NewDebug() *Debug {
+	return &Debug{
+		Pprof: "",
+	}
+}
+
+// AddFlagsTo pflagSet.
+func (d *Debug) AddFlagsTo(flags *pflag.FlagSet) {
+	flags.StringVarP(&d.Pprof, flagDebugPprof, "", d.Pprof,
+		`address(e.g. 127.0.0.1:6060) on which pprof(/debug/pprof/) and go runtime metrics
+(/debug/vars) are served while gossh is running, for diagnosing memory/goroutine issues of giant runs`)
+}
+
+// Complete ...
+func (d *Debug) Complete() error {
+	return nil
+}
+
+// Validate ...
+func (d *Debug) Validate() (errs []error) {
+	if d.Pprof != "" {
+		if _, _, err := net.SplitHostPort(d.Pprof); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s - need format 'host:port'", flagDebugPprof, d.Pprof))
+		}
+	}
+
+	return
+}
@@ -24,31 +24,109 @@ package configflags
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 
 	"github.com/windvalley/gossh/pkg/util"
 )
 
 const (
-	flagHostsFile = "hosts.file"
-	flagHostsPort = "hosts.port"
-	flagHostsList = "hosts.list"
+	flagHostsFile   = "hosts.file"
+	flagHostsPort   = "hosts.port"
+	flagHostsList   = "hosts.list"
+	flagHostsLimit  = "hosts.limit"
+	flagHostsFirst  = "hosts.first"
+	flagHostsRandom = "hosts.random"
+	flagHostsTags   = "hosts.tags"
+	flagHostsRegex  = "hosts.regex"
+
+	flagHostsSRV        = "hosts.srv"
+	flagHostsConsul     = "hosts.consul"
+	flagHostsConsulAddr = "hosts.consul-addr"
+
+	flagHostsProvider        = "hosts.provider"
+	flagHostsProviderFilters = "hosts.provider-filters"
+
+	flagHostsCacheTTL = "hosts.cache-ttl"
+	flagHostsRefresh  = "hosts.refresh"
+
+	flagHostsQuarantineFile  = "hosts.quarantine-file"
+	flagHostsSkipQuarantined = "hosts.skip-quarantined"
+
+	flagHostsFactsFile = "hosts.facts-file"
+	flagHostsWhere     = "hosts.where"
+)
+
+// Values of '--hosts.provider'.
+const (
+	ProviderEC2   = "ec2"
+	ProviderGCE   = "gce"
+	ProviderAzure = "azure"
+
+	ProviderPrometheus = "prometheus"
+	ProviderZabbix     = "zabbix"
 )
 
 // Hosts ...
 type Hosts struct {
-	File string `json:"file" mapstructure:"file"`
-	Port int    `json:"port" mapstructure:"port"`
-	List bool   `json:"list" mapstructure:"list"`
+	File   string `json:"file" mapstructure:"file"`
+	Port   int    `json:"port" mapstructure:"port"`
+	List   bool   `json:"list" mapstructure:"list"`
+	Limit  string `json:"limit" mapstructure:"limit"`
+	First  int    `json:"first" mapstructure:"first"`
+	Random int    `json:"random" mapstructure:"random"`
+	Tags   string `json:"tags" mapstructure:"tags"`
+	Regex  string `json:"regex" mapstructure:"regex"`
+
+	SRV        []string `json:"srv" mapstructure:"srv"`
+	Consul     []string `json:"consul" mapstructure:"consul"`
+	ConsulAddr string   `json:"consul-addr" mapstructure:"consul-addr"`
+
+	Provider        string   `json:"provider" mapstructure:"provider"`
+	ProviderFilters []string `json:"provider-filters" mapstructure:"provider-filters"`
+
+	CacheTTL time.Duration `json:"cache-ttl" mapstructure:"cache-ttl"`
+	Refresh  bool          `json:"refresh" mapstructure:"refresh"`
+
+	QuarantineFile  string `json:"quarantine-file" mapstructure:"quarantine-file"`
+	SkipQuarantined bool   `json:"skip-quarantined" mapstructure:"skip-quarantined"`
+
+	FactsFile string   `json:"facts-file" mapstructure:"facts-file"`
+	Where     []string `json:"where" mapstructure:"where"`
 }
 
 // NewHosts ...
 func NewHosts() *Hosts {
 	return &Hosts{
-		File: "",
-		Port: 22,
-		List: false,
+		File:   "",
+		Port:   22,
+		List:   false,
+		Limit:  "",
+		First:  0,
+		Random: 0,
+		Tags:   "",
+		Regex:  "",
+
+		SRV:        []string{},
+		Consul:     []string{},
+		ConsulAddr: "",
+
+		Provider:        "",
+		ProviderFilters: []string{},
+
+		CacheTTL: 0,
+		Refresh:  false,
+
+		QuarantineFile:  "",
+		SkipQuarantined: false,
+
+		FactsFile: "",
+		Where:     []string{},
 	}
 }
 
@@ -59,7 +137,8 @@ func (h *Hosts) AddFlagsTo(fs *pflag.FlagSet) {
 		flagHostsFile,
 		"H",
 		h.File,
-		`file that holds the target hosts (one host/pattern per line)`,
+		`file that holds the target hosts (one [user@]host/pattern per line,
+optionally followed by annotations like 'tags=prod,web' or 'jump=[user@]bastion[:port]')`,
 	)
 	fs.IntVarP(
 		&h.Port,
@@ -75,6 +154,140 @@ func (h *Hosts) AddFlagsTo(fs *pflag.FlagSet) {
 		h.List,
 		"outputs a list of target hosts, and does not do anything else",
 	)
+	fs.StringVarP(
+		&h.Limit,
+		flagHostsLimit,
+		"",
+		h.Limit,
+		`only keep target hosts that match this host pattern
+(e.g. 'web[01:10]' or 'web*.bar.com')`,
+	)
+	fs.IntVarP(
+		&h.First,
+		flagHostsFirst,
+		"",
+		h.First,
+		"only keep the first N target hosts",
+	)
+	fs.IntVarP(
+		&h.Random,
+		flagHostsRandom,
+		"",
+		h.Random,
+		"only keep N randomly selected target hosts",
+	)
+	fs.StringVarP(
+		&h.Tags,
+		flagHostsTags,
+		"",
+		h.Tags,
+		`only keep target hosts of hosts file or consul that have these tags,
+',' means OR and '+' means AND, e.g. 'prod+web,db' for hosts
+tagged both prod and web, or tagged db`,
+	)
+	fs.StringVarP(
+		&h.Regex,
+		flagHostsRegex,
+		"",
+		h.Regex,
+		`only keep target hosts that match this regular expression
+(e.g. '^web-\d+\.eu\.')`,
+	)
+	fs.StringSliceVarP(
+		&h.SRV,
+		flagHostsSRV,
+		"",
+		h.SRV,
+		`discover target hosts and their ports from DNS SRV records,
+e.g. '_ssh._tcp.web.example.com'`,
+	)
+	fs.StringSliceVarP(
+		&h.Consul,
+		flagHostsConsul,
+		"",
+		h.Consul,
+		`discover target hosts from the nodes of Consul catalog services,
+in format 'service[@datacenter]', and the service tags are the tags
+of the hosts for '--hosts.tags'`,
+	)
+	fs.StringVarP(
+		&h.ConsulAddr,
+		flagHostsConsulAddr,
+		"",
+		h.ConsulAddr,
+		`address of Consul HTTP API (default $CONSUL_HTTP_ADDR or http://127.0.0.1:8500),
+the ACL token is read from $CONSUL_HTTP_TOKEN`,
+	)
+	fs.StringVarP(
+		&h.Provider,
+		flagHostsProvider,
+		"",
+		h.Provider,
+		`get target hosts from the running instances of a cloud by its cli,
+or the hosts of a monitoring system, available values: 'ec2' by aws,
+'gce' by gcloud, 'azure' by az, 'prometheus' for the active targets,
+'zabbix' for the monitored hosts by API token of $ZABBIX_API_TOKEN`,
+	)
+	fs.StringSliceVarP(
+		&h.ProviderFilters,
+		flagHostsProviderFilters,
+		"",
+		h.ProviderFilters,
+		`filters 'key=value' of '--hosts.provider', and 'address=public' connects public ips
+rather than private ips, available keys:
+ec2: region, profile, tag.KEY (e.g. tag.role=web)
+gce: project, zone, label.KEY (e.g. label.role=web)
+azure: subscription, resource-group, tag.KEY (e.g. tag.role=web)
+prometheus: url, job, health (up or any), label.KEY (e.g. label.role=web)
+zabbix: url (of api_jsonrpc.php), group (host groups joined by '|')`,
+	)
+	fs.DurationVarP(
+		&h.CacheTTL,
+		flagHostsCacheTTL,
+		"",
+		h.CacheTTL,
+		`cache the hosts discovered by '--hosts.srv', '--hosts.consul' and '--hosts.provider'
+for this long (e.g. 10m), and the expired cache is still used if the sources
+are unavailable, 0 means disabled`,
+	)
+	fs.BoolVarP(
+		&h.Refresh,
+		flagHostsRefresh,
+		"",
+		h.Refresh,
+		"query the sources of discovered hosts again rather than using the cache",
+	)
+	fs.StringVarP(
+		&h.QuarantineFile,
+		flagHostsQuarantineFile,
+		"",
+		h.QuarantineFile,
+		`file that records the target hosts failed in their last runs, and the
+hosts are removed from it once they succeed, see 'gossh quarantine'`,
+	)
+	fs.BoolVarP(
+		&h.SkipQuarantined,
+		flagHostsSkipQuarantined,
+		"",
+		h.SkipQuarantined,
+		"do not run on the target hosts recorded by '--hosts.quarantine-file'",
+	)
+	fs.StringVarP(
+		&h.FactsFile,
+		flagHostsFactsFile,
+		"",
+		h.FactsFile,
+		`facts document written by 'gossh facts', of which the facts are loaded as
+the variables 'facts_*' of the hosts(e.g. facts_os, facts_arch, facts_cpus)`,
+	)
+	fs.StringSliceVarP(
+		&h.Where,
+		flagHostsWhere,
+		"",
+		h.Where,
+		`keep the hosts of which the variables match all the conditions 'key=pattern',
+the pattern can contain shell wildcards(e.g. facts_os=Ubuntu*,facts_arch=x86_64)`,
+	)
 }
 
 // Complete ...
@@ -82,6 +295,45 @@ func (h *Hosts) Complete() error {
 	return nil
 }
 
+// SplitTags splits '--hosts.tags' value into alternatives, each of which
+// holds the tags that are all required.
+func SplitTags(tags string) [][]string {
+	var alternatives [][]string
+	for _, alternative := range strings.Split(tags, ",") {
+		required := strings.Split(alternative, "+")
+		for i := range required {
+			required[i] = strings.TrimSpace(required[i])
+		}
+
+		alternatives = append(alternatives, required)
+	}
+
+	return alternatives
+}
+
+// ParseWhere parses the conditions 'key=pattern' of '--hosts.where'.
+func ParseWhere(conditions []string) map[string]string {
+	return ParseProviderFilters(conditions)
+}
+
+// ParseProviderFilters parses the filters 'key=value' of '--hosts.provider-filters'.
+func ParseProviderFilters(filters []string) map[string]string {
+	parsed := make(map[string]string)
+	for _, filter := range filters {
+		if i := strings.Index(filter, "="); i > 0 {
+			parsed[strings.TrimSpace(filter[:i])] = strings.TrimSpace(filter[i+1:])
+		}
+	}
+
+	return parsed
+}
+
+// PortIsSet reports whether the port is given by flag or configuration file
+// rather than the default 22.
+func (h *Hosts) PortIsSet() bool {
+	return viper.IsSet(flagHostsPort)
+}
+
 // Validate ...
 func (h *Hosts) Validate() (errs []error) {
 	if h.Port < 1 || h.Port > 65535 {
@@ -96,5 +348,86 @@ func (h *Hosts) Validate() (errs []error) {
 		errs = append(errs, fmt.Errorf("invalid %s: %s not found", flagHostsFile, h.File))
 	}
 
+	if h.First < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagHostsFirst, h.First))
+	}
+
+	if h.Random < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagHostsRandom, h.Random))
+	}
+
+	if h.Tags != "" {
+		for _, tags := range SplitTags(h.Tags) {
+			if util.ContainsStr(tags, "") {
+				errs = append(errs, fmt.Errorf("invalid %s: %s - empty tag", flagHostsTags, h.Tags))
+				break
+			}
+		}
+	}
+
+	if h.Regex != "" {
+		if _, err := regexp.Compile(h.Regex); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s - %s", flagHostsRegex, h.Regex, err))
+		}
+	}
+
+	switch h.Provider {
+	case "", ProviderEC2, ProviderGCE, ProviderAzure, ProviderPrometheus, ProviderZabbix:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s, %s, %s, %s",
+			flagHostsProvider,
+			h.Provider,
+			ProviderEC2,
+			ProviderGCE,
+			ProviderAzure,
+			ProviderPrometheus,
+			ProviderZabbix,
+		))
+	}
+
+	for _, filter := range h.ProviderFilters {
+		if strings.Index(filter, "=") <= 0 {
+			errs = append(errs, fmt.Errorf(
+				"invalid %s: %s - need format 'key=value'",
+				flagHostsProviderFilters,
+				filter,
+			))
+		}
+	}
+
+	if address := ParseProviderFilters(h.ProviderFilters)["address"]; address != "" &&
+		address != "private" && address != "public" {
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: address=%s - available values: private, public",
+			flagHostsProviderFilters,
+			address,
+		))
+	}
+
+	if h.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %s - must not be negative", flagHostsCacheTTL, h.CacheTTL))
+	}
+
+	if h.SkipQuarantined && h.QuarantineFile == "" {
+		errs = append(errs, fmt.Errorf("%s needs %s", flagHostsSkipQuarantined, flagHostsQuarantineFile))
+	}
+
+	for _, condition := range h.Where {
+		if i := strings.Index(condition, "="); i <= 0 {
+			errs = append(errs, fmt.Errorf(
+				"invalid %s: %s - need format 'key=pattern'",
+				flagHostsWhere,
+				condition,
+			))
+		} else if _, err := path.Match(condition[i+1:], ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s - %s", flagHostsWhere, condition, err))
+		}
+	}
+
+	if h.First > 0 && h.Random > 0 {
+		errs = append(errs, fmt.Errorf("%s and %s can not be used together", flagHostsFirst, flagHostsRandom))
+	}
+
 	return
 }
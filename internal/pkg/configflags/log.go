@@ -0,0 +1,93 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configflags
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagLogSyslog         = "log.syslog"
+	flagLogSyslogFacility = "log.syslog-facility"
+	flagLogMaxSize        = "log.max-size"
+	flagLogMaxBackups     = "log.max-backups"
+	flagLogMaxAge         = "log.max-age"
+)
+
+// Log ...
+type Log struct {
+	Syslog         bool   `json:"syslog" mapstructure:"syslog"`
+	SyslogFacility string `json:"syslog-facility" mapstructure:"syslog-facility"`
+	MaxSize        int    `json:"max-size" mapstructure:"max-size"`
+	MaxBackups     int    `json:"max-backups" mapstructure:"max-backups"`
+	MaxAge         int    `json:"max-age" mapstructure:"max-age"`
+}
+
+// NewLog ...
+func NewLog() *Log {
+	return &Log{
+		Syslog:         false,
+		SyslogFacility: "user",
+		MaxSize:        0,
+		MaxBackups:     0,
+		MaxAge:         0,
+	}
+}
+
+// AddFlagsTo pflagSet.
+func (l *Log) AddFlagsTo(flags *pflag.FlagSet) {
+	flags.BoolVarP(&l.Syslog, flagLogSyslog, "", l.Syslog,
+		"also send logs and audit events to the local syslog/journald")
+	flags.StringVarP(&l.SyslogFacility, flagLogSyslogFacility, "", l.SyslogFacility,
+		"syslog facility, e.g. user, auth, authpriv, local0-local7")
+	flags.IntVarP(&l.MaxSize, flagLogMaxSize, "", l.MaxSize,
+		"rotate '-o/--output.file' when it reaches this size in megabytes, 0 means no rotation")
+	flags.IntVarP(&l.MaxBackups, flagLogMaxBackups, "", l.MaxBackups,
+		"max number of rotated files to keep, 0 means no limit")
+	flags.IntVarP(&l.MaxAge, flagLogMaxAge, "", l.MaxAge,
+		"max days to keep rotated files, 0 means no limit")
+}
+
+// Complete ...
+func (l *Log) Complete() error {
+	return nil
+}
+
+// Validate ...
+func (l *Log) Validate() (errs []error) {
+	if l.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagLogMaxSize, l.MaxSize))
+	}
+
+	if l.MaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagLogMaxBackups, l.MaxBackups))
+	}
+
+	if l.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagLogMaxAge, l.MaxAge))
+	}
+
+	return
+}
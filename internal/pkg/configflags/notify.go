@@ -0,0 +1,163 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configflags
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+const (
+	flagNotifyTargets     = "notify.targets"
+	flagNotifyWhen        = "notify.when"
+	flagNotifyFailedHosts = "notify.failed-hosts"
+)
+
+// Conditions of '--notify.when'.
+const (
+	NotifyWhenAlways    = "always"
+	NotifyWhenFailure   = "failure"
+	NotifyWhenThreshold = "threshold"
+)
+
+var (
+	pagerDutySeverities = []string{"critical", "error", "warning", "info"}
+	opsgeniePriorities  = []string{"P1", "P2", "P3", "P4", "P5"}
+)
+
+// Notify ...
+type Notify struct {
+	Targets     []string `json:"targets" mapstructure:"targets"`
+	When        string   `json:"when" mapstructure:"when"`
+	FailedHosts bool     `json:"failed-hosts" mapstructure:"failed-hosts"`
+}
+
+// NewNotify ...
+func NewNotify() *Notify {
+	return &Notify{
+		Targets:     []string{},
+		When:        NotifyWhenFailure,
+		FailedHosts: false,
+	}
+}
+
+// AddFlagsTo pflagSet.
+func (n *Notify) AddFlagsTo(flags *pflag.FlagSet) {
+	flags.StringSliceVarP(&n.Targets, flagNotifyTargets, "", n.Targets,
+		`targets to which the task summary is posted when the task completes, available targets:
+'slack://hooks.slack.com/services/...' for slack incoming webhook,
+'teams://xxx.webhook.office.com/...' for microsoft teams incoming webhook,
+'smtp://[user:pass@]host:port?from=gossh@bar.com&to=ops@bar.com' for email,
+'pagerduty://ROUTING_KEY[?severity=critical]' for pagerduty alert(Events API v2),
+'opsgenie://API_KEY[?priority=P1&host=api.eu.opsgenie.com]' for opsgenie alert,
+alerts of the same task are grouped into one incident, e.g. of the runs scheduled by cron`)
+	flags.StringVarP(&n.When, flagNotifyWhen, "", n.When,
+		fmt.Sprintf(
+			`when to notify, available values:
+%s: every time the task completes
+%s: any target host failed
+%s: failed hosts exceed '--run.failure-threshold'`,
+			NotifyWhenAlways,
+			NotifyWhenFailure,
+			NotifyWhenThreshold,
+		),
+	)
+	flags.BoolVarP(&n.FailedHosts, flagNotifyFailedHosts, "", n.FailedHosts,
+		"also post the failed hosts and their errors in the notifications")
+}
+
+// Complete ...
+func (n *Notify) Complete() error {
+	return nil
+}
+
+// Validate ...
+func (n *Notify) Validate() (errs []error) {
+	switch n.When {
+	case NotifyWhenAlways, NotifyWhenFailure, NotifyWhenThreshold:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s, %s",
+			flagNotifyWhen,
+			n.When,
+			NotifyWhenAlways,
+			NotifyWhenFailure,
+			NotifyWhenThreshold,
+		))
+	}
+
+	for _, target := range n.Targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s", flagNotifyTargets, err))
+			continue
+		}
+
+		switch strings.ToLower(u.Scheme) {
+		case "slack", "teams":
+		case "pagerduty", "opsgenie":
+			if u.Host == "" {
+				errs = append(errs, fmt.Errorf(
+					"invalid %s: %s - %s target needs the routing key or api key as host",
+					flagNotifyTargets,
+					u.Redacted(),
+					u.Scheme,
+				))
+			}
+
+			severity, priority := u.Query().Get("severity"), u.Query().Get("priority")
+			if (severity != "" && !util.ContainsStr(pagerDutySeverities, severity)) ||
+				(priority != "" && !util.ContainsStr(opsgeniePriorities, priority)) {
+				errs = append(errs, fmt.Errorf(
+					"invalid %s: %s - severity must be one of %s, priority must be one of %s",
+					flagNotifyTargets,
+					u.Redacted(),
+					strings.Join(pagerDutySeverities, ", "),
+					strings.Join(opsgeniePriorities, ", "),
+				))
+			}
+		case "smtp":
+			if u.Query().Get("from") == "" || u.Query().Get("to") == "" {
+				errs = append(errs, fmt.Errorf(
+					"invalid %s: %s - smtp target needs parameters 'from' and 'to'",
+					flagNotifyTargets,
+					u.Redacted(),
+				))
+			}
+		default:
+			errs = append(errs, fmt.Errorf(
+				"invalid %s: %s - unsupported scheme '%s'",
+				flagNotifyTargets,
+				u.Redacted(),
+				u.Scheme,
+			))
+		}
+	}
+
+	return
+}
@@ -22,33 +22,81 @@ THE SOFTWARE.
 
 package configflags
 
-import "github.com/spf13/pflag"
+import (
+	"fmt"
+	"os"
 
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+const (
+	flagOutputFile      = "output.file"
+	flagOutputJSON      = "output.json"
+	flagOutputCondense  = "output.condense"
+	flagOutputQuite     = "output.quiet"
+	flagOutputVerbose   = "output.verbose"
+	flagOutputSinks     = "output.sinks"
+	flagOutputTimings   = "output.timings"
+	flagOutputSummary   = "output.summary"
+	flagOutputMaxSize   = "output.max-size"
+	flagOutputStreams   = "output.streams"
+	flagOutputRecord    = "output.record"
+	flagOutputColor     = "output.color"
+	flagOutputOneline   = "output.oneline"
+	flagOutputAnonymize = "output.anonymize"
+)
+
+// Values of '--output.streams'.
 const (
-	flagOutputFile     = "output.file"
-	flagOutputJSON     = "output.json"
-	flagOutputCondense = "output.condense"
-	flagOutputQuite    = "output.quiet"
-	flagOutputVerbose  = "output.verbose"
+	StreamsMerged   = "merged"
+	StreamsSeparate = "separate"
+	StreamsStdout   = "stdout"
+	StreamsStderr   = "stderr"
+)
+
+// Values of '--output.color'.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
 )
 
 // Output ...
 type Output struct {
-	File     string `json:"file" mapstructure:"file"`
-	JSON     bool   `json:"json" mapstructure:"json"`
-	Condense bool   `json:"condense" mapstructure:"condense"`
-	Quiet    bool   `json:"quiet" mapstructure:"quiet"`
-	Verbose  bool   `json:"verbose" mapstructure:"verbose"`
+	File      string   `json:"file" mapstructure:"file"`
+	JSON      bool     `json:"json" mapstructure:"json"`
+	Condense  bool     `json:"condense" mapstructure:"condense"`
+	Quiet     bool     `json:"quiet" mapstructure:"quiet"`
+	Verbose   bool     `json:"verbose" mapstructure:"verbose"`
+	Sinks     []string `json:"sinks" mapstructure:"sinks"`
+	Timings   bool     `json:"timings" mapstructure:"timings"`
+	Summary   string   `json:"summary" mapstructure:"summary"`
+	MaxSize   int      `json:"max-size" mapstructure:"max-size"`
+	Streams   string   `json:"streams" mapstructure:"streams"`
+	Record    string   `json:"record" mapstructure:"record"`
+	Color     string   `json:"color" mapstructure:"color"`
+	Oneline   bool     `json:"oneline" mapstructure:"oneline"`
+	Anonymize bool     `json:"anonymize" mapstructure:"anonymize"`
 }
 
 // NewOutput ...
 func NewOutput() *Output {
 	return &Output{
-		File:     "",
-		JSON:     false,
-		Condense: false,
-		Quiet:    false,
-		Verbose:  false,
+		File:      "",
+		JSON:      false,
+		Condense:  false,
+		Quiet:     false,
+		Verbose:   false,
+		Sinks:     []string{},
+		Timings:   false,
+		Summary:   "",
+		MaxSize:   0,
+		Streams:   StreamsMerged,
+		Record:    "",
+		Color:     ColorAuto,
+		Oneline:   false,
+		Anonymize: false,
 	}
 }
 
@@ -57,9 +105,39 @@ func (o *Output) AddFlagsTo(flags *pflag.FlagSet) {
 	flags.StringVarP(&o.File, flagOutputFile, "o", o.File, "file to which messages are output")
 	flags.BoolVarP(&o.JSON, flagOutputJSON, "j", o.JSON, "output messages in json format")
 	flags.BoolVarP(&o.Condense, flagOutputCondense, "C", o.Condense, "condense output and disable color")
+	flags.BoolVarP(&o.Oneline, flagOutputOneline, "", o.Oneline,
+		`output exactly one line 'host status exit-code first-line-of-output' for each target host
+to stdout(exit-code is '-' if commands did not exit), and the other messages to stderr, e.g. for awk/grep`)
+	flags.BoolVarP(&o.Anonymize, flagOutputAnonymize, "", o.Anonymize,
+		`replace hostnames and IPs in results and summaries with stable pseudonyms(e.g. 'host-1a2b3c4d5e'),
+so that they can be shared externally without leaking infrastructure details`)
 	flags.BoolVarP(&o.Quiet, flagOutputQuite, "q", o.Quiet,
 		"do not output messages to screen (except error messages)")
 	flags.BoolVarP(&o.Verbose, flagOutputVerbose, "v", o.Verbose, "show debug messages")
+	flags.BoolVarP(&o.Timings, flagOutputTimings, "", o.Timings,
+		"add per-host phase timings(dns, dial, auth, exec, transfer) to json results")
+	flags.StringVarP(&o.Summary, flagOutputSummary, "", o.Summary,
+		"file to which a machine-readable json summary(task ID, start/end time, counts, per-host status) is written")
+	flags.IntVarP(&o.MaxSize, flagOutputMaxSize, "", o.MaxSize,
+		"max kilobytes of output kept for each target host, the rest is truncated, 0 means no limit")
+	flags.StringVarP(&o.Streams, flagOutputStreams, "", o.Streams,
+		`how to output stdout and stderr of commands/script, available values:
+'merged' for both in 'output' like on a terminal, 'separate' for stderr in its own field 'stderr',
+'stdout' for only stdout, 'stderr' for only stderr,
+values except 'merged' execute commands/script without pty`)
+	flags.StringVarP(&o.Record, flagOutputRecord, "", o.Record,
+		`directory in which the session output of each target host is recorded to
+'<task ID>/<host>.cast' in asciicast v2 format, replay it by 'asciinema play' or 'gossh replay'`)
+	flags.StringVarP(&o.Color, flagOutputColor, "", o.Color,
+		`when to output colorfully, available values: 'auto' for only if stdout is a terminal
+and $NO_COLOR is not set, 'always', 'never', and output that is not colorful is plain text
+free of ANSI escape sequences and control characters, e.g. from the outputs of target hosts`)
+	flags.StringSliceVarP(&o.Sinks, flagOutputSinks, "", o.Sinks,
+		`additional sinks to which results are output besides screen, available sinks:
+'file:///path/to/results.json' for json lines file, 'http(s)://host/path' for webhook,
+'kafka(s)://rest-proxy:8082/topic' for kafka topic through the REST Proxy,
+'nats://[user:pass@]server:4222/subject' for nats subject,
+'otlp(s)://otel-collector:4318' for OpenTelemetry spans of the task and each host by OTLP/HTTP`)
 }
 
 // Complete ...
@@ -69,5 +147,57 @@ func (o *Output) Complete() error {
 
 // Validate ...
 func (o *Output) Validate() (errs []error) {
+	if o.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagOutputMaxSize, o.MaxSize))
+	}
+
+	switch o.Streams {
+	case StreamsMerged, StreamsSeparate, StreamsStdout, StreamsStderr:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s, %s, %s",
+			flagOutputStreams,
+			o.Streams,
+			StreamsMerged,
+			StreamsSeparate,
+			StreamsStdout,
+			StreamsStderr,
+		))
+	}
+
+	if o.Oneline && o.JSON {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s", flagOutputOneline, flagOutputJSON))
+	}
+
+	if o.Oneline && o.Condense {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s", flagOutputOneline, flagOutputCondense))
+	}
+
+	switch o.Color {
+	case ColorAuto, ColorAlways, ColorNever:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s, %s",
+			flagOutputColor,
+			o.Color,
+			ColorAuto,
+			ColorAlways,
+			ColorNever,
+		))
+	}
+
 	return
 }
+
+// Colorful reports whether to output colorfully by '--output.color', otherwise
+// the output is plain text for redirected logs and CI systems.
+func (o *Output) Colorful() bool {
+	switch o.Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	return os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && term.IsTerminal(int(os.Stdout.Fd()))
+}
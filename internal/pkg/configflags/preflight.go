@@ -0,0 +1,61 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configflags
+
+import (
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagPreflightSudo = "preflight.sudo"
+)
+
+// Preflight ...
+type Preflight struct {
+	Sudo bool `json:"sudo" mapstructure:"sudo"`
+}
+
+// NewPreflight ...
+func NewPreflight() *Preflight {
+	return &Preflight{
+		Sudo: false,
+	}
+}
+
+// AddFlagsTo pflagSet.
+func (p *Preflight) AddFlagsTo(flags *pflag.FlagSet) {
+	flags.BoolVarP(&p.Sudo, flagPreflightSudo, "", p.Sudo,
+		`check sudo by 'sudo -n -l' on all target hosts before the task, and the task
+is not run if sudo will fail on any of them(wrong password, not in sudoers,
+requiretty), it needs '--run.sudo'`)
+}
+
+// Complete ...
+func (p *Preflight) Complete() error {
+	return nil
+}
+
+// Validate ...
+func (p *Preflight) Validate() (errs []error) {
+	return
+}
@@ -23,10 +23,13 @@ THE SOFTWARE.
 package configflags
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
 
 	"github.com/spf13/pflag"
-	"github.com/spf13/viper"
 )
 
 const (
@@ -36,6 +39,8 @@ const (
 	flagProxyPassword      = "proxy.password"
 	flagProxyIdentityFiles = "proxy.identity-files"
 	flagProxyPassphrase    = "proxy.passphrase"
+	flagProxyHTTP          = "proxy.http"
+	flagProxyMaxSessions   = "proxy.max-sessions"
 )
 
 // Proxy config.
@@ -46,6 +51,8 @@ type Proxy struct {
 	Password      string   `json:"password" mapstructure:"password"`
 	IdentityFiles []string `json:"identity-files" mapstructure:"identity-files"`
 	Passphrase    string   `json:"passphrase" mapstructure:"passphrase"`
+	HTTP          string   `json:"http" mapstructure:"http"`
+	MaxSessions   int      `json:"max-sessions" mapstructure:"max-sessions"`
 }
 
 // NewProxy ...
@@ -57,12 +64,18 @@ func NewProxy() *Proxy {
 		Password:      "",
 		IdentityFiles: []string{},
 		Passphrase:    "",
+		HTTP:          "",
+		MaxSessions:   0,
 	}
 }
 
 // AddFlagsTo pflagSet.
 func (p *Proxy) AddFlagsTo(fs *pflag.FlagSet) {
-	fs.StringVarP(&p.Server, flagProxyServer, "X", p.Server, "proxy server address")
+	fs.StringVarP(&p.Server, flagProxyServer, "X", p.Server,
+		`proxy server address, connections to all target hosts are multiplexed
+as channels of a single ssh connection to it, or comma-separated addresses
+(e.g. bastion1,bastion2:2222) across which target hosts are distributed in turn,
+with health checks and failover to the next one if one is unreachable`)
 	fs.IntVarP(&p.Port, flagProxyPort, "", p.Port, "proxy server port")
 	fs.StringVarP(&p.User, flagProxyUser, "", p.User,
 		"login user for proxy (default same as 'auth.user')")
@@ -73,44 +86,87 @@ func (p *Proxy) AddFlagsTo(fs *pflag.FlagSet) {
 	fs.StringVarP(&p.Passphrase, flagProxyPassphrase, "", p.Passphrase,
 		`passphrase of the identity files for proxy
 (default same as 'auth.passphrase')`)
+	fs.StringVarP(&p.HTTP, flagProxyHTTP, "", p.HTTP,
+		`http proxy '[user:password@]host:port' through which ssh connections
+to target hosts and proxy server are tunneled by the CONNECT method`)
+	fs.IntVarP(&p.MaxSessions, flagProxyMaxSessions, "", p.MaxSessions,
+		`max concurrent sessions to target hosts through each proxy server, including
+the jump hosts of ssh config, and the other target hosts wait in queue, e.g. 10 for
+the default MaxSessions of OpenSSH servers, 0 means no limit`)
 }
 
-// Complete some flags value.
-func (p *Proxy) Complete() error {
-	var err error
-
+// Complete the login user and credentials of the proxy by those of the target hosts.
+func (p *Proxy) Complete(auth *Auth) {
 	if p.Server != "" {
 		if p.User == "" {
-			user := viper.GetString("auth.user")
-			if user == "" {
-				p.User = os.Getenv("USER")
-			} else {
-				p.User = user
-			}
+			p.User = auth.User
 		}
 
 		if p.Password == "" {
-			p.Password = viper.GetString("auth.password")
+			p.Password = auth.Password
 		}
 
 		if len(p.IdentityFiles) == 0 {
-			authIdentityFiles := viper.GetStringSlice("auth.identity-files")
-			if len(authIdentityFiles) == 0 {
-				p.IdentityFiles, err = getDefaultIdentityFiles()
-			} else {
-				p.IdentityFiles = authIdentityFiles
-			}
+			p.IdentityFiles = auth.IdentityFiles
 		}
 
 		if p.Passphrase == "" {
-			p.Passphrase = viper.GetString("auth.passphrase")
+			p.Passphrase = auth.Passphrase
+		}
+	}
+}
+
+// Servers returns the addresses of '--proxy.server'.
+func (p *Proxy) Servers() []string {
+	var servers []string
+
+	for _, v := range strings.Split(p.Server, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			servers = append(servers, v)
 		}
 	}
 
-	return err
+	return servers
 }
 
 // Validate flags.
 func (p *Proxy) Validate() (errs []error) {
+	if p.MaxSessions < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagProxyMaxSessions, p.MaxSessions))
+	}
+
+	if p.HTTP != "" {
+		if _, _, _, err := ParseHTTPProxy(p.HTTP); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s - %s", flagProxyHTTP, p.HTTP, err))
+		}
+	}
+
 	return
 }
+
+// ParseHTTPProxy parses '[http://][user:password@]host:port' into its address and basic auth.
+func ParseHTTPProxy(proxy string) (addr, user, password string, err error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if u.Scheme != "http" {
+		return "", "", "", fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+
+	if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+		return "", "", "", errors.New("must be in format '[user:password@]host:port'")
+	}
+
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	return u.Host, user, password, nil
+}
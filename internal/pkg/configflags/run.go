@@ -24,15 +24,71 @@ package configflags
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/pflag"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+const (
+	flagRunSudo             = "run.sudo"
+	flagRunAsUser           = "run.as-user"
+	flagRunLang             = "run.lang"
+	flagRunNoLang           = "run.no-lang"
+	flagRunConcurrency      = "run.concurrency"
+	flagRunConnectRate      = "run.connect-rate"
+	flagRunExitCode         = "run.exit-code"
+	flagRunFailureThreshold = "run.failure-threshold"
+	flagRunRaw              = "run.raw"
+	flagRunPty              = "run.pty"
+	flagRunTerm             = "run.term"
+	flagRunPtyWidth         = "run.pty-width"
+	flagRunPtyHeight        = "run.pty-height"
+	flagRunDetach           = "run.detach"
+	flagRunOutputRemote     = "run.output-remote"
+	flagRunResponses        = "run.responses"
+	flagRunResponsesFile    = "run.responses-file"
+	flagRunPreserveEnv      = "run.preserve-env"
+	flagRunPreserveEnvVars  = "run.preserve-env-vars"
+	flagRunSetHome          = "run.set-home"
+	flagRunSudoWrapper      = "run.sudo-wrapper"
+	flagRunEscalate         = "run.escalate"
+	flagRunSuPassword       = "run.su-password"
+	flagRunTmpDir           = "run.tmp-dir"
+	flagRunWorkDir          = "run.workdir"
+	flagRunUmask            = "run.umask"
+	flagRunTmpSweep         = "run.tmp-sweep"
+	flagRunLocalBefore      = "run.local-before"
+	flagRunLocalAfter       = "run.local-after"
+	flagRunSpreadBy         = "run.spread-by"
+	flagRunSpreadMax        = "run.spread-max"
+	flagRunConfirm          = "run.confirm"
+	flagRunConfirmOver      = "run.confirm-over"
+	flagRunPolicyFile       = "run.policy-file"
+	flagRunLock             = "run.lock"
+	flagRunLockDir          = "run.lock-dir"
+	flagRunRespectWindows   = "run.respect-windows"
+	flagRunWindowAction     = "run.window-action"
+	flagRunOverrideWindows  = "run.override-windows"
+)
+
+// Policies of '--run.exit-code'.
+const (
+	ExitCodeAny       = "any"
+	ExitCodeThreshold = "threshold"
+	ExitCodeNever     = "never"
 )
 
+// Actions of '--run.window-action' on the target hosts outside their maintenance windows.
 const (
-	flagRunSudo        = "run.sudo"
-	flagRunAsUser      = "run.as-user"
-	flagRunLang        = "run.lang"
-	flagRunConcurrency = "run.concurrency"
+	WindowActionRefuse = "refuse"
+	WindowActionSkip   = "skip"
+	WindowActionWait   = "wait"
 )
 
 // Run ...
@@ -40,7 +96,56 @@ type Run struct {
 	Sudo        bool   `json:"sudo" mapstructure:"sudo"`
 	AsUser      string `json:"as-user" mapstructure:"as-user"`
 	Lang        string `json:"lang" mapstructure:"lang"`
+	NoLang      bool   `json:"no-lang" mapstructure:"no-lang"`
 	Concurrency int    `json:"concurrency" mapstructure:"concurrency"`
+	ConnectRate string `json:"connect-rate" mapstructure:"connect-rate"`
+
+	ExitCode         string `json:"exit-code" mapstructure:"exit-code"`
+	FailureThreshold string `json:"failure-threshold" mapstructure:"failure-threshold"`
+
+	Raw    bool `json:"raw" mapstructure:"raw"`
+	Detach bool `json:"detach" mapstructure:"detach"`
+
+	Pty       bool   `json:"pty" mapstructure:"pty"`
+	Term      string `json:"term" mapstructure:"term"`
+	PtyWidth  int    `json:"pty-width" mapstructure:"pty-width"`
+	PtyHeight int    `json:"pty-height" mapstructure:"pty-height"`
+
+	OutputRemote string `json:"output-remote" mapstructure:"output-remote"`
+
+	Responses     []string `json:"responses" mapstructure:"responses"`
+	ResponsesFile string   `json:"responses-file" mapstructure:"responses-file"`
+
+	PreserveEnv     bool     `json:"preserve-env" mapstructure:"preserve-env"`
+	PreserveEnvVars []string `json:"preserve-env-vars" mapstructure:"preserve-env-vars"`
+	SetHome         bool     `json:"set-home" mapstructure:"set-home"`
+	SudoWrapper     string   `json:"sudo-wrapper" mapstructure:"sudo-wrapper"`
+	Escalate        string   `json:"escalate" mapstructure:"escalate"`
+	SuPassword      string   `json:"su-password" mapstructure:"su-password"`
+
+	TmpDir   string `json:"tmp-dir" mapstructure:"tmp-dir"`
+	TmpSweep bool   `json:"tmp-sweep" mapstructure:"tmp-sweep"`
+
+	WorkDir string `json:"workdir" mapstructure:"workdir"`
+	Umask   string `json:"umask" mapstructure:"umask"`
+
+	LocalBefore string `json:"local-before" mapstructure:"local-before"`
+	LocalAfter  string `json:"local-after" mapstructure:"local-after"`
+
+	SpreadBy  string `json:"spread-by" mapstructure:"spread-by"`
+	SpreadMax int    `json:"spread-max" mapstructure:"spread-max"`
+
+	Confirm     bool `json:"confirm" mapstructure:"confirm"`
+	ConfirmOver int  `json:"confirm-over" mapstructure:"confirm-over"`
+
+	PolicyFile string `json:"policy-file" mapstructure:"policy-file"`
+
+	Lock    string `json:"lock" mapstructure:"lock"`
+	LockDir string `json:"lock-dir" mapstructure:"lock-dir"`
+
+	RespectWindows  bool   `json:"respect-windows" mapstructure:"respect-windows"`
+	WindowAction    string `json:"window-action" mapstructure:"window-action"`
+	OverrideWindows string `json:"override-windows" mapstructure:"override-windows"`
 }
 
 // NewRun ...
@@ -48,7 +153,53 @@ func NewRun() *Run {
 	return &Run{
 		Sudo:        false,
 		AsUser:      "root",
+		NoLang:      false,
 		Concurrency: 1,
+		ConnectRate: "",
+
+		ExitCode:         ExitCodeAny,
+		FailureThreshold: "0",
+
+		Raw:    false,
+		Detach: false,
+
+		Pty:       true,
+		Term:      "xterm",
+		PtyWidth:  100,
+		PtyHeight: 100,
+
+		OutputRemote: "",
+
+		Responses:     []string{},
+		ResponsesFile: "",
+
+		PreserveEnv:     false,
+		PreserveEnvVars: []string{},
+		SetHome:         true,
+		SudoWrapper:     "",
+		Escalate:        batchssh.EscalateSudo,
+		SuPassword:      "",
+
+		TmpDir:   "",
+		TmpSweep: false,
+
+		LocalBefore: "",
+		LocalAfter:  "",
+
+		SpreadBy:  "",
+		SpreadMax: 1,
+
+		Confirm:     false,
+		ConfirmOver: 0,
+
+		PolicyFile: "",
+
+		Lock:    "",
+		LockDir: "",
+
+		RespectWindows:  false,
+		WindowAction:    WindowActionRefuse,
+		OverrideWindows: "",
 	}
 }
 
@@ -61,10 +212,175 @@ func (r *Run) AddFlagsTo(flags *pflag.FlagSet) {
 		flagRunLang,
 		"l",
 		r.Lang,
-		`specify i18n while executing command (e.g. zh_CN.UTF-8|en_US.UTF-8)`,
+		`specify i18n while executing command (e.g. zh_CN.UTF-8|en_US.UTF-8),
+which is set by env requests, or by 'export' if the ssh server rejects them`,
 	)
+	flags.BoolVarP(&r.NoLang, flagRunNoLang, "", r.NoLang,
+		"do not set i18n of commands, even if '--run.lang' is given by the config file")
 	flags.IntVarP(&r.Concurrency, flagRunConcurrency, "c", r.Concurrency,
 		"number of concurrent connections")
+	flags.StringVarP(&r.ConnectRate, flagRunConnectRate, "", r.ConnectRate,
+		`max rate of opening new connections independent of '--run.concurrency', in format
+'N/s' or 'N/m'(e.g. 50/s), to avoid overwhelming bastion hosts or triggering fail2ban-style
+blocks, empty means no limit`)
+	flags.StringVarP(&r.ExitCode, flagRunExitCode, "", r.ExitCode,
+		`exit with code 2 when target hosts failed, available policies:
+'any' for any host failed, 'threshold' for failed hosts above '--run.failure-threshold',
+'never' for always exiting with 0`)
+	flags.StringVarP(&r.FailureThreshold, flagRunFailureThreshold, "", r.FailureThreshold,
+		"max number(e.g. 5) or percentage(e.g. 10%) of failed hosts that is tolerated by '--run.exit-code threshold'")
+	flags.BoolVarP(&r.Raw, flagRunRaw, "", r.Raw,
+		`network device compatibility mode, send commands as they are without pty,
+shell wrappers and 'export LANG', for routers/switches with limited ssh servers`)
+	flags.BoolVarP(&r.Pty, flagRunPty, "", r.Pty,
+		`allocate pty for commands/script, without pty stderr is still merged into stdout,
+and the sudo password is given by 'sudo -S', e.g. '--run.pty=false' for the commands
+that behave differently on terminals, it is not allocated with '--run.raw' anyway`)
+	flags.StringVarP(&r.Term, flagRunTerm, "", r.Term,
+		"value of TERM of the allocated pty, e.g. xterm-256color, vt100, dumb")
+	flags.IntVarP(&r.PtyWidth, flagRunPtyWidth, "", r.PtyWidth,
+		"columns of the allocated pty, e.g. 200 for the commands that cut long lines")
+	flags.IntVarP(&r.PtyHeight, flagRunPtyHeight, "", r.PtyHeight,
+		"rows of the allocated pty")
+	flags.BoolVarP(&r.Detach, flagRunDetach, "", r.Detach,
+		`start commands on target hosts under nohup and return immediately with the pid,
+for long-running jobs whose output is collected later by 'gossh attach' or 'gossh jobs'`)
+	flags.StringVarP(&r.OutputRemote, flagRunOutputRemote, "", r.OutputRemote,
+		`absolute path of the file on target hosts to which the output of commands is redirected,
+and only the last 20 lines of it are returned, for huge outputs that should not be transported back`)
+	flags.StringArrayVarP(&r.Responses, flagRunResponses, "", nil,
+		`auto-answer prompts of commands/script in format 'prompt-regexp=answer',
+e.g. 'Are you sure \(y/n\)\?=y', can be repeated`)
+	flags.StringVarP(&r.ResponsesFile, flagRunResponsesFile, "", r.ResponsesFile,
+		`yaml file that holds the prompts to auto-answer, in format:
+responses:
+  - prompt: 'Are you sure \(y/n\)\?'
+    answer: y`)
+	flags.BoolVarP(&r.PreserveEnv, flagRunPreserveEnv, "", r.PreserveEnv,
+		"preserve the whole environment of login user while using sudo (sudo -E)")
+	flags.StringSliceVarP(&r.PreserveEnvVars, flagRunPreserveEnvVars, "", nil,
+		"preserve these environment variables while using sudo (sudo --preserve-env=VAR,...)")
+	flags.BoolVarP(&r.SetHome, flagRunSetHome, "", r.SetHome,
+		"set HOME to the home directory of the target user while using sudo (sudo -H)")
+	flags.StringVarP(&r.SudoWrapper, flagRunSudoWrapper, "", r.SudoWrapper,
+		`absolute path of the program executed by sudo as 'WRAPPER -c COMMANDS' instead
+of bash, so that sudoers can be restricted to it (e.g. /usr/local/bin/gossh-run)`)
+	flags.StringVarP(&r.Escalate, flagRunEscalate, "", r.Escalate,
+		`method of running as other users while using sudo, available values:
+'sudo', 'su', or 'auto' that tries passwordless sudo, sudo with password and su
+on each target host, and records the method that worked in the results`)
+	flags.StringVarP(&r.SuPassword, flagRunSuPassword, "", r.SuPassword,
+		"password of the target user for su, which can be encrypted by vault (default the password of login user)")
+	flags.StringVarP(&r.TmpDir, flagRunTmpDir, "", r.TmpDir,
+		`directory of target hosts for temporary files, i.e. the copied script of 'script',
+the zip files of 'fetch' and the job files of '--run.detach', used if '-d/--dest-path' of 'script' or '-t/--tmp-dir'
+of 'fetch' is not given (default /tmp)`)
+	flags.StringVarP(&r.WorkDir, flagRunWorkDir, "", r.WorkDir,
+		`absolute path of the directory on target hosts in which commands/script are executed,
+instead of embedding 'cd' in every command (default the home of the user)`)
+	flags.StringVarP(&r.Umask, flagRunUmask, "", r.Umask,
+		"umask(e.g. 027) set before commands/script are executed (default the umask of target hosts)")
+	flags.BoolVarP(&r.TmpSweep, flagRunTmpSweep, "", r.TmpSweep,
+		`after the task, remove the temporary files left on the target hosts
+that failed or timed out`)
+	flags.StringVarP(&r.LocalBefore, flagRunLocalBefore, "", r.LocalBefore,
+		`commands executed on local before the task(e.g. 'make build'),
+and the task is not run if they failed`)
+	flags.StringVarP(&r.LocalAfter, flagRunLocalAfter, "", r.LocalAfter,
+		`commands executed on local after the task, with the task results in
+environment variables GOSSH_TASK_ID, GOSSH_SUCCESS_COUNT and GOSSH_FAILED_COUNT`)
+	flags.StringVarP(&r.SpreadBy, flagRunSpreadBy, "", r.SpreadBy,
+		`variable of hosts file(e.g. 'zone' of 'web01 zone=us-east-1a') by which
+target hosts are grouped, and at most '--run.spread-max' hosts of each group
+are run concurrently, hosts without the variable are in the same group`)
+	flags.IntVarP(&r.SpreadMax, flagRunSpreadMax, "", r.SpreadMax,
+		"max concurrent target hosts of each group by '--run.spread-by'")
+	flags.BoolVarP(&r.Confirm, flagRunConfirm, "", r.Confirm,
+		`print the host count, groups and the exact command before execution,
+and require typing 'yes' or the host count to continue`)
+	flags.IntVarP(&r.ConfirmOver, flagRunConfirmOver, "", r.ConfirmOver,
+		"require the confirmation of '--run.confirm' when target hosts are more than this, 0 means disabled")
+	flags.StringVarP(&r.PolicyFile, flagRunPolicyFile, "", r.PolicyFile,
+		`yaml file that holds the policy evaluated before execution, in format:
+allow:  # commands must match one of the regexps if not empty
+  - '^systemctl (status|restart) '
+deny:   # commands and each line of scripts must match none of the regexps
+  - 'rm\s+-rf\s+/(\s|$)'
+sudo:
+  forbidden: false
+  as-users: [root]  # users that sudo can run as, empty means any
+and /etc/gossh/policy.yaml is also evaluated if it exists`)
+	flags.StringVarP(&r.Lock, flagRunLock, "", r.Lock,
+		`name of the lock held during the task(e.g. the group of target hosts), so that
+the tasks with the same lock can not run at the same time, e.g. by two operators`)
+	flags.StringVarP(&r.LockDir, flagRunLockDir, "", r.LockDir,
+		`directory of the locks of '--run.lock', which should be shared by the operators,
+e.g. on a bastion or a shared filesystem (default $HOME/.gossh/locks)`)
+	flags.BoolVarP(&r.RespectWindows, flagRunRespectWindows, "", r.RespectWindows,
+		`only run on target hosts within their maintenance windows, which are declared by
+variable 'window' of hosts file, e.g. 'web[01-10] window=mon-fri@22:00-06:00 window-tz=UTC'`)
+	flags.StringVarP(&r.WindowAction, flagRunWindowAction, "", r.WindowAction,
+		fmt.Sprintf(
+			`action on target hosts outside their maintenance windows, available values:
+%s: the task is not run
+%s: the task is only run on the hosts within their windows
+%s: the task is run when the windows of all target hosts are open`,
+			WindowActionRefuse,
+			WindowActionSkip,
+			WindowActionWait,
+		),
+	)
+	flags.StringVarP(&r.OverrideWindows, flagRunOverrideWindows, "", r.OverrideWindows,
+		"run regardless of the maintenance windows, the REASON is recorded in the audit log",
+	)
+}
+
+// SplitResponse splits '--run.responses' value 'prompt-regexp=answer' at the last '='.
+func SplitResponse(response string) (prompt, answer string, ok bool) {
+	i := strings.LastIndex(response, "=")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	return response[:i], response[i+1:], true
+}
+
+// ParseConnectRate parses '--run.connect-rate' value 'N/s' or 'N/m' into connections per second.
+func ParseConnectRate(rate string) (perSecond float64, ok bool) {
+	i := strings.LastIndex(rate, "/")
+	if i <= 0 {
+		return 0, false
+	}
+
+	n, err := strconv.ParseFloat(rate[:i], 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+
+	switch rate[i+1:] {
+	case "s":
+		return n, true
+	case "m":
+		//nolint:gomnd
+		return n / 60, true
+	default:
+		return 0, false
+	}
+}
+
+// FailureThresholdExceeded reports whether failedCount of totalCount hosts
+// exceeds '--run.failure-threshold'.
+func (r *Run) FailureThresholdExceeded(failedCount, totalCount int) bool {
+	if strings.HasSuffix(r.FailureThreshold, "%") {
+		percent, _ := strconv.ParseFloat(strings.TrimSuffix(r.FailureThreshold, "%"), 64)
+
+		//nolint:gomnd
+		return totalCount > 0 && float64(failedCount)*100/float64(totalCount) > percent
+	}
+
+	count, _ := strconv.Atoi(r.FailureThreshold)
+
+	return failedCount > count
 }
 
 // Complete ...
@@ -82,5 +398,239 @@ func (r *Run) Validate() (errs []error) {
 		))
 	}
 
+	if r.ConnectRate != "" {
+		if _, ok := ParseConnectRate(r.ConnectRate); !ok {
+			errs = append(errs, fmt.Errorf(
+				"invalid %s: %s - need format 'N/s' or 'N/m' with N greater than 0",
+				flagRunConnectRate,
+				r.ConnectRate,
+			))
+		}
+	}
+
+	switch r.ExitCode {
+	case ExitCodeAny, ExitCodeThreshold, ExitCodeNever:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s, %s",
+			flagRunExitCode,
+			r.ExitCode,
+			ExitCodeAny,
+			ExitCodeThreshold,
+			ExitCodeNever,
+		))
+	}
+
+	if r.Raw && r.Sudo {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s", flagRunRaw, flagRunSudo))
+	}
+
+	if r.SudoWrapper != "" && !validSudoWrapper(r.SudoWrapper) {
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - must be an absolute path without spaces or shell metacharacters",
+			flagRunSudoWrapper,
+			r.SudoWrapper,
+		))
+	}
+
+	switch r.Escalate {
+	case batchssh.EscalateSudo, batchssh.EscalateSu, batchssh.EscalateAuto:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s, %s",
+			flagRunEscalate,
+			r.Escalate,
+			batchssh.EscalateSudo,
+			batchssh.EscalateSu,
+			batchssh.EscalateAuto,
+		))
+	}
+
+	for _, v := range r.PreserveEnvVars {
+		if !validEnvName(v) {
+			errs = append(errs, fmt.Errorf(
+				"invalid %s: %s - not a valid environment variable name",
+				flagRunPreserveEnvVars,
+				v,
+			))
+		}
+	}
+
+	if r.ConfirmOver < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must not be negative", flagRunConfirmOver, r.ConfirmOver))
+	}
+
+	if r.SpreadMax < 1 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must be gather than 0", flagRunSpreadMax, r.SpreadMax))
+	}
+
+	if r.TmpDir != "" && !path.IsAbs(r.TmpDir) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s - must be an absolute path", flagRunTmpDir, r.TmpDir))
+	}
+
+	if r.WorkDir != "" && (!path.IsAbs(r.WorkDir) || strings.Contains(r.WorkDir, "'")) {
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - must be an absolute path without single quotes",
+			flagRunWorkDir,
+			r.WorkDir,
+		))
+	}
+
+	if r.Umask != "" && !umaskRegexp.MatchString(r.Umask) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s - must be 3 or 4 octal digits, e.g. 027", flagRunUmask, r.Umask))
+	}
+
+	if r.Raw && (r.WorkDir != "" || r.Umask != "") {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s/%s", flagRunRaw, flagRunWorkDir, flagRunUmask))
+	}
+
+	if r.OutputRemote != "" && !path.IsAbs(r.OutputRemote) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s - must be an absolute path", flagRunOutputRemote, r.OutputRemote))
+	}
+
+	if r.OutputRemote != "" && r.Detach {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s", flagRunOutputRemote, flagRunDetach))
+	}
+
+	if r.OutputRemote != "" && r.Raw {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s", flagRunOutputRemote, flagRunRaw))
+	}
+
+	if r.Detach && r.Raw {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s", flagRunDetach, flagRunRaw))
+	}
+
+	if r.Detach && (len(r.Responses) != 0 || r.ResponsesFile != "") {
+		errs = append(errs, fmt.Errorf(
+			"%s can not be used with %s/%s",
+			flagRunDetach,
+			flagRunResponses,
+			flagRunResponsesFile,
+		))
+	}
+
+	if r.Raw && r.Lang != "" && !r.NoLang {
+		errs = append(errs, fmt.Errorf("%s can not be used with %s", flagRunRaw, flagRunLang))
+	}
+
+	for _, v := range r.Responses {
+		prompt, _, ok := SplitResponse(v)
+		if !ok {
+			errs = append(errs, fmt.Errorf("invalid %s: %s - need format 'prompt-regexp=answer'", flagRunResponses, v))
+			continue
+		}
+
+		if _, err := regexp.Compile(prompt); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s - %s", flagRunResponses, v, err))
+		}
+	}
+
+	if r.PolicyFile != "" && !util.FileExists(r.PolicyFile) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s not found", flagRunPolicyFile, r.PolicyFile))
+	}
+
+	if r.Lock != "" && !lockNameRegexp.MatchString(r.Lock) {
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - only letters, digits, '.', '_' and '-' are allowed",
+			flagRunLock,
+			r.Lock,
+		))
+	}
+
+	switch r.WindowAction {
+	case WindowActionRefuse, WindowActionSkip, WindowActionWait:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s, %s",
+			flagRunWindowAction,
+			r.WindowAction,
+			WindowActionRefuse,
+			WindowActionSkip,
+			WindowActionWait,
+		))
+	}
+
+	if r.OverrideWindows != "" && !r.RespectWindows {
+		errs = append(errs, fmt.Errorf("%s needs %s", flagRunOverrideWindows, flagRunRespectWindows))
+	}
+
+	if r.ResponsesFile != "" && !util.FileExists(r.ResponsesFile) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s not found", flagRunResponsesFile, r.ResponsesFile))
+	}
+
+	if r.Term == "" {
+		errs = append(errs, fmt.Errorf("invalid %s: must not be empty", flagRunTerm))
+	}
+
+	if r.PtyWidth < 1 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must be gather than 0", flagRunPtyWidth, r.PtyWidth))
+	}
+
+	if r.PtyHeight < 1 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must be gather than 0", flagRunPtyHeight, r.PtyHeight))
+	}
+
+	if !r.Pty && (len(r.Responses) != 0 || r.ResponsesFile != "") {
+		errs = append(errs, fmt.Errorf(
+			"%s=false can not be used with %s/%s that need pty",
+			flagRunPty,
+			flagRunResponses,
+			flagRunResponsesFile,
+		))
+	}
+
+	if !r.Pty && r.Escalate == batchssh.EscalateSu {
+		errs = append(errs, fmt.Errorf(
+			"%s=false can not be used with %s %s that needs pty",
+			flagRunPty,
+			flagRunEscalate,
+			r.Escalate,
+		))
+	}
+
+	if r.Raw && (len(r.Responses) != 0 || r.ResponsesFile != "") {
+		errs = append(errs, fmt.Errorf(
+			"%s can not be used with %s/%s that need pty",
+			flagRunRaw,
+			flagRunResponses,
+			flagRunResponsesFile,
+		))
+	}
+
+	if !validFailureThreshold(r.FailureThreshold) {
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - must be a non-negative number or percentage",
+			flagRunFailureThreshold,
+			r.FailureThreshold,
+		))
+	}
+
 	return
 }
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var umaskRegexp = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+var lockNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+func validEnvName(name string) bool {
+	return envNameRegexp.MatchString(name)
+}
+
+// validSudoWrapper checks the wrapper which is put into the commands as it is.
+func validSudoWrapper(wrapper string) bool {
+	return path.IsAbs(wrapper) && !strings.ContainsAny(wrapper, " \t'\"`$;&|<>\\")
+}
+
+func validFailureThreshold(threshold string) bool {
+	if strings.HasSuffix(threshold, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+		//nolint:gomnd
+		return err == nil && percent >= 0 && percent <= 100
+	}
+
+	count, err := strconv.Atoi(threshold)
+
+	return err == nil && count >= 0
+}
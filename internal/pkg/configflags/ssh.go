@@ -0,0 +1,155 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configflags
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+const (
+	flagSSHConfigFile = "ssh.config-file"
+	flagSSHPersist    = "ssh.persist"
+	flagSSHCiphers    = "ssh.ciphers"
+	flagSSHKex        = "ssh.kex"
+	flagSSHMACs       = "ssh.macs"
+	flagSSHHostKey    = "ssh.hostkey-algos"
+
+	flagSSHPreConnect        = "ssh.pre-connect"
+	flagSSHPreConnectTimeout = "ssh.pre-connect-timeout"
+	flagSSHPreConnectOnError = "ssh.pre-connect-on-error"
+
+	// SSHConfigFileNone disables reading the openssh config file.
+	SSHConfigFileNone = "none"
+
+	defaultSSHConfigFile = "~/.ssh/config"
+
+	defaultPreConnectTimeout = 10 * time.Second
+)
+
+// Values of '--ssh.pre-connect-on-error'.
+const (
+	PreConnectOnErrorFail   = "fail"
+	PreConnectOnErrorIgnore = "ignore"
+)
+
+// SSH ...
+type SSH struct {
+	ConfigFile   string        `json:"config-file" mapstructure:"config-file"`
+	Persist      time.Duration `json:"persist" mapstructure:"persist"`
+	Ciphers      []string      `json:"ciphers" mapstructure:"ciphers"`
+	Kex          []string      `json:"kex" mapstructure:"kex"`
+	MACs         []string      `json:"macs" mapstructure:"macs"`
+	HostKeyAlgos []string      `json:"hostkey-algos" mapstructure:"hostkey-algos"`
+
+	PreConnect        string        `json:"pre-connect" mapstructure:"pre-connect"`
+	PreConnectTimeout time.Duration `json:"pre-connect-timeout" mapstructure:"pre-connect-timeout"`
+	PreConnectOnError string        `json:"pre-connect-on-error" mapstructure:"pre-connect-on-error"`
+}
+
+// NewSSH ...
+func NewSSH() *SSH {
+	return &SSH{
+		ConfigFile:   defaultSSHConfigFile,
+		Persist:      0,
+		Ciphers:      []string{},
+		Kex:          []string{},
+		MACs:         []string{},
+		HostKeyAlgos: []string{},
+
+		PreConnect:        "",
+		PreConnectTimeout: defaultPreConnectTimeout,
+		PreConnectOnError: PreConnectOnErrorFail,
+	}
+}
+
+// AddFlagsTo pflagSet.
+func (s *SSH) AddFlagsTo(flags *pflag.FlagSet) {
+	flags.StringVarP(&s.ConfigFile, flagSSHConfigFile, "", s.ConfigFile,
+		`openssh config file that provides per-host settings
+(HostName/User/Port/IdentityFile/ProxyJump), use 'none' to disable`)
+	flags.DurationVarP(&s.Persist, flagSSHPersist, "", s.Persist,
+		`keep connections to target hosts in a background control master
+for this long after last use (e.g. 10m), so consecutive invocations
+skip dialing and authentication, 0 means disabled`)
+	flags.StringSliceVarP(&s.Ciphers, flagSSHCiphers, "", nil,
+		"ciphers in preference order (e.g. aes256-ctr,aes128-cbc), default the built-in list")
+	flags.StringSliceVarP(&s.Kex, flagSSHKex, "", nil,
+		"key exchange algorithms in preference order (e.g. diffie-hellman-group1-sha1), default the built-in list")
+	flags.StringSliceVarP(&s.MACs, flagSSHMACs, "", nil,
+		"MAC algorithms in preference order (e.g. hmac-sha2-256,hmac-sha1), default the built-in list")
+	flags.StringSliceVarP(&s.HostKeyAlgos, flagSSHHostKey, "", nil,
+		"host key algorithms in preference order (e.g. ssh-rsa,ssh-dss), default the built-in list")
+	flags.StringVarP(&s.PreConnect, flagSSHPreConnect, "", s.PreConnect,
+		`local command executed before connecting each target host, e.g. a port knocking
+sequence or calling an API to open a firewall window, the target host is given by
+environment variables GOSSH_HOST, GOSSH_HOSTNAME, GOSSH_PORT and GOSSH_VAR_<KEY>
+for the variables of hosts file`)
+	flags.DurationVarP(&s.PreConnectTimeout, flagSSHPreConnectTimeout, "", s.PreConnectTimeout,
+		"timeout for executing '--ssh.pre-connect' of each target host")
+	flags.StringVarP(&s.PreConnectOnError, flagSSHPreConnectOnError, "", s.PreConnectOnError,
+		`what to do if '--ssh.pre-connect' fails, available values:
+'fail' for failing the target host, 'ignore' for connecting it anyway`)
+}
+
+// Complete ...
+func (s *SSH) Complete() error {
+	return nil
+}
+
+// Validate ...
+func (s *SSH) Validate() (errs []error) {
+	if s.ConfigFile != SSHConfigFileNone && s.ConfigFile != defaultSSHConfigFile && !util.FileExists(s.ConfigFile) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s not found", flagSSHConfigFile, s.ConfigFile))
+	}
+
+	if s.Persist < 0 {
+		errs = append(errs, fmt.Errorf("invalid %s: %s - must not be negative", flagSSHPersist, s.Persist))
+	}
+
+	if s.PreConnectTimeout <= 0 {
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - must be gather than 0",
+			flagSSHPreConnectTimeout,
+			s.PreConnectTimeout,
+		))
+	}
+
+	switch s.PreConnectOnError {
+	case PreConnectOnErrorFail, PreConnectOnErrorIgnore:
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %s - available values: %s, %s",
+			flagSSHPreConnectOnError,
+			s.PreConnectOnError,
+			PreConnectOnErrorFail,
+			PreConnectOnErrorIgnore,
+		))
+	}
+
+	return
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configflags
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagTransferChunkSize = "transfer.chunk-size"
+	flagTransferInflight  = "transfer.inflight"
+
+	// maxTransferChunkSize is the max sftp packet size of openssh sftp-server in kilobytes.
+	maxTransferChunkSize = 256
+)
+
+// Transfer ...
+type Transfer struct {
+	ChunkSize int `json:"chunk-size" mapstructure:"chunk-size"`
+	Inflight  int `json:"inflight" mapstructure:"inflight"`
+}
+
+// NewTransfer ...
+func NewTransfer() *Transfer {
+	return &Transfer{
+		ChunkSize: 32,
+		Inflight:  64,
+	}
+}
+
+// AddFlagsTo pflagSet.
+func (t *Transfer) AddFlagsTo(flags *pflag.FlagSet) {
+	flags.IntVarP(&t.ChunkSize, flagTransferChunkSize, "", t.ChunkSize,
+		`kilobytes of each sftp read/write request while pushing/fetching files,
+sizes larger than 32 might not work with all servers`)
+	flags.IntVarP(&t.Inflight, flagTransferInflight, "", t.Inflight,
+		`max concurrent sftp read/write requests per file, larger values make
+better use of links with high bandwidth-delay product`)
+}
+
+// Complete ...
+func (t *Transfer) Complete() error {
+	return nil
+}
+
+// Validate ...
+func (t *Transfer) Validate() (errs []error) {
+	if t.ChunkSize < 1 || t.ChunkSize > maxTransferChunkSize {
+		errs = append(errs, fmt.Errorf(
+			"invalid %s: %d - must be between 1 and %d",
+			flagTransferChunkSize,
+			t.ChunkSize,
+			maxTransferChunkSize,
+		))
+	}
+
+	if t.Inflight < 1 {
+		errs = append(errs, fmt.Errorf("invalid %s: %d - must be gather than 0", flagTransferInflight, t.Inflight))
+	}
+
+	return
+}
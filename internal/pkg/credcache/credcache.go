@@ -0,0 +1,204 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package credcache caches the password entered from terminal prompt, so
+// repeated invocations of gossh in a short time don't prompt again.
+//
+// The cached password is encrypted with a random session key by AES-GCM.
+// The session key is stored in the user's runtime directory
+// ($XDG_RUNTIME_DIR, which is usually a tmpfs cleared on logout) or the
+// system temporary directory, while the cipher text is stored under
+// $HOME/.gossh/cache, so neither of them alone can reveal the password.
+package credcache
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/aes"
+)
+
+const (
+	sessionKeyLen  = 32
+	sessionKeyFile = "session.key"
+)
+
+type entry struct {
+	ExpireAt   int64  `json:"expire_at"`
+	CipherText string `json:"cipher_text"`
+}
+
+// Get the cached password of the user. It returns false if there is no
+// cached password or it is expired.
+func Get(user string) (string, bool) {
+	content, err := ioutil.ReadFile(cacheFile(user))
+	if err != nil {
+		return "", false
+	}
+
+	var e entry
+	if err := json.Unmarshal(content, &e); err != nil {
+		return "", false
+	}
+
+	if time.Now().Unix() > e.ExpireAt {
+		_ = os.Remove(cacheFile(user))
+		return "", false
+	}
+
+	key, err := ioutil.ReadFile(filepath.Join(sessionDir(), sessionKeyFile))
+	if err != nil || len(key) != sessionKeyLen {
+		return "", false
+	}
+
+	password, err := decrypt(e.CipherText, key)
+	if err != nil {
+		return "", false
+	}
+
+	return password, true
+}
+
+// Set the password of the user into cache, and it expires after ttl.
+func Set(user, password string, ttl time.Duration) error {
+	key, err := getOrCreateSessionKey()
+	if err != nil {
+		return err
+	}
+
+	cipherText, err := encrypt(password, key)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(entry{
+		ExpireAt:   time.Now().Add(ttl).Unix(),
+		CipherText: cipherText,
+	})
+	if err != nil {
+		return err
+	}
+
+	file := cacheFile(user)
+
+	//nolint:gomnd
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	//nolint:gomnd
+	return ioutil.WriteFile(file, content, 0600)
+}
+
+// Clear the cached password of the user.
+func Clear(user string) error {
+	err := os.Remove(cacheFile(user))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func getOrCreateSessionKey() ([]byte, error) {
+	dir := sessionDir()
+	file := filepath.Join(dir, sessionKeyFile)
+
+	key, err := ioutil.ReadFile(file)
+	if err == nil && len(key) == sessionKeyLen {
+		return key, nil
+	}
+
+	//nolint:gomnd
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	// Refuse to put the session key into a directory that others can access.
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:gomnd
+	if !fi.IsDir() || fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("insecure session directory '%s'", dir)
+	}
+
+	key = make([]byte, sessionKeyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	//nolint:gomnd
+	if err := ioutil.WriteFile(file, key, 0600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func encrypt(plainText string, key []byte) (string, error) {
+	cipherText, err := aes.EncodeGCM([]byte(plainText), key)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(cipherText), nil
+}
+
+func decrypt(hexCipherText string, key []byte) (string, error) {
+	cipherText, err := hex.DecodeString(hexCipherText)
+	if err != nil {
+		return "", err
+	}
+
+	plainText, err := aes.DecodeGCM(cipherText, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plainText), nil
+}
+
+func cacheFile(user string) string {
+	home, _ := os.UserHomeDir()
+	sum := sha256.Sum256([]byte(user))
+
+	return filepath.Join(home, ".gossh", "cache", hex.EncodeToString(sum[:8]))
+}
+
+func sessionDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "gossh")
+	}
+
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gossh-%d", os.Getuid()))
+}
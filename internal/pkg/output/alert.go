@@ -0,0 +1,145 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	opsgenieHost       = "api.opsgenie.com"
+
+	// Max lengths of the alert message of pagerduty and opsgenie.
+	pagerDutyMaxSummaryLen = 1024
+	opsgenieMaxMessageLen  = 130
+)
+
+// alertDedupKey is the same for the runs of the same task, e.g. scheduled by cron,
+// so that their alerts are grouped into one incident.
+func alertDedupKey(title string) string {
+	sum := sha256.Sum256([]byte(title))
+
+	return "gossh-" + hex.EncodeToString(sum[:8])
+}
+
+// pagerDutyNotifier triggers pagerduty alerts by the Events API v2.
+type pagerDutyNotifier struct {
+	routingKey string
+	severity   string
+	title      string
+	dedupKey   string
+	client     *http.Client
+}
+
+// newPagerDutyNotifier from 'pagerduty://ROUTING_KEY[?severity=critical|error|warning|info]'.
+func newPagerDutyNotifier(u *url.URL, title string) notifier {
+	severity := u.Query().Get("severity")
+	if severity == "" {
+		severity = "error"
+	}
+
+	return &pagerDutyNotifier{
+		routingKey: u.Host,
+		severity:   severity,
+		title:      title,
+		dedupKey:   alertDedupKey(title),
+		client:     &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (p *pagerDutyNotifier) notify(subject, text string) error {
+	return postJSON(p.client, pagerDutyEventsURL, nil, map[string]interface{}{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    p.dedupKey,
+		"payload": map[string]interface{}{
+			"summary":  truncate(alertSubject(subject, p.title), pagerDutyMaxSummaryLen),
+			"source":   "gossh",
+			"severity": p.severity,
+			"custom_details": map[string]string{
+				"details": text,
+			},
+		},
+	})
+}
+
+// opsgenieNotifier creates opsgenie alerts by the Alert API.
+type opsgenieNotifier struct {
+	url      string
+	apiKey   string
+	priority string
+	title    string
+	alias    string
+	client   *http.Client
+}
+
+// newOpsgenieNotifier from 'opsgenie://API_KEY[?priority=P1..P5&host=api.eu.opsgenie.com]'.
+func newOpsgenieNotifier(u *url.URL, title string) notifier {
+	host := u.Query().Get("host")
+	if host == "" {
+		host = opsgenieHost
+	}
+
+	return &opsgenieNotifier{
+		url:      "https://" + host + "/v2/alerts",
+		apiKey:   u.Host,
+		priority: u.Query().Get("priority"),
+		title:    title,
+		alias:    alertDedupKey(title),
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (o *opsgenieNotifier) notify(subject, text string) error {
+	alert := map[string]string{
+		"message":     truncate(alertSubject(subject, o.title), opsgenieMaxMessageLen),
+		"alias":       o.alias,
+		"description": text,
+		"source":      "gossh",
+	}
+
+	if o.priority != "" {
+		alert["priority"] = o.priority
+	}
+
+	return postJSON(o.client, o.url, map[string]string{"Authorization": "GenieKey " + o.apiKey}, alert)
+}
+
+// truncate s to max bytes.
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max-3] + "..."
+	}
+
+	return s
+}
+
+// alertSubject is the subject of the alert, which tells what the task does.
+func alertSubject(subject, title string) string {
+	return fmt.Sprintf("%s - %s", subject, title)
+}
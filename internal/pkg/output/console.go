@@ -0,0 +1,254 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// maxMostMatchedHosts is the number of the most matched hosts in the summary of grep.
+const maxMostMatchedHosts = 5
+
+// consoleSink writes results by the logger, which honors
+// '-j/--output.json', '-q/--output.quiet' and '-o/--output.file'.
+type consoleSink struct {
+	mu sync.Mutex
+	// failures of the task, printed in groups before the summary.
+	failures []*HostResult
+}
+
+// NewConsoleSink ...
+func NewConsoleSink() Sink {
+	return &consoleSink{}
+}
+
+// WriteResult ...
+func (c *consoleSink) WriteResult(res *HostResult) error {
+	fields := log.Fields{
+		"hostname": res.Hostname,
+		"status":   res.Status,
+		"output":   res.Output,
+	}
+
+	if res.Stderr != "" {
+		fields["stderr"] = res.Stderr
+	}
+
+	if res.Timings != nil {
+		fields["timings"] = res.Timings
+	}
+
+	if res.Escalation != "" {
+		fields["escalation"] = res.Escalation
+	}
+
+	if res.Category != "" {
+		fields["category"] = res.Category
+	}
+
+	if res.ExitCode != nil {
+		fields["exit_code"] = *res.ExitCode
+	}
+
+	contextLogger := log.WithFields(fields)
+
+	if res.Status == batchssh.SuccessIdentifier {
+		contextLogger.Infof("success")
+	} else {
+		contextLogger.Errorf("failed")
+
+		c.mu.Lock()
+		c.failures = append(c.failures, res)
+		c.mu.Unlock()
+	}
+
+	return nil
+}
+
+// WriteSummary ...
+func (c *consoleSink) WriteSummary(summary *TaskSummary) error {
+	c.mu.Lock()
+	failures := c.failures
+	c.failures = nil
+	c.mu.Unlock()
+
+	// Grouping a single failed host tells nothing more than its result.
+	if len(failures) > 1 {
+		for _, group := range groupFailures(failures) {
+			log.Errorf("%s", group)
+		}
+	}
+
+	if summary.Durations != nil && summary.SuccessCount+summary.FailedCount > 1 {
+		slowest := make([]string, 0, len(summary.Durations.Slowest))
+		for _, v := range summary.Durations.Slowest {
+			slowest = append(slowest, fmt.Sprintf("%s(%.2fs)", v.Hostname, v.Duration))
+		}
+
+		log.Infof(
+			"host duration p50: %.2fs, p95: %.2fs, max: %.2fs, slowest: %s",
+			summary.Durations.P50,
+			summary.Durations.P95,
+			summary.Durations.Max,
+			strings.Join(slowest, ", "),
+		)
+	}
+
+	if summary.Matches != nil {
+		message := fmt.Sprintf(
+			"matched lines: %d, files: %d, hosts: %d",
+			summary.Matches.Lines,
+			summary.Matches.Files,
+			len(summary.Matches.Hosts),
+		)
+
+		if len(summary.Matches.Hosts) != 0 {
+			most := make([]string, 0, maxMostMatchedHosts)
+			for i, v := range summary.Matches.Hosts {
+				if i == maxMostMatchedHosts {
+					break
+				}
+				most = append(most, fmt.Sprintf("%s(%d)", v.Hostname, v.Lines))
+			}
+
+			message += ", most matched: " + strings.Join(most, ", ")
+		}
+
+		log.Infof("%s", message)
+	}
+
+	failedCount := strconv.Itoa(summary.FailedCount)
+	if len(summary.FailedCategories) != 0 {
+		failedCount += " (" + formatCategories(summary.FailedCategories) + ")"
+	}
+
+	log.Infof(
+		"success count: %d, failed count: %s, elapsed: %.2fs",
+		summary.SuccessCount,
+		failedCount,
+		summary.Elapsed,
+	)
+
+	return nil
+}
+
+// Close ...
+func (c *consoleSink) Close() error {
+	return nil
+}
+
+// formatCategories formats the counts of failure categories like '3 auth, 2 command-timeout',
+// the most frequent category first.
+func formatCategories(categories map[string]int) string {
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if categories[names[i]] != categories[names[j]] {
+			return categories[names[i]] > categories[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%d %s", categories[name], name))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// failureGroup is the failed hosts with the same category and message.
+type failureGroup struct {
+	category string
+	message  string
+	hosts    []string
+}
+
+func (g *failureGroup) String() string {
+	hostOrHosts := "host"
+	if len(g.hosts) > 1 {
+		hostOrHosts = "hosts"
+	}
+
+	category := g.category
+	if category == "" {
+		category = batchssh.CategoryOther
+	}
+
+	message := ""
+	if g.message != "" {
+		message = fmt.Sprintf(" '%s'", g.message)
+	}
+
+	return fmt.Sprintf(
+		"%d %s failed with %s%s: %s",
+		len(g.hosts),
+		hostOrHosts,
+		category,
+		message,
+		strings.Join(g.hosts, ","),
+	)
+}
+
+// groupFailures groups the failed hosts by category and the first line of output,
+// so that hosts failed for the same reason, e.g. a missing binary, are told at a glance.
+// The largest group comes first, and the hosts of each group are sorted.
+func groupFailures(failures []*HostResult) []*failureGroup {
+	var groups []*failureGroup
+	index := make(map[string]*failureGroup)
+
+	for _, res := range failures {
+		message := strings.TrimSpace(strings.SplitN(strings.TrimSpace(res.Output), "\n", 2)[0])
+
+		key := res.Category + "\n" + message
+		group, ok := index[key]
+		if !ok {
+			group = &failureGroup{category: res.Category, message: message}
+			index[key] = group
+			groups = append(groups, group)
+		}
+
+		group.hosts = append(group.hosts, res.Hostname)
+	}
+
+	for _, group := range groups {
+		sort.Strings(group.hosts)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].hosts) > len(groups[j].hosts)
+	})
+
+	return groups
+}
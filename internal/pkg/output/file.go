@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fileSink writes results to a file as json lines.
+type fileSink struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewFileSink ...
+func NewFileSink(path string) (Sink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("output sink file path is empty")
+	}
+
+	//nolint:gomnd
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open output sink file '%s' failed: %s", path, err)
+	}
+
+	return &fileSink{
+		path:    path,
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// WriteResult ...
+func (f *fileSink) WriteResult(res *HostResult) error {
+	return f.write(newResultRecord(res))
+}
+
+// WriteSummary ...
+func (f *fileSink) WriteSummary(summary *TaskSummary) error {
+	return f.write(newSummaryRecord(summary))
+}
+
+// Close ...
+func (f *fileSink) Close() error {
+	return f.file.Close()
+}
+
+func (f *fileSink) write(v interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.encoder.Encode(v); err != nil {
+		return fmt.Errorf("write output sink file '%s' failed: %s", f.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const kafkaContentType = "application/vnd.kafka.json.v2+json"
+
+// kafkaSink publishes each result to a kafka topic through the Confluent REST Proxy.
+type kafkaSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaSink publishes results to the topic in spec,
+// e.g. 'kafka://rest-proxy:8082/gossh-results', use scheme 'kafkas' for https.
+func NewKafkaSink(u *url.URL) (Sink, error) {
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" || strings.Contains(topic, "/") {
+		return nil, fmt.Errorf("invalid kafka output sink '%s': need topic as path", u.Redacted())
+	}
+
+	scheme := "http"
+	if strings.EqualFold(u.Scheme, "kafkas") {
+		scheme = "https"
+	}
+
+	endpoint := url.URL{
+		Scheme: scheme,
+		User:   u.User,
+		Host:   u.Host,
+		Path:   "/topics/" + topic,
+	}
+
+	return &kafkaSink{
+		url:    endpoint.String(),
+		client: &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+// WriteResult ...
+func (k *kafkaSink) WriteResult(res *HostResult) error {
+	return k.publish(res.Hostname, newResultRecord(res))
+}
+
+// WriteSummary ...
+func (k *kafkaSink) WriteSummary(summary *TaskSummary) error {
+	return k.publish(summary.TaskID, newSummaryRecord(summary))
+}
+
+// Close ...
+func (k *kafkaSink) Close() error {
+	return nil
+}
+
+func (k *kafkaSink) publish(key string, v interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{
+			{"key": key, "value": v},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.client.Post(k.url, kafkaContentType, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("publish to kafka failed: %s", err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	//nolint:gomnd
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("publish to kafka failed: %s", resp.Status)
+	}
+
+	return nil
+}
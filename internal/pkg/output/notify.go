@@ -0,0 +1,296 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+)
+
+const (
+	// notifyMaxFailedHosts is the max failed hosts listed in a notification.
+	notifyMaxFailedHosts = 50
+	// notifyMaxErrorLen is the max length of the error of a failed host in a notification.
+	notifyMaxErrorLen = 200
+)
+
+// NotifyCondition reports whether to notify by the summary of the task.
+type NotifyCondition func(summary *TaskSummary) bool
+
+// notifier sends a message to slack/teams/email.
+type notifier interface {
+	notify(subject, text string) error
+}
+
+// notifySink posts the task summary to a notifier when the task completes.
+type notifySink struct {
+	title       string
+	notifier    notifier
+	condition   NotifyCondition
+	failedHosts bool
+
+	mu     sync.Mutex
+	failed []*HostResult
+}
+
+// NewNotifySink from spec, the spec is 'slack://hooks.slack.com/services/...' for slack,
+// 'teams://xxx.webhook.office.com/...' for microsoft teams,
+// 'smtp://[user:pass@]host:port?from=...&to=...' for email,
+// 'pagerduty://ROUTING_KEY' or 'opsgenie://API_KEY' for alerts. The title tells what the task
+// does, and failed hosts are also posted if failedHosts is true.
+func NewNotifySink(spec, title string, condition NotifyCondition, failedHosts bool) (Sink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notify target: %s", err)
+	}
+
+	var n notifier
+	switch strings.ToLower(u.Scheme) {
+	case "slack":
+		n = newChatNotifier(u, "\n")
+	case "teams":
+		// Teams renders single line breaks as spaces.
+		n = newChatNotifier(u, "\n\n")
+	case "smtp":
+		n = newMailNotifier(u)
+	case "pagerduty":
+		n = newPagerDutyNotifier(u, title)
+	case "opsgenie":
+		n = newOpsgenieNotifier(u, title)
+	default:
+		return nil, fmt.Errorf("invalid notify target '%s': unsupported scheme '%s'", u.Redacted(), u.Scheme)
+	}
+
+	return &notifySink{
+		title:       title,
+		notifier:    n,
+		condition:   condition,
+		failedHosts: failedHosts,
+	}, nil
+}
+
+// WriteResult ...
+func (n *notifySink) WriteResult(res *HostResult) error {
+	if !n.failedHosts || res.Status == batchssh.SuccessIdentifier {
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.failed = append(n.failed, res)
+
+	return nil
+}
+
+// WriteSummary ...
+func (n *notifySink) WriteSummary(summary *TaskSummary) error {
+	if !n.condition(summary) {
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	subject := fmt.Sprintf(
+		"gossh task %s: %d succeeded, %d failed",
+		summary.TaskID,
+		summary.SuccessCount,
+		summary.FailedCount,
+	)
+
+	return n.notifier.notify(subject, n.message(summary))
+}
+
+// Close ...
+func (n *notifySink) Close() error {
+	return nil
+}
+
+func (n *notifySink) message(summary *TaskSummary) string {
+	lines := []string{
+		n.title,
+		fmt.Sprintf(
+			"task: %s, success count: %d, failed count: %d, elapsed: %.2fs",
+			summary.TaskID,
+			summary.SuccessCount,
+			summary.FailedCount,
+			summary.Elapsed,
+		),
+	}
+
+	if len(summary.FailedCategories) != 0 {
+		categories := make([]string, 0, len(summary.FailedCategories))
+		for k, v := range summary.FailedCategories {
+			categories = append(categories, fmt.Sprintf("%s: %d", k, v))
+		}
+		sort.Strings(categories)
+
+		lines = append(lines, "failed categories: "+strings.Join(categories, ", "))
+	}
+
+	if len(n.failed) != 0 {
+		sort.Slice(n.failed, func(i, j int) bool { return n.failed[i].Hostname < n.failed[j].Hostname })
+
+		lines = append(lines, "failed hosts:")
+		for i, res := range n.failed {
+			if i == notifyMaxFailedHosts {
+				lines = append(lines, fmt.Sprintf("... and %d more", len(n.failed)-i))
+				break
+			}
+
+			detail := firstLine(res.Output, notifyMaxErrorLen)
+			if detail == "" {
+				detail = res.Category
+			}
+
+			lines = append(lines, fmt.Sprintf("%s: %s", res.Hostname, detail))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// firstLine of s, truncated to max bytes.
+func firstLine(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n"); i != -1 {
+		s = s[:i]
+	}
+
+	return truncate(s, max)
+}
+
+// chatNotifier posts messages to the incoming webhooks of slack or teams.
+type chatNotifier struct {
+	url       string
+	lineBreak string
+	client    *http.Client
+}
+
+func newChatNotifier(u *url.URL, lineBreak string) notifier {
+	webhook := *u
+	webhook.Scheme = "https"
+
+	return &chatNotifier{
+		url:       webhook.String(),
+		lineBreak: lineBreak,
+		client:    &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (c *chatNotifier) notify(subject, text string) error {
+	return postJSON(c.client, c.url, nil, map[string]string{
+		"text": strings.ReplaceAll(text, "\n", c.lineBreak),
+	})
+}
+
+// postJSON posts v as json to endpoint with the headers.
+func postJSON(client *http.Client, endpoint string, headers map[string]string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify '%s' failed: %s", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	//nolint:gomnd
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notify '%s' failed: %s", endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+// mailNotifier sends messages by smtp, with STARTTLS if the server supports it.
+type mailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func newMailNotifier(u *url.URL) notifier {
+	m := &mailNotifier{
+		addr: u.Host,
+		from: u.Query().Get("from"),
+		to:   u.Query()["to"],
+	}
+
+	if u.Port() == "" {
+		m.addr = u.Host + ":25"
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		m.auth = smtp.PlainAuth("", u.User.Username(), password, u.Hostname())
+	}
+
+	return m
+}
+
+func (m *mailNotifier) notify(subject, text string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, m.to, msg.Bytes()); err != nil {
+		return fmt.Errorf("notify by smtp server '%s' failed: %s", m.addr, err)
+	}
+
+	return nil
+}
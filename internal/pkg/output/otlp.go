@@ -0,0 +1,356 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+)
+
+const (
+	otlpDefaultPort = "4318"
+	otlpTracesPath  = "/v1/traces"
+	// otlpBatchSpans is the max spans of an export request.
+	otlpBatchSpans = 1000
+
+	otlpServiceName = "gossh"
+
+	// Span kinds and status codes of OTLP.
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// otlpSink exports the task and its phases on each target host as OpenTelemetry spans
+// by OTLP/HTTP in json encoding. The task is the root span of a trace, each target host
+// is a child span of it, and the phases(dns, dial, auth, exec, transfer) are the children
+// of the host spans.
+type otlpSink struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+
+	mu      sync.Mutex
+	traceID string
+	rootID  string
+	spans   []*otlpSpan
+}
+
+// NewOTLPSink exports spans to the OpenTelemetry collector in spec, e.g.
+// 'otlp://otel-collector:4318', use scheme 'otlps' for https. The headers of requests,
+// e.g. for auth, are taken from $OTEL_EXPORTER_OTLP_HEADERS('key1=value1,key2=value2'),
+// and the service name from $OTEL_SERVICE_NAME.
+func NewOTLPSink(u *url.URL) (Sink, error) {
+	scheme := "http"
+	if strings.EqualFold(u.Scheme, "otlps") {
+		scheme = "https"
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = u.Host + ":" + otlpDefaultPort
+	}
+
+	path := u.Path
+	if path == "" || path == "/" {
+		path = otlpTracesPath
+	}
+
+	endpoint := url.URL{
+		Scheme: scheme,
+		User:   u.User,
+		Host:   host,
+		Path:   path,
+	}
+
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = otlpServiceName
+	}
+
+	o := &otlpSink{
+		url:     endpoint.String(),
+		headers: parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		service: service,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+	o.newTrace()
+
+	return o, nil
+}
+
+// WriteResult ...
+func (o *otlpSink) WriteResult(res *HostResult) error {
+	if res.StartTime.IsZero() {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	hostSpan := &otlpSpan{
+		TraceID:      o.traceID,
+		SpanID:       newSpanID(),
+		ParentSpanID: o.rootID,
+		Name:         "host",
+		Kind:         otlpSpanKindClient,
+		Start:        res.StartTime,
+		End:          res.StartTime.Add(res.Duration),
+		Attributes: []otlpAttribute{
+			stringAttribute("host.name", res.Hostname),
+			stringAttribute("gossh.status", res.Status),
+		},
+	}
+
+	if res.Status == batchssh.SuccessIdentifier {
+		hostSpan.Status.Code = otlpStatusOK
+	} else {
+		hostSpan.Status.Code = otlpStatusError
+		hostSpan.Status.Message = firstLine(res.Output, notifyMaxErrorLen)
+		hostSpan.Attributes = append(hostSpan.Attributes, stringAttribute("gossh.category", res.Category))
+	}
+
+	if res.ExitCode != nil {
+		hostSpan.Attributes = append(hostSpan.Attributes, intAttribute("gossh.exit_code", *res.ExitCode))
+	}
+
+	o.spans = append(o.spans, hostSpan)
+
+	if res.Phases == nil {
+		return nil
+	}
+
+	// The timings are the total durations of the phases, which are laid out one
+	// after another from the start of the host.
+	start := res.StartTime
+	for _, phase := range []struct {
+		name    string
+		seconds float64
+	}{
+		{"dns", res.Phases.DNS},
+		{"dial", res.Phases.Dial},
+		{"auth", res.Phases.Auth},
+		{"exec", res.Phases.Exec},
+		{"transfer", res.Phases.Transfer},
+	} {
+		if phase.seconds <= 0 {
+			continue
+		}
+
+		end := start.Add(time.Duration(phase.seconds * float64(time.Second)))
+		o.spans = append(o.spans, &otlpSpan{
+			TraceID:      o.traceID,
+			SpanID:       newSpanID(),
+			ParentSpanID: hostSpan.SpanID,
+			Name:         phase.name,
+			Kind:         otlpSpanKindInternal,
+			Start:        start,
+			End:          end,
+		})
+		start = end
+	}
+
+	return nil
+}
+
+// WriteSummary exports the spans of the task, and the next summary, e.g. of the
+// next round of '--run.watch', starts a new trace.
+func (o *otlpSink) WriteSummary(summary *TaskSummary) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	root := &otlpSpan{
+		TraceID: o.traceID,
+		SpanID:  o.rootID,
+		Name:    "task",
+		Kind:    otlpSpanKindInternal,
+		Start:   summary.StartTime,
+		End:     summary.EndTime,
+		Attributes: []otlpAttribute{
+			stringAttribute("gossh.task_id", summary.TaskID),
+			intAttribute("gossh.success_count", summary.SuccessCount),
+			intAttribute("gossh.failed_count", summary.FailedCount),
+		},
+	}
+
+	root.Status.Code = otlpStatusOK
+	if summary.FailedCount > 0 {
+		root.Status.Code = otlpStatusError
+	}
+
+	spans := append([]*otlpSpan{root}, o.spans...)
+	o.newTrace()
+
+	for len(spans) > 0 {
+		n := otlpBatchSpans
+		if n > len(spans) {
+			n = len(spans)
+		}
+
+		if err := o.export(spans[:n]); err != nil {
+			return err
+		}
+
+		spans = spans[n:]
+	}
+
+	return nil
+}
+
+// Close ...
+func (o *otlpSink) Close() error {
+	return nil
+}
+
+func (o *otlpSink) newTrace() {
+	o.traceID = randomHex(16)
+	o.rootID = newSpanID()
+	o.spans = nil
+}
+
+func (o *otlpSink) export(spans []*otlpSpan) error {
+	jsonSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		jsonSpans = append(jsonSpans, span.json())
+	}
+
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{stringAttribute("service.name", o.service)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": otlpServiceName},
+						"spans": jsonSpans,
+					},
+				},
+			},
+		},
+	}
+
+	return postJSON(o.client, o.url, o.headers, request)
+}
+
+// otlpSpan is a span of OTLP, the ids are in hex.
+type otlpSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         int
+	Start, End   time.Time
+	Attributes   []otlpAttribute
+	Status       struct {
+		Code    int
+		Message string
+	}
+}
+
+func (s *otlpSpan) json() map[string]interface{} {
+	span := map[string]interface{}{
+		"traceId":           s.TraceID,
+		"spanId":            s.SpanID,
+		"name":              s.Name,
+		"kind":              s.Kind,
+		"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+	}
+
+	if s.ParentSpanID != "" {
+		span["parentSpanId"] = s.ParentSpanID
+	}
+
+	if len(s.Attributes) != 0 {
+		span["attributes"] = s.Attributes
+	}
+
+	if s.Status.Code != 0 {
+		status := map[string]interface{}{"code": s.Status.Code}
+		if s.Status.Message != "" {
+			status["message"] = s.Status.Message
+		}
+		span["status"] = status
+	}
+
+	return span
+}
+
+// otlpAttribute is a key value of OTLP, e.g. {"key":"host.name","value":{"stringValue":"web01"}}.
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": value}}
+}
+
+// intAttribute is encoded as a string like other 64-bit integers of OTLP json.
+func intAttribute(key string, value int) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.Itoa(value)}}
+}
+
+// parseOTLPHeaders parses the headers in format 'key1=value1,key2=value2'.
+func parseOTLPHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(kv[:i])
+		value, err := url.QueryUnescape(strings.TrimSpace(kv[i+1:]))
+		if err != nil {
+			continue
+		}
+
+		headers[key] = value
+	}
+
+	return headers
+}
+
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
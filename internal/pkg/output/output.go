@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ...
+const (
+	TypeResult  = "result"
+	TypeSummary = "summary"
+)
+
+// HostResult is the result of a task on one target host.
+type HostResult struct {
+	TaskID   string   `json:"task_id"`
+	Hostname string   `json:"hostname"`
+	Status   string   `json:"status"`
+	Output   string   `json:"output"`
+	Stderr   string   `json:"stderr,omitempty"`
+	Timings  *Timings `json:"timings,omitempty"`
+	// Escalation is how the target host ran as other users by '--run.escalate'.
+	Escalation string `json:"escalation,omitempty"`
+	// Category is the category of the failure, e.g. 'auth', 'dial-timeout'.
+	Category string `json:"category,omitempty"`
+	// ExitCode of the commands, it is nil if they did not exit, e.g. failures of connecting.
+	ExitCode *int `json:"exit_code,omitempty"`
+
+	// StartTime, Duration and Phases of the task on the target host are for the spans
+	// of the otlp sink, and Timings is only set by '--output.timings'.
+	StartTime time.Time     `json:"-"`
+	Duration  time.Duration `json:"-"`
+	Phases    *Timings      `json:"-"`
+}
+
+// Timings of the phases of a task on one target host, in seconds.
+type Timings struct {
+	DNS      float64 `json:"dns"`
+	Dial     float64 `json:"dial"`
+	Auth     float64 `json:"auth"`
+	Exec     float64 `json:"exec"`
+	Transfer float64 `json:"transfer"`
+}
+
+// TaskSummary is the summary of a task.
+type TaskSummary struct {
+	TaskID       string    `json:"task_id"`
+	SuccessCount int       `json:"success_count"`
+	FailedCount  int       `json:"failed_count"`
+	Elapsed      float64   `json:"elapsed"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+	// FailedCategories is the count of failed hosts of each failure category.
+	FailedCategories map[string]int `json:"failed_categories,omitempty"`
+	// Durations of the task on target hosts.
+	Durations *DurationStats `json:"durations,omitempty"`
+	// Matches of the grep task on target hosts.
+	Matches *MatchStats `json:"matches,omitempty"`
+}
+
+// DurationStats of the durations of a task on target hosts, in seconds.
+type DurationStats struct {
+	P50     float64        `json:"p50"`
+	P95     float64        `json:"p95"`
+	Max     float64        `json:"max"`
+	Slowest []HostDuration `json:"slowest"`
+}
+
+// HostDuration is the duration of a task on one target host, in seconds.
+type HostDuration struct {
+	Hostname string  `json:"hostname"`
+	Duration float64 `json:"duration"`
+}
+
+// MatchStats of the lines matched by the grep task on target hosts.
+type MatchStats struct {
+	Lines int `json:"lines"`
+	Files int `json:"files"`
+	// Hosts having matches, the most matched first.
+	Hosts []HostMatches `json:"hosts"`
+}
+
+// HostMatches is the count of lines matched on one target host.
+type HostMatches struct {
+	Hostname string `json:"hostname"`
+	Lines    int    `json:"lines"`
+}
+
+// Sink receives results of a task.
+type Sink interface {
+	WriteResult(res *HostResult) error
+	WriteSummary(summary *TaskSummary) error
+	Close() error
+}
+
+// resultRecord and summaryRecord are the records written by non-console sinks,
+// field 'type' tells consumers which kind of record it is.
+type resultRecord struct {
+	Type string `json:"type"`
+	*HostResult
+}
+
+type summaryRecord struct {
+	Type string `json:"type"`
+	*TaskSummary
+}
+
+func newResultRecord(res *HostResult) *resultRecord {
+	return &resultRecord{Type: TypeResult, HostResult: res}
+}
+
+func newSummaryRecord(summary *TaskSummary) *summaryRecord {
+	return &summaryRecord{Type: TypeSummary, TaskSummary: summary}
+}
+
+// New sink from spec, the spec is 'file:///path/to/results.json' for json file,
+// 'http(s)://host/path' for webhook, 'kafka(s)://rest-proxy:8082/topic' for kafka,
+// 'nats://server:4222/subject' for nats, or 'otlp(s)://otel-collector:4318' for
+// OpenTelemetry tracing.
+func New(spec string) (Sink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output sink: %s", err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "file":
+		return NewFileSink(u.Path)
+	case "http", "https":
+		return NewWebhookSink(spec), nil
+	case "kafka", "kafkas":
+		return NewKafkaSink(u)
+	case "nats":
+		return NewNATSSink(u)
+	case "otlp", "otlps":
+		return NewOTLPSink(u)
+	default:
+		return nil, fmt.Errorf("invalid output sink '%s': unsupported scheme '%s'", u.Redacted(), u.Scheme)
+	}
+}
+
+// multiSink writes results to all its sinks.
+type multiSink struct {
+	sinks []Sink
+}
+
+// NewMulti returns a sink that writes results to all sinks simultaneously.
+func NewMulti(sinks ...Sink) Sink {
+	return &multiSink{sinks: sinks}
+}
+
+// WriteResult ...
+func (m *multiSink) WriteResult(res *HostResult) error {
+	var errs []string
+	for _, s := range m.sinks {
+		if err := s.WriteResult(res); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// WriteSummary ...
+func (m *multiSink) WriteSummary(summary *TaskSummary) error {
+	var errs []string
+	for _, s := range m.sinks {
+		if err := s.WriteSummary(summary); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// Close ...
+func (m *multiSink) Close() error {
+	var errs []string
+	for _, s := range m.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(errs, "; "))
+}
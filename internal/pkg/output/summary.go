@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+)
+
+// summaryFile is the content of '--output.summary'.
+type summaryFile struct {
+	TaskID       string    `json:"task_id"`
+	Finished     bool      `json:"finished"`
+	StartTime    time.Time `json:"start_time"`
+	EndTime      time.Time `json:"end_time"`
+	Elapsed      float64   `json:"elapsed"`
+	TotalCount   int       `json:"total_count"`
+	SuccessCount int       `json:"success_count"`
+	FailedCount  int       `json:"failed_count"`
+	// FailedCategories is the count of failed hosts of each failure category.
+	FailedCategories map[string]int `json:"failed_categories,omitempty"`
+	// Hosts is the status index of target hosts.
+	Hosts map[string]string `json:"hosts"`
+}
+
+// summarySink collects results and writes a summary file on Close,
+// so that wrappers can make decisions without scraping logs.
+type summarySink struct {
+	path string
+
+	mu      sync.Mutex
+	summary *summaryFile
+	// categories of the failed target hosts.
+	categories map[string]string
+}
+
+// NewSummaryFileSink ...
+func NewSummaryFileSink(path, taskID string) Sink {
+	return &summarySink{
+		path: path,
+		summary: &summaryFile{
+			TaskID:    taskID,
+			StartTime: time.Now(),
+			Hosts:     make(map[string]string),
+		},
+		categories: make(map[string]string),
+	}
+}
+
+// WriteResult ...
+func (s *summarySink) WriteResult(res *HostResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary.Hosts[res.Hostname] = res.Status
+	s.categories[res.Hostname] = res.Category
+
+	return nil
+}
+
+// WriteSummary ...
+func (s *summarySink) WriteSummary(summary *TaskSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary.Finished = true
+	s.summary.StartTime = summary.StartTime
+	s.summary.EndTime = summary.EndTime
+	s.summary.Elapsed = summary.Elapsed
+
+	return nil
+}
+
+// Close writes the summary file, it is also written if the task did not finish,
+// e.g. task timeout, with 'finished' being false.
+func (s *summarySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.summary.Finished {
+		s.summary.EndTime = time.Now()
+		s.summary.Elapsed = s.summary.EndTime.Sub(s.summary.StartTime).Seconds()
+	}
+
+	s.summary.TotalCount = len(s.summary.Hosts)
+	s.summary.SuccessCount, s.summary.FailedCount = 0, 0
+	s.summary.FailedCategories = make(map[string]int)
+	for host, status := range s.summary.Hosts {
+		if status == batchssh.SuccessIdentifier {
+			s.summary.SuccessCount++
+		} else {
+			s.summary.FailedCount++
+			s.summary.FailedCategories[s.categories[host]]++
+		}
+	}
+
+	content, err := json.MarshalIndent(s.summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//nolint:gomnd
+	if err := ioutil.WriteFile(s.path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("write summary file '%s' failed: %s", s.path, err)
+	}
+
+	return nil
+}
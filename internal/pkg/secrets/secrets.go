@@ -0,0 +1,127 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package secrets resolves secret references like 'awssm://name' or
+// 'ssm://path' in password/passphrase fields at runtime, so that credentials
+// never live in local files.
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// awsSecretsManagerScheme for AWS Secrets Manager, e.g. 'awssm://prod/ssh-password'.
+	awsSecretsManagerScheme = "awssm://"
+	// awsSSMScheme for AWS SSM Parameter Store, e.g. 'ssm:///prod/ssh/password'.
+	awsSSMScheme = "ssm://"
+)
+
+// IsReference reports whether text is a secret reference.
+func IsReference(text string) bool {
+	return strings.HasPrefix(text, awsSecretsManagerScheme) || strings.HasPrefix(text, awsSSMScheme)
+}
+
+// Resolve the secret reference to its plaintext value.
+// Region and profile can be given by query string, e.g. 'awssm://name?region=us-east-1&profile=ops',
+// otherwise the default settings of aws cli are used.
+func Resolve(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, awsSecretsManagerScheme):
+		name, args, err := parseReference(strings.TrimPrefix(ref, awsSecretsManagerScheme))
+		if err != nil {
+			return "", fmt.Errorf("invalid secret reference '%s': %w", ref, err)
+		}
+
+		return runAWS(append([]string{
+			"secretsmanager", "get-secret-value",
+			"--secret-id", name,
+			"--query", "SecretString",
+			"--output", "text",
+		}, args...)...)
+	case strings.HasPrefix(ref, awsSSMScheme):
+		name, args, err := parseReference(strings.TrimPrefix(ref, awsSSMScheme))
+		if err != nil {
+			return "", fmt.Errorf("invalid secret reference '%s': %w", ref, err)
+		}
+
+		return runAWS(append([]string{
+			"ssm", "get-parameter",
+			"--name", name,
+			"--with-decryption",
+			"--query", "Parameter.Value",
+			"--output", "text",
+		}, args...)...)
+	default:
+		return "", fmt.Errorf("unsupported secret reference '%s'", ref)
+	}
+}
+
+func parseReference(ref string) (string, []string, error) {
+	var args []string
+
+	name := ref
+	if i := strings.Index(ref, "?"); i != -1 {
+		name = ref[:i]
+
+		query, err := url.ParseQuery(ref[i+1:])
+		if err != nil {
+			return "", nil, err
+		}
+
+		if region := query.Get("region"); region != "" {
+			args = append(args, "--region", region)
+		}
+
+		if profile := query.Get("profile"); profile != "" {
+			args = append(args, "--profile", profile)
+		}
+	}
+
+	if name == "" {
+		return "", nil, fmt.Errorf("empty secret name")
+	}
+
+	return name, args, nil
+}
+
+func runAWS(args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("aws", args...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf(
+			"aws %s failed: %s",
+			strings.Join(args[:2], " "),
+			strings.TrimSpace(stderr.String()+" "+err.Error()),
+		)
+	}
+
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
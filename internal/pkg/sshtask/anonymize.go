@@ -0,0 +1,148 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/windvalley/gossh/internal/pkg/output"
+)
+
+const anonymizeKeyLen = 32
+
+// ipRegexp matches the candidates of IPv4 and IPv6 addresses, which are checked by net.ParseIP.
+var ipRegexp = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b|[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`)
+
+// anonymizer replaces hostnames and IPs of results with pseudonyms by '--output.anonymize'.
+// The pseudonyms are keyed by a random key of the user, so that they are stable across
+// runs while the real names can not be guessed from them.
+type anonymizer struct {
+	key []byte
+	// hostsRegexp matches the target hosts and their real host names in outputs.
+	hostsRegexp *regexp.Regexp
+}
+
+// newAnonymizer with the key in $HOME/.gossh/anonymize.key, which is created if not exists.
+func newAnonymizer() (*anonymizer, error) {
+	home, _ := os.UserHomeDir()
+	file := filepath.Join(home, ".gossh", "anonymize.key")
+
+	key, err := ioutil.ReadFile(file)
+	if err == nil && len(key) == anonymizeKeyLen {
+		return &anonymizer{key: key}, nil
+	}
+
+	key = make([]byte, anonymizeKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate anonymize key failed: %s", err)
+	}
+
+	//nolint:gomnd
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, fmt.Errorf("create anonymize key failed: %s", err)
+	}
+
+	//nolint:gomnd
+	if err := ioutil.WriteFile(file, key, 0600); err != nil {
+		return nil, fmt.Errorf("create anonymize key failed: %s", err)
+	}
+
+	return &anonymizer{key: key}, nil
+}
+
+// setHosts sets the names to be replaced in outputs, the longer ones are matched first.
+func (a *anonymizer) setHosts(names []string) {
+	var quoted []string
+	for _, name := range names {
+		if name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+
+	if len(quoted) == 0 {
+		return
+	}
+
+	sort.Slice(quoted, func(i, j int) bool {
+		return len(quoted[i]) > len(quoted[j])
+	})
+
+	a.hostsRegexp = regexp.MustCompile(`\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// pseudonym of the host name or IP, e.g. 'host-1a2b3c4d5e'.
+func (a *anonymizer) pseudonym(name string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(strings.ToLower(name)))
+
+	//nolint:gomnd
+	return "host-" + hex.EncodeToString(mac.Sum(nil))[:10]
+}
+
+// text replaces the target hosts and IPs in s with their pseudonyms.
+func (a *anonymizer) text(s string) string {
+	if a.hostsRegexp != nil {
+		s = a.hostsRegexp.ReplaceAllStringFunc(s, a.pseudonym)
+	}
+
+	return ipRegexp.ReplaceAllStringFunc(s, func(candidate string) string {
+		if net.ParseIP(candidate) == nil {
+			return candidate
+		}
+
+		return a.pseudonym(candidate)
+	})
+}
+
+// result anonymizes the hostname and outputs of res.
+func (a *anonymizer) result(res *output.HostResult) {
+	res.Hostname = a.pseudonym(res.Hostname)
+	res.Output = a.text(res.Output)
+	res.Stderr = a.text(res.Stderr)
+}
+
+// summary anonymizes the hostnames of the slowest and the most matched target hosts in s.
+func (a *anonymizer) summary(s *output.TaskSummary) {
+	if s.Durations != nil {
+		for i := range s.Durations.Slowest {
+			s.Durations.Slowest[i].Hostname = a.pseudonym(s.Durations.Slowest[i].Hostname)
+		}
+	}
+
+	if s.Matches != nil {
+		for i := range s.Matches.Hosts {
+			s.Matches.Hosts[i].Hostname = a.pseudonym(s.Matches.Hosts[i].Hostname)
+		}
+	}
+}
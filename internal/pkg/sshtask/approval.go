@@ -0,0 +1,478 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+const (
+	// approvalIDLength is the length of the ID of approval requests.
+	approvalIDLength = 12
+
+	// approvalTTL is how long an approval is valid after it is approved.
+	approvalTTL = 24 * time.Hour
+)
+
+// approvalPolicy decides the high-risk tasks that need approval of a second user.
+type approvalPolicy struct {
+	// Dir is shared by the requesters and approvers for storing approval requests.
+	Dir string `mapstructure:"dir"`
+	// Sudo tasks need approval.
+	Sudo bool `mapstructure:"sudo"`
+	// HostsOver is the count of target hosts above which tasks need approval, 0 means disabled.
+	HostsOver int `mapstructure:"hosts-over"`
+	// Patterns are the regexps of commands that need approval.
+	Patterns []string `mapstructure:"patterns"`
+}
+
+// ApprovalRequest of high-risk task, which is stored in approval dir as file '<id>.json'
+// by the requester, and the id is the hash of the fields that describe the task, so that
+// the fields can not be modified after the id is given to the approver.
+type ApprovalRequest struct {
+	ID          string    `json:"id"`
+	Nonce       string    `json:"nonce"`
+	Task        string    `json:"task"`
+	Hosts       int       `json:"hosts"`
+	HostsHash   string    `json:"hosts_sha256"`
+	ContentHash string    `json:"content_sha256,omitempty"`
+	Sudo        bool      `json:"sudo"`
+	AsUser      string    `json:"as_user"`
+	Requester   string    `json:"requester"`
+	RequestedAt time.Time `json:"requested_at"`
+
+	// Approver and ApprovedAt are of the verified approval file rather than the request file.
+	Approver   string    `json:"-"`
+	ApprovedAt time.Time `json:"-"`
+}
+
+// needApproval reports whether the task is high-risk by the approval policy.
+func (a *approvalPolicy) needApproval(t *Task, hosts []string) (bool, error) {
+	if a.Dir == "" {
+		return false, nil
+	}
+
+	if a.Sudo && t.configFlags.Run.Sudo {
+		return true, nil
+	}
+
+	if a.HostsOver > 0 && len(hosts) > a.HostsOver {
+		return true, nil
+	}
+
+	for _, v := range a.Patterns {
+		matched, err := regexp.MatchString(v, t.describe())
+		if err != nil {
+			return false, fmt.Errorf("invalid approval pattern '%s' of policy: %w", v, err)
+		}
+
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// checkApproval requires the high-risk task to be approved by a second user. The first run
+// files an approval request, and the task runs once the request is approved by 'gossh approve'.
+//
+// The approval is a separate file '<id>.<nonce>.approval' created by the approver, and it is
+// verified by the owner of the file rather than its content, which must be another user than
+// the requester, so the requester can not approve the request by editing the files. An approval
+// is used only once, since the nonce of the next request is different, and it expires after
+// approvalTTL. Root can still bypass it, and so can ssh without gossh.
+func (t *Task) checkApproval(a *approvalPolicy, hosts []string) error {
+	need, err := a.needApproval(t, hosts)
+	if err != nil || !need || t.approval != nil {
+		return err
+	}
+
+	requester, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("get current user failed: %w", err)
+	}
+
+	expected, err := t.newApprovalRequest(requester.Username, hosts)
+	if err != nil {
+		return err
+	}
+
+	id := expected.ID
+	requestFile := filepath.Join(a.Dir, id+".json")
+
+	request, err := readApprovalRequest(requestFile)
+	if errors.Is(err, os.ErrNotExist) {
+		nonce := make([]byte, 8)
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+
+		request = expected
+		request.Nonce = hex.EncodeToString(nonce)
+		request.RequestedAt = time.Now()
+
+		if err := writeApprovalRequest(requestFile, request); err != nil {
+			return err
+		}
+
+		return fmt.Errorf(
+			"high-risk task needs approval, ask another user to run 'gossh approve %s', then run it again",
+			id,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !request.sameTask(expected) {
+		return fmt.Errorf("approval request '%s' has been modified, remove '%s' and run the task again", id, requestFile)
+	}
+
+	approvalFile := filepath.Join(a.Dir, id+"."+request.Nonce+".approval")
+
+	approver, approvedAt, err := verifyApproval(approvalFile, requester.Uid)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("high-risk task is waiting for approval, ask another user to run 'gossh approve %s'", id)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid approval of '%s': %w", id, err)
+	}
+
+	if err := os.Remove(requestFile); err != nil {
+		return fmt.Errorf("remove used approval request failed: %w", err)
+	}
+
+	// It fails if the approval dir is sticky, and the approval is useless without the request anyway.
+	if err := os.Remove(approvalFile); err != nil {
+		log.Debugf("Policy: remove used approval '%s' failed: %s", approvalFile, err)
+	}
+
+	request.Approver = approver
+	request.ApprovedAt = approvedAt
+
+	log.Debugf("Policy: task '%s' requested by '%s' is approved by '%s'", id, request.Requester, request.Approver)
+
+	t.approval = request
+
+	return nil
+}
+
+// verifyApproval returns the approver and the time of the approval file, of which the owner
+// must not be the requester.
+func verifyApproval(approvalFile, requesterUID string) (string, time.Time, error) {
+	info, err := os.Lstat(approvalFile)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", time.Time{}, errors.New("not a regular file")
+	}
+
+	ownerUID, err := fileOwner(info)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if ownerUID == requesterUID {
+		return "", time.Time{}, errors.New("approved by the requester self")
+	}
+
+	if time.Since(info.ModTime()) > approvalTTL {
+		return "", time.Time{}, fmt.Errorf("expired after %s", approvalTTL)
+	}
+
+	approver := ownerUID
+	if u, err := user.LookupId(ownerUID); err == nil {
+		approver = u.Username
+	}
+
+	return approver, info.ModTime(), nil
+}
+
+// newApprovalRequest of the task by requester on the target hosts, without nonce and time.
+func (t *Task) newApprovalRequest(requester string, hosts []string) (*ApprovalRequest, error) {
+	sorted := append([]string{}, hosts...)
+	sort.Strings(sorted)
+	hostsHash := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+
+	contentHash, err := t.contentHash()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &ApprovalRequest{
+		Task:        t.describe(),
+		Hosts:       len(hosts),
+		HostsHash:   hex.EncodeToString(hostsHash[:]),
+		ContentHash: contentHash,
+		Sudo:        t.configFlags.Run.Sudo,
+		AsUser:      t.configFlags.Run.AsUser,
+		Requester:   requester,
+	}
+	request.ID = request.hashID()
+
+	return request, nil
+}
+
+// contentHash of the local files sent by the script or push task, as the description of
+// the task only holds their names, and a file changed after approval must not be run.
+// The hash of a script is that of its content as 'sha256sum' shows, and the push files
+// are hashed by the names and contents in their zip files but not the modification times,
+// and the urls fetched by target hosts by their '#sha256=<hex>' checksums if any.
+func (t *Task) contentHash() (string, error) {
+	h := sha256.New()
+
+	switch t.taskType {
+	case ScriptTask:
+		if err := hashFile(h, expandHome(t.scriptFile)); err != nil {
+			return "", err
+		}
+	case PushTask:
+		for _, zipFile := range t.pushFiles.zipFiles {
+			if err := hashZipFile(h, zipFile); err != nil {
+				return "", err
+			}
+		}
+
+		for _, u := range t.pushFiles.urls {
+			fmt.Fprintf(h, "%s#sha256=%s\n", u.Display, u.SHA256)
+		}
+	default:
+		return "", nil
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(h io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+
+	return err
+}
+
+func hashZipFile(h io.Writer, zipFile string) error {
+	r, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		fmt.Fprintf(h, "%s %s\n", f.Name, f.Mode())
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hashID identifies the task of the request by its requester, content and target hosts.
+func (r *ApprovalRequest) hashID() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%v\n%s\n%d\n%s\n%s",
+		r.Requester,
+		r.Task,
+		r.Sudo,
+		r.AsUser,
+		r.Hosts,
+		r.HostsHash,
+		r.ContentHash,
+	)
+
+	return hex.EncodeToString(h.Sum(nil))[:approvalIDLength]
+}
+
+// sameTask reports whether the request is of the same task as the expected one,
+// i.e. the request file is not modified after it is filed.
+func (r *ApprovalRequest) sameTask(expected *ApprovalRequest) bool {
+	return r.ID == expected.ID && r.hashID() == expected.ID &&
+		r.Task == expected.Task &&
+		r.Hosts == expected.Hosts &&
+		r.HostsHash == expected.HostsHash &&
+		r.ContentHash == expected.ContentHash &&
+		r.Sudo == expected.Sudo &&
+		r.AsUser == expected.AsUser &&
+		r.Requester == expected.Requester
+}
+
+// Approve approves the approval request id of approval dir by the current user, who must
+// not be the owner of the request file, by creating the approval file owned by the current user.
+func Approve(approvalDir, id string) (*ApprovalRequest, error) {
+	approver, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("get current user failed: %w", err)
+	}
+
+	requestFile := filepath.Join(approvalDir, filepath.Base(id)+".json")
+
+	request, err := readApprovalRequest(requestFile)
+	if err != nil {
+		return nil, fmt.Errorf("read approval request '%s' failed: %w", id, err)
+	}
+
+	info, err := os.Stat(requestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	requesterUID, err := fileOwner(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if requesterUID == approver.Uid {
+		return nil, fmt.Errorf(
+			"approval request '%s' must be approved by another user than '%s'", id, approver.Username)
+	}
+
+	// The fields shown to the approver must be those of the task that is run by the id.
+	if request.ID != filepath.Base(id) || request.hashID() != request.ID {
+		return nil, fmt.Errorf("approval request '%s' has been modified, refuse to approve it", id)
+	}
+
+	approvalFile := filepath.Join(approvalDir, request.ID+"."+filepath.Base(request.Nonce)+".approval")
+
+	// Readable by the requester, and only the approver can modify it.
+	//nolint:gosec
+	f, err := os.OpenFile(approvalFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("approval request '%s' has been approved", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write approval failed: %w", err)
+	}
+	defer f.Close()
+
+	request.Approver = approver.Username
+	request.ApprovedAt = time.Now()
+
+	if _, err := fmt.Fprintf(f, "%s approved by %s at %s\n",
+		request.ID, request.Approver, request.ApprovedAt.Format(time.RFC3339)); err != nil {
+		return nil, fmt.Errorf("write approval failed: %w", err)
+	}
+
+	log.Audit(log.Fields{
+		"event":     "approve",
+		"task_id":   request.ID,
+		"task":      request.Task,
+		"requester": request.Requester,
+		"approver":  request.Approver,
+	})
+
+	return request, nil
+}
+
+// ApprovalDir returns the approval dir of the policy file, or of SystemPolicyFile if it is empty.
+func ApprovalDir(policyFile string) (string, error) {
+	if policyFile == "" && util.FileExists(SystemPolicyFile) {
+		policyFile = SystemPolicyFile
+	}
+
+	if policyFile == "" {
+		return "", errors.New("need flag '--run.policy-file' that holds the approval dir")
+	}
+
+	p, err := readPolicyFile(expandHome(policyFile))
+	if err != nil {
+		return "", fmt.Errorf("read policy file '%s' failed: %w", policyFile, err)
+	}
+
+	if p.Approval.Dir == "" {
+		return "", fmt.Errorf("no approval dir in policy file '%s'", policyFile)
+	}
+
+	return p.Approval.Dir, nil
+}
+
+func readApprovalRequest(file string) (*ApprovalRequest, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &ApprovalRequest{}
+	if err := json.Unmarshal(content, request); err != nil {
+		return nil, fmt.Errorf("invalid approval request '%s': %w", file, err)
+	}
+
+	return request, nil
+}
+
+func writeApprovalRequest(file string, request *ApprovalRequest) error {
+	content, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Shared by the requesters and approvers.
+	//nolint:gosec
+	if err := ioutil.WriteFile(file, content, 0664); err != nil {
+		return fmt.Errorf("write approval request failed: %w", err)
+	}
+
+	return nil
+}
+
+func currentUser() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("get current user failed: %w", err)
+	}
+
+	return u.Username, nil
+}
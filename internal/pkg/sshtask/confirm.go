@@ -0,0 +1,157 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// needConfirm reports whether the operator must confirm the task on count hosts.
+func (t *Task) needConfirm(count int) bool {
+	runConf := t.configFlags.Run
+
+	return runConf.Confirm || (runConf.ConfirmOver > 0 && count > runConf.ConfirmOver)
+}
+
+// confirm prints the blast radius of the task, and requires the operator
+// to type 'yes' or the count of target hosts before execution.
+func (t *Task) confirm(hosts []string) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("confirmation needs a terminal, check '--run.confirm' and '--run.confirm-over'")
+	}
+
+	fmt.Fprintf(os.Stderr, "\nhosts: %d\n", len(hosts))
+
+	if len(t.hostTags) != 0 {
+		fmt.Fprintf(os.Stderr, "tags: %s\n", countGroups(hosts, func(host string) []string {
+			return t.hostTags[host]
+		}))
+	}
+
+	if spreadBy := t.configFlags.Run.SpreadBy; spreadBy != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", spreadBy, countGroups(hosts, func(host string) []string {
+			return []string{t.hostGroups[host]}
+		}))
+	}
+
+	fmt.Fprintf(os.Stderr, "%s\n", t.describe())
+
+	if t.configFlags.Run.Sudo {
+		fmt.Fprintf(os.Stderr, "sudo: as user '%s'\n", t.configFlags.Run.AsUser)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nType 'yes' or the count of hosts(%d) to continue: ", len(hosts))
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read confirmation failed: %w", err)
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer != "yes" && answer != strconv.Itoa(len(hosts)) {
+		return errors.New("task not confirmed, nothing is done")
+	}
+
+	return nil
+}
+
+// describe returns what the task does on target hosts.
+func (t *Task) describe() string {
+	switch t.taskType {
+	case CommandTask, DiffTask:
+		description := "command: " + t.command
+		if t.commands != nil {
+			description = t.describeExecMap()
+		}
+
+		if t.loopItems != nil {
+			description += ", " + t.describeLoop()
+		}
+
+		return description
+	case ScriptTask:
+		return "script: " + t.scriptFile
+	case PushTask:
+		return fmt.Sprintf("push: %s to %s", strings.Join(t.pushFileNames(), ", "), t.dstDir)
+	case FetchTask:
+		files := t.fetchFiles
+		if t.fetchPattern != "" {
+			files = append(append([]string{}, files...), t.describeFetchPattern())
+		}
+
+		return fmt.Sprintf("fetch: %s to %s", strings.Join(files, ", "), t.dstDir)
+	case PingTask:
+		return "ping"
+	case FactsTask:
+		return "facts: to " + t.factsFile
+	case RebootTask:
+		return "reboot"
+	case AttachTask:
+		return "attach: " + t.attachTaskID
+	case JobStatusTask:
+		return "jobs status: " + t.attachTaskID
+	case JobCollectTask:
+		return fmt.Sprintf("jobs collect: %s to %s", t.attachTaskID, t.dstDir)
+	case TailTask:
+		return "tail: " + strings.Join(t.tailFiles, ", ")
+	case GrepTask:
+		return fmt.Sprintf("grep: %s in %s", t.grepPattern, strings.Join(t.grepFiles, ", "))
+	default:
+		return ""
+	}
+}
+
+// countGroups returns the host counts of groups in format 'group1(3), group2(2)'.
+func countGroups(hosts []string, groupsOf func(host string) []string) string {
+	counts := make(map[string]int)
+	for _, host := range hosts {
+		for _, group := range groupsOf(host) {
+			counts[group]++
+		}
+	}
+
+	groups := make([]string, 0, len(counts))
+	for group := range counts {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for i, group := range groups {
+		name := group
+		if name == "" {
+			name = "-"
+		}
+
+		groups[i] = fmt.Sprintf("%s(%d)", name, counts[group])
+	}
+
+	return strings.Join(groups, ", ")
+}
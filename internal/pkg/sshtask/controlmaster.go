@@ -0,0 +1,171 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// ControlMasterCommand is the hidden subcommand that runs the control master.
+const ControlMasterCommand = "control-master"
+
+// ControlMasterRequest is passed to the control master process by stdin,
+// so that the password never appears in process arguments or environment.
+type ControlMasterRequest struct {
+	Config      *configflags.ConfigFlags `json:"config"`
+	Password    string                   `json:"password"`
+	ControlPath string                   `json:"control_path"`
+}
+
+// ServeControlMaster keeps connections to target hosts until it is idle for
+// the duration of '--ssh.persist'.
+func ServeControlMaster(req *ControlMasterRequest) error {
+	// The control master runs in background, and must not prompt for anything.
+	req.Config.Run.Sudo = false
+
+	t := NewTask(CommandTask, req.Config)
+	password := req.Password
+
+	auths := t.getSSHAuthMethods(&password)
+	if t.privateAgent != nil {
+		defer t.privateAgent.Close()
+	}
+
+	client := batchssh.NewClient(
+		t.configFlags.Auth.User,
+		password,
+		auths,
+		t.getSSHClientOptions(&password)...,
+	)
+
+	var resolve func(addr string) *batchssh.HostConfig
+	if resolver := t.newHostConfigResolver(auths); resolver != nil {
+		resolve = resolver.resolve
+	}
+
+	return client.ServeControlMaster(req.ControlPath, req.Config.SSH.Persist, resolve)
+}
+
+// getControlPath returns the unix socket of the control master, which is
+// shared by the invocations with the same connection settings.
+func (t *Task) getControlPath() string {
+	home, _ := os.UserHomeDir()
+
+	key := fmt.Sprintf("%s|%d|%s|%d|%s|%s",
+		t.configFlags.Auth.User,
+		t.configFlags.Hosts.Port,
+		t.configFlags.Proxy.Server,
+		t.configFlags.Proxy.Port,
+		t.configFlags.Proxy.User,
+		t.configFlags.SSH.ConfigFile,
+	)
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(home, ".gossh", "mux", hex.EncodeToString(sum[:8])+".sock")
+}
+
+// startControlMaster starts gossh in background as the control master
+// if it is not running yet.
+func (t *Task) startControlMaster(controlPath, password string) {
+	if conn, err := net.Dial("unix", controlPath); err == nil {
+		conn.Close()
+		log.Debugf("Control Master: reuse control master '%s'", controlPath)
+		return
+	}
+
+	//nolint:gomnd
+	if err := os.MkdirAll(filepath.Dir(controlPath), 0700); err != nil {
+		log.Debugf("Control Master: create dir of '%s' failed: %s", controlPath, err)
+		return
+	}
+
+	payload, err := json.Marshal(&ControlMasterRequest{
+		Config:      t.configFlags,
+		Password:    password,
+		ControlPath: controlPath,
+	})
+	if err != nil {
+		log.Debugf("Control Master: marshal request failed: %s", err)
+		return
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		log.Debugf("Control Master: get executable failed: %s", err)
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		log.Debugf("Control Master: create pipe failed: %s", err)
+		return
+	}
+	defer w.Close()
+
+	//nolint:gosec
+	cmd := exec.Command(executable, ControlMasterCommand)
+	cmd.Stdin = r
+	setDetached(cmd)
+
+	err = cmd.Start()
+	r.Close()
+	if err != nil {
+		log.Debugf("Control Master: start control master failed: %s", err)
+		return
+	}
+
+	if _, err := w.Write(payload); err != nil {
+		log.Debugf("Control Master: send request to control master failed: %s", err)
+		return
+	}
+	w.Close()
+
+	_ = cmd.Process.Release()
+
+	// Wait for the control master, so this invocation can also use it.
+	//nolint:gomnd
+	for i := 0; i < 20; i++ {
+		if conn, err := net.Dial("unix", controlPath); err == nil {
+			conn.Close()
+			log.Debugf("Control Master: started control master '%s' for %s", controlPath, t.configFlags.SSH.Persist)
+			return
+		}
+
+		//nolint:gomnd
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	log.Debugf("Control Master: control master '%s' not ready, connect target hosts directly", controlPath)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// detachCommandTemplate starts the commands in background, and keeps the
+// output, pid and exit code of them in the job directory of the task.
+const detachCommandTemplate = `d=%s;mkdir -p "$d" || exit 1
+s=;command -v setsid >/dev/null 2>&1 && s=setsid
+nohup $s bash -c %s >"$d/output" 2>&1 </dev/null &
+echo $! >"$d/pid";echo "detached, task id: %s, pid: $!"`
+
+// outputRemoteTailLines is the number of the last lines of the remote output
+// file returned by '--run.output-remote'.
+const outputRemoteTailLines = 20
+
+// outputRemoteCommandTemplate redirects the output of the commands to the file
+// on target hosts, and outputs the size and the last lines of it.
+const outputRemoteCommandTemplate = `f=%s;mkdir -p "$(dirname "$f")" || exit 1
+(
+%s
+) >"$f" 2>&1;e=$?
+echo "output saved to $f ($(wc -c <"$f") bytes), last %d lines:";tail -n %d "$f";exit $e`
+
+// jobCommandTemplate outputs the status of the job, then the output of it if
+// the cat command is given. It fails if the job is not found, exited with
+// non-zero code or killed.
+const jobCommandTemplate = `d=%s
+[ -f "$d/pid" ] || { echo "job %s not found";exit 1; }
+p=$(cat "$d/pid");e=
+if [ -f "$d/exit" ];then e=$(cat "$d/exit");echo "exited: $e, pid: $p"
+elif [ -d "/proc/$p" ];then echo "running, pid: $p"
+else e=1;echo "killed, pid: $p"
+fi
+%s
+[ -z "$e" ] || exit "$e"`
+
+// jobDir returns the directory of target hosts for the job files of the task.
+func (t *Task) jobDir(taskID string) string {
+	tmpDir := t.configFlags.Run.TmpDir
+	if tmpDir == "" {
+		tmpDir = "/tmp"
+	}
+
+	return path.Join(tmpDir, "gossh-jobs", taskID)
+}
+
+// detachCommand wraps the commands of the task to be started in background.
+func (t *Task) detachCommand() string {
+	dir := t.jobDir(t.id)
+
+	return fmt.Sprintf(
+		detachCommandTemplate,
+		util.ShellDoubleQuote(dir),
+		util.ShellDoubleQuote("(\n"+t.command+"\n)\necho $? >"+util.ShellDoubleQuote(dir+"/exit")),
+		t.id,
+	)
+}
+
+// outputRemoteCommand wraps the command to keep its output on target hosts.
+func (t *Task) outputRemoteCommand(command string) string {
+	return fmt.Sprintf(
+		outputRemoteCommandTemplate,
+		util.ShellDoubleQuote(t.configFlags.Run.OutputRemote),
+		command,
+		outputRemoteTailLines,
+		outputRemoteTailLines,
+	)
+}
+
+// SetAttachTaskID ...
+func (t *Task) SetAttachTaskID(taskID string) {
+	t.attachTaskID = taskID
+}
+
+// checkJob outputs the status of the detached job, and also the output of it if withOutput.
+func (t *Task) checkJob(addr string, withOutput bool) (string, error) {
+	cat := ""
+	if withOutput {
+		cat = `cat "$d/output"`
+	}
+
+	command := fmt.Sprintf(jobCommandTemplate, util.ShellDoubleQuote(t.jobDir(t.attachTaskID)), t.attachTaskID, cat)
+
+	return t.sshClient.ExecuteCmd(addr, command, "", t.configFlags.Run.AsUser, t.configFlags.Run.Sudo)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// diffContextLines is the lines of context of the unified diffs.
+const diffContextLines = 3
+
+// categoryDrift is the failure category of the hosts that deviate from the baseline.
+const categoryDrift = "drift"
+
+// compareResults waits for all results, and compares the outputs of the succeeded hosts
+// with the baseline, which is the host specified by SetBaseline or the majority output.
+// Hosts that deviate from the baseline are reported as failed with unified diffs.
+func (t *Task) compareResults(results <-chan *batchssh.Result) <-chan *batchssh.Result {
+	compared := make(chan *batchssh.Result)
+
+	go func() {
+		defer close(compared)
+
+		var all []*batchssh.Result
+		outputs := make(map[string]string)
+		for v := range results {
+			all = append(all, v)
+			if v.Status == batchssh.SuccessIdentifier {
+				outputs[v.Addr] = normalizeOutput(v.Message)
+			}
+		}
+
+		baseline := t.pickBaseline(all, outputs)
+		if baseline == "" {
+			log.Warnf("no succeeded hosts to be compared")
+
+			for _, v := range all {
+				compared <- v
+			}
+
+			return
+		}
+
+		log.Debugf("compare outputs with baseline host '%s'", baseline)
+
+		baselineLines := strings.Split(outputs[baseline], "\n")
+
+		// Output of the baseline host comes first.
+		for _, v := range all {
+			if v.Addr == baseline {
+				compared <- v
+				break
+			}
+		}
+
+		for _, v := range all {
+			if v.Addr == baseline {
+				continue
+			}
+
+			output, ok := outputs[v.Addr]
+			if !ok {
+				compared <- v
+				continue
+			}
+
+			if output == outputs[baseline] {
+				v.Message = fmt.Sprintf("same as baseline '%s'", baseline)
+			} else {
+				v.Status = batchssh.FailedIdentifier
+				v.Category = categoryDrift
+				v.Message = fmt.Sprintf(
+					"deviates from baseline '%s':\n%s",
+					baseline,
+					util.UnifiedDiff(
+						baselineLines,
+						strings.Split(output, "\n"),
+						baseline,
+						v.Addr,
+						diffContextLines,
+					),
+				)
+			}
+
+			compared <- v
+		}
+	}()
+
+	return compared
+}
+
+// pickBaseline returns the baseline host, which is the specified one if it succeeded,
+// otherwise the first host of the most common output.
+func (t *Task) pickBaseline(results []*batchssh.Result, outputs map[string]string) string {
+	if t.baseline != "" {
+		if _, ok := outputs[t.baseline]; ok {
+			return t.baseline
+		}
+
+		log.Warnf("baseline host '%s' failed, use the majority output as baseline instead", t.baseline)
+	}
+
+	counts := make(map[string]int)
+	maxCount := 0
+	for _, output := range outputs {
+		counts[output]++
+		if counts[output] > maxCount {
+			maxCount = counts[output]
+		}
+	}
+
+	// The first host of the most common output.
+	for _, v := range results {
+		if output, ok := outputs[v.Addr]; ok && counts[output] == maxCount {
+			return v.Addr
+		}
+	}
+
+	return ""
+}
+
+// normalizeOutput removes the differences that are not from the commands,
+// i.e. line breaks of pty, leading and trailing blanks and sudo prompts.
+func normalizeOutput(output string) string {
+	output = strings.TrimSpace(strings.ReplaceAll(output, "\r\n", "\n"))
+
+	re, err := regexp.Compile(sudoPromptRegex)
+	if err != nil {
+		return output
+	}
+
+	return strings.TrimSpace(re.ReplaceAllString(output, ""))
+}
@@ -0,0 +1,235 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+const (
+	defaultConsulAddr = "http://127.0.0.1:8500"
+	discoveryTimeout  = 10 * time.Second
+)
+
+// consulService is a node of a service returned by Consul '/v1/catalog/service/:service'.
+type consulService struct {
+	Node           string
+	Address        string
+	Datacenter     string
+	ServiceAddress string
+	ServiceTags    []string
+}
+
+// discoverHosts gets target hosts from service registries and inventory providers,
+// '--hosts.srv', '--hosts.consul' and '--hosts.provider'. The results are cached
+// for '--hosts.cache-ttl', and the expired cache is still used if the sources
+// are unavailable, e.g. offline.
+func (t *Task) discoverHosts() ([]string, error) {
+	key := t.discoveryKey()
+	if key == "" {
+		return nil, nil
+	}
+
+	ttl := t.configFlags.Hosts.CacheTTL
+	if ttl <= 0 {
+		return t.queryHosts()
+	}
+
+	cache := readHostCache(key)
+	if cache != nil && !t.configFlags.Hosts.Refresh && time.Since(cache.CreatedAt) < ttl {
+		log.Debugf("Discovery: %d target hosts from cache created at %s", len(cache.Hosts), cache.CreatedAt)
+		return t.applyHostCache(cache), nil
+	}
+
+	hosts, err := t.queryHosts()
+	if err != nil {
+		if cache == nil {
+			return nil, err
+		}
+
+		log.Warnf("%s, use the hosts cached at %s", err, cache.CreatedAt.Format("2006-01-02 15:04:05"))
+
+		return t.applyHostCache(cache), nil
+	}
+
+	t.writeHostCache(key, hosts)
+
+	return hosts, nil
+}
+
+// queryHosts queries the sources of discovered hosts.
+func (t *Task) queryHosts() ([]string, error) {
+	hosts, err := t.inventoryHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range t.configFlags.Hosts.SRV {
+		srvHosts, err := t.discoverSRVHosts(name)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = append(hosts, srvHosts...)
+	}
+
+	for _, service := range t.configFlags.Hosts.Consul {
+		consulHosts, err := t.discoverConsulHosts(service)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = append(hosts, consulHosts...)
+	}
+
+	return hosts, nil
+}
+
+// discoverSRVHosts looks up the SRV records of name, and records the ports of the
+// target hosts, which take precedence over '-P/--hosts.port'.
+func (t *Task) discoverSRVHosts(name string) ([]string, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("discover hosts from SRV records of '%s' failed: %s", name, err)
+	}
+
+	if t.hostPorts == nil {
+		t.hostPorts = make(map[string]int)
+	}
+
+	var hosts []string
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		if host == "" {
+			continue
+		}
+
+		hosts = append(hosts, host)
+		t.hostPorts[host] = int(record.Port)
+	}
+
+	log.Debugf("Discovery: %d target hosts from SRV records of '%s'", len(hosts), name)
+
+	return hosts, nil
+}
+
+// discoverConsulHosts gets the nodes of the Consul service in format 'service[@datacenter]',
+// the target hosts are the node names, which are connected by their addresses.
+func (t *Task) discoverConsulHosts(service string) ([]string, error) {
+	name, datacenter := service, ""
+	if i := strings.LastIndex(service, "@"); i != -1 {
+		name, datacenter = service[:i], service[i+1:]
+	}
+
+	addr := t.configFlags.Hosts.ConsulAddr
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = defaultConsulAddr
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	apiURL := strings.TrimSuffix(addr, "/") + "/v1/catalog/service/" + url.PathEscape(name)
+	if datacenter != "" {
+		apiURL += "?dc=" + url.QueryEscape(datacenter)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("discover hosts from consul service '%s' failed: %s", service, err)
+	}
+
+	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	client := &http.Client{Timeout: discoveryTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discover hosts from consul service '%s' failed: %s", service, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("discover hosts from consul service '%s' failed: %s", service, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"discover hosts from consul service '%s' failed: %s: %s",
+			service,
+			resp.Status,
+			strings.TrimSpace(string(body)),
+		)
+	}
+
+	var nodes []consulService
+	if err := json.Unmarshal(body, &nodes); err != nil {
+		return nil, fmt.Errorf("discover hosts from consul service '%s' failed: %s", service, err)
+	}
+
+	if t.hostNames == nil {
+		t.hostNames = make(map[string]string)
+	}
+	if t.hostTags == nil {
+		t.hostTags = make(map[string][]string)
+	}
+
+	var hosts []string
+	for _, node := range nodes {
+		address := node.Address
+		if address == "" {
+			address = node.ServiceAddress
+		}
+
+		host := node.Node
+		if host == "" {
+			host = address
+		}
+
+		hosts = append(hosts, host)
+
+		if address != "" && address != host {
+			t.hostNames[host] = address
+		}
+		t.hostTags[host] = append(t.hostTags[host], node.ServiceTags...)
+	}
+
+	log.Debugf("Discovery: %d target hosts from consul service '%s'", len(hosts), service)
+
+	return hosts, nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/windvalley/gossh/internal/pkg/output"
+)
+
+// slowestHostsCount is the number of the slowest target hosts in the summary.
+const slowestHostsCount = 5
+
+// hostDurations collects the durations of the task on target hosts for the summary,
+// only the durations are kept for the percentiles, and the hostnames of the slowest ones.
+type hostDurations struct {
+	durations []float64
+	slowest   []output.HostDuration
+}
+
+func (d *hostDurations) add(host string, duration time.Duration) {
+	seconds := duration.Seconds()
+	d.durations = append(d.durations, seconds)
+
+	if len(d.slowest) == slowestHostsCount && seconds <= d.slowest[len(d.slowest)-1].Duration {
+		return
+	}
+
+	i := sort.Search(len(d.slowest), func(i int) bool {
+		return d.slowest[i].Duration < seconds
+	})
+
+	d.slowest = append(d.slowest, output.HostDuration{})
+	copy(d.slowest[i+1:], d.slowest[i:])
+	d.slowest[i] = output.HostDuration{Hostname: host, Duration: seconds}
+
+	if len(d.slowest) > slowestHostsCount {
+		d.slowest = d.slowest[:slowestHostsCount]
+	}
+}
+
+// stats returns the percentiles and the slowest target hosts, nil if no target hosts.
+func (d hostDurations) stats() *output.DurationStats {
+	if len(d.durations) == 0 {
+		return nil
+	}
+
+	sorted := append([]float64{}, d.durations...)
+	sort.Float64s(sorted)
+
+	return &output.DurationStats{
+		P50:     percentile(sorted, 50),
+		P95:     percentile(sorted, 95),
+		Max:     sorted[len(sorted)-1],
+		Slowest: d.slowest,
+	}
+}
+
+// percentile by the nearest-rank method of the durations sorted in ascending order.
+func percentile(sorted []float64, p float64) float64 {
+	//nolint:gomnd
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
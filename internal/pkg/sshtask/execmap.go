@@ -0,0 +1,134 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// execMapDigestLength is the length of the digest of exec map in the task description.
+const execMapDigestLength = 8
+
+// ReadExecMap reads the csv file of lines 'host,command', and returns the hosts
+// in the order of the file and the command of each host. The command of a line
+// is the rest after the first comma, so it needs no quotes even if it contains
+// commas, and lines starting with '#' are comments.
+func ReadExecMap(file string) (hosts []string, commands map[string]string, err error) {
+	f, err := os.Open(expandHome(file))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.LazyQuotes = true
+
+	commands = make(map[string]string)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := r.FieldPos(0)
+
+		host := strings.TrimSpace(record[0])
+		command := strings.TrimSpace(strings.Join(record[1:], ","))
+		if host == "" || command == "" {
+			return nil, nil, fmt.Errorf("line %d: need format 'host,command'", line)
+		}
+
+		if _, ok := commands[host]; ok {
+			return nil, nil, fmt.Errorf("line %d: duplicate host '%s'", line, host)
+		}
+
+		hosts = append(hosts, host)
+		commands[host] = command
+	}
+
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("no hosts in it")
+	}
+
+	return hosts, commands, nil
+}
+
+// SetExecMap sets the commands of each target host read from execMapFile by
+// ReadExecMap, which take the place of the command of the task.
+func (t *Task) SetExecMap(execMapFile string, commands map[string]string) {
+	t.execMapFile = execMapFile
+	t.commands = commands
+}
+
+// hostCommand returns the command of the task for the target host.
+func (t *Task) hostCommand(addr string) (string, error) {
+	if t.commands == nil {
+		return t.command, nil
+	}
+
+	command, ok := t.commands[addr]
+	if !ok {
+		return "", fmt.Errorf("no command for '%s' in exec map '%s'", addr, t.execMapFile)
+	}
+
+	return command, nil
+}
+
+// describeExecMap describes the commands of exec map, with the digest of them
+// so that approvals are bound to the exact commands.
+func (t *Task) describeExecMap() string {
+	hosts := make([]string, 0, len(t.commands))
+	distinct := make(map[string]bool)
+	for host, command := range t.commands {
+		hosts = append(hosts, host)
+		distinct[command] = true
+	}
+	sort.Strings(hosts)
+
+	h := sha256.New()
+	for _, host := range hosts {
+		fmt.Fprintf(h, "%s\n%s\n", host, t.commands[host])
+	}
+
+	return fmt.Sprintf(
+		"commands of exec map '%s' (%d hosts, %d distinct commands, digest %s)",
+		t.execMapFile,
+		len(hosts),
+		len(distinct),
+		hex.EncodeToString(h.Sum(nil))[:execMapDigestLength],
+	)
+}
@@ -0,0 +1,204 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of the facts document.
+const (
+	FactsFormatJSON = "json"
+	FactsFormatYAML = "yaml"
+)
+
+// factsCommand prints the facts of target host in format 'key=value' per line.
+const factsCommand = `echo "hostname=$(hostname)";` +
+	`(. /etc/os-release 2>/dev/null; echo "os=${PRETTY_NAME:-$(uname -s)}");` +
+	`echo "kernel=$(uname -r)";` +
+	`echo "arch=$(uname -m)";` +
+	`echo "cpus=$(getconf _NPROCESSORS_ONLN 2>/dev/null)";` +
+	`awk -F': ' '/^model name/{print "cpu_model="$2;exit}' /proc/cpuinfo 2>/dev/null;` +
+	`awk '/^MemTotal:/{print "memory_total="$2} /^MemAvailable:/{print "memory_available="$2}' /proc/meminfo 2>/dev/null;` +
+	`echo "uptime=$(cut -d. -f1 /proc/uptime 2>/dev/null)";` +
+	`df -Pk -x tmpfs -x devtmpfs -x overlay -x squashfs 2>/dev/null|awk 'NR>1{print "disk="$6" "$1" "$2" "$3" "$4}';` +
+	`if command -v ip >/dev/null 2>&1;then ` +
+	`ip -o addr show scope global|awk '{split($4,a,"/");print "ip="$2" "a[1]}';` +
+	`else for i in $(hostname -I 2>/dev/null);do echo "ip=- $i";done;fi`
+
+// hostFacts is the standard fact set of a target host.
+type hostFacts struct {
+	Hostname string      `json:"hostname" yaml:"hostname"`
+	OS       string      `json:"os" yaml:"os"`
+	Kernel   string      `json:"kernel" yaml:"kernel"`
+	Arch     string      `json:"arch" yaml:"arch"`
+	CPUs     int         `json:"cpus" yaml:"cpus"`
+	CPUModel string      `json:"cpu_model" yaml:"cpu_model"`
+	Memory   memoryFacts `json:"memory" yaml:"memory"`
+	Disks    []diskFacts `json:"disks" yaml:"disks"`
+	IPs      []ipFacts   `json:"ips" yaml:"ips"`
+	// Uptime in seconds.
+	Uptime int64 `json:"uptime" yaml:"uptime"`
+}
+
+// memoryFacts in bytes.
+type memoryFacts struct {
+	Total     int64 `json:"total" yaml:"total"`
+	Available int64 `json:"available" yaml:"available"`
+}
+
+// diskFacts in bytes.
+type diskFacts struct {
+	Mount     string `json:"mount" yaml:"mount"`
+	Device    string `json:"device" yaml:"device"`
+	Size      int64  `json:"size" yaml:"size"`
+	Used      int64  `json:"used" yaml:"used"`
+	Available int64  `json:"available" yaml:"available"`
+}
+
+type ipFacts struct {
+	Interface string `json:"interface" yaml:"interface"`
+	Address   string `json:"address" yaml:"address"`
+}
+
+// gatherFacts collects the facts of target host, the facts are kept for
+// the document, and a brief of them is returned as the output of the host.
+func (t *Task) gatherFacts(addr string) (string, error) {
+	output, err := t.sshClient.ExecuteCmd(addr, factsCommand, "", "", false)
+	if err != nil {
+		return output, err
+	}
+
+	facts := parseFacts(output)
+
+	t.factsMu.Lock()
+	t.facts[addr] = facts
+	t.factsMu.Unlock()
+
+	//nolint:gomnd
+	return fmt.Sprintf(
+		"os: %s, kernel: %s, cpus: %d, memory: %dMB, disks: %d, ips: %d, uptime: %dd",
+		facts.OS,
+		facts.Kernel,
+		facts.CPUs,
+		facts.Memory.Total>>20,
+		len(facts.Disks),
+		len(facts.IPs),
+		facts.Uptime/86400,
+	), nil
+}
+
+// parseFacts parses the output of factsCommand, unknown lines are ignored.
+func parseFacts(output string) *hostFacts {
+	facts := &hostFacts{}
+
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+
+		key, value := line[:i], strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "hostname":
+			facts.Hostname = value
+		case "os":
+			facts.OS = value
+		case "kernel":
+			facts.Kernel = value
+		case "arch":
+			facts.Arch = value
+		case "cpus":
+			facts.CPUs, _ = strconv.Atoi(value)
+		case "cpu_model":
+			facts.CPUModel = value
+		case "memory_total":
+			facts.Memory.Total = parseKilobytes(value)
+		case "memory_available":
+			facts.Memory.Available = parseKilobytes(value)
+		case "uptime":
+			facts.Uptime, _ = strconv.ParseInt(value, 10, 64)
+		case "disk":
+			//nolint:gomnd
+			if fields := strings.Fields(value); len(fields) == 5 {
+				facts.Disks = append(facts.Disks, diskFacts{
+					Mount:     fields[0],
+					Device:    fields[1],
+					Size:      parseKilobytes(fields[2]),
+					Used:      parseKilobytes(fields[3]),
+					Available: parseKilobytes(fields[4]),
+				})
+			}
+		case "ip":
+			//nolint:gomnd
+			if fields := strings.Fields(value); len(fields) == 2 {
+				facts.IPs = append(facts.IPs, ipFacts{Interface: fields[0], Address: fields[1]})
+			}
+		}
+	}
+
+	return facts
+}
+
+func parseKilobytes(value string) int64 {
+	kb, _ := strconv.ParseInt(value, 10, 64)
+
+	//nolint:gomnd
+	return kb * 1024
+}
+
+// writeFacts writes the facts of target hosts to the document keyed by host.
+func (t *Task) writeFacts() error {
+	var (
+		content []byte
+		err     error
+	)
+
+	if t.factsMerge {
+		t.mergeFacts()
+	}
+
+	if t.factsFormat == FactsFormatYAML {
+		content, err = yaml.Marshal(t.facts)
+	} else {
+		content, err = json.MarshalIndent(t.facts, "", "  ")
+	}
+
+	if err != nil {
+		return fmt.Errorf("marshal facts failed: %w", err)
+	}
+
+	//nolint:gosec
+	if err := ioutil.WriteFile(t.factsFile, content, 0644); err != nil {
+		return fmt.Errorf("write facts to '%s' failed: %w", t.factsFile, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// factsVarPrefix is the prefix of the host variables loaded from '--hosts.facts-file'.
+const factsVarPrefix = "facts_"
+
+// readFactsFile reads the facts document in json or yaml keyed by host.
+func readFactsFile(file string) (map[string]*hostFacts, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := make(map[string]*hostFacts)
+	if jsonErr := json.Unmarshal(content, &facts); jsonErr != nil {
+		if err := yaml.Unmarshal(content, &facts); err != nil {
+			return nil, fmt.Errorf("neither json(%s) nor yaml(%s)", jsonErr, err)
+		}
+	}
+
+	return facts, nil
+}
+
+// loadFactsVars loads the facts of '--hosts.facts-file' as the variables 'facts_*'
+// of the hosts, the variables annotated in hosts file or of the inventory hosts
+// take precedence. It does nothing if the facts have not been gathered yet.
+func (t *Task) loadFactsVars() error {
+	factsFile := t.configFlags.Hosts.FactsFile
+	if factsFile == "" {
+		return nil
+	}
+
+	facts, err := readFactsFile(expandHome(factsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Debugf("Facts: '%s' not found, gather facts by 'gossh facts' first", factsFile)
+			return nil
+		}
+
+		return fmt.Errorf("read facts file '%s' failed: %w", factsFile, err)
+	}
+
+	if t.hostVars == nil {
+		t.hostVars = make(map[string]map[string]string)
+	}
+
+	for host, f := range facts {
+		if f == nil {
+			continue
+		}
+
+		if t.hostVars[host] == nil {
+			t.hostVars[host] = make(map[string]string)
+		}
+
+		for k, v := range f.vars() {
+			if _, ok := t.hostVars[host][k]; !ok {
+				t.hostVars[host][k] = v
+			}
+		}
+	}
+
+	log.Debugf("Facts: loaded facts of %d hosts from '%s'", len(facts), factsFile)
+
+	return nil
+}
+
+// vars flattens the facts into host variables, the disks are left out.
+func (f *hostFacts) vars() map[string]string {
+	ips := make([]string, 0, len(f.IPs))
+	for _, ip := range f.IPs {
+		ips = append(ips, ip.Address)
+	}
+
+	return map[string]string{
+		factsVarPrefix + "hostname":         f.Hostname,
+		factsVarPrefix + "os":               f.OS,
+		factsVarPrefix + "kernel":           f.Kernel,
+		factsVarPrefix + "arch":             f.Arch,
+		factsVarPrefix + "cpus":             strconv.Itoa(f.CPUs),
+		factsVarPrefix + "cpu_model":        f.CPUModel,
+		factsVarPrefix + "memory_total":     strconv.FormatInt(f.Memory.Total, 10),
+		factsVarPrefix + "memory_available": strconv.FormatInt(f.Memory.Available, 10),
+		factsVarPrefix + "uptime":           strconv.FormatInt(f.Uptime, 10),
+		factsVarPrefix + "ips":              strings.Join(ips, ","),
+	}
+}
+
+// whereHosts keeps the hosts of which the variables match all the conditions
+// of '--hosts.where', a host without the variable does not match.
+func (t *Task) whereHosts(hosts, conditions []string) ([]string, error) {
+	where := configflags.ParseWhere(conditions)
+
+	var matched []string
+	for _, host := range hosts {
+		ok := true
+		for key, pattern := range where {
+			value, found := t.hostVars[host][key]
+			if !found {
+				ok = false
+				break
+			}
+
+			if ok, _ = path.Match(pattern, value); !ok {
+				break
+			}
+		}
+
+		if ok {
+			matched = append(matched, host)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no target hosts match '%s'", strings.Join(conditions, ","))
+	}
+
+	return matched, nil
+}
+
+// mergeFacts merges the facts of the existing document into the gathered ones,
+// so that the document is a cache of all the hosts ever gathered.
+func (t *Task) mergeFacts() {
+	existing, err := readFactsFile(t.factsFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Facts: '%s' is not merged but overwritten: %s", t.factsFile, err)
+		}
+
+		return
+	}
+
+	for host, f := range existing {
+		if _, ok := t.facts[host]; !ok && f != nil {
+			t.facts[host] = f
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+)
+
+// fetchPatternCommandTemplate outputs the regular files matching the pattern
+// on target hosts, newest first by modification time.
+const fetchPatternCommandTemplate = `for f in %s;do [ -f "$f" ] && echo "$(stat -c %%Y "$f" 2>/dev/null) $f";done` +
+	`|sort -rn|cut -d" " -f2-`
+
+// fetchPatternUnsafeChars are not allowed in the pattern, as it is expanded
+// by the shell of target hosts.
+const fetchPatternUnsafeChars = " \t\n'\"\\;&|$`<>()"
+
+// CheckFetchPattern checks the pattern of '--fetch.pattern'.
+func CheckFetchPattern(pattern string) error {
+	if !path.IsAbs(pattern) {
+		return fmt.Errorf("invalid pattern '%s': need absolute path", pattern)
+	}
+
+	if strings.ContainsAny(pattern, fetchPatternUnsafeChars) {
+		return fmt.Errorf("invalid pattern '%s': must not contain spaces, quotes or shell metacharacters", pattern)
+	}
+
+	return nil
+}
+
+// SetFetchPattern sets the pattern of files on target hosts to fetch, and
+// only the newest latest ones are fetched if latest is greater than 0.
+func (t *Task) SetFetchPattern(pattern string, latest int) {
+	t.fetchPattern = pattern
+	t.fetchLatest = latest
+}
+
+// SetFetchFilter skips the files larger than maxSize bytes if it is not 0, and
+// the files/dirs matching excludes.
+func (t *Task) SetFetchFilter(maxSize int64, excludes []string) {
+	if maxSize == 0 && len(excludes) == 0 {
+		return
+	}
+
+	t.fetchFilter = &batchssh.FetchFilter{
+		MaxSize:  maxSize,
+		Excludes: excludes,
+	}
+}
+
+// hostFetchFiles returns the files to fetch from the host, that are the files
+// of '-f/--files' and the newest ones matching the pattern.
+func (t *Task) hostFetchFiles(addr, runAs string, sudo bool) ([]string, error) {
+	if t.fetchPattern == "" {
+		return t.fetchFiles, nil
+	}
+
+	command := fmt.Sprintf(fetchPatternCommandTemplate, t.fetchPattern)
+
+	output, err := t.sshClient.ExecuteCmd(addr, command, "", runAs, sudo)
+	if err != nil {
+		return nil, fmt.Errorf("list files matching '%s' failed: %w", t.fetchPattern, err)
+	}
+
+	var matched []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			matched = append(matched, line)
+		}
+	}
+
+	if t.fetchLatest > 0 && len(matched) > t.fetchLatest {
+		matched = matched[:t.fetchLatest]
+	}
+
+	if len(matched) == 0 && len(t.fetchFiles) == 0 {
+		return nil, errors.New("no files match '" + t.fetchPattern + "'")
+	}
+
+	return append(append([]string{}, t.fetchFiles...), matched...), nil
+}
+
+// describeFetchPattern describes the pattern of the fetch task.
+func (t *Task) describeFetchPattern() string {
+	if t.fetchLatest > 0 {
+		return fmt.Sprintf("newest %d of %s", t.fetchLatest, t.fetchPattern)
+	}
+
+	return t.fetchPattern
+}
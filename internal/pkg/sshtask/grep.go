@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/windvalley/gossh/internal/pkg/output"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// grepCommandTemplate outputs the matched lines as 'FILE\0LINE:TEXT' while
+// skipping binary files, and it is not a failure that nothing matched.
+const grepCommandTemplate = `grep -HnIZ %s -- %s %s;r=$?;[ $r -eq 1 ] && exit 0;exit $r`
+
+// grepMatches of a target host.
+type grepMatches struct {
+	lines int
+	files int
+}
+
+// SetGrepOptions sets the pattern to search in the files of target hosts,
+// and the options of grep, e.g. '-i'.
+func (t *Task) SetGrepOptions(pattern string, files, options []string) {
+	t.grepPattern = pattern
+	t.grepFiles = files
+	t.grepOptions = options
+	t.grepMatches = make(map[string]grepMatches)
+}
+
+func (t *Task) grepCommand() string {
+	return fmt.Sprintf(
+		grepCommandTemplate,
+		strings.Join(t.grepOptions, " "),
+		util.ShellDoubleQuote(t.grepPattern),
+		strings.Join(t.grepFiles, " "),
+	)
+}
+
+// grepHost searches the files on the target host, and outputs the matched
+// lines in format 'HOST:FILE:LINE:TEXT'.
+func (t *Task) grepHost(addr, lang, runAs string, sudo bool) (string, error) {
+	out, err := t.sshClient.ExecuteCmd(addr, t.grepCommand(), lang, runAs, sudo)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		lines   []string
+		matches grepMatches
+	)
+	files := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		i := strings.IndexByte(line, 0)
+		if i == -1 {
+			// Messages of grep, e.g. permission denied of some files.
+			if line != "" {
+				lines = append(lines, line)
+			}
+			continue
+		}
+
+		file := line[:i]
+		if !files[file] {
+			files[file] = true
+			matches.files++
+		}
+		matches.lines++
+
+		lines = append(lines, addr+":"+file+":"+line[i+1:])
+	}
+
+	t.grepMu.Lock()
+	t.grepMatches[addr] = matches
+	t.grepMu.Unlock()
+
+	if matches.lines == 0 && len(lines) == 0 {
+		return "no matches", nil
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// grepStats returns the matches of all target hosts for the summary.
+func (t *Task) grepStats() *output.MatchStats {
+	t.grepMu.Lock()
+	defer t.grepMu.Unlock()
+
+	stats := &output.MatchStats{Hosts: []output.HostMatches{}}
+	for addr, matches := range t.grepMatches {
+		stats.Lines += matches.lines
+		stats.Files += matches.files
+
+		if matches.lines != 0 {
+			stats.Hosts = append(stats.Hosts, output.HostMatches{Hostname: addr, Lines: matches.lines})
+		}
+	}
+
+	sort.Slice(stats.Hosts, func(i, j int) bool {
+		if stats.Hosts[i].Lines != stats.Hosts[j].Lines {
+			return stats.Hosts[i].Lines > stats.Hosts[j].Lines
+		}
+
+		return stats.Hosts[i].Hostname < stats.Hosts[j].Hostname
+	})
+
+	return stats
+}
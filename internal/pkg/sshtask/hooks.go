@@ -0,0 +1,139 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// runLocal executes the hook commands on local, and their output goes to the
+// terminal directly. The extra envs are added to the environment of gossh.
+func runLocal(name, command string, envs ...string) error {
+	log.Debugf("run %s: %s", name, command)
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), envs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s '%s' failed: %w", name, command, err)
+	}
+
+	return nil
+}
+
+// runLocalBefore executes '--run.local-before' if given.
+func (t *Task) runLocalBefore() error {
+	command := t.configFlags.Run.LocalBefore
+	if command == "" {
+		return nil
+	}
+
+	return runLocal("run.local-before", command, "GOSSH_TASK_ID="+t.id)
+}
+
+// runLocalAfter executes '--run.local-after' if given.
+func (t *Task) runLocalAfter(successCount, failedCount int) {
+	command := t.configFlags.Run.LocalAfter
+	if command == "" {
+		return
+	}
+
+	err := runLocal(
+		"run.local-after",
+		command,
+		"GOSSH_TASK_ID="+t.id,
+		fmt.Sprintf("GOSSH_SUCCESS_COUNT=%d", successCount),
+		fmt.Sprintf("GOSSH_FAILED_COUNT=%d", failedCount),
+	)
+	if err != nil {
+		log.Errorf("%s", err)
+	}
+}
+
+// preConnect executes '--ssh.pre-connect' for the target host before connecting it.
+// Its output is not shown unless it fails, so that it does not mix with the results.
+func (t *Task) preConnect(addr, hostName string, port int) error {
+	sshConf := t.configFlags.SSH
+
+	envs := []string{
+		"GOSSH_TASK_ID=" + t.id,
+		"GOSSH_HOST=" + addr,
+		"GOSSH_HOSTNAME=" + hostName,
+		"GOSSH_PORT=" + strconv.Itoa(port),
+	}
+	for key, value := range t.hostVars[addr] {
+		envs = append(envs, "GOSSH_VAR_"+strings.ToUpper(strings.ReplaceAll(key, "-", "_"))+"="+value)
+	}
+
+	log.Debugf("run ssh.pre-connect for %s: %s", addr, sshConf.PreConnect)
+
+	ctx, cancel := context.WithTimeout(context.Background(), sshConf.PreConnectTimeout)
+	defer cancel()
+
+	// The output goes to a file rather than a pipe, otherwise the children left by
+	// a killed command hold the pipe open and the timeout does not take effect.
+	outputFile, err := ioutil.TempFile("", "gossh-pre-connect-")
+	if err != nil {
+		return fmt.Errorf("ssh.pre-connect failed: %s", err)
+	}
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", sshConf.PreConnect)
+	cmd.Env = append(os.Environ(), envs...)
+	cmd.Stdout = outputFile
+	cmd.Stderr = outputFile
+
+	err = cmd.Run()
+	output, _ := ioutil.ReadFile(outputFile.Name())
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timeout after %s", sshConf.PreConnectTimeout)
+	}
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("ssh.pre-connect failed: %s", err)
+	if msg := strings.TrimSpace(string(output)); msg != "" {
+		err = fmt.Errorf("%s: %s", err, msg)
+	}
+
+	if sshConf.PreConnectOnError == configflags.PreConnectOnErrorIgnore {
+		log.Warnf("%s: %s, connect it anyway", addr, err)
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,169 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// hostCache is the discovered hosts cached under $HOME/.gossh/cache, so that
+// repeated invocations do not query service registries and cloud APIs again.
+type hostCache struct {
+	Key       string                       `json:"key"`
+	CreatedAt time.Time                    `json:"created_at"`
+	Hosts     []string                     `json:"hosts"`
+	Names     map[string]string            `json:"names,omitempty"`
+	Ports     map[string]int               `json:"ports,omitempty"`
+	Tags      map[string][]string          `json:"tags,omitempty"`
+	Vars      map[string]map[string]string `json:"vars,omitempty"`
+}
+
+// discoveryKey identifies the sources of discovered hosts, it is empty if there is none.
+func (t *Task) discoveryKey() string {
+	h := t.configFlags.Hosts
+	if len(h.SRV) == 0 && len(h.Consul) == 0 && h.Provider == "" {
+		return ""
+	}
+
+	return strings.Join([]string{
+		"srv=" + strings.Join(h.SRV, ","),
+		"consul=" + strings.Join(h.Consul, ","),
+		"consul-addr=" + h.ConsulAddr,
+		"provider=" + h.Provider,
+		"provider-filters=" + strings.Join(h.ProviderFilters, ","),
+	}, ";")
+}
+
+func hostCacheFile(key string) string {
+	home, _ := os.UserHomeDir()
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(home, ".gossh", "cache", "hosts-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// readHostCache returns nil if there is no cache of the key.
+func readHostCache(key string) *hostCache {
+	content, err := ioutil.ReadFile(hostCacheFile(key))
+	if err != nil {
+		return nil
+	}
+
+	var c hostCache
+	if err := json.Unmarshal(content, &c); err != nil || c.Key != key {
+		return nil
+	}
+
+	return &c
+}
+
+// writeHostCache saves the discovered hosts and their addresses, ports, tags and variables.
+func (t *Task) writeHostCache(key string, hosts []string) {
+	c := hostCache{
+		Key:       key,
+		CreatedAt: time.Now(),
+		Hosts:     hosts,
+		Names:     make(map[string]string),
+		Ports:     make(map[string]int),
+		Tags:      make(map[string][]string),
+		Vars:      make(map[string]map[string]string),
+	}
+
+	for _, host := range hosts {
+		if name, ok := t.hostNames[host]; ok {
+			c.Names[host] = name
+		}
+		if port, ok := t.hostPorts[host]; ok {
+			c.Ports[host] = port
+		}
+		if tags, ok := t.hostTags[host]; ok {
+			c.Tags[host] = tags
+		}
+		if vars, ok := t.hostVars[host]; ok {
+			c.Vars[host] = vars
+		}
+	}
+
+	content, err := json.Marshal(c)
+	if err != nil {
+		log.Debugf("Discovery: write hosts cache failed: %s", err)
+		return
+	}
+
+	file := hostCacheFile(key)
+
+	//nolint:gomnd
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		log.Debugf("Discovery: write hosts cache failed: %s", err)
+		return
+	}
+
+	//nolint:gomnd
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		log.Debugf("Discovery: write hosts cache failed: %s", err)
+	}
+}
+
+// applyHostCache restores the discovered hosts and their addresses, ports, tags and variables.
+func (t *Task) applyHostCache(c *hostCache) []string {
+	if t.hostNames == nil {
+		t.hostNames = make(map[string]string)
+	}
+	if t.hostPorts == nil {
+		t.hostPorts = make(map[string]int)
+	}
+	if t.hostTags == nil {
+		t.hostTags = make(map[string][]string)
+	}
+	if t.hostVars == nil {
+		t.hostVars = make(map[string]map[string]string)
+	}
+
+	for host, name := range c.Names {
+		t.hostNames[host] = name
+	}
+	for host, port := range c.Ports {
+		t.hostPorts[host] = port
+	}
+	for host, tags := range c.Tags {
+		t.hostTags[host] = append(t.hostTags[host], tags...)
+	}
+	for host, vars := range c.Vars {
+		if t.hostVars[host] == nil {
+			t.hostVars[host] = make(map[string]string)
+		}
+		for k, v := range vars {
+			t.hostVars[host][k] = v
+		}
+	}
+
+	return c.Hosts
+}
@@ -0,0 +1,455 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-project-pkg/expandhost"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// colonRangeRegex matches ranges like '[01:10]' which are accepted by
+// '--hosts.limit' as an alternative to '[01-10]'.
+var colonRangeRegex = regexp.MustCompile(`(\d+):(\d+)`)
+
+// hostVarJump is the variable of hosts file for the jump host of the hosts,
+// in format '[user@]host[:port]' like ProxyJump of openssh config file.
+const hostVarJump = "jump"
+
+// groupAll is the group of host expressions for all the inventory hosts.
+const groupAll = "all"
+
+// expandHostPattern expands '[user@]host-pattern', and records the login user
+// of the expanded hosts if it is specified.
+func (t *Task) expandHostPattern(hostOrPattern string) ([]string, error) {
+	user := ""
+	if i := strings.LastIndex(hostOrPattern, "@"); i != -1 {
+		user, hostOrPattern = hostOrPattern[:i], hostOrPattern[i+1:]
+
+		if user == "" || hostOrPattern == "" {
+			return nil, fmt.Errorf("invalid host '%s@%s': need both user and host", user, hostOrPattern)
+		}
+	}
+
+	hosts, err := expandhost.PatternToHosts(hostOrPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host pattern: %s", err)
+	}
+
+	if user != "" {
+		if t.hostUsers == nil {
+			t.hostUsers = make(map[string]string)
+		}
+
+		for _, host := range hosts {
+			t.hostUsers[host] = user
+		}
+	}
+
+	return hosts, nil
+}
+
+// expandHostLine expands a line of hosts file, which is '[user@]host-pattern'
+// optionally followed by annotations in format 'key=value', e.g. 'tags=prod,web'
+// for '--hosts.tags', and the others are variables of the hosts, e.g. 'zone=us-east-1a',
+// 'jump=bastion.us-east-1' for the jump host through which the hosts are connected.
+func (t *Task) expandHostLine(line string) ([]string, error) {
+	fields := strings.Fields(line)
+
+	hosts, err := t.expandHostPattern(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, annotation := range fields[1:] {
+		i := strings.Index(annotation, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid annotation '%s' of '%s': need format 'key=value'", annotation, fields[0])
+		}
+
+		key, value := annotation[:i], annotation[i+1:]
+
+		switch key {
+		case "tags":
+			if t.hostTags == nil {
+				t.hostTags = make(map[string][]string)
+			}
+
+			for _, host := range hosts {
+				t.hostTags[host] = append(t.hostTags[host], strings.Split(value, ",")...)
+			}
+		default:
+			if t.hostVars == nil {
+				t.hostVars = make(map[string]map[string]string)
+			}
+
+			for _, host := range hosts {
+				if t.hostVars[host] == nil {
+					t.hostVars[host] = make(map[string]string)
+				}
+
+				t.hostVars[host][key] = value
+			}
+		}
+	}
+
+	return hosts, nil
+}
+
+// selectHosts applies the subset selectors(tags, regex, where, limit, first, random) to the
+// expanded target hosts.
+func (t *Task) selectHosts(hosts []string) ([]string, error) {
+	hostsConf := t.configFlags.Hosts
+
+	if hostsConf.Tags != "" {
+		tagged, err := t.tagHosts(hosts, hostsConf.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = tagged
+	}
+
+	if hostsConf.Regex != "" {
+		matched, err := regexHosts(hosts, hostsConf.Regex)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = matched
+	}
+
+	if len(hostsConf.Where) != 0 {
+		matched, err := t.whereHosts(hosts, hostsConf.Where)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = matched
+	}
+
+	if hostsConf.Limit != "" {
+		limited, err := limitHosts(hosts, hostsConf.Limit)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = limited
+	}
+
+	if hostsConf.First > 0 && hostsConf.First < len(hosts) {
+		hosts = hosts[:hostsConf.First]
+	}
+
+	if hostsConf.Random > 0 && hostsConf.Random < len(hosts) {
+		shuffled := make([]string, len(hosts))
+		copy(shuffled, hosts)
+
+		r := rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+		r.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		hosts = shuffled[:hostsConf.Random]
+	}
+
+	return hosts, nil
+}
+
+// tagHosts keeps the hosts that have the tags, see configflags.SplitTags.
+func (t *Task) tagHosts(hosts []string, tags string) ([]string, error) {
+	alternatives := configflags.SplitTags(tags)
+
+	var tagged []string
+	for _, host := range hosts {
+		for _, required := range alternatives {
+			if hasAllTags(t.hostTags[host], required) {
+				tagged = append(tagged, host)
+				break
+			}
+		}
+	}
+
+	if len(tagged) == 0 {
+		return nil, fmt.Errorf("no target hosts have the tags '%s'", tags)
+	}
+
+	return tagged, nil
+}
+
+func hasAllTags(hostTags, required []string) bool {
+	for _, tag := range required {
+		if !util.ContainsStr(hostTags, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// spreadHosts orders the hosts round-robin across the groups by variable key, so that
+// hosts of the same group are not next to each other, which reduces the waiting for
+// the slots of '--run.spread-max'. Hosts without the variable are in group "".
+func (t *Task) spreadHosts(hosts []string, key string) (ordered []string, groups map[string]string) {
+	groups = make(map[string]string)
+
+	var groupNames []string
+	members := make(map[string][]string)
+	for _, host := range hosts {
+		group := t.hostVars[host][key]
+		groups[host] = group
+
+		if _, ok := members[group]; !ok {
+			groupNames = append(groupNames, group)
+		}
+		members[group] = append(members[group], host)
+	}
+
+	for i := 0; len(ordered) < len(hosts); i++ {
+		for _, group := range groupNames {
+			if i < len(members[group]) {
+				ordered = append(ordered, members[group][i])
+			}
+		}
+	}
+
+	return ordered, groups
+}
+
+// regexHosts keeps the hosts that match the regular expression.
+func regexHosts(hosts []string, expr string) ([]string, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression '%s': %s", expr, err)
+	}
+
+	var matched []string
+	for _, host := range hosts {
+		if re.MatchString(host) {
+			matched = append(matched, host)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no target hosts match the regular expression '%s'", expr)
+	}
+
+	return matched, nil
+}
+
+// limitHosts keeps the hosts that match the limit pattern. The pattern can be
+// a host pattern like 'web[01:10].bar.com', and each expanded pattern can also
+// contain shell wildcards like 'web*.bar.com'.
+func limitHosts(hosts []string, limit string) ([]string, error) {
+	pattern := colonRangeRegex.ReplaceAllString(strings.TrimSpace(limit), "$1-$2")
+
+	patterns, err := expandhost.PatternToHosts(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid limit pattern '%s': %s", limit, err)
+	}
+
+	var limited []string
+	for _, host := range hosts {
+		for _, p := range patterns {
+			matched, err := path.Match(p, host)
+			if err != nil {
+				return nil, fmt.Errorf("invalid limit pattern '%s': %s", limit, err)
+			}
+
+			if matched {
+				limited = append(limited, host)
+				break
+			}
+		}
+	}
+
+	if len(limited) == 0 {
+		return nil, fmt.Errorf("no target hosts match the limit pattern '%s'", limit)
+	}
+
+	return limited, nil
+}
+
+// evalHostExprs evaluates the positional arguments, each of which is a host pattern or a host
+// expression composed of host patterns and groups(tags of the inventory hosts, and 'all' for all
+// of them) by operators: union ',', intersection '&' and exclusion '!', e.g. 'web,db',
+// 'web&prod', 'web!canary' and '!canary'. '&' and '!' are evaluated from left to right, and
+// then ',' unions the results. If the arguments refer to groups or use '&' or '!', the targets
+// are selected from the inventory(hosts file and discovered hosts) by them, otherwise the
+// targets are both the hosts of the arguments and the inventory hosts as before.
+func (t *Task) evalHostExprs(exprs, inventory []string) ([]string, error) {
+	groups := t.inventoryGroups(inventory)
+
+	var hosts []string
+	selecting := false
+	for _, expr := range exprs {
+		expr = strings.TrimSpace(expr)
+
+		if expr == "" {
+			continue
+		}
+
+		hostList, selected, err := t.evalHostExpr(expr, groups)
+		if err != nil {
+			return nil, err
+		}
+
+		if selected && len(hostList) == 0 {
+			return nil, fmt.Errorf("no target hosts match the host expression '%s'", expr)
+		}
+
+		hosts = append(hosts, hostList...)
+		selecting = selecting || selected
+	}
+
+	if selecting {
+		return hosts, nil
+	}
+
+	return append(hosts, inventory...), nil
+}
+
+// evalHostExpr evaluates a host expression, and reports whether it selects from the inventory.
+func (t *Task) evalHostExpr(expr string, groups map[string][]string) (hosts []string, selected bool, err error) {
+	operands, operators := splitHostExpr(expr)
+
+	var term []string
+	for i, operand := range operands {
+		operator := operators[i]
+
+		if operand == "" {
+			// A term starting with '&' or '!' applies to all the inventory hosts, e.g. '!canary'.
+			if operator == ',' && i+1 < len(operands) && operators[i+1] != ',' {
+				hosts = append(hosts, term...)
+				term, selected = groups[groupAll], true
+				continue
+			}
+
+			return nil, false, fmt.Errorf("invalid host expression '%s': empty host or group", expr)
+		}
+
+		operandHosts, ok := groups[operand]
+		if ok {
+			selected = true
+		} else {
+			operandHosts, err = t.expandHostPattern(operand)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		switch operator {
+		case '&':
+			term, selected = intersectHosts(term, operandHosts), true
+		case '!':
+			term, selected = excludeHosts(term, operandHosts), true
+		default:
+			hosts = append(hosts, term...)
+			term = operandHosts
+		}
+	}
+
+	return append(hosts, term...), selected, nil
+}
+
+// inventoryGroups groups the inventory hosts by their tags, and group 'all' holds all of them.
+func (t *Task) inventoryGroups(inventory []string) map[string][]string {
+	groups := map[string][]string{groupAll: inventory}
+
+	for _, host := range util.RemoveDuplStr(inventory) {
+		for _, tag := range util.RemoveDuplStr(t.hostTags[host]) {
+			if tag != groupAll {
+				groups[tag] = append(groups[tag], host)
+			}
+		}
+	}
+
+	return groups
+}
+
+// splitHostExpr splits the host expression into operands by the operators outside
+// the brackets of host patterns, and the operator before the first operand is ','.
+func splitHostExpr(expr string) (operands []string, operators []byte) {
+	operator := byte(',')
+	depth, start := 0, 0
+
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',', '&', '!':
+			if depth == 0 {
+				operands = append(operands, strings.TrimSpace(expr[start:i]))
+				operators = append(operators, operator)
+				operator, start = c, i+1
+			}
+		}
+	}
+
+	return append(operands, strings.TrimSpace(expr[start:])), append(operators, operator)
+}
+
+func intersectHosts(hosts, others []string) []string {
+	set := hostSet(others)
+
+	var intersected []string
+	for _, host := range hosts {
+		if set[host] {
+			intersected = append(intersected, host)
+		}
+	}
+
+	return intersected
+}
+
+func excludeHosts(hosts, excluded []string) []string {
+	set := hostSet(excluded)
+
+	var kept []string
+	for _, host := range hosts {
+		if !set[host] {
+			kept = append(kept, host)
+		}
+	}
+
+	return kept
+}
+
+func hostSet(hosts []string) map[string]bool {
+	set := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		set[host] = true
+	}
+
+	return set
+}
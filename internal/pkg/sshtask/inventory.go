@@ -0,0 +1,391 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+const inventoryTimeout = 60 * time.Second
+
+// inventoryHost is a target host got from an inventory provider.
+type inventoryHost struct {
+	Name    string
+	Address string
+	// Tags are for '--hosts.tags', and Vars are like the variables of hosts file, e.g. for '--run.spread-by'.
+	Tags []string
+	Vars map[string]string
+}
+
+// inventoryProvider gets target hosts by the filters of '--hosts.provider-filters'.
+type inventoryProvider func(filters map[string]string) ([]inventoryHost, error)
+
+// inventoryProviders are the available values of '--hosts.provider'.
+var inventoryProviders = map[string]inventoryProvider{
+	configflags.ProviderEC2:   ec2Hosts,
+	configflags.ProviderGCE:   gceHosts,
+	configflags.ProviderAzure: azureHosts,
+
+	configflags.ProviderPrometheus: prometheusHosts,
+	configflags.ProviderZabbix:     zabbixHosts,
+}
+
+// inventoryHosts gets target hosts from '--hosts.provider', and records their
+// addresses, tags and variables.
+func (t *Task) inventoryHosts() ([]string, error) {
+	name := t.configFlags.Hosts.Provider
+	if name == "" {
+		return nil, nil
+	}
+
+	provider, ok := inventoryProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hosts provider '%s'", name)
+	}
+
+	filters := configflags.ParseProviderFilters(t.configFlags.Hosts.ProviderFilters)
+
+	inventory, err := provider(filters)
+	if err != nil {
+		return nil, fmt.Errorf("get hosts from provider '%s' failed: %s", name, err)
+	}
+
+	if t.hostNames == nil {
+		t.hostNames = make(map[string]string)
+	}
+	if t.hostTags == nil {
+		t.hostTags = make(map[string][]string)
+	}
+	if t.hostVars == nil {
+		t.hostVars = make(map[string]map[string]string)
+	}
+
+	var hosts []string
+	for _, h := range inventory {
+		if h.Name == "" || h.Address == "" {
+			continue
+		}
+
+		hosts = append(hosts, h.Name)
+
+		if h.Address != h.Name {
+			t.hostNames[h.Name] = h.Address
+		}
+		t.hostTags[h.Name] = append(t.hostTags[h.Name], h.Tags...)
+
+		if t.hostVars[h.Name] == nil {
+			t.hostVars[h.Name] = make(map[string]string)
+		}
+		for k, v := range h.Vars {
+			t.hostVars[h.Name][k] = v
+		}
+	}
+
+	log.Debugf("Discovery: %d target hosts from provider '%s'", len(hosts), name)
+
+	return hosts, nil
+}
+
+// runProviderCLI executes the cli of the provider, e.g. aws/gcloud/az,
+// which handles the credentials the same way as the user does, and
+// decodes its json output into v.
+func runProviderCLI(v interface{}, name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), inventoryTimeout)
+	defer cancel()
+
+	log.Debugf("Discovery: run '%s %s'", name, strings.Join(args, " "))
+
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) != 0 {
+			return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return err
+	}
+
+	return json.Unmarshal(output, v)
+}
+
+// checkFilters returns error if any filter is not supported by the provider,
+// the filter keys ending with '.' accept any suffix, e.g. 'tag.' for 'tag.role'.
+func checkFilters(filters map[string]string, supported ...string) error {
+	for key := range filters {
+		ok := false
+		for _, s := range supported {
+			if key == s || (strings.HasSuffix(s, ".") && strings.HasPrefix(key, s) && len(key) > len(s)) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			available := strings.ReplaceAll(strings.Join(supported, ", ")+",", ".,", ".KEY,")
+			return fmt.Errorf("unsupported filter '%s', available filters: %s", key, strings.TrimSuffix(available, ","))
+		}
+	}
+
+	return nil
+}
+
+// keyValueTags converts the key/value tags or labels of clouds to tags 'key=value'
+// for '--hosts.tags' and variables of the hosts.
+func keyValueTags(kv map[string]string, h *inventoryHost) {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		h.Tags = append(h.Tags, k+"="+kv[k])
+		h.Vars[k] = kv[k]
+	}
+}
+
+// ec2Hosts gets the running EC2 instances by 'aws ec2 describe-instances'.
+// Filters: region, profile, tag.KEY, address(private or public).
+func ec2Hosts(filters map[string]string) ([]inventoryHost, error) {
+	if err := checkFilters(filters, "region", "profile", "address", "tag."); err != nil {
+		return nil, err
+	}
+
+	args := []string{"ec2", "describe-instances", "--output", "json"}
+	if filters["region"] != "" {
+		args = append(args, "--region", filters["region"])
+	}
+	if filters["profile"] != "" {
+		args = append(args, "--profile", filters["profile"])
+	}
+
+	args = append(args, "--filters", "Name=instance-state-name,Values=running")
+	for k, v := range filters {
+		if strings.HasPrefix(k, "tag.") {
+			args = append(args, fmt.Sprintf("Name=tag:%s,Values=%s", strings.TrimPrefix(k, "tag."), v))
+		}
+	}
+
+	var result struct {
+		Reservations []struct {
+			Instances []struct {
+				InstanceID       string `json:"InstanceId"`
+				PrivateIPAddress string `json:"PrivateIpAddress"`
+				PublicIPAddress  string `json:"PublicIpAddress"`
+				Placement        struct {
+					AvailabilityZone string
+				}
+				Tags []struct {
+					Key   string
+					Value string
+				}
+			}
+		}
+	}
+	if err := runProviderCLI(&result, "aws", args...); err != nil {
+		return nil, err
+	}
+
+	var hosts []inventoryHost
+	for _, r := range result.Reservations {
+		for _, i := range r.Instances {
+			h := inventoryHost{
+				Name:    i.InstanceID,
+				Address: i.PrivateIPAddress,
+				Vars:    map[string]string{"zone": i.Placement.AvailabilityZone},
+			}
+			if filters["address"] == "public" {
+				h.Address = i.PublicIPAddress
+			}
+
+			tags := make(map[string]string)
+			for _, tag := range i.Tags {
+				tags[tag.Key] = tag.Value
+				if tag.Key == "Name" && tag.Value != "" {
+					h.Name = tag.Value
+				}
+			}
+			keyValueTags(tags, &h)
+
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts, nil
+}
+
+// gceHosts gets the running GCE instances by 'gcloud compute instances list'.
+// Filters: project, zone, label.KEY, address(private or public).
+func gceHosts(filters map[string]string) ([]inventoryHost, error) {
+	if err := checkFilters(filters, "project", "zone", "address", "label."); err != nil {
+		return nil, err
+	}
+
+	args := []string{"compute", "instances", "list", "--format", "json"}
+	if filters["project"] != "" {
+		args = append(args, "--project", filters["project"])
+	}
+	if filters["zone"] != "" {
+		args = append(args, "--zones", filters["zone"])
+	}
+
+	expressions := []string{"status=RUNNING"}
+	for k, v := range filters {
+		if strings.HasPrefix(k, "label.") {
+			expressions = append(expressions, fmt.Sprintf("labels.%s=%s", strings.TrimPrefix(k, "label."), v))
+		}
+	}
+	sort.Strings(expressions)
+	args = append(args, "--filter", strings.Join(expressions, " AND "))
+
+	var result []struct {
+		Name              string
+		Zone              string
+		Labels            map[string]string
+		NetworkInterfaces []struct {
+			NetworkIP     string
+			AccessConfigs []struct {
+				NatIP string
+			}
+		}
+		Tags struct {
+			Items []string
+		}
+	}
+	if err := runProviderCLI(&result, "gcloud", args...); err != nil {
+		return nil, err
+	}
+
+	var hosts []inventoryHost
+	for _, i := range result {
+		h := inventoryHost{
+			Name: i.Name,
+			// Zone is an url like '.../zones/us-central1-a'.
+			Vars: map[string]string{"zone": path.Base(i.Zone)},
+			Tags: i.Tags.Items,
+		}
+
+		if len(i.NetworkInterfaces) != 0 {
+			nic := i.NetworkInterfaces[0]
+			h.Address = nic.NetworkIP
+			if filters["address"] == "public" {
+				h.Address = ""
+				if len(nic.AccessConfigs) != 0 {
+					h.Address = nic.AccessConfigs[0].NatIP
+				}
+			}
+		}
+
+		keyValueTags(i.Labels, &h)
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
+
+// azureHosts gets the running Azure VMs by 'az vm list -d'.
+// Filters: subscription, resource-group, tag.KEY, address(private or public).
+func azureHosts(filters map[string]string) ([]inventoryHost, error) {
+	if err := checkFilters(filters, "subscription", "resource-group", "address", "tag."); err != nil {
+		return nil, err
+	}
+
+	args := []string{"vm", "list", "--show-details", "--output", "json"}
+	if filters["subscription"] != "" {
+		args = append(args, "--subscription", filters["subscription"])
+	}
+	if filters["resource-group"] != "" {
+		args = append(args, "--resource-group", filters["resource-group"])
+	}
+
+	var result []struct {
+		Name          string
+		Location      string
+		ResourceGroup string
+		PowerState    string
+		PrivateIps    string
+		PublicIps     string
+		Tags          map[string]string
+	}
+	if err := runProviderCLI(&result, "az", args...); err != nil {
+		return nil, err
+	}
+
+	var hosts []inventoryHost
+	for _, vm := range result {
+		if vm.PowerState != "" && vm.PowerState != "VM running" {
+			continue
+		}
+
+		if !matchTags(vm.Tags, filters, "tag.") {
+			continue
+		}
+
+		// The ips of all the nics are joined by ','.
+		address := vm.PrivateIps
+		if filters["address"] == "public" {
+			address = vm.PublicIps
+		}
+
+		h := inventoryHost{
+			Name:    vm.Name,
+			Address: strings.Split(address, ",")[0],
+			Vars: map[string]string{
+				"location":       vm.Location,
+				"resource-group": vm.ResourceGroup,
+			},
+		}
+		keyValueTags(vm.Tags, &h)
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
+
+// matchTags reports whether tags have all the filters with the prefix.
+func matchTags(tags, filters map[string]string, prefix string) bool {
+	for k, v := range filters {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		if value, ok := tags[strings.TrimPrefix(k, prefix)]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
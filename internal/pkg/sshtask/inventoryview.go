@@ -0,0 +1,205 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// Views of inventory.
+const (
+	InventoryViewList  = "list"
+	InventoryViewGraph = "graph"
+)
+
+// Formats of inventory.
+const (
+	InventoryFormatText = "text"
+	InventoryFormatJSON = "json"
+)
+
+// ungrouped is the group of the hosts without tags.
+const ungrouped = "ungrouped"
+
+// InventoryHost is a resolved target host.
+type InventoryHost struct {
+	Host    string            `json:"host"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	User    string            `json:"user"`
+	Groups  []string          `json:"groups"`
+	Vars    map[string]string `json:"vars"`
+}
+
+// ShowInventory prints the resolved target hosts with their groups(tags) and variables,
+// after pattern expansion, selection and discovery, without connecting any of them.
+// The group keeps the hosts that have the tags like '--hosts.tags' if it is not empty.
+func (t *Task) ShowInventory(view, group, format string) error {
+	hosts, err := t.getAllHosts()
+	if err != nil {
+		return err
+	}
+
+	if group != "" {
+		hosts, err = t.tagHosts(hosts, group)
+		if err != nil {
+			return err
+		}
+	}
+
+	inventory := make([]InventoryHost, 0, len(hosts))
+	for _, host := range hosts {
+		h := InventoryHost{
+			Host:    host,
+			Address: host,
+			Port:    t.configFlags.Hosts.Port,
+			User:    t.configFlags.Auth.User,
+			Groups:  util.RemoveDuplStr(t.hostTags[host]),
+			Vars:    t.hostVars[host],
+		}
+
+		if name, ok := t.hostNames[host]; ok {
+			h.Address = name
+		}
+		if port, ok := t.hostPorts[host]; ok {
+			h.Port = port
+		}
+		if user, ok := t.hostUsers[host]; ok {
+			h.User = user
+		}
+		if h.Vars == nil {
+			h.Vars = map[string]string{}
+		}
+
+		inventory = append(inventory, h)
+	}
+
+	if view == InventoryViewGraph {
+		return writeInventoryGraph(os.Stdout, inventory, format)
+	}
+
+	return writeInventoryList(os.Stdout, inventory, format)
+}
+
+func writeInventoryList(w io.Writer, inventory []InventoryHost, format string) error {
+	if format == InventoryFormatJSON {
+		return writeJSON(w, inventory)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tADDRESS\tPORT\tUSER\tGROUPS\tVARS")
+
+	for _, h := range inventory {
+		vars := make([]string, 0, len(h.Vars))
+		for k, v := range h.Vars {
+			vars = append(vars, k+"="+v)
+		}
+		sort.Strings(vars)
+
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%d\t%s\t%s\t%s\n",
+			h.Host,
+			h.Address,
+			h.Port,
+			orDash(h.User),
+			orDash(strings.Join(h.Groups, ",")),
+			orDash(strings.Join(vars, " ")),
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "\nhosts (%d)\n", len(inventory))
+
+	return nil
+}
+
+// writeInventoryGraph prints the hosts by groups, and a host is in each group of its tags.
+func writeInventoryGraph(w io.Writer, inventory []InventoryHost, format string) error {
+	groups := make(map[string][]string)
+	for _, h := range inventory {
+		if len(h.Groups) == 0 {
+			groups[ungrouped] = append(groups[ungrouped], h.Host)
+			continue
+		}
+
+		for _, g := range h.Groups {
+			groups[g] = append(groups[g], h.Host)
+		}
+	}
+
+	if format == InventoryFormatJSON {
+		return writeJSON(w, groups)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		if name != ungrouped {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := groups[ungrouped]; ok {
+		names = append(names, ungrouped)
+	}
+
+	fmt.Fprintf(w, "@all (%d):\n", len(inventory))
+	for _, name := range names {
+		fmt.Fprintf(w, "  |--@%s (%d):\n", name, len(groups[name]))
+		for _, host := range groups[name] {
+			fmt.Fprintf(w, "  |  |--%s\n", host)
+		}
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", content)
+
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
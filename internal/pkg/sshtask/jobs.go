@@ -0,0 +1,237 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// JobRecord is the handle of a detached task saved under $HOME/.gossh/jobs,
+// by which subcommand 'jobs' reconnects to the target hosts of the task.
+type JobRecord struct {
+	TaskID    string    `json:"task_id"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+	Sudo      bool      `json:"sudo"`
+	AsUser    string    `json:"as_user"`
+	TmpDir    string    `json:"tmp_dir,omitempty"`
+	Hosts     []string  `json:"hosts"`
+}
+
+// jobStatusRegexp matches the status line output by jobCommandTemplate.
+var jobStatusRegexp = regexp.MustCompile(`^(exited: (\d+)|running|killed), pid: \d+$`)
+
+func jobsDir() string {
+	home, _ := os.UserHomeDir()
+
+	return filepath.Join(home, ".gossh", "jobs")
+}
+
+// saveJob saves the record of the detached task with the hosts that started the commands.
+func (t *Task) saveJob(hosts []string) {
+	job := JobRecord{
+		TaskID:    t.id,
+		Command:   t.command,
+		StartedAt: time.Now(),
+		Sudo:      t.configFlags.Run.Sudo,
+		AsUser:    t.configFlags.Run.AsUser,
+		TmpDir:    t.configFlags.Run.TmpDir,
+		Hosts:     hosts,
+	}
+
+	content, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		log.Warnf("Detach: save job record failed: %s", err)
+		return
+	}
+
+	//nolint:gomnd
+	if err := os.MkdirAll(jobsDir(), 0700); err != nil {
+		log.Warnf("Detach: save job record failed: %s", err)
+		return
+	}
+
+	//nolint:gomnd
+	if err := ioutil.WriteFile(filepath.Join(jobsDir(), t.id+".json"), content, 0600); err != nil {
+		log.Warnf("Detach: save job record failed: %s", err)
+	}
+}
+
+func readJob(taskID string) (*JobRecord, error) {
+	content, err := ioutil.ReadFile(filepath.Join(jobsDir(), taskID+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("job %s not found", taskID)
+		}
+
+		return nil, fmt.Errorf("read job record failed: %w", err)
+	}
+
+	var job JobRecord
+	if err := json.Unmarshal(content, &job); err != nil {
+		return nil, fmt.Errorf("parse job record of %s failed: %w", taskID, err)
+	}
+
+	return &job, nil
+}
+
+// SetJob sets the saved job to check or collect, the target hosts and the
+// sudo options of the task are the recorded ones, and destPath is the local
+// directory to which the job files are collected.
+func (t *Task) SetJob(taskID, destPath string) error {
+	job, err := readJob(taskID)
+	if err != nil {
+		return err
+	}
+
+	t.job = job
+	t.attachTaskID = taskID
+	t.dstDir = destPath
+
+	t.configFlags.Run.Sudo = job.Sudo
+	t.configFlags.Run.AsUser = job.AsUser
+	t.configFlags.Run.TmpDir = job.TmpDir
+
+	return nil
+}
+
+// collectJob saves the output and the exit code of the job to the local
+// directory 'DEST_PATH/TASK_ID/HOST', and reports the status of the job.
+func (t *Task) collectJob(addr string) (string, error) {
+	output, jobErr := t.checkJob(addr, true)
+	if jobErr != nil {
+		// The output of the failed job is the error.
+		output = jobErr.Error()
+	}
+
+	status, jobOutput := output, ""
+	if i := strings.Index(output, "\n"); i >= 0 {
+		status, jobOutput = strings.TrimRight(output[:i], "\r"), output[i+1:]
+	}
+
+	matches := jobStatusRegexp.FindStringSubmatch(status)
+	if matches == nil {
+		if jobErr == nil {
+			jobErr = fmt.Errorf("unexpected status of job: %s", status)
+		}
+
+		return "", jobErr
+	}
+
+	dir := filepath.Join(t.dstDir, t.attachTaskID, addr)
+
+	//nolint:gomnd
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	//nolint:gosec,gomnd
+	if err := ioutil.WriteFile(filepath.Join(dir, "output"), []byte(jobOutput), 0644); err != nil {
+		return "", err
+	}
+
+	if code := matches[2]; code != "" {
+		//nolint:gosec,gomnd
+		if err := ioutil.WriteFile(filepath.Join(dir, "exit"), []byte(code+"\n"), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	message := fmt.Sprintf("%s, collected to '%s'", status, dir)
+	if jobErr != nil {
+		return "", errors.New(message)
+	}
+
+	return message, nil
+}
+
+// ShowJobs writes the saved jobs to stdout in format text or json.
+func ShowJobs(format string) error {
+	files, err := filepath.Glob(filepath.Join(jobsDir(), "*.json"))
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]*JobRecord, 0, len(files))
+	for _, file := range files {
+		job, err := readJob(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			log.Warnf("%s", err)
+			continue
+		}
+
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].TaskID < jobs[j].TaskID
+	})
+
+	if format == InventoryFormatJSON {
+		return writeJSON(os.Stdout, jobs)
+	}
+
+	return writeJobList(os.Stdout, jobs)
+}
+
+func writeJobList(w io.Writer, jobs []*JobRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK ID\tSTARTED\tHOSTS\tSUDO\tCOMMAND")
+
+	for _, job := range jobs {
+		sudo := "-"
+		if job.Sudo {
+			sudo = job.AsUser
+		}
+
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%d\t%s\t%s\n",
+			job.TaskID,
+			job.StartedAt.Format("2006-01-02 15:04:05"),
+			len(job.Hosts),
+			sudo,
+			strings.Join(strings.Fields(job.Command), " "),
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "\njobs (%d)\n", len(jobs))
+
+	return nil
+}
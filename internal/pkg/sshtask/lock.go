@@ -0,0 +1,221 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// taskLock is the content of the lock file of '--run.lock'.
+type taskLock struct {
+	Name      string    `json:"name"`
+	User      string    `json:"user"`
+	Hostname  string    `json:"hostname"`
+	Pid       int       `json:"pid"`
+	Task      string    `json:"task"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// lockFile returns the path of the lock file of name.
+func (t *Task) lockFile(name string) string {
+	dir := t.configFlags.Run.LockDir
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".gossh", "locks")
+	}
+
+	return filepath.Join(dir, name+".lock")
+}
+
+// acquireLock holds the lock of '--run.lock' during the task, so that the
+// conflicting tasks of several operators can not run at the same time. The
+// returned function releases the lock.
+//
+// The lock left by a gossh process that has died on the same host is stale
+// and taken over, the one of other hosts has to be removed by hand.
+func (t *Task) acquireLock() (func(), error) {
+	name := t.configFlags.Run.Lock
+	file := t.lockFile(name)
+
+	//nolint:gomnd
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, fmt.Errorf("create lock directory failed: %w", err)
+	}
+
+	user, err := currentUser()
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+
+	content, err := json.Marshal(&taskLock{
+		Name:      name,
+		User:      user,
+		Hostname:  hostname,
+		Pid:       os.Getpid(),
+		Task:      t.describe(),
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for attempts := 0; ; attempts++ {
+		err := createLockFile(file, content)
+		if err == nil {
+			log.Debugf("acquired lock '%s' in '%s'", name, file)
+
+			return func() {
+				if err := os.Remove(file); err != nil {
+					log.Warnf("release lock '%s' failed: %s", name, err)
+				}
+			}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("create lock file '%s' failed: %w", file, err)
+		}
+
+		holder, stale, err := readLockFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// Released just now.
+			continue
+		}
+		if err != nil {
+			// Unreadable lock files, e.g. of older versions being written, are held.
+			return nil, fmt.Errorf("lock '%s' is held: %s, remove '%s' if it is stale", name, err, file)
+		}
+
+		if holder.Hostname != hostname || processAlive(holder.Pid) {
+			return nil, fmt.Errorf(
+				"lock '%s' is held by %s@%s(pid %d) since %s: %s, remove '%s' if it is stale",
+				name,
+				holder.User,
+				holder.Hostname,
+				holder.Pid,
+				holder.StartedAt.Format(time.RFC3339),
+				holder.Task,
+				file,
+			)
+		}
+
+		log.Warnf("remove stale lock '%s' of dead process %d", name, holder.Pid)
+
+		err = removeStaleLock(file, stale, content)
+		if errors.Is(err, errLockTakeover) && attempts < lockTakeoverRetries {
+			time.Sleep(lockTakeoverInterval)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("remove stale lock file '%s' failed: %w", file, err)
+		}
+	}
+}
+
+const (
+	// lockTakeoverRetries and lockTakeoverInterval wait for the takeover of
+	// the stale lock by another process.
+	lockTakeoverRetries  = 50
+	lockTakeoverInterval = 100 * time.Millisecond
+)
+
+var errLockTakeover = errors.New("being taken over by another process")
+
+// createLockFile creates file with content atomically, it fails with os.ErrExist
+// if file exists, and file is never seen empty or partially written, as it is
+// written to a temporary file first and then linked.
+func createLockFile(file string, content []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	// Readable by the operators sharing the lock dir, like the lock files created directly.
+	//nolint:gomnd
+	err = f.Chmod(0644)
+	if err == nil {
+		_, err = f.Write(content)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Link(f.Name(), file)
+}
+
+// removeStaleLock removes the lock file of the dead holder whose content is stale.
+// Takeovers are serialized by a guard file, and the lock file is read again under
+// it, so that a lock file created just now after another takeover is not removed.
+func removeStaleLock(file string, stale, content []byte) error {
+	guard := file + ".takeover"
+	if err := createLockFile(guard, content); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w, remove '%s' if it is stale", errLockTakeover, guard)
+		}
+
+		return err
+	}
+	defer os.Remove(guard)
+
+	current, err := ioutil.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Taken over by another process already.
+	if !bytes.Equal(current, stale) {
+		return nil
+	}
+
+	return os.Remove(file)
+}
+
+func readLockFile(file string) (*taskLock, []byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	holder := &taskLock{}
+	if err := json.Unmarshal(content, holder); err != nil {
+		return nil, nil, fmt.Errorf("parse lock file '%s' failed: %w", file, err)
+	}
+
+	return holder, content, nil
+}
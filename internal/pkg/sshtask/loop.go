@@ -0,0 +1,160 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// loopItem is the data of the command template of '--loop', e.g. 'systemctl restart {{.Item}}'.
+type loopItem struct {
+	Item string
+}
+
+// ReadLoopItems reads the items of '--loop', one item per line,
+// and empty lines and lines starting with '#' are skipped.
+func ReadLoopItems(file string) ([]string, error) {
+	f, err := os.Open(expandHome(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		item := strings.TrimSpace(scanner.Text())
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items in it")
+	}
+
+	return items, nil
+}
+
+// SetLoop sets the items read from loopFile by ReadLoopItems, and the command
+// runs once per item on each target host.
+func (t *Task) SetLoop(loopFile string, items []string) {
+	t.loopFile = loopFile
+	t.loopItems = items
+}
+
+// renderLoop returns the commands rendered by each loop item,
+// or the command itself if there are no loop items.
+func (t *Task) renderLoop(command string) ([]string, error) {
+	if t.loopItems == nil {
+		return []string{command}, nil
+	}
+
+	tmpl, err := template.New("loop").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command template: %s", err)
+	}
+
+	commands := make([]string, 0, len(t.loopItems))
+	for _, item := range t.loopItems {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, loopItem{Item: item}); err != nil {
+			return nil, fmt.Errorf("render command by item '%s' failed: %s", item, err)
+		}
+
+		commands = append(commands, buf.String())
+	}
+
+	return commands, nil
+}
+
+// checkLoop renders the commands of the task by the loop items before execution.
+func (t *Task) checkLoop() error {
+	if t.commands == nil {
+		_, err := t.renderLoop(t.command)
+		return err
+	}
+
+	for host, command := range t.commands {
+		if _, err := t.renderLoop(command); err != nil {
+			return fmt.Errorf("exec map '%s', host '%s': %w", t.execMapFile, host, err)
+		}
+	}
+
+	return nil
+}
+
+// loopCommand runs the command once per loop item one after another, outputs
+// the result of each item, and fails if any item failed with the exit code of
+// the last failed item, so that failures are not hidden as by shell for-loops.
+func (t *Task) loopCommand(command string) (string, error) {
+	commands, err := t.renderLoop(command)
+	if err != nil || t.loopItems == nil {
+		return command, err
+	}
+
+	var b strings.Builder
+
+	b.WriteString("f=0;r=0\n")
+	for i, item := range t.loopItems {
+		label := "[item " + item + "]"
+
+		fmt.Fprintf(&b, "echo %s\n(\n%s\n)\n", util.ShellDoubleQuote(label), commands[i])
+		fmt.Fprintf(&b, "e=$?;if [ $e -eq 0 ];then echo %s;else echo %s\"$e\";f=$((f+1));r=$e;fi\n",
+			util.ShellDoubleQuote(label+" SUCCESS"),
+			util.ShellDoubleQuote(label+" FAILED, exit code: "),
+		)
+	}
+	fmt.Fprintf(&b, `[ $f -eq 0 ] || { echo "$f of %d items failed";exit $r; }`, len(t.loopItems))
+
+	return b.String(), nil
+}
+
+// describeLoop describes the loop items, with the digest of them so that
+// approvals are bound to the exact items.
+func (t *Task) describeLoop() string {
+	sum := sha256.Sum256([]byte(strings.Join(t.loopItems, "\n")))
+
+	return fmt.Sprintf(
+		"loop items of '%s' (%d items, digest %s)",
+		t.loopFile,
+		len(t.loopItems),
+		hex.EncodeToString(sum[:])[:execMapDigestLength],
+	)
+}
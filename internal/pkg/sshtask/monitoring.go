@@ -0,0 +1,303 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// getJSON sends the request, and decodes the json response into v.
+func getJSON(req *http.Request, v interface{}) error {
+	client := &http.Client{Timeout: discoveryTimeout}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// prometheusHosts gets the hosts of the active targets of Prometheus, which are
+// the host part of the label 'instance'. Only the targets that are up are kept
+// unless the filter 'health=any' is given.
+// Filters: url, job, health, label.KEY.
+func prometheusHosts(filters map[string]string) ([]inventoryHost, error) {
+	if err := checkFilters(filters, "url", "job", "health", "label."); err != nil {
+		return nil, err
+	}
+
+	if filters["url"] == "" {
+		return nil, errors.New("need filter 'url' of Prometheus, e.g. url=http://prometheus:9090")
+	}
+
+	apiURL := strings.TrimSuffix(filters["url"], "/") + "/api/v1/targets?state=active"
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Status string
+		Error  string
+		Data   struct {
+			ActiveTargets []struct {
+				Labels map[string]string
+				Health string
+			}
+		}
+	}
+	if err := getJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Status != "success" {
+		return nil, fmt.Errorf("query targets failed: %s", result.Error)
+	}
+
+	var hosts []inventoryHost
+	for _, target := range result.Data.ActiveTargets {
+		if filters["health"] != "any" && target.Health != "up" {
+			continue
+		}
+
+		if filters["job"] != "" && target.Labels["job"] != filters["job"] {
+			continue
+		}
+
+		if !matchTags(target.Labels, filters, "label.") {
+			continue
+		}
+
+		host := target.Labels["instance"]
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		h := inventoryHost{
+			Name:    host,
+			Address: host,
+			Vars:    make(map[string]string),
+		}
+		keyValueTags(target.Labels, &h)
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
+
+// zabbixClient calls Zabbix API with the API token of $ZABBIX_API_TOKEN,
+// which is supported by Zabbix 5.4 or later.
+type zabbixClient struct {
+	url   string
+	token string
+	// authHeader is for Zabbix 6.4 or later, which takes the token by header
+	// 'Authorization' rather than the deprecated property 'auth'.
+	authHeader bool
+}
+
+func newZabbixClient(apiURL string) (*zabbixClient, error) {
+	token := os.Getenv("ZABBIX_API_TOKEN")
+	if token == "" {
+		return nil, errors.New("need the API token of Zabbix in $ZABBIX_API_TOKEN")
+	}
+
+	z := &zabbixClient{url: apiURL}
+
+	var version string
+	if err := z.request("apiinfo.version", []string{}, &version); err != nil {
+		return nil, err
+	}
+
+	var major, minor int
+	_, _ = fmt.Sscanf(version, "%d.%d", &major, &minor)
+	//nolint:gomnd
+	z.authHeader = major > 6 || (major == 6 && minor >= 4)
+	z.token = token
+
+	return z, nil
+}
+
+func (z *zabbixClient) request(method string, params, v interface{}) error {
+	body := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	}
+	if z.token != "" && !z.authHeader {
+		body["auth"] = z.token
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, z.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json-rpc")
+	if z.token != "" && z.authHeader {
+		req.Header.Set("Authorization", "Bearer "+z.token)
+	}
+
+	var result struct {
+		Result json.RawMessage
+		Error  *struct {
+			Message string
+			Data    string
+		}
+	}
+	if err := getJSON(req, &result); err != nil {
+		return err
+	}
+
+	if result.Error != nil {
+		return fmt.Errorf("%s failed: %s %s", method, result.Error.Message, result.Error.Data)
+	}
+
+	return json.Unmarshal(result.Result, v)
+}
+
+// zabbixHosts gets the monitored hosts of the Zabbix host groups, which are
+// connected by the main agent interface. The host groups are the tags of hosts.
+// Filters: url, group (host groups joined by '|').
+func zabbixHosts(filters map[string]string) ([]inventoryHost, error) {
+	if err := checkFilters(filters, "url", "group"); err != nil {
+		return nil, err
+	}
+
+	if filters["url"] == "" {
+		return nil, errors.New("need filter 'url' of Zabbix, e.g. url=https://zabbix/api_jsonrpc.php")
+	}
+
+	z, err := newZabbixClient(filters["url"])
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{
+		"output":           []string{"host", "name"},
+		"selectInterfaces": []string{"ip", "dns", "useip", "main", "type"},
+		"selectGroups":     []string{"name"},
+		// 0 means monitored.
+		"filter": map[string]interface{}{"status": "0"},
+	}
+
+	if filters["group"] != "" {
+		var groups []struct {
+			GroupID string `json:"groupid"`
+		}
+		err := z.request("hostgroup.get", map[string]interface{}{
+			"output": []string{"groupid"},
+			"filter": map[string]interface{}{"name": strings.Split(filters["group"], "|")},
+		}, &groups)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(groups) == 0 {
+			return nil, fmt.Errorf("host group '%s' not found", filters["group"])
+		}
+
+		var groupIDs []string
+		for _, g := range groups {
+			groupIDs = append(groupIDs, g.GroupID)
+		}
+		params["groupids"] = groupIDs
+	}
+
+	var result []struct {
+		Host       string
+		Interfaces []struct {
+			IP    string
+			DNS   string
+			UseIP string
+			Main  string
+			Type  string
+		}
+		Groups []struct {
+			Name string
+		}
+	}
+	if err := z.request("host.get", params, &result); err != nil {
+		return nil, err
+	}
+
+	var hosts []inventoryHost
+	for _, r := range result {
+		h := inventoryHost{
+			Name: r.Host,
+			Vars: make(map[string]string),
+		}
+
+		// The main agent interface(type 1) is preferred, then the other main interfaces.
+		for _, i := range r.Interfaces {
+			if i.Main != "1" {
+				continue
+			}
+
+			address := i.DNS
+			if i.UseIP == "1" {
+				address = i.IP
+			}
+
+			if h.Address == "" || i.Type == "1" {
+				h.Address = address
+			}
+		}
+
+		for _, g := range r.Groups {
+			if !util.ContainsStr(h.Tags, g.Name) {
+				h.Tags = append(h.Tags, g.Name)
+			}
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	return hosts, nil
+}
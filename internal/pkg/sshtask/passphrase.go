@@ -0,0 +1,104 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/windvalley/gossh/pkg/log"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// getKeyPassphrase returns the passphrase of keyfile, in order of precedence:
+// entered from terminal prompt before, '--auth.key-passphrases', defaultPassphrase.
+func (t *Task) getKeyPassphrase(keyfile, defaultPassphrase string) string {
+	if passphrase, ok := t.keyPassphrases[keyfile]; ok {
+		return passphrase
+	}
+
+	for _, v := range t.configFlags.Auth.KeyPassphrases {
+		i := strings.Index(v, "=")
+		if i == -1 {
+			continue
+		}
+
+		if !sameFile(expandHome(v[:i]), keyfile) {
+			continue
+		}
+
+		passphrase := v[i+1:]
+		assignRealPass(&passphrase)
+
+		return passphrase
+	}
+
+	return defaultPassphrase
+}
+
+func (t *Task) setKeyPassphrase(keyfile, passphrase string) {
+	if t.keyPassphrases == nil {
+		t.keyPassphrases = make(map[string]string)
+	}
+
+	t.keyPassphrases[keyfile] = passphrase
+}
+
+func promptKeyPassphrase(keyfile string) string {
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", keyfile)
+
+	passphraseByte, err := term.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		err = fmt.Errorf("get passphrase from terminal failed: %s", err)
+	}
+	util.CheckErr(err)
+
+	fmt.Fprintln(os.Stderr, "")
+
+	log.Debugf("Auth: received passphrase of identity file '%s' from terminal prompt", keyfile)
+
+	return string(passphraseByte)
+}
+
+func expandHome(file string) string {
+	if strings.HasPrefix(file, "~/") {
+		return strings.Replace(file, "~", os.Getenv("HOME"), 1)
+	}
+
+	return file
+}
+
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/windvalley/gossh/pkg/log"
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// policy guards against catastrophic typos, it is read from '--run.policy-file' in format:
+//
+//	allow:
+//	  - '^(uptime|df -h)$'
+//	deny:
+//	  - 'rm\s+-rf\s+/(\s|$)'
+//	sudo:
+//	  forbidden: false
+//	  as-users: [root, app]
+//	approval:
+//	  dir: /shared/gossh/approvals
+//	  sudo: true
+//	  hosts-over: 50
+//	  patterns: ['restart']
+type policy struct {
+	// Allow holds the regexps of which commands must match one if it is not empty.
+	Allow []string `mapstructure:"allow"`
+	// Deny holds the regexps of which commands and each line of scripts must match none.
+	Deny []string `mapstructure:"deny"`
+
+	Sudo struct {
+		Forbidden bool `mapstructure:"forbidden"`
+		// AsUsers are the users that sudo can run as, empty means any.
+		AsUsers []string `mapstructure:"as-users"`
+	} `mapstructure:"sudo"`
+
+	Approval approvalPolicy `mapstructure:"approval"`
+}
+
+// SystemPolicyFile is always evaluated if it exists, so that the policy can not be
+// bypassed by omitting '--run.policy-file'.
+const SystemPolicyFile = "/etc/gossh/policy.yaml"
+
+// checkPolicy evaluates the task with SystemPolicyFile and '--run.policy-file' before execution.
+func (t *Task) checkPolicy(hosts []string) error {
+	for _, policyFile := range policyFiles(t.configFlags.Run.PolicyFile) {
+		if err := t.checkPolicyFile(policyFile, hosts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// policyFiles are SystemPolicyFile if it exists and the policy file of '--run.policy-file'.
+func policyFiles(policyFile string) []string {
+	var files []string
+
+	if util.FileExists(SystemPolicyFile) {
+		files = append(files, SystemPolicyFile)
+	}
+
+	if policyFile != "" && expandHome(policyFile) != SystemPolicyFile {
+		files = append(files, policyFile)
+	}
+
+	return files
+}
+
+func (t *Task) checkPolicyFile(policyFile string, hosts []string) error {
+	p, err := readPolicyFile(expandHome(policyFile))
+	if err != nil {
+		return fmt.Errorf("read policy file '%s' failed: %w", policyFile, err)
+	}
+
+	if err := p.checkSudo(t.configFlags.Run.Sudo, t.configFlags.Run.AsUser); err != nil {
+		return err
+	}
+
+	switch t.taskType {
+	case CommandTask, DiffTask:
+		if t.commands == nil {
+			if err := t.checkCommands(p, t.command); err != nil {
+				return err
+			}
+		}
+
+		for host, command := range t.commands {
+			if err := t.checkCommands(p, command); err != nil {
+				return fmt.Errorf("exec map '%s', host '%s': %w", t.execMapFile, host, err)
+			}
+		}
+	case RebootTask:
+		if err := p.checkCommand("reboot"); err != nil {
+			return err
+		}
+	case ScriptTask:
+		content, err := ioutil.ReadFile(expandHome(t.scriptFile))
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			if err := p.checkDeny(strings.TrimSpace(line)); err != nil {
+				return fmt.Errorf("script '%s': %w", t.scriptFile, err)
+			}
+		}
+	}
+
+	log.Debugf("Policy: task is allowed by policy file '%s'", policyFile)
+
+	return t.checkApproval(&p.Approval, hosts)
+}
+
+func readPolicyFile(file string) (*policy, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	p := &policy{}
+	if err := v.Unmarshal(p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *policy) checkSudo(sudo bool, asUser string) error {
+	if !sudo {
+		return nil
+	}
+
+	if p.Sudo.Forbidden {
+		return errors.New("denied by policy: sudo is forbidden")
+	}
+
+	if len(p.Sudo.AsUsers) != 0 && !util.ContainsStr(p.Sudo.AsUsers, asUser) {
+		return fmt.Errorf("denied by policy: sudo as user '%s' is not allowed", asUser)
+	}
+
+	return nil
+}
+
+// checkCommands checks command, or each of the commands rendered by the loop items.
+func (t *Task) checkCommands(p *policy, command string) error {
+	commands, err := t.renderLoop(command)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range commands {
+		if err := p.checkCommand(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *policy) checkCommand(command string) error {
+	if err := p.checkDeny(command); err != nil {
+		return err
+	}
+
+	if len(p.Allow) == 0 {
+		return nil
+	}
+
+	for _, v := range p.Allow {
+		matched, err := regexp.MatchString(v, command)
+		if err != nil {
+			return fmt.Errorf("invalid allow regexp '%s' of policy: %w", v, err)
+		}
+
+		if matched {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("denied by policy: '%s' matches none of the allowed", command)
+}
+
+func (p *policy) checkDeny(command string) error {
+	for _, v := range p.Deny {
+		matched, err := regexp.MatchString(v, command)
+		if err != nil {
+			return fmt.Errorf("invalid deny regexp '%s' of policy: %w", v, err)
+		}
+
+		if matched {
+			return fmt.Errorf("denied by policy: '%s' matches '%s'", command, v)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// preflightTask checks sudo on target hosts before the task, implements batchssh.Task.
+type preflightTask struct {
+	t *Task
+}
+
+// RunSSH implements batchssh.Task
+func (p *preflightTask) RunSSH(addr string) (string, error) {
+	return p.t.sshClient.CheckSudo(addr, p.t.configFlags.Run.AsUser)
+}
+
+// preflightSudo checks sudo on all target hosts by '--preflight.sudo', so that
+// the operator can fix the auth of the hosts on which sudo will fail before
+// a long run, and the task is not run on any of them then.
+func (t *Task) preflightSudo(hosts []string) error {
+	log.Infof("Preflight: checking sudo as user '%s' on %d hosts", t.configFlags.Run.AsUser, len(hosts))
+
+	var failedHosts []string
+	for v := range t.sshClient.BatchRun(hosts, &preflightTask{t: t}) {
+		if v.Status == batchssh.SuccessIdentifier {
+			log.Debugf("Preflight: %s: %s", v.Addr, v.Message)
+			continue
+		}
+
+		failedHosts = append(failedHosts, v.Addr)
+		log.Errorf("Preflight: %s: %s", v.Addr, v.Message)
+	}
+
+	if len(failedHosts) != 0 {
+		sort.Strings(failedHosts)
+
+		return fmt.Errorf(
+			"sudo will fail on %d of %d hosts, the task is not run: %s",
+			len(failedHosts),
+			len(hosts),
+			strings.Join(failedHosts, ","),
+		)
+	}
+
+	log.Infof("Preflight: sudo is ok on all the %d hosts", len(hosts))
+
+	return nil
+}
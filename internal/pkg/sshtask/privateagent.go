@@ -0,0 +1,271 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// privateAgent is an ssh-agent started by gossh for the keys that gossh can not
+// use directly, e.g. FIDO2 security keys and PKCS#11 tokens, and it is killed
+// when the task ends.
+type privateAgent struct {
+	dir  string
+	sock string
+	cmd  *exec.Cmd
+	conn net.Conn
+}
+
+// getPrivateAgent starts the private ssh-agent on first use.
+func (t *Task) getPrivateAgent() (*privateAgent, error) {
+	if t.privateAgent != nil {
+		return t.privateAgent, nil
+	}
+
+	if _, err := exec.LookPath("ssh-agent"); err != nil {
+		return nil, errors.New("command 'ssh-agent' not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gossh-agent-")
+	if err != nil {
+		return nil, err
+	}
+
+	a := &privateAgent{
+		dir:  dir,
+		sock: filepath.Join(dir, "agent.sock"),
+	}
+
+	args := []string{"-D", "-a", a.sock}
+	if provider := t.configFlags.Auth.PKCS11; provider != "" {
+		// ssh-agent only allows providers under system library dirs by default.
+		args = append(args, "-P", provider)
+	}
+
+	//nolint:gosec
+	a.cmd = exec.Command("ssh-agent", args...)
+	if err := a.cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("start ssh-agent failed: %s", err)
+	}
+
+	//nolint:gomnd
+	for i := 0; i < 20; i++ {
+		if a.conn, err = net.Dial("unix", a.sock); err == nil {
+			break
+		}
+
+		//nolint:gomnd
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("connect to ssh-agent failed: %s", err)
+	}
+
+	log.Debugf("Auth: started private ssh-agent '%s'", a.sock)
+
+	t.privateAgent = a
+
+	return a, nil
+}
+
+// add runs ssh-add with args against the private agent, which may prompt for
+// passphrase or PIN in terminal.
+func (a *privateAgent) add(args ...string) error {
+	cmd := exec.Command("ssh-add", args...)
+	cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+a.sock)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// signers ...
+func (a *privateAgent) signers() ([]ssh.Signer, error) {
+	return agent.NewClient(a.conn).Signers()
+}
+
+// Close kills the private agent and removes its socket.
+func (a *privateAgent) Close() {
+	if a.conn != nil {
+		a.conn.Close()
+	}
+
+	if a.cmd.Process != nil {
+		_ = a.cmd.Process.Kill()
+		_ = a.cmd.Wait()
+	}
+
+	os.RemoveAll(a.dir)
+}
+
+// getPrivateAgentSigners returns the signers of the keys loaded into the private agent.
+func (t *Task) getPrivateAgentSigners(msgHead string) []ssh.Signer {
+	if t.privateAgent == nil {
+		return nil
+	}
+
+	signers, err := t.privateAgent.signers()
+	if err != nil {
+		log.Debugf("%sget signers from private ssh-agent failed: %s", msgHead, err)
+		return nil
+	}
+
+	return signers
+}
+
+// loadSecurityKeys loads FIDO2 security keys(sk-ssh-ed25519, sk-ecdsa) from
+// keyfiles into the private agent, the keys already in the ssh-agent of
+// SSH_AUTH_SOCK are skipped because they are used by ssh-agent auth.
+func (t *Task) loadSecurityKeys(keyfiles []string, msgHead string) {
+	var agentKeys []*agent.Key
+	if t.sshAgent != nil {
+		agentKeys, _ = agent.NewClient(t.sshAgent).List()
+	}
+
+	var skFiles []string
+	for _, f := range keyfiles {
+		pubkey, ok := securityKeyPublicKey(f)
+		if !ok {
+			continue
+		}
+
+		if hasAgentKey(agentKeys, pubkey) {
+			log.Debugf("%sFIDO2 security key '%s' is already in ssh-agent", msgHead, f)
+			continue
+		}
+
+		skFiles = append(skFiles, f)
+	}
+
+	if len(skFiles) == 0 {
+		return
+	}
+
+	a, err := t.getPrivateAgent()
+	if err != nil {
+		log.Debugf("%sload FIDO2 security keys failed: %s", msgHead, err)
+		return
+	}
+
+	for _, f := range skFiles {
+		if err := a.add(f); err != nil {
+			log.Debugf("%sload FIDO2 security key '%s' failed: %s", msgHead, f, err)
+			continue
+		}
+
+		log.Debugf("%sloaded FIDO2 security key '%s', touch the key if it blinks", msgHead, f)
+	}
+}
+
+// securityKeyPublicKey returns the public key of an openssh private key file
+// if it is a FIDO2 security key, the public key is not encrypted in the file.
+func securityKeyPublicKey(keyfile string) (ssh.PublicKey, bool) {
+	buf, err := ioutil.ReadFile(keyfile)
+	if err != nil {
+		return nil, false
+	}
+
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return nil, false
+	}
+
+	const magic = "openssh-key-v1\x00"
+	if len(block.Bytes) < len(magic) || string(block.Bytes[:len(magic)]) != magic {
+		return nil, false
+	}
+
+	var header struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(magic):], &header); err != nil {
+		return nil, false
+	}
+
+	pubkey, err := ssh.ParsePublicKey(header.PubKey)
+	if err != nil {
+		return nil, false
+	}
+
+	switch pubkey.Type() {
+	case ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256:
+		return pubkey, true
+	default:
+		return nil, false
+	}
+}
+
+func hasAgentKey(keys []*agent.Key, pubkey ssh.PublicKey) bool {
+	marshaled := string(pubkey.Marshal())
+
+	for _, k := range keys {
+		if string(k.Marshal()) == marshaled {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadPKCS11Provider loads the keys of '--auth.pkcs11-provider' into the private
+// agent, ssh-add prompts for the PIN of the smartcard or token.
+func (t *Task) loadPKCS11Provider() {
+	provider := t.configFlags.Auth.PKCS11
+	if provider == "" {
+		return
+	}
+
+	a, err := t.getPrivateAgent()
+	if err != nil {
+		log.Debugf("Auth: load PKCS#11 provider failed: %s", err)
+		return
+	}
+
+	if err := a.add("-s", provider); err != nil {
+		log.Debugf("Auth: load PKCS#11 provider '%s' failed: %s", provider, err)
+		return
+	}
+
+	log.Debugf("Auth: loaded PKCS#11 provider '%s'", provider)
+}
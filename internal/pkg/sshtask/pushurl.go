@@ -0,0 +1,245 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// pushURLHeaderTimeout is the timeout for waiting the response headers of
+// downloading the urls of the push task, and the body has no timeout as it
+// may be a large artifact.
+const pushURLHeaderTimeout = 30 * time.Second
+
+// remoteFetchCommandTemplate downloads the url into the destination directory
+// of target hosts by curl or wget, and verifies the checksum if any.
+const remoteFetchCommandTemplate = `d=%s;f="$d"/%s;u=%s
+[ -d "$d" ] || { echo "destination directory '$d' not exist";exit 1; }
+%s
+t="$f.gossh.$$"
+if command -v curl >/dev/null 2>&1;then curl -fsSL -o "$t" "$u"
+elif command -v wget >/dev/null 2>&1;then wget -q -O "$t" "$u"
+else echo "need install 'curl' or 'wget' command";false
+fi || { rm -f "$t";echo "download '$u' failed";exit 1; }
+%s
+mv -f "$t" "$f" || { rm -f "$t";exit 1; }`
+
+// PushURL is an url of '-f/--files' of the push task.
+type PushURL struct {
+	// URL to download, without the fragment.
+	URL string
+	// Display is the url without the query and fragment, which may hold tokens.
+	Display string
+	// Name of the downloaded file.
+	Name string
+	// SHA256 is the checksum from the fragment '#sha256=<hex>', empty means no verification.
+	SHA256 string
+}
+
+// IsPushURL reports whether the file of '-f/--files' is an url.
+func IsPushURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// ParsePushURL parses the url of '-f/--files', e.g.
+// 'https://artifacts.example.com/app.tar.gz#sha256=<hex>'.
+func ParsePushURL(rawURL string) (*PushURL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url '%s': %s", rawURL, err)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid url '%s': need host", rawURL)
+	}
+
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return nil, fmt.Errorf("invalid url '%s': need file name in path", rawURL)
+	}
+
+	sum := ""
+	if u.Fragment != "" {
+		if !strings.HasPrefix(u.Fragment, "sha256=") {
+			return nil, fmt.Errorf("invalid url '%s': fragment must be '#sha256=<hex>'", rawURL)
+		}
+
+		sum = strings.ToLower(strings.TrimPrefix(u.Fragment, "sha256="))
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid url '%s': sha256 need 64 hex digits", rawURL)
+		}
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	display := *u
+	display.User = nil
+	display.RawQuery = ""
+
+	return &PushURL{
+		URL:     u.String(),
+		Display: display.String(),
+		Name:    name,
+		SHA256:  sum,
+	}, nil
+}
+
+// Download the url into dir once on local, and verify the checksum if any.
+func (p *PushURL) Download(dir string) (file string, err error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = pushURLHeaderTimeout
+
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(p.URL)
+	if err != nil {
+		return "", fmt.Errorf("download '%s' failed: %s", p.Display, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download '%s' failed: %s", p.Display, resp.Status)
+	}
+
+	file = filepath.Join(dir, p.Name)
+	f, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		return "", fmt.Errorf("download '%s' failed: %s", p.Display, err)
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); p.SHA256 != "" && sum != p.SHA256 {
+		return "", fmt.Errorf("checksum of '%s' mismatch: sha256 is %s, not %s", p.Display, sum, p.SHA256)
+	}
+
+	return file, nil
+}
+
+// SetPushURLs sets the urls downloaded by target hosts directly.
+func (t *Task) SetPushURLs(urls []*PushURL) {
+	t.pushFiles.urls = urls
+}
+
+// pushFileNames returns the files and urls of the push task for describing.
+func (t *Task) pushFileNames() []string {
+	names := append([]string{}, t.pushFiles.files...)
+	for _, u := range t.pushFiles.urls {
+		names = append(names, u.Display)
+	}
+
+	return names
+}
+
+// remoteFetchCommand downloads the urls of the push task on target hosts.
+func (t *Task) remoteFetchCommand() string {
+	commands := make([]string, 0, len(t.pushFiles.urls))
+	for _, u := range t.pushFiles.urls {
+		overwrite := ""
+		if !t.allowOverwrite {
+			overwrite = `[ ! -e "$f" ] || { echo "$f already exists, you can add '-F' flag to overwrite it";exit 1; }`
+		}
+
+		verify := ""
+		if u.SHA256 != "" {
+			verify = fmt.Sprintf(
+				`set -- $(sha256sum "$t");[ "$1" = %s ] || `+
+					`{ rm -f "$t";echo "checksum of '%s' mismatch: sha256 is $1, not %s";exit 1; }`,
+				u.SHA256,
+				util.ShellDoubleQuote(u.Display),
+				u.SHA256,
+			)
+		}
+
+		commands = append(commands, fmt.Sprintf(
+			remoteFetchCommandTemplate,
+			util.ShellDoubleQuote(t.dstDir),
+			util.ShellDoubleQuote(u.Name),
+			util.ShellDoubleQuote(u.URL),
+			overwrite,
+			verify,
+		))
+	}
+
+	return strings.Join(commands, "\n")
+}
+
+// pushWithURLs copies the local files to target hosts, then let target hosts
+// download the urls directly.
+func (t *Task) pushWithURLs(addr string) (string, error) {
+	var outputs []string
+
+	if len(t.pushFiles.files) != 0 {
+		output, err := t.sshClient.PushFiles(
+			addr,
+			t.pushFiles.files,
+			t.pushFiles.zipFiles,
+			t.dstDir,
+			t.allowOverwrite,
+			t.pushFiles.preservePaths,
+		)
+		if err != nil {
+			return output, err
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	output, err := t.sshClient.ExecuteCmd(addr, t.remoteFetchCommand(), "", "", false)
+	if err != nil {
+		return output, err
+	}
+
+	names := make([]string, 0, len(t.pushFiles.urls))
+	for _, u := range t.pushFiles.urls {
+		names = append(names, u.Display)
+	}
+
+	hasOrHave := "has"
+	if len(names) > 1 {
+		hasOrHave = "have"
+	}
+
+	outputs = append(
+		outputs,
+		fmt.Sprintf("'%s' %s been downloaded to '%s'", strings.Join(names, ","), hasOrHave, t.dstDir),
+	)
+
+	return strings.Join(outputs, "\n"), nil
+}
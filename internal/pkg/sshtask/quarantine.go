@@ -0,0 +1,241 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// maxQuarantineErrorSize is the max size of the last error of a quarantined host.
+const maxQuarantineErrorSize = 256
+
+// QuarantinedHost is a target host failed in its last runs.
+type QuarantinedHost struct {
+	Host        string    `json:"host"`
+	Failures    int       `json:"failures"`
+	FirstFailed time.Time `json:"first_failed"`
+	LastFailed  time.Time `json:"last_failed"`
+	LastTaskID  string    `json:"last_task_id"`
+	LastError   string    `json:"last_error"`
+}
+
+// readQuarantine returns the quarantined hosts by host, which is empty if the file does not exist.
+func readQuarantine(file string) (map[string]*QuarantinedHost, error) {
+	quarantined := make(map[string]*QuarantinedHost)
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return quarantined, nil
+		}
+
+		return nil, fmt.Errorf("read quarantine file failed: %s", err)
+	}
+
+	if err := json.Unmarshal(content, &quarantined); err != nil {
+		return nil, fmt.Errorf("parse quarantine file '%s' failed: %s", file, err)
+	}
+
+	return quarantined, nil
+}
+
+// writeQuarantine replaces the file by renaming, so that the concurrent readers
+// never see a partial file.
+func writeQuarantine(file string, quarantined map[string]*QuarantinedHost) error {
+	content, err := json.MarshalIndent(quarantined, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//nolint:gomnd
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	tmpFile := fmt.Sprintf("%s.%d.tmp", file, os.Getpid())
+
+	//nolint:gomnd
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, file)
+}
+
+// skipQuarantined removes the quarantined hosts from the target hosts.
+func (t *Task) skipQuarantined(hosts []string) ([]string, error) {
+	quarantined, err := readQuarantine(t.configFlags.Hosts.QuarantineFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []string
+	for _, host := range hosts {
+		if _, ok := quarantined[host]; !ok {
+			kept = append(kept, host)
+		}
+	}
+
+	if skipped := len(hosts) - len(kept); skipped > 0 {
+		log.Warnf("skipped %d quarantined hosts, see 'gossh quarantine list'", skipped)
+	}
+
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("all target hosts are quarantined, see 'gossh quarantine list'")
+	}
+
+	return kept, nil
+}
+
+// updateQuarantine records the failed hosts, and removes the succeeded hosts.
+func (t *Task) updateQuarantine(failed map[string]string, succeeded []string) {
+	file := t.configFlags.Hosts.QuarantineFile
+
+	quarantined, err := readQuarantine(file)
+	if err != nil {
+		log.Warnf("update quarantine file failed: %s", err)
+		return
+	}
+
+	now := time.Now()
+	for host, msg := range failed {
+		q, ok := quarantined[host]
+		if !ok {
+			q = &QuarantinedHost{Host: host, FirstFailed: now}
+			quarantined[host] = q
+		}
+
+		q.Failures++
+		q.LastFailed = now
+		q.LastTaskID = t.id
+		q.LastError = quarantineError(msg)
+	}
+
+	for _, host := range succeeded {
+		delete(quarantined, host)
+	}
+
+	if err := writeQuarantine(file, quarantined); err != nil {
+		log.Warnf("update quarantine file failed: %s", err)
+		return
+	}
+
+	log.Debugf("Quarantine: %d hosts quarantined in '%s'", len(quarantined), file)
+}
+
+// ShowQuarantine prints the quarantined hosts in text or json format, see InventoryFormatText.
+func ShowQuarantine(file, format string) error {
+	quarantined, err := readQuarantine(file)
+	if err != nil {
+		return err
+	}
+
+	hosts := make([]*QuarantinedHost, 0, len(quarantined))
+	for _, q := range quarantined {
+		hosts = append(hosts, q)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Host < hosts[j].Host
+	})
+
+	if format == InventoryFormatJSON {
+		return writeJSON(os.Stdout, hosts)
+	}
+
+	return writeQuarantineList(os.Stdout, hosts)
+}
+
+func writeQuarantineList(w io.Writer, hosts []*QuarantinedHost) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tFAILURES\tFIRST FAILED\tLAST FAILED\tLAST TASK\tLAST ERROR")
+
+	for _, q := range hosts {
+		fmt.Fprintf(
+			tw,
+			"%s\t%d\t%s\t%s\t%s\t%s\n",
+			q.Host,
+			q.Failures,
+			q.FirstFailed.Format("2006-01-02 15:04:05"),
+			q.LastFailed.Format("2006-01-02 15:04:05"),
+			q.LastTaskID,
+			orDash(strings.Join(strings.Fields(q.LastError), " ")),
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "\nquarantined hosts (%d)\n", len(hosts))
+
+	return nil
+}
+
+// ClearQuarantine removes the hosts from quarantine, or all of them if hosts is empty,
+// and returns the number of removed hosts.
+func ClearQuarantine(file string, hosts []string) (int, error) {
+	quarantined, err := readQuarantine(file)
+	if err != nil {
+		return 0, err
+	}
+
+	cleared := 0
+	if len(hosts) == 0 {
+		cleared = len(quarantined)
+		quarantined = make(map[string]*QuarantinedHost)
+	}
+
+	for _, host := range hosts {
+		if _, ok := quarantined[host]; ok {
+			delete(quarantined, host)
+			cleared++
+		}
+	}
+
+	if err := writeQuarantine(file, quarantined); err != nil {
+		return 0, fmt.Errorf("write quarantine file failed: %s", err)
+	}
+
+	return cleared, nil
+}
+
+// quarantineError is the last error of a quarantined host, at most maxQuarantineErrorSize.
+func quarantineError(msg string) string {
+	msg = strings.TrimSpace(msg)
+	if len(msg) > maxQuarantineErrorSize {
+		msg = msg[:maxQuarantineErrorSize]
+	}
+
+	return msg
+}
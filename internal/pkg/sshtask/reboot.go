@@ -0,0 +1,83 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+const (
+	// bootIDCommand prints the id that changes on every boot, by which the
+	// target host is known to be rebooted rather than not yet down.
+	bootIDCommand = "cat /proc/sys/kernel/random/boot_id"
+
+	// rebootCommand returns at once, so that the session is not broken by the reboot.
+	rebootCommand = `nohup sh -c "sleep 2;reboot" >/dev/null 2>&1 &`
+)
+
+// SetRebootOptions ...
+func (t *Task) SetRebootOptions(waitTimeout, pollInterval time.Duration) {
+	t.rebootWait = waitTimeout
+	t.rebootPoll = pollInterval
+}
+
+// rebootHost reboots the target host, and then polls it until ssh is back
+// with a new boot id, and reports the downtime.
+func (t *Task) rebootHost(addr string) (string, error) {
+	runAs := t.configFlags.Run.AsUser
+
+	bootID, err := t.sshClient.ExecuteCmd(addr, bootIDCommand, "", runAs, false)
+	if err != nil {
+		return "", fmt.Errorf("read boot id failed: %w", err)
+	}
+	bootID = strings.TrimSpace(bootID)
+
+	if _, err := t.sshClient.ExecuteCmd(addr, rebootCommand, "", runAs, t.configFlags.Run.Sudo); err != nil {
+		return "", fmt.Errorf("reboot failed: %w", err)
+	}
+
+	start := time.Now()
+	log.Debugf("Reboot: %s is rebooting, boot id: %s", addr, bootID)
+
+	for time.Since(start) < t.rebootWait {
+		time.Sleep(t.rebootPoll)
+
+		current, err := t.sshClient.ExecuteCmd(addr, bootIDCommand, "", runAs, false)
+		if err != nil {
+			log.Debugf("Reboot: %s is not back yet: %s", addr, err)
+			continue
+		}
+
+		if strings.TrimSpace(current) != bootID {
+			return fmt.Sprintf("rebooted, back after %s", time.Since(start).Round(time.Second)), nil
+		}
+
+		log.Debugf("Reboot: %s is not down yet", addr)
+	}
+
+	return "", fmt.Errorf("rebooting, but not back after %s", t.rebootWait)
+}
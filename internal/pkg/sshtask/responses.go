@@ -0,0 +1,109 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/spf13/viper"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// getResponses returns the answers to prompts, those from '--run.responses'
+// are tried before those from '--run.responses-file'.
+func (t *Task) getResponses() ([]batchssh.Response, error) {
+	var responses []batchssh.Response
+
+	for _, v := range t.configFlags.Run.Responses {
+		prompt, answer, ok := configflags.SplitResponse(v)
+		if !ok {
+			continue
+		}
+
+		response, err := newResponse(prompt, answer)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+
+	responsesFile := t.configFlags.Run.ResponsesFile
+	if responsesFile != "" {
+		fileResponses, err := readResponsesFile(expandHome(responsesFile))
+		if err != nil {
+			return nil, fmt.Errorf("read responses file '%s' failed: %w", responsesFile, err)
+		}
+
+		log.Debugf("Responses: read %d responses from file '%s'", len(fileResponses), responsesFile)
+
+		responses = append(responses, fileResponses...)
+	}
+
+	return responses, nil
+}
+
+func readResponsesFile(file string) ([]batchssh.Response, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var items []struct {
+		Prompt string `mapstructure:"prompt"`
+		Answer string `mapstructure:"answer"`
+	}
+	if err := v.UnmarshalKey("responses", &items); err != nil {
+		return nil, err
+	}
+
+	responses := make([]batchssh.Response, 0, len(items))
+	for _, item := range items {
+		if item.Prompt == "" {
+			return nil, fmt.Errorf("prompt of answer '%s' is empty", item.Answer)
+		}
+
+		response, err := newResponse(item.Prompt, item.Answer)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+func newResponse(prompt, answer string) (batchssh.Response, error) {
+	re, err := regexp.Compile(prompt)
+	if err != nil {
+		return batchssh.Response{}, fmt.Errorf("invalid prompt '%s': %w", prompt, err)
+	}
+
+	return batchssh.Response{Prompt: re, Answer: answer}, nil
+}
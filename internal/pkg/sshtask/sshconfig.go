@@ -0,0 +1,258 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+	"github.com/windvalley/gossh/pkg/sshconfig"
+)
+
+// hostConfigResolver resolves per-host connection settings from the openssh
+// config file, so that gossh behaves like ssh for the hosts already configured.
+// Settings given by flags or gossh configuration file take precedence.
+type hostConfigResolver struct {
+	t         *Task
+	sshConfig *sshconfig.Config
+	auths     []ssh.AuthMethod
+
+	mu      sync.Mutex
+	signers map[string]ssh.Signer
+	proxies map[string]*batchssh.Proxy
+}
+
+// newHostConfigResolver returns nil if the openssh config file is disabled or unavailable.
+func (t *Task) newHostConfigResolver(auths []ssh.AuthMethod) *hostConfigResolver {
+	configFile := t.configFlags.SSH.ConfigFile
+	if configFile == configflags.SSHConfigFileNone {
+		return nil
+	}
+
+	sshConfig, err := sshconfig.ParseFile(configFile)
+	if err != nil {
+		log.Debugf("SSH Config: not using openssh config file: %s", err)
+		return nil
+	}
+
+	log.Debugf("SSH Config: using openssh config file '%s'", configFile)
+
+	return t.newHostConfigResolverWith(sshConfig, auths)
+}
+
+func (t *Task) newHostConfigResolverWith(sshConfig *sshconfig.Config, auths []ssh.AuthMethod) *hostConfigResolver {
+	return &hostConfigResolver{
+		t:         t,
+		sshConfig: sshConfig,
+		auths:     auths,
+		signers:   make(map[string]ssh.Signer),
+		proxies:   make(map[string]*batchssh.Proxy),
+	}
+}
+
+func (t *Task) getHostConfigs(hosts []string, auths []ssh.AuthMethod) map[string]*batchssh.HostConfig {
+	hostConfigs := make(map[string]*batchssh.HostConfig)
+
+	resolver := t.newHostConfigResolver(auths)
+	if resolver != nil {
+		for _, host := range hosts {
+			if hostConfig := resolver.resolve(host); hostConfig != nil {
+				hostConfigs[host] = hostConfig
+			}
+		}
+
+		log.Debugf("SSH Config: %d target hosts matched by openssh config file", len(hostConfigs))
+	}
+
+	// 'user@host' takes precedence over both '-u/--auth.user' and openssh config file.
+	for _, host := range hosts {
+		user, ok := t.hostUsers[host]
+		if !ok {
+			continue
+		}
+
+		if hostConfigs[host] == nil {
+			hostConfigs[host] = &batchssh.HostConfig{}
+		}
+		hostConfigs[host].User = user
+
+		log.Debugf("Auth: login user of %s: %s", host, user)
+	}
+
+	// The ports and addresses of the discovered hosts take precedence over
+	// both '-P/--hosts.port' and openssh config file.
+	for _, host := range hosts {
+		port, hasPort := t.hostPorts[host]
+		hostName, hasHostName := t.hostNames[host]
+		if !hasPort && !hasHostName {
+			continue
+		}
+
+		if hostConfigs[host] == nil {
+			hostConfigs[host] = &batchssh.HostConfig{}
+		}
+		if hasPort {
+			hostConfigs[host].Port = port
+		}
+		if hasHostName {
+			hostConfigs[host].HostName = hostName
+		}
+	}
+
+	// 'jump=' of hosts file routes the hosts through their own jump host, e.g. the
+	// bastion of each datacenter, which takes precedence over both '-X/--proxy.server'
+	// and ProxyJump of openssh config file.
+	for _, host := range hosts {
+		jump := t.hostVars[host][hostVarJump]
+		if jump == "" {
+			continue
+		}
+
+		if resolver == nil {
+			resolver = t.newHostConfigResolverWith(&sshconfig.Config{}, auths)
+		}
+
+		if hostConfigs[host] == nil {
+			hostConfigs[host] = &batchssh.HostConfig{}
+		}
+		hostConfigs[host].Proxy = resolver.getJumpProxy(jump)
+	}
+
+	return hostConfigs
+}
+
+// resolve returns nil if no settings apply to the host.
+func (r *hostConfigResolver) resolve(host string) *batchssh.HostConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.t
+	settings := r.sshConfig.Lookup(host)
+	hostConfig := &batchssh.HostConfig{}
+	isSet := false
+
+	if settings.HostName != "" && settings.HostName != host {
+		hostConfig.HostName = settings.HostName
+		isSet = true
+	}
+
+	if settings.User != "" && !t.configFlags.Auth.UserIsSet() {
+		hostConfig.User = settings.User
+		isSet = true
+	}
+
+	if settings.Port != 0 && !t.configFlags.Hosts.PortIsSet() {
+		hostConfig.Port = settings.Port
+		isSet = true
+	}
+
+	var hostSigners []ssh.Signer
+	for _, f := range settings.IdentityFiles {
+		signer, ok := r.signers[f]
+		if !ok {
+			if s := t.getSigners([]string{f}, t.configFlags.Auth.Passphrase, false); len(s) != 0 {
+				signer = s[0]
+			}
+			r.signers[f] = signer
+		}
+
+		if signer != nil {
+			hostSigners = append(hostSigners, signer)
+		}
+	}
+	if len(hostSigners) != 0 {
+		hostConfig.Auths = []ssh.AuthMethod{ssh.PublicKeys(hostSigners...)}
+		isSet = true
+	}
+
+	if settings.ProxyJump != "" && t.configFlags.Proxy.Server == "" {
+		hostConfig.Proxy = r.getJumpProxy(settings.ProxyJump)
+		isSet = true
+	}
+
+	if !isSet {
+		return nil
+	}
+
+	return hostConfig
+}
+
+// getJumpProxy parses ProxyJump '[user@]host[:port][,...]', and the proxies are
+// shared by the target hosts using the same jump hosts. Multiple jump hosts are
+// chained, each of which is connected through the former one.
+func (r *hostConfigResolver) getJumpProxy(proxyJump string) *batchssh.Proxy {
+	if proxy, ok := r.proxies[proxyJump]; ok {
+		return proxy
+	}
+
+	var via *batchssh.Proxy
+	jump := proxyJump
+	if i := strings.LastIndex(proxyJump, ","); i != -1 {
+		via = r.getJumpProxy(proxyJump[:i])
+		jump = strings.TrimSpace(proxyJump[i+1:])
+	}
+
+	user, host, port := "", jump, 0
+
+	if i := strings.LastIndex(host, "@"); i != -1 {
+		user, host = host[:i], host[i+1:]
+	}
+
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		port, _ = strconv.Atoi(host[i+1:])
+		host = host[:i]
+	}
+
+	jumpSettings := r.sshConfig.Lookup(host)
+
+	if user == "" {
+		user = jumpSettings.User
+	}
+	if user == "" {
+		user = r.t.configFlags.Auth.User
+	}
+
+	if port == 0 {
+		port = jumpSettings.Port
+	}
+	if port == 0 {
+		port = 22
+	}
+
+	if jumpSettings.HostName != "" {
+		host = jumpSettings.HostName
+	}
+
+	log.Debugf("SSH Config: use jump host %s@%s:%d", user, host, port)
+
+	proxy := batchssh.NewProxyVia(via, host, user, port, r.auths)
+	r.proxies[proxyJump] = proxy
+
+	return proxy
+}
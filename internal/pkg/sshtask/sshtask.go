@@ -28,12 +28,15 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ScaleFT/sshkeys"
-	"github.com/go-project-pkg/expandhost"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/term"
@@ -41,6 +44,9 @@ import (
 	"github.com/windvalley/gossh/internal/cmd/vault"
 	"github.com/windvalley/gossh/internal/pkg/aes"
 	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/internal/pkg/credcache"
+	"github.com/windvalley/gossh/internal/pkg/output"
+	"github.com/windvalley/gossh/internal/pkg/secrets"
 	"github.com/windvalley/gossh/pkg/batchssh"
 	"github.com/windvalley/gossh/pkg/log"
 	"github.com/windvalley/gossh/pkg/util"
@@ -53,8 +59,12 @@ var (
 		linuxUserRegex,
 		linuxUserRegex,
 	)
+	suPromptRegexp = regexp.MustCompile(`^(?i)password: *\n?`)
 )
 
+// ExitCodeHostsFailed is the exit code when target hosts failed, see '--run.exit-code'.
+const ExitCodeHostsFailed = 2
+
 // TaskType ...
 type TaskType int
 
@@ -64,6 +74,17 @@ const (
 	ScriptTask
 	PushTask
 	FetchTask
+	PingTask
+	FactsTask
+	DiffTask
+	RebootTask
+	AttachTask
+	JobStatusTask
+	JobCollectTask
+	TailTask
+	GrepTask
+	// InventoryTask only resolves target hosts, see ShowInventory.
+	InventoryTask
 )
 
 // taskResult ...
@@ -71,20 +92,36 @@ type taskResult struct {
 	taskID            string
 	hostsSuccessCount int
 	hostsFailureCount int
+	failedCategories  map[string]int
+	durations         *output.DurationStats
+	matches           *output.MatchStats
 	elapsed           float64
+	startTime         time.Time
+	endTime           time.Time
 }
 
 // detailResult each ssh host result.
 type detailResult struct {
-	taskID   string
-	hostname string
-	status   string
-	output   string
+	taskID     string
+	hostname   string
+	status     string
+	output     string
+	stderr     string
+	timings    *batchssh.Timings
+	escalation string
+	category   string
+	exitCode   int
+	startTime  time.Time
+	duration   time.Duration
 }
 
 type pushFiles struct {
 	files    []string
 	zipFiles []string
+	// preservePaths keeps the paths of files under the destination instead of their names.
+	preservePaths bool
+	// urls are downloaded by target hosts directly.
+	urls []*PushURL
 }
 
 // Task ...
@@ -96,21 +133,107 @@ type Task struct {
 	sshClient *batchssh.Client
 	sshAgent  net.Conn
 
+	privateAgent *privateAgent
+
+	// keyPassphrases are the passphrases of identity files entered from terminal prompt.
+	keyPassphrases map[string]string
+
 	// hostnames or ips from command line arguments.
 	hosts []string
+	// hostUsers are the login users specified by 'user@host'.
+	hostUsers map[string]string
+	// hostTags are the tags annotated in hosts file or of the discovered hosts.
+	hostTags map[string][]string
+	// hostVars are the variables annotated in hosts file or of the inventory hosts.
+	hostVars map[string]map[string]string
+	// hostPorts and hostNames are the ports and addresses of the discovered hosts.
+	hostPorts map[string]int
+	hostNames map[string]string
+	// hostGroups are the groups of hosts by '--run.spread-by'.
+	hostGroups map[string]string
 
 	command    string
 	scriptFile string
 
-	pushFiles      *pushFiles
-	fetchFiles     []string
+	// commands of each target host by '--exec-map', which take the place of command.
+	execMapFile string
+	commands    map[string]string
+
+	// loopItems by '--loop', the commands run once per item on each target host.
+	loopFile  string
+	loopItems []string
+
+	pushFiles  *pushFiles
+	fetchFiles []string
+
+	// fetchPattern of files on target hosts, of which the newest fetchLatest ones are fetched.
+	fetchPattern string
+	fetchLatest  int
+	fetchFilter  *batchssh.FetchFilter
+
+	// tailFiles are followed on all target hosts at the same time, see tailHost.
+	tailFiles     []string
+	tailLines     int
+	tailHighlight *regexp.Regexp
+	tailMu        sync.Mutex
+
+	// grepPattern is searched in grepFiles, and grepMatches are the counts of each target host.
+	grepPattern string
+	grepFiles   []string
+	grepOptions []string
+	grepMatches map[string]grepMatches
+	grepMu      sync.Mutex
+
 	dstDir         string
 	tmpDir         string
 	remove         bool
 	allowOverwrite bool
+	// scriptByStdin pipes the script to 'bash -s' instead of copying it to target hosts.
+	scriptByStdin bool
+
+	// facts of target hosts keyed by host, written to factsFile in factsFormat.
+	facts       map[string]*hostFacts
+	factsMu     sync.Mutex
+	factsFile   string
+	factsFormat string
+	// factsMerge keeps the facts of other hosts in factsFile, which is '--hosts.facts-file'.
+	factsMerge bool
+
+	// baseline is the host with which outputs of other hosts are compared.
+	baseline string
+
+	// rebootWait and rebootPoll are the timeout and interval of waiting for
+	// the rebooted hosts, see rebootHost.
+	rebootWait time.Duration
+	rebootPoll time.Duration
+
+	// attachTaskID is the task id of the detached job to check, see checkJob,
+	// and job is the saved record of it for subcommand 'jobs'.
+	attachTaskID string
+	job          *JobRecord
+
+	// approval is the approved request of the high-risk task, nil if it needs no approval.
+	approval *ApprovalRequest
+
+	// watch is the interval of re-running the command, 0 means running once.
+	watch time.Duration
+
+	// stdinFanout duplicates the local stdin to the command of each target host.
+	stdinFanout bool
+	stdin       []byte
+
+	// passwordCached is whether the password of the login user is from or put into
+	// the credential cache, which is cleared once the password failed on a target host.
+	passwordCached     bool
+	passwordCacheClear sync.Once
 
 	taskOutput   chan taskResult
 	detailOutput chan detailResult
+	sink         output.Sink
+	anonymizer   *anonymizer
+
+	// summary is nil if the task did not finish, e.g. task timeout.
+	summary *taskResult
 
 	err error
 }
@@ -132,6 +255,25 @@ func (t *Task) Start() {
 		defer t.sshAgent.Close()
 	}
 
+	defer func() {
+		if t.privateAgent != nil {
+			t.privateAgent.Close()
+		}
+	}()
+
+	sink, err := t.buildSink()
+	if err != nil {
+		util.CheckErr(err)
+	}
+	t.sink = sink
+
+	if t.configFlags.Output.Anonymize {
+		t.anonymizer, err = newAnonymizer()
+		if err != nil {
+			util.CheckErr(err)
+		}
+	}
+
 	go func() {
 		defer close(t.taskOutput)
 		defer close(t.detailOutput)
@@ -171,10 +313,11 @@ func (t *Task) SetScriptFile(sciptFile string) {
 }
 
 // SetPushfiles ...
-func (t *Task) SetPushfiles(files, zipFiles []string) {
+func (t *Task) SetPushfiles(files, zipFiles []string, preservePaths bool) {
 	t.pushFiles = &pushFiles{
-		files:    files,
-		zipFiles: zipFiles,
+		files:         files,
+		zipFiles:      zipFiles,
+		preservePaths: preservePaths,
 	}
 }
 
@@ -190,6 +333,11 @@ func (t *Task) SetScriptOptions(destPath string, remove, allowOverwrite bool) {
 	t.allowOverwrite = allowOverwrite
 }
 
+// SetScriptByStdin ...
+func (t *Task) SetScriptByStdin(byStdin bool) {
+	t.scriptByStdin = byStdin
+}
+
 // SetPushOptions ...
 func (t *Task) SetPushOptions(destPath string, allowOverwrite bool) {
 	t.dstDir = destPath
@@ -202,21 +350,115 @@ func (t *Task) SetFetchOptions(destPath, tmpDir string) {
 	t.tmpDir = tmpDir
 }
 
+// SetFactsOptions ...
+func (t *Task) SetFactsOptions(destFile, format string) {
+	if destFile == "" && t.configFlags.Hosts.FactsFile != "" {
+		destFile = expandHome(t.configFlags.Hosts.FactsFile)
+		t.factsMerge = true
+	}
+
+	t.factsFile = destFile
+	t.factsFormat = format
+}
+
+// SetBaseline ...
+func (t *Task) SetBaseline(host string) {
+	t.baseline = host
+}
+
+// SetWatch ...
+func (t *Task) SetWatch(interval time.Duration) {
+	t.watch = interval
+}
+
+// SetStdinFanout ...
+func (t *Task) SetStdinFanout(fanout bool) {
+	t.stdinFanout = fanout
+}
+
 // RunSSH implements batchssh.Task
 func (t *Task) RunSSH(addr string) (string, error) {
 	lang := t.configFlags.Run.Lang
+	if t.configFlags.Run.NoLang {
+		lang = ""
+	}
+
 	runAs := t.configFlags.Run.AsUser
 	sudo := t.configFlags.Run.Sudo
 
+	if sudo {
+		if err := t.sshClient.ResolveEscalation(addr, runAs); err != nil {
+			return "", err
+		}
+	}
+
 	switch t.taskType {
-	case CommandTask:
-		return t.sshClient.ExecuteCmd(addr, t.command, lang, runAs, sudo)
+	case CommandTask, DiffTask:
+		command, err := t.hostCommand(addr)
+		if err != nil {
+			return "", err
+		}
+
+		command, err = t.loopCommand(command)
+		if err != nil {
+			return "", err
+		}
+
+		if t.configFlags.Run.OutputRemote != "" && t.taskType == CommandTask {
+			command = t.outputRemoteCommand(command)
+		}
+
+		if t.stdinFanout {
+			return t.sshClient.ExecuteCmdWithStdin(addr, command, lang, runAs, sudo, t.stdin)
+		}
+
+		if t.configFlags.Run.Detach && t.taskType == CommandTask {
+			return t.sshClient.ExecuteCmd(addr, t.detachCommand(), lang, runAs, sudo)
+		}
+
+		return t.sshClient.ExecuteCmd(addr, command, lang, runAs, sudo)
 	case ScriptTask:
+		if t.scriptByStdin {
+			return t.sshClient.ExecuteScriptByStdin(addr, t.scriptFile, lang, runAs, sudo)
+		}
+
 		return t.sshClient.ExecuteScript(addr, t.scriptFile, t.dstDir, lang, runAs, sudo, t.remove, t.allowOverwrite)
 	case PushTask:
-		return t.sshClient.PushFiles(addr, t.pushFiles.files, t.pushFiles.zipFiles, t.dstDir, t.allowOverwrite)
+		if len(t.pushFiles.urls) != 0 {
+			return t.pushWithURLs(addr)
+		}
+
+		return t.sshClient.PushFiles(
+			addr,
+			t.pushFiles.files,
+			t.pushFiles.zipFiles,
+			t.dstDir,
+			t.allowOverwrite,
+			t.pushFiles.preservePaths,
+		)
 	case FetchTask:
-		return t.sshClient.FetchFiles(addr, t.fetchFiles, t.dstDir, t.tmpDir, sudo, runAs)
+		files, err := t.hostFetchFiles(addr, runAs, sudo)
+		if err != nil {
+			return "", err
+		}
+
+		return t.sshClient.FetchFiles(addr, files, t.dstDir, t.tmpDir, sudo, runAs, t.fetchFilter)
+	case PingTask:
+		return t.sshClient.Ping(addr)
+	case FactsTask:
+		return t.gatherFacts(addr)
+	case RebootTask:
+		return t.rebootHost(addr)
+	case AttachTask:
+		return t.checkJob(addr, true)
+	case JobStatusTask:
+		return t.checkJob(addr, false)
+	case JobCollectTask:
+		return t.collectJob(addr)
+	case TailTask:
+		return t.tailHost(addr)
+	case GrepTask:
+		return t.grepHost(addr, lang, runAs, sudo)
 	default:
 		return "", fmt.Errorf("unknown task type: %v", t.taskType)
 	}
@@ -251,22 +493,33 @@ func (t *Task) BatchRun() {
 		log.Debugf("Auth: use sudo as user '%s'", runConf.AsUser)
 	}
 
+	var windowWait time.Duration
+	allHosts, windowWait, err = t.checkWindows(allHosts)
+	if err != nil {
+		t.err = err
+		return
+	}
+
 	switch t.taskType {
 	case CommandTask:
-		if t.command == "" {
-			t.err = errors.New("need flag '-e/--execute' or '-L/--hosts.list'")
+		if t.command == "" && t.commands == nil {
+			t.err = errors.New("need flag '-e/--execute', '--exec-map' or '-L/--hosts.list'")
+		}
+
+		if t.err == nil && t.loopItems != nil {
+			t.err = t.checkLoop()
 		}
 	case ScriptTask:
 		if t.scriptFile == "" {
 			t.err = errors.New("need flag '-e/--execute' or '-L/--hosts.list'")
 		}
 	case PushTask:
-		if t.pushFiles == nil || len(t.pushFiles.files) == 0 {
+		if t.pushFiles == nil || len(t.pushFiles.files) == 0 && len(t.pushFiles.urls) == 0 {
 			t.err = errors.New("need flag '-f/--files' or '-L/--hosts.list'")
 		}
 	case FetchTask:
-		if len(t.fetchFiles) == 0 {
-			t.err = errors.New("need flag '-f/--files' or '-L/--hosts.list'")
+		if len(t.fetchFiles) == 0 && t.fetchPattern == "" {
+			t.err = errors.New("need flag '-f/--files', '--fetch.pattern' or '-L/--hosts.list'")
 		} else if len(t.dstDir) == 0 {
 			t.err = errors.New("need flag '-d/--dest-path' or '-L/--hosts.list'")
 		} else {
@@ -275,50 +528,314 @@ func (t *Task) BatchRun() {
 				util.CheckErr(err)
 			}
 		}
+	case FactsTask:
+		if t.factsFile == "" {
+			t.err = errors.New("need flag '-d/--dest-file', '--hosts.facts-file' or '-L/--hosts.list'")
+		} else if t.factsFormat != FactsFormatJSON && t.factsFormat != FactsFormatYAML {
+			t.err = fmt.Errorf("invalid format '%s', available formats: %s, %s",
+				t.factsFormat, FactsFormatJSON, FactsFormatYAML)
+		}
+
+		t.facts = make(map[string]*hostFacts)
+	case DiffTask:
+		if t.command == "" {
+			t.err = errors.New("need flag '-e/--execute' or '-L/--hosts.list'")
+		} else if t.baseline != "" && !util.ContainsStr(allHosts, t.baseline) {
+			t.err = fmt.Errorf("baseline host '%s' is not in target hosts", t.baseline)
+		}
+	case TailTask:
+		if len(t.tailFiles) == 0 {
+			t.err = errors.New("need flag '-f/--files' or '-L/--hosts.list'")
+		}
+
+		// All target hosts are followed at the same time, as tail never ends.
+		t.configFlags.Run.Concurrency = len(allHosts)
+	case GrepTask:
+		if t.grepPattern == "" || len(t.grepFiles) == 0 {
+			t.err = errors.New("need PATTERN and FILE arguments or '-L/--hosts.list'")
+		}
 	}
 
 	if t.err != nil {
 		return
 	}
 
-	t.buildSSHClient()
+	if err := t.checkPolicy(allHosts); err != nil {
+		t.err = err
+		return
+	}
+
+	if t.configFlags.Run.Lock != "" {
+		release, err := t.acquireLock()
+		if err != nil {
+			t.err = err
+			return
+		}
+		defer release()
+	}
+
+	if t.needConfirm(len(allHosts)) {
+		if err := t.confirm(allHosts); err != nil {
+			t.err = err
+			return
+		}
+	}
+
+	t.waitWindows(windowWait)
+
+	if err := t.runLocalBefore(); err != nil {
+		t.err = err
+		return
+	}
+
+	if t.stdinFanout {
+		// Read all before connecting, so that every target host gets the same content.
+		t.stdin, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			t.err = fmt.Errorf("read stdin failed: %w", err)
+			return
+		}
+
+		log.Debugf("read %d bytes from stdin", len(t.stdin))
+	}
+
+	t.buildSSHClient(allHosts)
+
+	if t.configFlags.Preflight.Sudo {
+		if err := t.preflightSudo(allHosts); err != nil {
+			t.err = err
+			return
+		}
+	}
+
+	if t.anonymizer != nil {
+		names := append([]string{}, allHosts...)
+		for _, hostConfig := range t.sshClient.HostConfigs {
+			names = append(names, hostConfig.HostName)
+		}
+
+		t.anonymizer.setHosts(names)
+	}
+
+	t.audit(allHosts)
+
+	if t.watch > 0 {
+		t.watchRun(allHosts)
+		return
+	}
 
 	result := t.sshClient.BatchRun(allHosts, t)
+	if t.taskType == DiffTask {
+		result = t.compareResults(result)
+	}
+
+	// Only the counters and the bounded aggregates are kept for all target hosts,
+	// and the hosts themselves only if they are needed after the task.
+	// The drifted hosts of diff are not failures of the hosts.
+	quarantine := t.configFlags.Hosts.QuarantineFile != "" && t.taskType != DiffTask
+	keepSucceeded := quarantine || (runConf.Detach && t.taskType == CommandTask)
+	keepFailed := quarantine || runConf.TmpSweep
+
 	successCount, failedCount := 0, 0
+	var failedHosts, succeededHosts []string
+	failedMessages := make(map[string]string)
+	failedCategories := make(map[string]int)
+	var durations hostDurations
 	for v := range result {
+		durations.add(v.Addr, v.Duration)
+
 		if v.Status == batchssh.SuccessIdentifier {
 			successCount++
+			if keepSucceeded {
+				succeededHosts = append(succeededHosts, v.Addr)
+			}
 		} else {
 			failedCount++
+			failedCategories[v.Category]++
+			t.clearPasswordCache(v.Category)
+			if keepFailed {
+				failedHosts = append(failedHosts, v.Addr)
+			}
+			if quarantine {
+				failedMessages[v.Addr] = quarantineError(v.Message)
+			}
 		}
 
 		t.detailOutput <- detailResult{
-			taskID:   t.id,
-			hostname: v.Addr,
-			status:   v.Status,
-			output:   v.Message,
+			taskID:     t.id,
+			hostname:   v.Addr,
+			status:     v.Status,
+			output:     v.Message,
+			stderr:     v.Stderr,
+			timings:    v.Timings,
+			escalation: v.Escalation,
+			category:   v.Category,
+			exitCode:   v.ExitCode,
+			startTime:  v.StartTime,
+			duration:   v.Duration,
+		}
+	}
+
+	if runConf.TmpSweep {
+		t.sweepTmpFiles(failedHosts)
+	}
+
+	if runConf.Detach && t.taskType == CommandTask && len(succeededHosts) != 0 {
+		t.saveJob(succeededHosts)
+	}
+
+	if quarantine {
+		t.updateQuarantine(failedMessages, succeededHosts)
+	}
+
+	t.runLocalAfter(successCount, failedCount)
+
+	if t.taskType == FactsTask {
+		if err := t.writeFacts(); err != nil {
+			log.Errorf("%s", err)
+		} else {
+			log.Infof("facts of %d hosts have been written to '%s'", len(t.facts), t.factsFile)
 		}
 	}
 
-	elapsed := time.Since(timeNow).Seconds()
+	var matches *output.MatchStats
+	if t.taskType == GrepTask {
+		matches = t.grepStats()
+	}
+
+	endTime := time.Now()
 
 	t.taskOutput <- taskResult{
-		t.id,
-		successCount,
-		failedCount,
-		elapsed,
+		taskID:            t.id,
+		hostsSuccessCount: successCount,
+		hostsFailureCount: failedCount,
+		failedCategories:  failedCategories,
+		durations:         durations.stats(),
+		matches:           matches,
+		elapsed:           endTime.Sub(timeNow).Seconds(),
+		startTime:         timeNow,
+		endTime:           endTime,
+	}
+}
+
+// audit records who runs what on which hosts, only written to syslog.
+func (t *Task) audit(hosts []string) {
+	fields := log.Fields{
+		"task_id":     t.id,
+		"remote_user": t.configFlags.Auth.User,
+		"sudo":        t.configFlags.Run.Sudo,
+		"hosts":       hosts,
+	}
+
+	if localUser, err := user.Current(); err == nil {
+		fields["local_user"] = localUser.Username
+	}
+
+	if t.configFlags.Run.Sudo {
+		fields["as_user"] = t.configFlags.Run.AsUser
+	}
+
+	if dir := t.recordDir(); dir != "" {
+		fields["record_dir"] = dir
+	}
+
+	if t.configFlags.Run.RespectWindows && t.configFlags.Run.OverrideWindows != "" {
+		fields["override_windows"] = t.configFlags.Run.OverrideWindows
+	}
+
+	if t.approval != nil {
+		fields["requester"] = t.approval.Requester
+		fields["approver"] = t.approval.Approver
+	}
+
+	switch t.taskType {
+	case CommandTask:
+		fields["task_type"] = "command"
+		if t.commands != nil {
+			fields["exec_map"] = t.describeExecMap()
+		} else {
+			fields["command"] = t.command
+		}
+		if t.loopItems != nil {
+			fields["loop"] = t.describeLoop()
+		}
+		if t.configFlags.Run.Detach {
+			fields["detach"] = true
+		}
+		if t.configFlags.Run.OutputRemote != "" {
+			fields["output_remote"] = t.configFlags.Run.OutputRemote
+		}
+	case ScriptTask:
+		fields["task_type"] = "script"
+		fields["script"] = t.scriptFile
+	case PushTask:
+		fields["task_type"] = "push"
+		fields["files"] = t.pushFileNames()
+		fields["dest_path"] = t.dstDir
+	case FetchTask:
+		fields["task_type"] = "fetch"
+		fields["files"] = t.fetchFiles
+		fields["dest_path"] = t.dstDir
+		if t.fetchPattern != "" {
+			fields["pattern"] = t.describeFetchPattern()
+		}
+		if t.fetchFilter != nil {
+			fields["max_size"] = t.fetchFilter.MaxSize
+			fields["excludes"] = t.fetchFilter.Excludes
+		}
+	case PingTask:
+		fields["task_type"] = "ping"
+	case FactsTask:
+		fields["task_type"] = "facts"
+		fields["dest_path"] = t.factsFile
+	case DiffTask:
+		fields["task_type"] = "diff"
+		fields["command"] = t.command
+	case RebootTask:
+		fields["task_type"] = "reboot"
+	case AttachTask:
+		fields["task_type"] = "attach"
+		fields["attach_task_id"] = t.attachTaskID
+	case JobStatusTask:
+		fields["task_type"] = "jobs_status"
+		fields["attach_task_id"] = t.attachTaskID
+	case JobCollectTask:
+		fields["task_type"] = "jobs_collect"
+		fields["attach_task_id"] = t.attachTaskID
+		fields["dest_path"] = t.dstDir
+	case TailTask:
+		fields["task_type"] = "tail"
+		fields["files"] = t.tailFiles
+	case GrepTask:
+		fields["task_type"] = "grep"
+		fields["pattern"] = t.grepPattern
+		fields["files"] = t.grepFiles
 	}
+
+	log.Audit(fields)
 }
 
 // HandleOutput ...
 func (t *Task) HandleOutput() {
+	plain := !t.configFlags.Output.Colorful()
+
 	for res := range t.detailOutput {
-		output := ""
+		// A result without hostname only syncs with the producer, see watchRun.
+		if res.hostname == "" {
+			continue
+		}
+
+		message := ""
 
 		// Fix the problem of special characters ^M appearing at the end of
 		// the line break when writing files in text format.
 		outputNoR := strings.ReplaceAll(res.output, "\r\n", "\n")
 
+		// Plain text for redirected logs and CI systems.
+		if plain {
+			outputNoR = util.StripControl(outputNoR)
+		}
+
 		// Trim leading and trailing blank characters.
 		outputNoSpace := strings.TrimSpace(outputNoR)
 
@@ -327,29 +844,141 @@ func (t *Task) HandleOutput() {
 		if err != nil {
 			log.Debugf("re compile '%s' failed: %s", sudoPromptRegex, err)
 		} else {
-			output = re.ReplaceAllString(outputNoSpace, "")
+			message = re.ReplaceAllString(outputNoSpace, "")
 		}
 
-		contextLogger := log.WithFields(log.Fields{
-			"hostname": res.hostname,
-			"status":   res.status,
-			"output":   output,
-		})
+		if res.escalation == batchssh.EscalationSu {
+			message = suPromptRegexp.ReplaceAllString(message, "")
+		}
 
-		if res.status == batchssh.SuccessIdentifier {
-			contextLogger.Infof("success")
-		} else {
-			contextLogger.Errorf("failed")
+		hostResult := &output.HostResult{
+			TaskID:     res.taskID,
+			Hostname:   res.hostname,
+			Status:     res.status,
+			Output:     message,
+			Escalation: res.escalation,
+			Category:   res.category,
+			StartTime:  res.startTime,
+			Duration:   res.duration,
+		}
+
+		if res.exitCode >= 0 {
+			exitCode := res.exitCode
+			hostResult.ExitCode = &exitCode
+		}
+
+		stderr := strings.TrimSpace(strings.ReplaceAll(res.stderr, "\r\n", "\n"))
+		if plain {
+			stderr = util.StripControl(stderr)
+		}
+		switch t.configFlags.Output.Streams {
+		case configflags.StreamsSeparate:
+			hostResult.Stderr = stderr
+		case configflags.StreamsStderr:
+			// Errors such as connection failures are kept.
+			if res.status == batchssh.SuccessIdentifier || stderr != "" {
+				hostResult.Output = stderr
+			}
+		}
+
+		if t.anonymizer != nil {
+			t.anonymizer.result(hostResult)
+		}
+
+		if res.timings != nil {
+			hostResult.Phases = &output.Timings{
+				DNS:      res.timings.DNS.Seconds(),
+				Dial:     res.timings.Dial.Seconds(),
+				Auth:     res.timings.Auth.Seconds(),
+				Exec:     res.timings.Exec.Seconds(),
+				Transfer: res.timings.Transfer.Seconds(),
+			}
+
+			if t.configFlags.Output.Timings {
+				hostResult.Timings = hostResult.Phases
+			}
+		}
+
+		err = t.sink.WriteResult(hostResult)
+		if err != nil {
+			log.Warnf("output result of %s failed: %s", res.hostname, err)
 		}
 	}
 
 	for res := range t.taskOutput {
-		log.Infof(
-			"success count: %d, failed count: %d, elapsed: %.2fs",
-			res.hostsSuccessCount,
-			res.hostsFailureCount,
-			res.elapsed,
+		res := res
+		t.summary = &res
+
+		summary := &output.TaskSummary{
+			TaskID:       res.taskID,
+			SuccessCount: res.hostsSuccessCount,
+			FailedCount:  res.hostsFailureCount,
+			Elapsed:      res.elapsed,
+			StartTime:    res.startTime,
+			EndTime:      res.endTime,
+
+			FailedCategories: res.failedCategories,
+			Durations:        res.durations,
+			Matches:          res.matches,
+		}
+
+		if t.anonymizer != nil {
+			t.anonymizer.summary(summary)
+		}
+
+		err := t.sink.WriteSummary(summary)
+		if err != nil {
+			log.Warnf("output task summary failed: %s", err)
+		}
+	}
+
+	if err := t.sink.Close(); err != nil {
+		log.Warnf("close output sinks failed: %s", err)
+	}
+}
+
+// buildSink returns the screen sink together with sinks from '--output.sinks'.
+func (t *Task) buildSink() (output.Sink, error) {
+	sinks := []output.Sink{output.NewConsoleSink()}
+
+	if t.configFlags.Output.Summary != "" {
+		sinks = append(sinks, output.NewSummaryFileSink(t.configFlags.Output.Summary, t.id))
+	}
+
+	for _, spec := range t.configFlags.Output.Sinks {
+		sink, err := output.New(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	notifyConf := t.configFlags.Notify
+	for _, spec := range notifyConf.Targets {
+		sink, err := output.NewNotifySink(spec, t.describe(), t.notifyCondition, notifyConf.FailedHosts)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	return output.NewMulti(sinks...), nil
+}
+
+// notifyCondition reports whether to notify by '--notify.when'.
+func (t *Task) notifyCondition(summary *output.TaskSummary) bool {
+	switch t.configFlags.Notify.When {
+	case configflags.NotifyWhenAlways:
+		return true
+	case configflags.NotifyWhenThreshold:
+		return t.configFlags.Run.FailureThresholdExceeded(
+			summary.FailedCount,
+			summary.SuccessCount+summary.FailedCount,
 		)
+	default:
+		return summary.FailedCount > 0
 	}
 }
 
@@ -358,26 +987,88 @@ func (t *Task) CheckErr() error {
 	return t.err
 }
 
+// ExitCode of the task by the policy of '--run.exit-code'.
+func (t *Task) ExitCode() int {
+	runConf := t.configFlags.Run
+
+	if runConf.ExitCode == configflags.ExitCodeNever {
+		return 0
+	}
+
+	if t.summary == nil {
+		return ExitCodeHostsFailed
+	}
+
+	failed := t.summary.hostsFailureCount
+	total := t.summary.hostsSuccessCount + failed
+
+	switch runConf.ExitCode {
+	case configflags.ExitCodeThreshold:
+		if runConf.FailureThresholdExceeded(failed, total) {
+			return ExitCodeHostsFailed
+		}
+	default:
+		if failed > 0 {
+			return ExitCodeHostsFailed
+		}
+	}
+
+	return 0
+}
+
 func (t *Task) getAllHosts() ([]string, error) {
-	var hosts []string
+	inventory, err := t.getInventoryHosts()
+	if err != nil {
+		return nil, err
+	}
 
-	if len(t.hosts) != 0 {
-		for _, hostOrPattern := range t.hosts {
-			hostOrPattern = strings.TrimSpace(hostOrPattern)
+	if err := t.loadFactsVars(); err != nil {
+		return nil, err
+	}
 
-			if hostOrPattern == "" {
-				continue
-			}
+	var hosts []string
+	if t.job != nil {
+		// The target hosts of the saved job are the recorded ones, the
+		// inventory is still needed for their addresses and ports.
+		hosts = t.job.Hosts
+	} else {
+		hosts, err = t.evalHostExprs(t.hosts, inventory)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			hostList, err := expandhost.PatternToHosts(hostOrPattern)
-			if err != nil {
-				return nil, fmt.Errorf("invalid host pattern: %s", err)
-			}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("need target hosts, you can specify hosts file by flag '-H', " +
+			"discover them by '--hosts.srv', '--hosts.consul' or '--hosts.provider', " +
+			"or provide host/pattern as positional arguments")
+	}
 
-			hosts = append(hosts, hostList...)
+	hosts = util.RemoveDuplStr(hosts)
+
+	if t.configFlags.Hosts.SkipQuarantined {
+		hosts, err = t.skipQuarantined(hosts)
+		if err != nil {
+			return nil, err
 		}
 	}
 
+	hosts, err = t.selectHosts(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	if spreadBy := t.configFlags.Run.SpreadBy; spreadBy != "" {
+		hosts, t.hostGroups = t.spreadHosts(hosts, spreadBy)
+	}
+
+	return hosts, nil
+}
+
+// getInventoryHosts gets the hosts of hosts file and the discovered hosts.
+func (t *Task) getInventoryHosts() ([]string, error) {
+	var hosts []string
+
 	if t.configFlags.Hosts.File != "" {
 		content, err := ioutil.ReadFile(t.configFlags.Hosts.File)
 		if err != nil {
@@ -385,33 +1076,40 @@ func (t *Task) getAllHosts() ([]string, error) {
 		}
 
 		hostSlice := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
-		for _, hostOrPattern := range hostSlice {
-			hostOrPattern = strings.TrimSpace(hostOrPattern)
+		for _, line := range hostSlice {
+			line = strings.TrimSpace(line)
 
-			if hostOrPattern == "" {
+			if line == "" {
 				continue
 			}
 
-			hostList, err := expandhost.PatternToHosts(hostOrPattern)
+			hostList, err := t.expandHostLine(line)
 			if err != nil {
-				return nil, fmt.Errorf("invalid host pattern: %s", err)
+				return nil, err
 			}
 
 			hosts = append(hosts, hostList...)
 		}
 	}
 
-	if len(hosts) == 0 {
-		return nil, fmt.Errorf("need target hosts, you can specify hosts file by flag '-H' or " +
-			"provide host/pattern as positional arguments")
+	discovered, err := t.discoverHosts()
+	if err != nil {
+		return nil, err
 	}
 
-	return util.RemoveDuplStr(hosts), nil
+	return append(hosts, discovered...), nil
 }
 
-func (t *Task) buildSSHClient() {
-	var sshClient *batchssh.Client
+// recordDir is the directory in which the sessions of this task are recorded.
+func (t *Task) recordDir() string {
+	if t.configFlags.Output.Record == "" {
+		return ""
+	}
 
+	return filepath.Join(t.configFlags.Output.Record, t.id)
+}
+
+func (t *Task) buildSSHClient(hosts []string) {
 	password, err := t.getPassword()
 	if err != nil {
 		util.CheckErr(err)
@@ -419,37 +1117,129 @@ func (t *Task) buildSSHClient() {
 
 	auths := t.getSSHAuthMethods(&password)
 
-	if t.configFlags.Proxy.Server != "" {
-		proxyAuths := t.getProxySSHAuthMethods(&password)
-
-		sshClient = batchssh.NewClient(
-			t.configFlags.Auth.User,
-			password,
-			auths,
-			batchssh.WithConnTimeout(time.Duration(t.configFlags.Timeout.Conn)*time.Second),
-			batchssh.WithCommandTimeout(time.Duration(t.configFlags.Timeout.Command)*time.Second),
-			batchssh.WithConcurrency(t.configFlags.Run.Concurrency),
-			batchssh.WithPort(t.configFlags.Hosts.Port),
-			batchssh.WithProxyServer(
-				t.configFlags.Proxy.Server,
-				t.configFlags.Proxy.User,
-				t.configFlags.Proxy.Port,
-				proxyAuths,
-			),
-		)
-	} else {
-		sshClient = batchssh.NewClient(
-			t.configFlags.Auth.User,
-			password,
-			auths,
-			batchssh.WithConnTimeout(time.Duration(t.configFlags.Timeout.Conn)*time.Second),
-			batchssh.WithCommandTimeout(time.Duration(t.configFlags.Timeout.Command)*time.Second),
-			batchssh.WithConcurrency(t.configFlags.Run.Concurrency),
-			batchssh.WithPort(t.configFlags.Hosts.Port),
+	responses, err := t.getResponses()
+	if err != nil {
+		util.CheckErr(err)
+	}
+
+	options := t.getSSHClientOptions(&password)
+	options = append(options,
+		batchssh.WithHostConfigs(t.getHostConfigs(hosts, auths)),
+		batchssh.WithResponses(responses),
+	)
+
+	if t.configFlags.SSH.Persist > 0 {
+		controlPath := t.getControlPath()
+		t.startControlMaster(controlPath, password)
+
+		options = append(options, batchssh.WithControlPath(controlPath))
+	}
+
+	t.sshClient = batchssh.NewClient(
+		t.configFlags.Auth.User,
+		password,
+		auths,
+		options...,
+	)
+}
+
+func (t *Task) getSSHClientOptions(password *string) []func(*batchssh.Client) {
+	options := []func(*batchssh.Client){
+		batchssh.WithConnTimeout(time.Duration(t.configFlags.Timeout.Conn) * time.Second),
+		batchssh.WithCommandTimeout(time.Duration(t.configFlags.Timeout.Command) * time.Second),
+		batchssh.WithConcurrency(t.configFlags.Run.Concurrency),
+		batchssh.WithPort(t.configFlags.Hosts.Port),
+		batchssh.WithRawExec(t.configFlags.Run.Raw),
+		batchssh.WithSeparateStderr(t.configFlags.Output.Streams != configflags.StreamsMerged),
+		batchssh.WithNoPty(!t.configFlags.Run.Pty),
+		batchssh.WithPty(batchssh.Pty{
+			Term:   t.configFlags.Run.Term,
+			Width:  t.configFlags.Run.PtyWidth,
+			Height: t.configFlags.Run.PtyHeight,
+		}),
+		//nolint:gomnd
+		batchssh.WithMaxOutputSize(t.configFlags.Output.MaxSize * 1024),
+		batchssh.WithRecordDir(t.recordDir()),
+		//nolint:gomnd
+		batchssh.WithTransfer(batchssh.Transfer{
+			ChunkSize: t.configFlags.Transfer.ChunkSize * 1024,
+			Inflight:  t.configFlags.Transfer.Inflight,
+		}),
+		batchssh.WithSudoEnv(batchssh.SudoEnv{
+			PreserveEnv:     t.configFlags.Run.PreserveEnv,
+			PreserveEnvVars: t.configFlags.Run.PreserveEnvVars,
+			SetHome:         t.configFlags.Run.SetHome,
+		}),
+		batchssh.WithSudoWrapper(t.configFlags.Run.SudoWrapper),
+		batchssh.WithEscalate(t.configFlags.Run.Escalate, t.getSuPassword()),
+		batchssh.WithAlgorithms(batchssh.Algorithms{
+			Ciphers:           t.configFlags.SSH.Ciphers,
+			KeyExchanges:      t.configFlags.SSH.Kex,
+			MACs:              t.configFlags.SSH.MACs,
+			HostKeyAlgorithms: t.configFlags.SSH.HostKeyAlgos,
+		}),
+	}
+
+	if t.configFlags.Run.SpreadBy != "" {
+		options = append(options, batchssh.WithSpread(t.hostGroups, t.configFlags.Run.SpreadMax))
+	}
+
+	if t.configFlags.Run.ConnectRate != "" {
+		// It has been validated.
+		perSecond, _ := configflags.ParseConnectRate(t.configFlags.Run.ConnectRate)
+
+		options = append(options, batchssh.WithConnectRate(perSecond))
+	}
+
+	// The helper commands of other tasks, e.g. facts and fetch, are not affected.
+	switch t.taskType {
+	case CommandTask, ScriptTask, DiffTask:
+		options = append(options,
+			batchssh.WithWorkDir(t.configFlags.Run.WorkDir),
+			batchssh.WithUmask(t.configFlags.Run.Umask),
 		)
 	}
 
-	t.sshClient = sshClient
+	if t.configFlags.SSH.PreConnect != "" {
+		options = append(options, batchssh.WithPreConnect(t.preConnect))
+	}
+
+	if t.configFlags.Proxy.HTTP != "" {
+		// It has been validated.
+		addr, user, pass, _ := configflags.ParseHTTPProxy(t.configFlags.Proxy.HTTP)
+
+		options = append(options, batchssh.WithHTTPProxy(&batchssh.HTTPProxy{
+			Addr:     addr,
+			User:     user,
+			Password: pass,
+		}))
+	}
+
+	if t.configFlags.Proxy.MaxSessions > 0 {
+		options = append(options, batchssh.WithProxyMaxSessions(t.configFlags.Proxy.MaxSessions))
+	}
+
+	if servers := t.configFlags.Proxy.Servers(); len(servers) > 1 {
+		proxyAuths := t.getProxySSHAuthMethods(password)
+
+		options = append(options, batchssh.WithProxyServers(
+			servers,
+			t.configFlags.Proxy.User,
+			t.configFlags.Proxy.Port,
+			proxyAuths,
+		))
+	} else if t.configFlags.Proxy.Server != "" {
+		proxyAuths := t.getProxySSHAuthMethods(password)
+
+		options = append(options, batchssh.WithProxyServer(
+			t.configFlags.Proxy.Server,
+			t.configFlags.Proxy.User,
+			t.configFlags.Proxy.Port,
+			proxyAuths,
+		))
+	}
+
+	return options
 }
 
 func (t *Task) getSSHAuthMethods(password *string) []ssh.AuthMethod {
@@ -467,7 +1257,7 @@ func (t *Task) getSSHAuthMethods(password *string) []ssh.AuthMethod {
 
 	keyfiles := t.getItentityFiles()
 	if len(keyfiles) != 0 {
-		sshSigners := getSigners(keyfiles, t.configFlags.Auth.Passphrase, false)
+		sshSigners := t.getSigners(keyfiles, t.configFlags.Auth.Passphrase, false)
 		if len(sshSigners) == 0 {
 			log.Debugf("Auth: no valid identity files")
 		} else {
@@ -489,10 +1279,17 @@ func (t *Task) getSSHAuthMethods(password *string) []ssh.AuthMethod {
 		t.sshAgent = sshAgent
 	}
 
+	t.loadSecurityKeys(keyfiles, "Auth: ")
+	t.loadPKCS11Provider()
+
+	if agentSigners := t.getPrivateAgentSigners("Auth: "); len(agentSigners) != 0 {
+		auths = append(auths, ssh.PublicKeys(agentSigners...))
+	}
+
 	if len(auths) == 0 {
 		log.Debugf("Auth: no valid authentication method detected. Prompt for password of the login user")
 
-		*password = getPasswordFromPrompt(t.configFlags.Auth.User)
+		*password = t.getPasswordFromPromptOrCache()
 		auths = append(auths, ssh.Password(*password))
 
 		return auths
@@ -501,7 +1298,7 @@ func (t *Task) getSSHAuthMethods(password *string) []ssh.AuthMethod {
 	if *password == "" && t.configFlags.Run.Sudo {
 		log.Debugf("Auth: using sudo as other user needs password. Prompt for password of the login user")
 
-		*password = getPasswordFromPrompt(t.configFlags.Auth.User)
+		*password = t.getPasswordFromPromptOrCache()
 		auths = append(auths, ssh.Password(*password))
 	}
 
@@ -518,7 +1315,10 @@ func (t *Task) getProxySSHAuthMethods(password *string) []ssh.AuthMethod {
 	log.Debugf("Proxy Auth: proxy login user: %s", t.configFlags.Proxy.User)
 
 	if t.configFlags.Proxy.Password != "" {
-		proxyAuths = append(proxyAuths, ssh.Password(t.configFlags.Proxy.Password))
+		proxyPassword := t.configFlags.Proxy.Password
+		assignRealPass(&proxyPassword)
+
+		proxyAuths = append(proxyAuths, ssh.Password(proxyPassword))
 	} else {
 		proxyAuths = append(proxyAuths, ssh.Password(*password))
 	}
@@ -526,7 +1326,7 @@ func (t *Task) getProxySSHAuthMethods(password *string) []ssh.AuthMethod {
 
 	proxyKeyfiles := t.getProxyItentityFiles()
 	if len(proxyKeyfiles) != 0 {
-		sshSigners := getSigners(proxyKeyfiles, t.configFlags.Proxy.Passphrase, true)
+		sshSigners := t.getSigners(proxyKeyfiles, t.configFlags.Proxy.Passphrase, true)
 		if len(sshSigners) == 0 {
 			log.Debugf("Proxy Auth: no valid identity files for proxy")
 		} else {
@@ -549,6 +1349,12 @@ func (t *Task) getProxySSHAuthMethods(password *string) []ssh.AuthMethod {
 		t.sshAgent = sshAgent
 	}
 
+	t.loadSecurityKeys(proxyKeyfiles, "Proxy Auth: ")
+
+	if agentSigners := t.getPrivateAgentSigners("Proxy Auth: "); len(agentSigners) != 0 {
+		proxyAuths = append(proxyAuths, ssh.PublicKeys(agentSigners...))
+	}
+
 	return proxyAuths
 }
 
@@ -567,6 +1373,16 @@ func (t *Task) getPassword() (password string, err error) {
 		log.Debugf("Auth: read password from file '%s'", authFile)
 	}
 
+	passCmd := t.configFlags.Auth.PassCmd
+	if passCmd != "" {
+		password, err = getPasswordFromCommand(passCmd)
+		if err != nil {
+			return "", err
+		}
+
+		log.Debugf("Auth: received password from command '%s'", passCmd)
+	}
+
 	passwordFromFlag := t.configFlags.Auth.Password
 	if passwordFromFlag != "" {
 		password = passwordFromFlag
@@ -578,7 +1394,7 @@ func (t *Task) getPassword() (password string, err error) {
 
 	if t.configFlags.Auth.AskPass {
 		log.Debugf("Auth: ask for password of login user by flag '-k/--auth.ask-pass'")
-		password = getPasswordFromPrompt(t.configFlags.Auth.User)
+		password = t.getPasswordFromPromptOrCache()
 	}
 
 	//nolint:nakedret
@@ -611,7 +1427,7 @@ func (t *Task) getProxyItentityFiles() (proxyKeyfiles []string) {
 	return
 }
 
-func getSigners(keyfiles []string, passphrase string, isForProxy bool) []ssh.Signer {
+func (t *Task) getSigners(keyfiles []string, passphrase string, isForProxy bool) []ssh.Signer {
 	assignRealPass(&passphrase)
 
 	var (
@@ -626,7 +1442,21 @@ func getSigners(keyfiles []string, passphrase string, isForProxy bool) []ssh.Sig
 	}
 
 	for _, f := range keyfiles {
-		signer, msg := getSigner(f, passphrase)
+		keyPassphrase := t.getKeyPassphrase(f, passphrase)
+
+		signer, msg, encrypted := getSigner(f, keyPassphrase)
+
+		// Each identity file may have its own passphrase, so prompt for it
+		// rather than silently skipping the identity file.
+		if signer == nil && encrypted && term.IsTerminal(int(os.Stdin.Fd())) {
+			log.Debugf("%s%s", msgHead, msg)
+
+			keyPassphrase = promptKeyPassphrase(f)
+			signer, msg, _ = getSigner(f, keyPassphrase)
+			if signer != nil {
+				t.setKeyPassphrase(f, keyPassphrase)
+			}
+		}
 
 		log.Debugf("%s%s", msgHead, msg)
 
@@ -638,10 +1468,15 @@ func getSigners(keyfiles []string, passphrase string, isForProxy bool) []ssh.Sig
 	return signers
 }
 
-func getSigner(keyfile, passphrase string) (ssh.Signer, string) {
+// getSigner also reports whether the identity file is encrypted by passphrase.
+func getSigner(keyfile, passphrase string) (ssh.Signer, string, bool) {
 	buf, err := ioutil.ReadFile(keyfile)
 	if err != nil {
-		return nil, fmt.Sprintf("read identity file '%s' failed: %s", keyfile, err)
+		return nil, fmt.Sprintf("read identity file '%s' failed: %s", keyfile, err), false
+	}
+
+	if _, ok := securityKeyPublicKey(keyfile); ok {
+		return nil, fmt.Sprintf("identity file '%s' is a FIDO2 security key, use it by ssh-agent", keyfile), false
 	}
 
 	pubkey, err := ssh.ParsePrivateKey(buf)
@@ -650,16 +1485,62 @@ func getSigner(keyfile, passphrase string) (ssh.Signer, string) {
 		if ok {
 			pubkeyWithPassphrase, err1 := sshkeys.ParseEncryptedPrivateKey(buf, []byte(passphrase))
 			if err1 != nil {
-				return nil, fmt.Sprintf("parse identity file '%s' with passphrase failed: %s", keyfile, err1)
+				return nil, fmt.Sprintf("parse identity file '%s' with passphrase failed: %s", keyfile, err1), true
 			}
 
-			return pubkeyWithPassphrase, fmt.Sprintf("parsed identity file '%s' with passphrase", keyfile)
+			return pubkeyWithPassphrase, fmt.Sprintf("parsed identity file '%s' with passphrase", keyfile), true
+		}
+
+		return nil, fmt.Sprintf("parse identity file '%s' failed: %s", keyfile, err), false
+	}
+
+	return pubkey, fmt.Sprintf("parsed identity file '%s'", keyfile), false
+}
+
+// getPasswordFromPromptOrCache prompts for the password of the login user,
+// unless it is cached by '--auth.cache-ttl' before and not expired.
+func (t *Task) getPasswordFromPromptOrCache() string {
+	loginUser := t.configFlags.Auth.User
+	ttl := t.configFlags.Auth.CacheTTL
+
+	if ttl > 0 {
+		if password, ok := credcache.Get(loginUser); ok {
+			log.Debugf("Auth: received password of the login user '%s' from credential cache", loginUser)
+			t.passwordCached = true
+			return password
 		}
+	}
+
+	password := getPasswordFromPrompt(loginUser)
 
-		return nil, fmt.Sprintf("parse identity file '%s' failed: %s", keyfile, err)
+	if ttl > 0 {
+		if err := credcache.Set(loginUser, password, ttl); err != nil {
+			log.Debugf("Auth: cache password of the login user '%s' failed: %s", loginUser, err)
+		} else {
+			log.Debugf("Auth: cached password of the login user '%s' for %s", loginUser, ttl)
+			t.passwordCached = true
+		}
 	}
 
-	return pubkey, fmt.Sprintf("parsed identity file '%s'", keyfile)
+	return password
+}
+
+// clearPasswordCache clears the cached password of the login user if authentication or sudo failed
+// on a target host, e.g. the mistyped password, so that the password is prompted again next time.
+func (t *Task) clearPasswordCache(category string) {
+	if !t.passwordCached || category != batchssh.CategoryAuth {
+		return
+	}
+
+	t.passwordCacheClear.Do(func() {
+		loginUser := t.configFlags.Auth.User
+		if err := credcache.Clear(loginUser); err != nil {
+			log.Warnf("Auth: clear cached password of the login user '%s' failed: %s", loginUser, err)
+			return
+		}
+
+		log.Warnf("Auth: authentication failed, cleared the cached password of the login user '%s'", loginUser)
+	})
 }
 
 func getPasswordFromPrompt(loginUser string) string {
@@ -681,13 +1562,56 @@ func getPasswordFromPrompt(loginUser string) string {
 	return password
 }
 
+// getPasswordFromCommand runs the password provider command such as
+// 1Password cli, pass or a custom script, and takes its output as the password.
+func getPasswordFromCommand(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("get password by command '%s' failed: %w", command, err)
+	}
+
+	password := strings.TrimSpace(string(output))
+	if password == "" {
+		return "", fmt.Errorf("get password by command '%s' failed: empty output", command)
+	}
+
+	return password, nil
+}
+
+// getSuPassword returns the password of su for '--run.escalate', which can be
+// encrypted by vault or a secret reference as the password of login user.
+func (t *Task) getSuPassword() string {
+	password := t.configFlags.Run.SuPassword
+	if password != "" {
+		assignRealPass(&password)
+	}
+
+	return password
+}
+
 func assignRealPass(pass *string) {
 	var err error
 
-	if aes.IsAES256CipherText(*pass) {
-		vaultPass := vault.GetVaultPassword()
+	if secrets.IsReference(*pass) {
+		ref := *pass
+
+		*pass, err = secrets.Resolve(ref)
+		if err != nil {
+			log.Debugf("Auth: resolve password/passphrase from secret reference '%s' failed: %s", ref, err)
+			util.CheckErr(err)
+		}
+
+		log.Debugf("Auth: resolve password/passphrase from secret reference '%s' success", ref)
+
+		return
+	}
 
-		*pass, err = aes.AES256Decode(*pass, vaultPass)
+	if aes.IsCipherText(*pass) {
+		*pass, err = vault.Decrypt(*pass)
 		if err != nil {
 			log.Debugf("Auth: decrypt password/passphrase which encrypted by vault failed: %s", err)
 			util.CheckErr(err)
@@ -0,0 +1,91 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"path"
+	"path/filepath"
+
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// sweepTask removes the temporary files left on target hosts, implements batchssh.Task.
+type sweepTask struct {
+	t *Task
+}
+
+// RunSSH implements batchssh.Task
+func (s *sweepTask) RunSSH(addr string) (string, error) {
+	t := s.t
+
+	switch t.taskType {
+	case ScriptTask:
+		// The script is copied by the login user.
+		return t.sshClient.RemoveFiles(addr, t.getTmpFiles(addr), false, "")
+	case FetchTask:
+		// The zip files are created by sudo.
+		return t.sshClient.RemoveFiles(addr, t.getTmpFiles(addr), true, t.configFlags.Run.AsUser)
+	default:
+		return "", nil
+	}
+}
+
+// getTmpFiles returns the temporary files of the task on target host addr.
+func (t *Task) getTmpFiles(addr string) []string {
+	switch t.taskType {
+	case ScriptTask:
+		if t.remove && !t.scriptByStdin {
+			return []string{path.Join(t.dstDir, filepath.Base(t.scriptFile))}
+		}
+	case FetchTask:
+		return []string{path.Join(t.tmpDir, "gossh-"+addr, addr+".*")}
+	}
+
+	return nil
+}
+
+// sweepTmpFiles removes the temporary files left on the hosts that failed
+// or timed out, for which the cleanup of the task may not be done.
+func (t *Task) sweepTmpFiles(hosts []string) {
+	var sweepHosts []string
+	for _, host := range hosts {
+		if len(t.getTmpFiles(host)) != 0 {
+			sweepHosts = append(sweepHosts, host)
+		}
+	}
+
+	if len(sweepHosts) == 0 {
+		return
+	}
+
+	log.Debugf("Sweep: remove temporary files on %d failed hosts", len(sweepHosts))
+
+	for v := range t.sshClient.BatchRun(sweepHosts, &sweepTask{t: t}) {
+		if v.Status == batchssh.SuccessIdentifier {
+			log.Debugf("Sweep: %s: %s", v.Addr, v.Message)
+		} else {
+			log.Warnf("Sweep: remove temporary files on %s failed: %s", v.Addr, v.Message)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// SetTailOptions ...
+func (t *Task) SetTailOptions(files []string, lines int, highlight *regexp.Regexp) {
+	t.tailFiles = files
+	t.tailLines = lines
+	t.tailHighlight = highlight
+}
+
+// tailCommand follows the files by name, so that it goes on after they are rotated.
+func (t *Task) tailCommand() string {
+	return fmt.Sprintf("tail -n %d -F %s", t.tailLines, strings.Join(t.tailFiles, " "))
+}
+
+// tailHost streams the lines appended to the files of the target host until
+// the task is interrupted or timed out.
+func (t *Task) tailHost(addr string) (string, error) {
+	lang := t.configFlags.Run.Lang
+	if t.configFlags.Run.NoLang {
+		lang = ""
+	}
+
+	err := t.sshClient.StreamCmd(
+		addr,
+		t.tailCommand(),
+		lang,
+		t.configFlags.Run.AsUser,
+		t.configFlags.Run.Sudo,
+		func(line string) { t.printTailLine(addr, line) },
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return "tail exited", nil
+}
+
+// printTailLine prints the line of the target host prefixed with the host, and
+// highlights the matches of '--highlight'. Lines of target hosts are never mixed.
+func (t *Task) printTailLine(addr, line string) {
+	host := addr
+	if t.anonymizer != nil {
+		host = t.anonymizer.pseudonym(addr)
+		line = t.anonymizer.text(line)
+	}
+
+	if t.tailHighlight != nil {
+		line = t.tailHighlight.ReplaceAllStringFunc(line, func(s string) string {
+			return color.New(color.FgRed, color.Bold).Sprint(s)
+		})
+	}
+
+	t.tailMu.Lock()
+	defer t.tailMu.Unlock()
+
+	fmt.Printf("%s | %s\n", color.CyanString(host), line)
+}
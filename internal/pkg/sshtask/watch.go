@@ -0,0 +1,114 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/windvalley/gossh/internal/pkg/output"
+	"github.com/windvalley/gossh/pkg/batchssh"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// clearScreen moves the cursor to top left and clears the terminal.
+const clearScreen = "\033[H\033[2J"
+
+// watchRun re-runs the task on target hosts every t.watch until interrupted like watch(1),
+// and the screen is refreshed for each round if it is a terminal and the output is colorful.
+func (t *Task) watchRun(hosts []string) {
+	refresh := term.IsTerminal(int(os.Stdout.Fd())) && !t.configFlags.Output.Quiet && t.configFlags.Output.Colorful()
+
+	for round := 1; ; round++ {
+		startTime := time.Now()
+
+		if refresh {
+			fmt.Print(clearScreen)
+		}
+
+		command := t.command
+		if t.commands != nil {
+			command = t.describeExecMap()
+		}
+
+		log.Infof("every %s: %s, round: %d", t.watch, command, round)
+
+		successCount, failedCount := 0, 0
+		failedCategories := make(map[string]int)
+		var durations hostDurations
+		for v := range t.sshClient.BatchRun(hosts, t) {
+			durations.add(v.Addr, v.Duration)
+
+			if v.Status == batchssh.SuccessIdentifier {
+				successCount++
+			} else {
+				failedCount++
+				failedCategories[v.Category]++
+				t.clearPasswordCache(v.Category)
+			}
+
+			t.detailOutput <- detailResult{
+				taskID:     t.id,
+				hostname:   v.Addr,
+				status:     v.Status,
+				output:     v.Message,
+				stderr:     v.Stderr,
+				timings:    v.Timings,
+				escalation: v.Escalation,
+				category:   v.Category,
+				exitCode:   v.ExitCode,
+			}
+		}
+
+		// Wait until the results of this round are written.
+		t.detailOutput <- detailResult{}
+
+		endTime := time.Now()
+
+		summary := &output.TaskSummary{
+			TaskID:       t.id,
+			SuccessCount: successCount,
+			FailedCount:  failedCount,
+			Elapsed:      endTime.Sub(startTime).Seconds(),
+			StartTime:    startTime,
+			EndTime:      endTime,
+
+			FailedCategories: failedCategories,
+			Durations:        durations.stats(),
+		}
+
+		if t.anonymizer != nil {
+			t.anonymizer.summary(summary)
+		}
+
+		err := t.sink.WriteSummary(summary)
+		if err != nil {
+			log.Warnf("output task summary failed: %s", err)
+		}
+
+		time.Sleep(t.watch - endTime.Sub(startTime))
+	}
+}
@@ -0,0 +1,326 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package sshtask
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/windvalley/gossh/internal/pkg/configflags"
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+const (
+	// hostVarWindow is the variable of hosts file for the maintenance windows of
+	// the hosts, in format '[DAYS@]HH:MM-HH:MM', several windows are separated by ';'.
+	hostVarWindow = "window"
+	// hostVarWindowTZ is the variable of hosts file for the time zone of the
+	// maintenance windows, e.g. 'UTC' or 'Asia/Shanghai', default local.
+	hostVarWindowTZ = "window-tz"
+
+	// windowWaitMax is how long '--run.window-action wait' looks ahead for the
+	// time at which the windows of all target hosts are open.
+	windowWaitMax = 7 * 24 * time.Hour
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// maintenanceWindow is the time of the days in which the hosts can be operated,
+// the window that ends before it starts, e.g. '22:00-06:00', crosses midnight.
+type maintenanceWindow struct {
+	days [7]bool
+	// start and end are minutes of the day.
+	start, end int
+}
+
+// contains reports whether t is within the window, which starts on one of the days.
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+
+	return (w.days[day] && minute >= w.start) || (w.days[(day+6)%7] && minute < w.end)
+}
+
+// hostWindows are the maintenance windows of a host in the time zone.
+type hostWindows struct {
+	windows  []maintenanceWindow
+	location *time.Location
+}
+
+// open reports whether t is within one of the windows.
+func (h *hostWindows) open(t time.Time) bool {
+	t = t.In(h.location)
+
+	for i := range h.windows {
+		if h.windows[i].contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseHostWindows parses the variables 'window' and 'window-tz' of hosts file.
+func parseHostWindows(spec, tz string) (*hostWindows, error) {
+	location := time.Local
+	if tz != "" {
+		var err error
+		location, err = time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %s", hostVarWindowTZ, tz, err)
+		}
+	}
+
+	h := &hostWindows{location: location}
+	for _, v := range strings.Split(spec, ";") {
+		w, err := parseMaintenanceWindow(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %s", hostVarWindow, v, err)
+		}
+
+		h.windows = append(h.windows, *w)
+	}
+
+	return h, nil
+}
+
+// parseMaintenanceWindow parses '[DAYS@]HH:MM-HH:MM', DAYS are like 'mon-fri' or 'sat,sun',
+// and all days if omitted.
+func parseMaintenanceWindow(s string) (*maintenanceWindow, error) {
+	w := &maintenanceWindow{}
+
+	timeRange := s
+	if i := strings.Index(s, "@"); i != -1 {
+		if err := parseWeekdays(s[:i], &w.days); err != nil {
+			return nil, err
+		}
+		timeRange = s[i+1:]
+	} else {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+
+	bounds := strings.Split(timeRange, "-")
+	if len(bounds) != 2 {
+		return nil, errors.New("need format '[DAYS@]HH:MM-HH:MM'")
+	}
+
+	var err error
+	if w.start, err = parseMinuteOfDay(bounds[0]); err != nil {
+		return nil, err
+	}
+	if w.end, err = parseMinuteOfDay(bounds[1]); err != nil {
+		return nil, err
+	}
+
+	if w.start == w.end || w.start == 24*60 {
+		return nil, fmt.Errorf("invalid time range '%s'", timeRange)
+	}
+
+	return w, nil
+}
+
+// parseWeekdays parses days like 'mon-fri', 'sat,sun' or 'mon,wed-fri'.
+func parseWeekdays(s string, days *[7]bool) error {
+	for _, item := range strings.Split(s, ",") {
+		bounds := strings.Split(strings.ToLower(item), "-")
+		if len(bounds) > 2 {
+			return fmt.Errorf("invalid days '%s'", item)
+		}
+
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return fmt.Errorf("invalid day '%s', available: sun, mon, tue, wed, thu, fri, sat", bounds[0])
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return fmt.Errorf("invalid day '%s', available: sun, mon, tue, wed, thu, fri, sat", bounds[1])
+			}
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseMinuteOfDay parses 'HH:MM' from '00:00' to '24:00'.
+func parseMinuteOfDay(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time '%s', need format 'HH:MM'", s)
+	}
+
+	hour, err1 := strconv.Atoi(parts[0])
+	minute, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 ||
+		hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("invalid time '%s', need format 'HH:MM'", s)
+	}
+
+	return hour*60 + minute, nil
+}
+
+// checkWindows applies '--run.respect-windows' to the target hosts, and returns the
+// hosts to run and how long to wait for their maintenance windows.
+func (t *Task) checkWindows(hosts []string) ([]string, time.Duration, error) {
+	runConf := t.configFlags.Run
+	if !runConf.RespectWindows {
+		return hosts, 0, nil
+	}
+
+	if runConf.OverrideWindows != "" {
+		log.Warnf("maintenance windows of target hosts are overridden: %s", runConf.OverrideWindows)
+		return hosts, 0, nil
+	}
+
+	// Hosts of the same line of hosts file share the windows.
+	parsed := make(map[string]*hostWindows)
+	windows := make(map[string]*hostWindows)
+	for _, host := range hosts {
+		spec := t.hostVars[host][hostVarWindow]
+		if spec == "" {
+			continue
+		}
+
+		tz := t.hostVars[host][hostVarWindowTZ]
+		key := spec + " " + tz
+		if _, ok := parsed[key]; !ok {
+			w, err := parseHostWindows(spec, tz)
+			if err != nil {
+				return nil, 0, fmt.Errorf("maintenance window of host '%s': %s", host, err)
+			}
+			parsed[key] = w
+		}
+
+		windows[host] = parsed[key]
+	}
+
+	now := time.Now()
+
+	var within, outside []string
+	for _, host := range hosts {
+		if w, ok := windows[host]; ok && !w.open(now) {
+			outside = append(outside, host)
+		} else {
+			within = append(within, host)
+		}
+	}
+
+	if len(outside) == 0 {
+		return hosts, 0, nil
+	}
+
+	switch runConf.WindowAction {
+	case configflags.WindowActionSkip:
+		if len(within) == 0 {
+			return nil, 0, fmt.Errorf("all the %d target hosts are outside their maintenance windows", len(hosts))
+		}
+
+		log.Warnf(
+			"skip %d hosts outside their maintenance windows: %s",
+			len(outside),
+			strings.Join(outside, ","),
+		)
+
+		return within, 0, nil
+	case configflags.WindowActionWait:
+		start, ok := nextCommonWindow(parsed, now)
+		if !ok {
+			return nil, 0, fmt.Errorf(
+				"the maintenance windows of target hosts are not open at the same time in %d days",
+				int(windowWaitMax.Hours()/24),
+			)
+		}
+
+		return hosts, start.Sub(now), nil
+	default:
+		sort.Strings(outside)
+
+		return nil, 0, fmt.Errorf(
+			"%d of %d hosts are outside their maintenance windows, the task is not run: %s",
+			len(outside),
+			len(hosts),
+			strings.Join(outside, ","),
+		)
+	}
+}
+
+// nextCommonWindow returns the next minute at which all the windows are open.
+func nextCommonWindow(windows map[string]*hostWindows, now time.Time) (time.Time, bool) {
+	start := now.Truncate(time.Minute)
+	for t := start.Add(time.Minute); t.Sub(start) <= windowWaitMax; t = t.Add(time.Minute) {
+		open := true
+		for _, w := range windows {
+			if !w.open(t) {
+				open = false
+				break
+			}
+		}
+
+		if open {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// waitWindows waits for the maintenance windows of target hosts by '--run.window-action wait'.
+func (t *Task) waitWindows(wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+
+	log.Infof(
+		"waiting %s until %s for the maintenance windows of target hosts",
+		wait.Round(time.Second),
+		time.Now().Add(wait).Format("2006-01-02 15:04"),
+	)
+
+	time.Sleep(wait)
+}
@@ -23,6 +23,7 @@ THE SOFTWARE.
 package batchssh
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -31,6 +32,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -44,7 +46,8 @@ import (
 )
 
 const (
-	exportLangPattern = "export LANG=%s;export LC_ALL=%s;export LANGUAGE=%s;"
+	// maxPendingOutput is the max size of output to match prompts against.
+	maxPendingOutput = 4096
 
 	// SuccessIdentifier for result output.
 	SuccessIdentifier = "SUCCESS"
@@ -59,9 +62,26 @@ type Task interface {
 
 // Result of ssh command.
 type Result struct {
-	Addr    string `json:"addr"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	Addr    string   `json:"addr"`
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Timings *Timings `json:"timings"`
+	// Escalation is how the target host ran as other users if Client.Escalate
+	// is not EscalateSudo, e.g. EscalationSu.
+	Escalation string `json:"escalation"`
+	// Category is the category of the failure, e.g. CategoryAuth,
+	// and it is empty if the target host succeeded.
+	Category string `json:"category"`
+	// ExitCode of the commands, -1 if they did not exit, e.g. failures of connecting.
+	ExitCode int `json:"exit_code"`
+	// Duration of the task on the target host, not including waiting for
+	// the slot of Client.Spread or the start allowed by Client.ConnectRate.
+	Duration time.Duration `json:"duration"`
+	// StartTime of the task on the target host.
+	StartTime time.Time `json:"start_time"`
+	// Stderr is only set if Client.SeparateStderr is set,
+	// otherwise it is merged into Message.
+	Stderr string `json:"stderr"`
 }
 
 // Client for ssh.
@@ -74,12 +94,260 @@ type Client struct {
 	CommandTimeout time.Duration
 	Concurrency    int
 	Proxy          *Proxy
+
+	// ProxyPool distributes the target hosts without their own proxy servers in
+	// HostConfigs across proxy servers with failover, it takes precedence over Proxy.
+	ProxyPool *ProxyPool
+
+	// ProxyMaxSessions caps the concurrent sessions through each proxy server,
+	// including the jump hosts of HostConfigs, the others wait for their turn,
+	// since proxy servers usually limit them by MaxSessions/MaxStartups.
+	// 0 means no limit.
+	ProxyMaxSessions int
+
+	// PreConnect is called before connecting each target host, e.g. for port knocking,
+	// and the target host fails if it returns error.
+	PreConnect func(addr, hostName string, port int) error
+
+	// HTTPProxy tunnels the connections to target hosts and proxy server
+	// through a http proxy if not nil.
+	HTTPProxy *HTTPProxy
+
+	// HostConfigs overrides the settings above for the target hosts in it.
+	HostConfigs map[string]*HostConfig
+
+	// Algorithms overrides the default algorithms of golang.org/x/crypto/ssh if not empty.
+	Algorithms Algorithms
+
+	// ControlPath is the unix socket of the control master that keeps
+	// connections to target hosts, see ServeControlMaster.
+	ControlPath string
+
+	// SudoEnv controls the environment of commands executed by sudo.
+	SudoEnv SudoEnv
+
+	// SudoWrapper is executed by sudo as 'SudoWrapper -c COMMANDS' instead of bash,
+	// so that sudoers can be restricted to it, e.g. /usr/local/bin/gossh-run.
+	SudoWrapper string
+
+	// Escalate is the method of running as other users, EscalateSudo, EscalateSu
+	// or EscalateAuto that finds the method of each target host by ResolveEscalation.
+	Escalate string
+
+	// SuPassword answers the password prompt of su, Password is used if it is empty.
+	SuPassword string
+
+	// Responses answer the prompts of commands on pty.
+	Responses []Response
+
+	// Spread limits the concurrent target hosts of each group, nil means no limit.
+	Spread *Spread
+
+	// ConnectRate limits how fast target hosts start, i.e. new connections
+	// are opened, independent of Concurrency, nil means no limit.
+	ConnectRate *RateLimiter
+
+	// Transfer tunes sftp requests, zero values mean the defaults of github.com/pkg/sftp.
+	Transfer Transfer
+
+	// MaxOutputSize is the max bytes of output kept for each target host, 0 means no limit.
+	MaxOutputSize int
+
+	// SeparateStderr captures stderr apart from stdout, commands are executed
+	// without pty then.
+	SeparateStderr bool
+
+	// RawExec sends commands as they are by exec requests without pty,
+	// for network devices whose ssh servers do not provide a full shell.
+	RawExec bool
+
+	// NoPty executes commands without pty, stderr is still merged into stdout
+	// unless SeparateStderr is set, and the sudo password is given by 'sudo -S'.
+	NoPty bool
+
+	// Pty is the pty requested for commands, zero values mean 'xterm' of 100x100.
+	Pty Pty
+
+	// WorkDir is the directory in which commands/scripts are executed,
+	// empty means the home directory of the login user.
+	WorkDir string
+
+	// Umask is set before commands/scripts are executed, e.g. 027,
+	// empty means the umask of target hosts.
+	Umask string
+
+	// RecordDir saves the output of each session to '<RecordDir>/<addr>.cast'
+	// in asciicast v2 format if not empty.
+	RecordDir string
+
+	timings timingRecorder
+	stderrs stderrRecorder
+
+	escalations escalationRecorder
+	ptyHosts    ptyRecorder
+
+	sharedFiles sharedFiles
 }
 
-// Proxy server.
+// HostConfig is the connection settings of a target host.
+// Zero value fields fall back to the settings of Client.
+type HostConfig struct {
+	// HostName is the real host name or ip to connect to.
+	HostName string
+	User     string
+	Port     int
+	// Auths are tried before the auth methods of Client.
+	Auths []ssh.AuthMethod
+	Proxy *Proxy
+}
+
+// SudoEnv is the environment handling of sudo, instead of sudo defaults only.
+type SudoEnv struct {
+	// PreserveEnv preserves the whole environment, sudo -E.
+	PreserveEnv bool
+	// PreserveEnvVars preserves these variables, sudo --preserve-env=VAR,...
+	PreserveEnvVars []string
+	// SetHome sets HOME to the home of the target user, sudo -H.
+	SetHome bool
+}
+
+// Response is the answer to a prompt emitted by the remote command on pty.
+type Response struct {
+	Prompt *regexp.Regexp
+	Answer string
+}
+
+// Transfer tunes sftp requests of each file.
+type Transfer struct {
+	// ChunkSize is the bytes of each read/write request.
+	ChunkSize int
+	// Inflight is the max concurrent read/write requests.
+	Inflight int
+}
+
+// Pty is the pseudo terminal requested for the sessions of commands.
+type Pty struct {
+	// Term is the value of TERM, e.g. xterm-256color.
+	Term string
+	// Width in columns.
+	Width int
+	// Height in rows.
+	Height int
+}
+
+// Algorithms used for ssh connections, empty means the defaults.
+type Algorithms struct {
+	Ciphers           []string
+	KeyExchanges      []string
+	MACs              []string
+	HostKeyAlgorithms []string
+}
+
+// Proxy server, which is connected only once, and the connections to all the
+// target hosts through it are channels of that single ssh connection.
 type Proxy struct {
 	SSHClient *ssh.Client
 	Err       error
+
+	server string
+	user   string
+	port   int
+	auths  []ssh.AuthMethod
+	once   sync.Once
+
+	// via is the proxy server through which this proxy server is connected, like
+	// the former jump hosts of ProxyJump 'a,b'.
+	via *Proxy
+
+	sessionsOnce sync.Once
+	sessions     chan struct{}
+}
+
+// NewProxy returns a proxy server which is connected on first use,
+// and it is shared by all the target hosts that use it.
+func NewProxy(proxyServer, user string, port int, auths []ssh.AuthMethod) *Proxy {
+	return &Proxy{
+		server: proxyServer,
+		user:   user,
+		port:   port,
+		auths:  auths,
+	}
+}
+
+// NewProxyVia returns a proxy server like NewProxy, which is connected through
+// the proxy server via.
+func NewProxyVia(via *Proxy, proxyServer, user string, port int, auths []ssh.AuthMethod) *Proxy {
+	proxy := NewProxy(proxyServer, user, port, auths)
+	proxy.via = via
+
+	return proxy
+}
+
+// acquireSession waits until the sessions through the proxy server are less than
+// max, and the returned release frees the session, max <= 0 means no limit.
+func (p *Proxy) acquireSession(max int) (release func()) {
+	if max <= 0 {
+		return func() {}
+	}
+
+	p.sessionsOnce.Do(func() {
+		p.sessions = make(chan struct{}, max)
+	})
+
+	p.sessions <- struct{}{}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			<-p.sessions
+		})
+	}
+}
+
+func (p *Proxy) connect(c *Client) {
+	p.once.Do(func() {
+		proxySSHConfig := c.newSSHConfig(p.user, p.auths)
+		proxyAddr := net.JoinHostPort(p.server, strconv.Itoa(p.port))
+
+		var proxyClient *ssh.Client
+		var err error
+		if p.via != nil {
+			proxyClient, err = p.via.dialSSH(c, proxyAddr, proxySSHConfig)
+		} else if c.HTTPProxy != nil {
+			proxyClient, err = c.HTTPProxy.dialSSH(proxyAddr, c.ConnTimeout, proxySSHConfig)
+		} else {
+			proxyClient, err = ssh.Dial("tcp", proxyAddr, proxySSHConfig)
+		}
+		if err != nil {
+			p.Err = fmt.Errorf("connet to proxy %s:%d failed: %s", p.server, p.port, err)
+
+			return
+		}
+
+		p.SSHClient = proxyClient
+	})
+}
+
+// dialSSH connects the ssh server addr through the proxy server.
+func (p *Proxy) dialSSH(c *Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	p.connect(c)
+	if p.Err != nil {
+		return nil, p.Err
+	}
+
+	conn, err := p.SSHClient.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(ncc, chans, reqs), nil
 }
 
 // NewClient session.
@@ -93,6 +361,7 @@ func NewClient(user, password string, auths []ssh.AuthMethod, options ...func(*C
 		CommandTimeout: 0,
 		Concurrency:    100,
 		Proxy:          &Proxy{},
+		SudoEnv:        SudoEnv{SetHome: true},
 	}
 
 	for _, option := range options {
@@ -103,6 +372,9 @@ func NewClient(user, password string, auths []ssh.AuthMethod, options ...func(*C
 }
 
 // BatchRun command on remote servers.
+// The target hosts are run by Concurrency workers, each of which runs them one
+// after another, results are not buffered, at most Concurrency results wait to
+// be received, and the output of each result is bounded by MaxOutputSize.
 func (c *Client) BatchRun(
 	addrs []string,
 	sshTask Task,
@@ -120,42 +392,8 @@ func (c *Client) BatchRun(
 	wg.Add(c.Concurrency)
 	for i := 0; i < c.Concurrency; i++ {
 		go func(wg *sync.WaitGroup) {
-			for addr := range addrCh {
-				var result *Result
-
-				done := make(chan struct{})
-				go func() {
-					defer close(done)
-
-					output, err := sshTask.RunSSH(addr)
-					if err != nil {
-						result = &Result{addr, FailedIdentifier, err.Error()}
-					} else {
-						result = &Result{addr, SuccessIdentifier, output}
-					}
-				}()
-
-				if c.CommandTimeout > 0 {
-					select {
-					case <-done:
-					case <-time.After(c.CommandTimeout):
-						result = &Result{
-							addr,
-							FailedIdentifier,
-							fmt.Sprintf(
-								"command timeout, timeout value: %d seconds",
-								c.CommandTimeout/time.Second,
-							),
-						}
-					}
-				} else {
-					<-done
-				}
-
-				resCh <- result
-			}
-
-			wg.Done()
+			defer wg.Done()
+			newWorker(c, sshTask).work(addrCh, resCh)
 		}(&wg)
 	}
 
@@ -175,23 +413,24 @@ func (c *Client) ExecuteCmd(addr, command, lang, runAs string, sudo bool) (strin
 	}
 	defer client.Close()
 
-	session, err := client.NewSession()
-	if err != nil {
-		return "", err
-	}
+	defer c.timings.since(addr, phaseExec, time.Now())
 
-	exportLang := ""
-	if lang != "" {
-		exportLang = fmt.Sprintf(exportLangPattern, lang, lang, lang)
-	}
+	return c.withPtyRetry(addr, sudo, func() (string, error) {
+		session, err := client.NewSession()
+		if err != nil {
+			return "", err
+		}
 
-	if sudo {
-		command = fmt.Sprintf("%ssudo -u %s -H bash -c '%s'", exportLang, runAs, command)
-	} else {
-		command = exportLang + command
-	}
+		exportLang := setLang(session, lang)
+		command := c.runPrefix() + command
+
+		if sudo {
+			return c.executeCmd(addr, session,
+				fmt.Sprintf("%s%s -c '%s'", exportLang, c.sudoCommand(addr, runAs), command))
+		}
 
-	return c.executeCmd(session, command)
+		return c.executeCmd(addr, session, exportLang+command)
+	})
 }
 
 // ExecuteScript on remote host.
@@ -205,49 +444,71 @@ func (c *Client) ExecuteScript(
 	}
 	defer client.Close()
 
-	ftpC, err := sftp.NewClient(client)
+	ftpC, err := c.newSFTPClient(client)
 	if err != nil {
 		return "", err
 	}
 	defer ftpC.Close()
 
+	transferStart := time.Now()
 	file, err := c.pushFile(ftpC, srcFile, dstDir, allowOverwrite)
+	c.timings.since(addr, phaseTransfer, transferStart)
 	if err != nil {
 		return "", err
 	}
 
+	script := file.Name()
+
+	if remove {
+		// The script removes itself by trap on exit, this also removes it
+		// if the script is not executed at all.
+		defer func() {
+			if err := ftpC.Remove(script); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Debugf("remove '%s:%s' failed: %s", addr, script, err)
+			}
+		}()
+	}
+
 	//nolint:gomnd,govet
 	if err := file.Chmod(0755); err != nil {
+		file.Close()
 		return "", err
 	}
-
-	script := file.Name()
 	file.Close()
 
-	session, err := client.NewSession()
-	if err != nil {
-		return "", err
-	}
-	defer session.Close()
+	defer c.timings.since(addr, phaseExec, time.Now())
 
-	exportLang := ""
-	if lang != "" {
-		exportLang = fmt.Sprintf(exportLangPattern, lang, lang, lang)
-	}
+	return c.withPtyRetry(addr, sudo, func() (string, error) {
+		session, err := client.NewSession()
+		if err != nil {
+			return "", err
+		}
+		defer session.Close()
 
-	command := ""
-	switch {
-	case sudo && remove:
-		command = fmt.Sprintf("%ssudo -u %s -H bash -c '%s;rm -f %s'", exportLang, runAs, script, script)
-	case sudo && !remove:
-		command = fmt.Sprintf("%ssudo -u %s -H bash -c '%s'", exportLang, runAs, script)
-	case !sudo && remove:
-		command = fmt.Sprintf("%s%s;rm -f %s", exportLang, script, script)
-	case !sudo && !remove:
-		command = exportLang + script
-	}
+		exportLang := setLang(session, lang)
+		prefix := c.runPrefix()
+
+		command := ""
+		switch {
+		case sudo && remove:
+			command = fmt.Sprintf(
+				`%s%s -c 'trap "rm -f %s" EXIT;%s%s'`,
+				exportLang,
+				c.sudoCommand(addr, runAs),
+				script,
+				prefix,
+				script,
+			)
+		case sudo && !remove:
+			command = fmt.Sprintf("%s%s -c '%s%s'", exportLang, c.sudoCommand(addr, runAs), prefix, script)
+		case !sudo && remove:
+			command = fmt.Sprintf(`%strap "rm -f %s" EXIT;%s%s`, exportLang, script, prefix, script)
+		case !sudo && !remove:
+			command = exportLang + prefix + script
+		}
 
-	return c.executeCmd(session, command)
+		return c.executeCmd(addr, session, command)
+	})
 }
 
 // PushFiles to remote host.
@@ -255,23 +516,36 @@ func (c *Client) PushFiles(
 	addr string,
 	srcFiles, srcZipFiles []string,
 	dstDir string,
-	allowOverwrite bool,
-) (string, error) {
+	allowOverwrite, preservePaths bool,
+) (output string, err error) {
+	// Failures that are not of connecting or executing commands are of transferring.
+	defer func() { err = withCategory(err, CategoryTransfer) }()
+
 	client, err := c.getClient(addr)
 	if err != nil {
 		return "", err
 	}
 	defer client.Close()
 
-	ftpC, err := sftp.NewClient(client)
+	ftpC, err := c.newSFTPClient(client)
 	if err != nil {
 		return "", err
 	}
 	defer ftpC.Close()
 
+	if err := c.preflightPush(client, ftpC, dstDir, srcZipFiles); err != nil {
+		return "", err
+	}
+
 	for i, f := range srcZipFiles {
 		srcFile := srcFiles[i]
 
+		// The files are in dstDir by their paths if preservePaths, otherwise by their names.
+		dstName := filepath.Base(srcFile)
+		if preservePaths {
+			dstName, _ = util.PreservedPath(srcFile)
+		}
+
 		dstZipFile := filepath.Base(f)
 
 		done := make(chan struct{})
@@ -279,10 +553,11 @@ func (c *Client) PushFiles(
 			err  error
 			file *sftp.File
 		)
+		transferStart := time.Now()
 		go func() {
 			defer close(done)
 
-			file, err = c.pushZipFile(ftpC, f, filepath.Base(srcFile), dstDir, allowOverwrite)
+			file, err = c.pushZipFile(ftpC, f, dstName, dstDir, allowOverwrite)
 			if err == nil {
 				file.Close()
 			}
@@ -290,6 +565,8 @@ func (c *Client) PushFiles(
 
 		<-done
 
+		c.timings.since(addr, phaseTransfer, transferStart)
+
 		if err != nil {
 			return "", err
 		}
@@ -300,7 +577,9 @@ func (c *Client) PushFiles(
 		}
 		defer session.Close()
 
+		execStart := time.Now()
 		_, err = c.executeCmd(
+			addr,
 			session,
 			fmt.Sprintf(
 				`which unzip &>/dev/null && { cd %s;unzip -o %s;rm %s;} || 
@@ -312,6 +591,7 @@ func (c *Client) PushFiles(
 				dstZipFile,
 			),
 		)
+		c.timings.since(addr, phaseExec, execStart)
 		if err != nil {
 			return "", err
 		}
@@ -333,14 +613,17 @@ func (c *Client) FetchFiles(
 	dstDir, tmpDir string,
 	sudo bool,
 	runAs string,
-) (string, error) {
+	filter *FetchFilter,
+) (output string, err error) {
+	defer func() { err = withCategory(err, CategoryTransfer) }()
+
 	client, err := c.getClient(addr)
 	if err != nil {
 		return "", err
 	}
 	defer client.Close()
 
-	ftpC, err := sftp.NewClient(client)
+	ftpC, err := c.newSFTPClient(client)
 	if err != nil {
 		return "", err
 	}
@@ -394,29 +677,41 @@ func (c *Client) FetchFiles(
 	zippedFileTmpDir := path.Join(tmpDir, "gossh-"+addr)
 	tmpZipFile := fmt.Sprintf("%s.%d", addr, time.Now().UnixMicro())
 	zippedFileFullpath := path.Join(zippedFileTmpDir, tmpZipFile)
-	_, err = c.executeCmd(
+
+	// Remove the zip file even if zipping or fetching it failed.
+	defer func() {
+		if err := c.removeFiles(addr, client, true, runAs, zippedFileFullpath); err != nil {
+			log.Debugf("remove '%s:%s' failed: %s", addr, zippedFileFullpath, err)
+		}
+	}()
+
+	execStart := time.Now()
+	zipOutput, err := c.executeCmd(
+		addr,
 		session,
 		fmt.Sprintf(
 			`if which zip &>/dev/null;then 
-    sudo -u %s -H bash -c '[[ ! -d %s ]] && { mkdir -p %s;chmod 777 %s;};zip -r %s %s'
+    %s -c '[[ ! -d %s ]] && { mkdir -p %s;chmod 777 %s;};%s'
 else
 	echo "need install 'zip' command"
 	exit 1
 fi`,
-			runAs,
+			c.sudoCommand(addr, runAs),
 			zippedFileTmpDir,
 			zippedFileTmpDir,
 			zippedFileTmpDir,
-			zippedFileFullpath,
-			strings.Join(validSrcFiles, " "),
+			filter.zipCommand(zippedFileFullpath, validSrcFiles),
 		),
 	)
+	c.timings.since(addr, phaseExec, execStart)
 	if err != nil {
 		log.Debugf("zip %s of %s failed: %s", strings.Join(validSrcFiles, ","), addr, err)
 		return "", err
 	}
 
+	transferStart := time.Now()
 	file, err := c.fetchZipFile(ftpC, zippedFileFullpath, dstDir)
+	c.timings.since(addr, phaseTransfer, transferStart)
 	if err == nil {
 		file.Close()
 	}
@@ -425,21 +720,6 @@ fi`,
 		return "", err
 	}
 
-	session2, err := client.NewSession()
-	if err != nil {
-		return "", err
-	}
-	defer session2.Close()
-
-	_, err = c.executeCmd(
-		session2,
-		fmt.Sprintf("sudo -u %s -H bash -c 'rm -f %s'", runAs, zippedFileFullpath),
-	)
-	if err != nil {
-		log.Debugf("remove '%s:%s' failed: %s", addr, zippedFileFullpath, err)
-		return "", err
-	}
-
 	finalDstDir := path.Join(dstDir, addr)
 	localZippedFileFullpath := path.Join(dstDir, tmpZipFile)
 	defer func() {
@@ -489,18 +769,26 @@ fi`,
 		)
 	}
 
+	if skipped := skippedFiles(zipOutput); len(skipped) != 0 {
+		ret += fmt.Sprintf("; '%s' skipped for larger than %s",
+			strings.Join(skipped, ","),
+			formatBytes(uint64(filter.MaxSize)),
+		)
+	}
+
 	return ret, nil
 }
 
-func (c *Client) executeCmd(session *ssh.Session, command string) (string, error) {
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          0,
-		ssh.TTY_OP_ISPEED: 28800,
-		ssh.TTY_OP_OSPEED: 28800,
+func (c *Client) executeCmd(addr string, session *ssh.Session, command string) (string, error) {
+	if c.RawExec && c.noPty(addr) {
+		return c.executeRawCmd(addr, session, command)
 	}
 
-	//nolint:gomnd
-	if err := session.RequestPty("xterm", 100, 100, modes); err != nil {
+	if c.noPty(addr) {
+		return c.executeNoPtyCmd(addr, session, command)
+	}
+
+	if err := c.requestPty(session); err != nil {
 		return "", err
 	}
 
@@ -514,7 +802,10 @@ func (c *Client) executeCmd(session *ssh.Session, command string) (string, error
 		return "", err
 	}
 
-	out, isWrongPass := c.handleOutput(w, r)
+	out, isWrongPass := c.handleOutput(w, r, c.escalations.get(addr) == EscalationSu)
+
+	recorder := c.startRecording(addr, command)
+	defer recorder.Close()
 
 	done := make(chan struct{})
 	go func() {
@@ -522,27 +813,178 @@ func (c *Client) executeCmd(session *ssh.Session, command string) (string, error
 		err = session.Run(command)
 	}()
 
-	var output []byte
+	output := newOutputBuffer(c.MaxOutputSize, recorder)
+	defer output.free()
 	for v := range out {
-		output = append(output, v...)
+		_, _ = output.Write(v)
 	}
 
-	outputStr := string(output)
+	outputStr := output.String()
 
 	if <-isWrongPass {
-		return "", errors.New("wrong sudo password")
+		return "", withCategory(errors.New("wrong sudo password"), CategoryAuth)
 	}
 
 	<-done
 
 	if err != nil {
 		log.Debugf("'%s' executed failed: %s", command, err)
-		return "", errors.New(outputStr)
+		return "", commandError(err, outputStr)
 	}
 
 	return outputStr, nil
 }
 
+// requestPty requests the pty of Client.Pty for session.
+func (c *Client) requestPty(session *ssh.Session) error {
+	term, width, height := c.Pty.Term, c.Pty.Width, c.Pty.Height
+	if term == "" {
+		term = "xterm"
+	}
+
+	//nolint:gomnd
+	if width <= 0 {
+		width = 100
+	}
+
+	//nolint:gomnd
+	if height <= 0 {
+		height = 100
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 28800,
+		ssh.TTY_OP_OSPEED: 28800,
+	}
+
+	return session.RequestPty(term, height, width, modes)
+}
+
+// RemoveFiles removes files/dirs on remote host, such as the temporary files left
+// by the tasks that failed or timed out. Shell patterns are supported.
+func (c *Client) RemoveFiles(addr string, files []string, sudo bool, runAs string) (string, error) {
+	client, err := c.getClient(addr)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if err := c.removeFiles(addr, client, sudo, runAs, files...); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("'%s' removed", strings.Join(files, ",")), nil
+}
+
+func (c *Client) removeFiles(addr string, client *ssh.Client, sudo bool, runAs string, files ...string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	command := "rm -rf " + strings.Join(files, " ")
+	if sudo {
+		command = fmt.Sprintf("%s -c '%s'", c.sudoCommand(addr, runAs), command)
+	}
+
+	_, err = c.executeCmd(addr, session, command)
+
+	return err
+}
+
+// sudoCommand returns the sudo command line with the options of SudoEnv and
+// the shell to which '-c COMMANDS' is appended, and the password is read from
+// stdin if commands are executed without pty.
+func (c *Client) sudoCommand(addr, runAs string) string {
+	// su can not read the password without pty.
+	if c.escalations.get(addr) == EscalationSu && !c.noPty(addr) {
+		return c.suCommand(runAs)
+	}
+
+	if c.noPty(addr) {
+		return c.sudoNoPtyCommand(runAs)
+	}
+
+	return c.sudoEnvCommand(runAs) + " " + c.sudoShell()
+}
+
+// sudoShell is SudoWrapper if it is set, otherwise bash.
+func (c *Client) sudoShell() string {
+	if c.SudoWrapper != "" {
+		return c.SudoWrapper
+	}
+
+	return "bash"
+}
+
+func (c *Client) sudoEnvCommand(runAs string) string {
+	command := "sudo -u " + runAs
+
+	if c.SudoEnv.SetHome {
+		command += " -H"
+	}
+
+	if c.SudoEnv.PreserveEnv {
+		command += " -E"
+	}
+
+	if len(c.SudoEnv.PreserveEnvVars) != 0 {
+		command += " --preserve-env=" + strings.Join(c.SudoEnv.PreserveEnvVars, ",")
+	}
+
+	return command
+}
+
+// runPrefix changes into WorkDir and sets Umask before commands/scripts.
+func (c *Client) runPrefix() string {
+	prefix := ""
+
+	if c.WorkDir != "" {
+		prefix += "cd " + util.ShellDoubleQuote(c.WorkDir) + " && "
+	}
+
+	if c.Umask != "" {
+		prefix += "umask " + c.Umask + " && "
+	}
+
+	return prefix
+}
+
+// executeRawCmd only sends an exec request, many network devices reject pty
+// requests or close the session after them.
+func (c *Client) executeRawCmd(addr string, session *ssh.Session, command string) (string, error) {
+	recorder := c.startRecording(addr, command)
+	defer recorder.Close()
+
+	output := newOutputBuffer(c.MaxOutputSize, recorder)
+	defer output.free()
+	session.Stdout = output
+	session.Stderr = output
+
+	if c.SeparateStderr {
+		errOutput := newOutputBuffer(c.MaxOutputSize, recorder)
+		defer errOutput.free()
+		session.Stderr = errOutput
+		defer func() {
+			c.stderrs.add(addr, errOutput.String())
+		}()
+	}
+
+	if err := session.Run(command); err != nil {
+		log.Debugf("'%s' executed failed: %s", command, err)
+
+		if output.String() == "" {
+			return "", withCategory(err, CategoryCommandNonzero)
+		}
+
+		return "", commandError(err, output.String())
+	}
+
+	return output.String(), nil
+}
+
 func (c *Client) pushFile(
 	ftpC *sftp.Client,
 	srcFile, dstDir string,
@@ -615,7 +1057,8 @@ func (c *Client) pushZipFile(
 		srcZipFile = strings.Replace(srcZipFile, "~", homeDir, 1)
 	}
 
-	content, err := ioutil.ReadFile(srcZipFile)
+	// The zip file is shared by all target hosts.
+	content, err := c.sharedFiles.get(srcZipFile)
 	if err != nil {
 		return nil, err
 	}
@@ -695,54 +1138,242 @@ func (c *Client) fetchZipFile(
 }
 
 func (c *Client) getClient(addr string) (*ssh.Client, error) {
-	var (
-		client *ssh.Client
-		err    error
-	)
+	if c.ControlPath != "" {
+		dialStart := time.Now()
+		client, err := c.dialControlMaster(addr)
+		c.timings.since(addr, phaseDial, dialStart)
+		if err == nil {
+			return client, nil
+		}
+
+		log.Debugf("connect %s through control master failed, connect directly: %s", addr, err)
+	}
+
+	return c.dial(addr, c.HostConfigs[addr])
+}
+
+// dial target host with the connection settings of hostConfig,
+// which falls back to the settings of Client if it is nil.
+func (c *Client) dial(addr string, hostConfig *HostConfig) (*ssh.Client, error) {
+	var err error
+
+	user, hostName, port, auths, proxy := c.User, addr, c.Port, c.Auths, c.Proxy
+
+	if hostConfig != nil {
+		if hostConfig.HostName != "" {
+			hostName = hostConfig.HostName
+		}
+
+		if hostConfig.User != "" {
+			user = hostConfig.User
+		}
+
+		if hostConfig.Port != 0 {
+			port = hostConfig.Port
+		}
+
+		if len(hostConfig.Auths) != 0 {
+			auths = append(append([]ssh.AuthMethod{}, hostConfig.Auths...), c.Auths...)
+		}
+
+		if hostConfig.Proxy != nil {
+			proxy = hostConfig.Proxy
+			proxy.connect(c)
+		}
+	}
+
+	if c.PreConnect != nil {
+		if err := c.PreConnect(addr, hostName, port); err != nil {
+			return nil, err
+		}
+	}
+
+	sshConfig := c.newSSHConfig(user, auths)
+
+	remoteHost := net.JoinHostPort(hostName, strconv.Itoa(port))
+
+	var conn net.Conn
+
+	switch {
+	case proxy == c.Proxy && c.ProxyPool != nil:
+		conn, err = c.ProxyPool.dial(c, addr, remoteHost)
+		if err != nil {
+			return nil, err
+		}
+	case proxy.SSHClient != nil || proxy.Err != nil:
+		if proxy.Err != nil {
+			return nil, proxy.Err
+		}
 
+		conn, err = c.dialProxy(addr, proxy, remoteHost)
+		if err != nil {
+			return nil, withCategory(err, dialCategory(err))
+		}
+	default:
+		conn, err = c.dialTCP(addr, hostName, port)
+		if err != nil {
+			return nil, withCategory(err, dialCategory(err))
+		}
+	}
+
+	authStart := time.Now()
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, remoteHost, sshConfig)
+	c.timings.since(addr, phaseAuth, authStart)
+	if err != nil {
+		conn.Close()
+		return nil, withCategory(err, handshakeCategory(err))
+	}
+
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// dialProxy connects remoteHost through the connected proxy server.
+func (c *Client) dialProxy(addr string, proxy *Proxy, remoteHost string) (net.Conn, error) {
+	release := proxy.acquireSession(c.ProxyMaxSessions)
+
+	// The proxy server resolves the target host.
+	dialStart := time.Now()
+	conn, err := proxy.SSHClient.Dial("tcp", remoteHost)
+	c.timings.since(addr, phaseDial, dialStart)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// The session is freed once the connection to the target host is closed.
+	return &proxiedConn{Conn: conn, release: release}, nil
+}
+
+// proxiedConn is the connection to a target host through a proxy server,
+// which frees its session of the proxy server when it is closed.
+type proxiedConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *proxiedConn) Close() error {
+	defer c.release()
+
+	return c.Conn.Close()
+}
+
+// newSSHConfig returns the ssh client config with the algorithms of Client.
+func (c *Client) newSSHConfig(user string, auths []ssh.AuthMethod) *ssh.ClientConfig {
 	sshConfig := &ssh.ClientConfig{
-		User:    c.User,
-		Auth:    c.Auths,
-		Timeout: c.ConnTimeout,
+		User:              user,
+		Auth:              auths,
+		Timeout:           c.ConnTimeout,
+		HostKeyAlgorithms: nilIfEmpty(c.Algorithms.HostKeyAlgorithms),
 	}
+	sshConfig.Ciphers = nilIfEmpty(c.Algorithms.Ciphers)
+	sshConfig.KeyExchanges = nilIfEmpty(c.Algorithms.KeyExchanges)
+	sshConfig.MACs = nilIfEmpty(c.Algorithms.MACs)
 	//nolint:gosec
 	sshConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
 
-	remoteHost := net.JoinHostPort(addr, strconv.Itoa(c.Port))
+	return sshConfig
+}
+
+func (c *Client) newSFTPClient(client *ssh.Client) (*sftp.Client, error) {
+	var options []sftp.ClientOption
 
-	if c.Proxy.SSHClient != nil || c.Proxy.Err != nil {
-		if c.Proxy.Err != nil {
-			return nil, c.Proxy.Err
-		}
+	if c.Transfer.ChunkSize > 0 {
+		options = append(options, sftp.MaxPacketUnchecked(c.Transfer.ChunkSize))
+	}
 
-		conn, err2 := c.Proxy.SSHClient.Dial("tcp", remoteHost)
-		if err2 != nil {
-			return nil, err2
+	if c.Transfer.Inflight > 0 {
+		options = append(options, sftp.MaxConcurrentRequestsPerFile(c.Transfer.Inflight))
+	}
+
+	return sftp.NewClient(client, options...)
+}
+
+// langEnvs are set to the language of commands, see setLang.
+var langEnvs = []string{"LANG", "LC_ALL", "LANGUAGE"}
+
+// setLang sets the language envs of session by env requests, and returns the
+// 'export' commands of the envs rejected by the ssh server, e.g. OpenSSH only
+// accepts the envs of its 'AcceptEnv'. It should be called before the session starts.
+func setLang(session *ssh.Session, lang string) string {
+	if lang == "" {
+		return ""
+	}
+
+	exports := ""
+	for _, env := range langEnvs {
+		if err := session.Setenv(env, lang); err != nil {
+			exports += fmt.Sprintf("export %s=%s;", env, lang)
 		}
+	}
+
+	return exports
+}
+
+// nilIfEmpty makes golang.org/x/crypto/ssh use its defaults, which only
+// applies to nil slices rather than empty ones.
+func nilIfEmpty(algorithms []string) []string {
+	if len(algorithms) == 0 {
+		return nil
+	}
+
+	return algorithms
+}
+
+// dialTCP resolves hostName and connects to it, recording both phases in timings of addr.
+func (c *Client) dialTCP(addr, hostName string, port int) (net.Conn, error) {
+	if c.HTTPProxy != nil {
+		// The http proxy resolves the target host.
+		dialStart := time.Now()
+		defer c.timings.since(addr, phaseDial, dialStart)
+
+		return c.HTTPProxy.dial(net.JoinHostPort(hostName, strconv.Itoa(port)), c.ConnTimeout)
+	}
 
-		ncc, chans, reqs, err3 := ssh.NewClientConn(conn, remoteHost, sshConfig)
-		if err3 != nil {
-			return nil, err3
+	ips := []string{hostName}
+
+	if net.ParseIP(hostName) == nil {
+		ctx := context.Background()
+		if c.ConnTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.ConnTimeout)
+			defer cancel()
 		}
 
-		client = ssh.NewClient(ncc, chans, reqs)
-	} else {
-		client, err = ssh.Dial("tcp", remoteHost, sshConfig)
+		dnsStart := time.Now()
+		resolved, err := net.DefaultResolver.LookupHost(ctx, hostName)
+		c.timings.since(addr, phaseDNS, dnsStart)
 		if err != nil {
 			return nil, err
 		}
+
+		ips = resolved
 	}
 
-	return client, nil
+	dialStart := time.Now()
+	defer c.timings.since(addr, phaseDial, dialStart)
+
+	var err error
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), c.ConnTimeout)
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
 }
 
-// handle output stream, and give sudo password if necessary.
-func (c *Client) handleOutput(w io.Writer, r io.Reader) (<-chan []byte, <-chan bool) {
+// handle output stream, and give sudo password or answers to prompts if necessary.
+func (c *Client) handleOutput(w io.Writer, r io.Reader, su bool) (<-chan []byte, <-chan bool) {
 	out := make(chan []byte, 1)
 	isWrongPass := make(chan bool, 1)
 
 	go func() {
-		sudoTimes := 0
+		sudoTimes, suTimes := 0, 0
+
+		// pending is the output since the last answer, prompts may be split across reads.
+		pending := ""
 
 		for {
 			//nolint:gomnd
@@ -768,6 +1399,39 @@ func (c *Client) handleOutput(w io.Writer, r io.Reader) (<-chan []byte, <-chan b
 					close(out)
 					return
 				}
+			} else if su && suTimes == 0 && isSuPrompt(string(buf[:n])) {
+				// su does not prompt again if the password is wrong.
+				suTimes++
+
+				if _, err := w.Write([]byte(c.suPassword() + "\n")); err != nil {
+					isWrongPass <- false
+					close(out)
+					return
+				}
+			}
+
+			if len(c.Responses) != 0 {
+				pending += string(buf[:n])
+				if len(pending) > maxPendingOutput {
+					pending = pending[len(pending)-maxPendingOutput:]
+				}
+
+				for _, response := range c.Responses {
+					if !response.Prompt.MatchString(pending) {
+						continue
+					}
+
+					log.Debugf("Responses: answer prompt '%s'", response.Prompt)
+
+					if _, err := w.Write([]byte(response.Answer + "\n")); err != nil {
+						isWrongPass <- false
+						close(out)
+						return
+					}
+					pending = ""
+
+					break
+				}
 			}
 
 			out <- buf[:n]
@@ -808,25 +1472,165 @@ func WithConcurrency(count int) func(*Client) {
 // WithProxyServer connect remote hosts by proxy server.
 func WithProxyServer(proxyServer, user string, port int, auths []ssh.AuthMethod) func(*Client) {
 	return func(c *Client) {
-		proxySSHConfig := &ssh.ClientConfig{
-			User:    user,
-			Auth:    auths,
-			Timeout: c.ConnTimeout,
-		}
-		//nolint:gosec
-		proxySSHConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
-
-		proxyClient, err1 := ssh.Dial(
-			"tcp",
-			net.JoinHostPort(proxyServer, strconv.Itoa(port)),
-			proxySSHConfig,
-		)
-		if err1 != nil {
-			c.Proxy.Err = fmt.Errorf("connet to proxy %s:%d failed: %s", proxyServer, port, err1)
+		c.Proxy = NewProxy(proxyServer, user, port, auths)
+		c.Proxy.connect(c)
+	}
+}
 
-			return
-		}
+// WithProxyServers distributes target hosts across the proxy servers with failover option.
+func WithProxyServers(proxyServers []string, user string, port int, auths []ssh.AuthMethod) func(*Client) {
+	return func(c *Client) {
+		c.ProxyPool = NewProxyPool(proxyServers, user, port, auths)
+	}
+}
 
-		c.Proxy.SSHClient = proxyClient
+// WithProxyMaxSessions caps the concurrent sessions through each proxy server option.
+func WithProxyMaxSessions(max int) func(*Client) {
+	return func(c *Client) {
+		c.ProxyMaxSessions = max
+	}
+}
+
+// WithPreConnect hook called before connecting each target host option.
+func WithPreConnect(preConnect func(addr, hostName string, port int) error) func(*Client) {
+	return func(c *Client) {
+		c.PreConnect = preConnect
+	}
+}
+
+// WithHTTPProxy tunnels ssh connections through the http proxy option,
+// it should be set before WithProxyServer.
+func WithHTTPProxy(proxy *HTTPProxy) func(*Client) {
+	return func(c *Client) {
+		c.HTTPProxy = proxy
+	}
+}
+
+// WithAlgorithms sets the algorithms for connecting target hosts and proxy server,
+// it should be set before WithProxyServer.
+func WithAlgorithms(algorithms Algorithms) func(*Client) {
+	return func(c *Client) {
+		c.Algorithms = algorithms
+	}
+}
+
+// WithControlPath connect target hosts through the control master listening on
+// this unix socket if it is available.
+func WithControlPath(controlPath string) func(*Client) {
+	return func(c *Client) {
+		c.ControlPath = controlPath
+	}
+}
+
+// WithSpread limits the concurrent target hosts of each group.
+func WithSpread(groups map[string]string, maxPerGroup int) func(*Client) {
+	return func(c *Client) {
+		c.Spread = &Spread{Groups: groups, MaxPerGroup: maxPerGroup}
+	}
+}
+
+// WithConnectRate limits the new connections to perSecond each second.
+func WithConnectRate(perSecond float64) func(*Client) {
+	return func(c *Client) {
+		c.ConnectRate = NewRateLimiter(perSecond)
+	}
+}
+
+// WithTransfer sftp requests tuning option.
+func WithTransfer(transfer Transfer) func(*Client) {
+	return func(c *Client) {
+		c.Transfer = transfer
+	}
+}
+
+// WithMaxOutputSize max bytes of output kept for each target host option.
+func WithMaxOutputSize(size int) func(*Client) {
+	return func(c *Client) {
+		c.MaxOutputSize = size
+	}
+}
+
+// WithRecordDir records the output of each session to files in dir.
+func WithRecordDir(dir string) func(*Client) {
+	return func(c *Client) {
+		c.RecordDir = dir
+	}
+}
+
+// WithSeparateStderr captures stderr apart from stdout option.
+func WithSeparateStderr(separate bool) func(*Client) {
+	return func(c *Client) {
+		c.SeparateStderr = separate
+	}
+}
+
+// WithRawExec executes commands without pty, shell wrappers and language settings.
+func WithRawExec(raw bool) func(*Client) {
+	return func(c *Client) {
+		c.RawExec = raw
+	}
+}
+
+// WithNoPty executes commands without pty option.
+func WithNoPty(noPty bool) func(*Client) {
+	return func(c *Client) {
+		c.NoPty = noPty
+	}
+}
+
+// WithPty the pty requested for commands option.
+func WithPty(pty Pty) func(*Client) {
+	return func(c *Client) {
+		c.Pty = pty
+	}
+}
+
+// WithWorkDir the directory in which commands/scripts are executed option.
+func WithWorkDir(dir string) func(*Client) {
+	return func(c *Client) {
+		c.WorkDir = dir
+	}
+}
+
+// WithUmask the umask of commands/scripts option.
+func WithUmask(umask string) func(*Client) {
+	return func(c *Client) {
+		c.Umask = umask
+	}
+}
+
+// WithSudoEnv environment handling of sudo option.
+func WithSudoEnv(sudoEnv SudoEnv) func(*Client) {
+	return func(c *Client) {
+		c.SudoEnv = sudoEnv
+	}
+}
+
+// WithEscalate sets the method of running as other users and the password of su.
+func WithEscalate(escalate, suPassword string) func(*Client) {
+	return func(c *Client) {
+		c.Escalate = escalate
+		c.SuPassword = suPassword
+	}
+}
+
+// WithSudoWrapper executes commands by the wrapper instead of bash while using sudo.
+func WithSudoWrapper(wrapper string) func(*Client) {
+	return func(c *Client) {
+		c.SudoWrapper = wrapper
+	}
+}
+
+// WithResponses answers prompts of commands by the responses in order.
+func WithResponses(responses []Response) func(*Client) {
+	return func(c *Client) {
+		c.Responses = responses
+	}
+}
+
+// WithHostConfigs per target host connection settings option.
+func WithHostConfigs(hostConfigs map[string]*HostConfig) func(*Client) {
+	return func(c *Client) {
+		c.HostConfigs = hostConfigs
 	}
 }
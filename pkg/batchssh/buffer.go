@@ -0,0 +1,123 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// maxPooledBufferSize is the max capacity of the buffers put back to bufferPool,
+// so that a few huge outputs are not kept in memory for the whole batch.
+const maxPooledBufferSize = 64 << 10
+
+// bufferPool reuses the buffers of outputs across target hosts, which saves
+// lots of allocations and GC work in the batches of tens of thousands of hosts.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// outputBuffer collects output of a target host, which is safe for concurrent
+// writes of stdout and stderr. If max is greater than 0, only the first max
+// bytes are kept, so that huge outputs of many hosts do not exhaust memory.
+// The whole output is still written to recorder if it is not nil.
+type outputBuffer struct {
+	mu       sync.Mutex
+	buf      *bytes.Buffer
+	max      int
+	dropped  int
+	recorder *sessionRecorder
+}
+
+// newOutputBuffer returns an outputBuffer whose buffer is taken from bufferPool,
+// it should be freed once the output is no longer needed.
+func newOutputBuffer(max int, recorder *sessionRecorder) *outputBuffer {
+	buf, _ := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	return &outputBuffer{buf: buf, max: max, recorder: recorder}
+}
+
+// Write never fails, the bytes beyond max are discarded,
+// and so are all the bytes after the buffer is freed.
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+
+	b.recorder.record(p)
+
+	if b.buf == nil {
+		return n, nil
+	}
+
+	if b.max > 0 {
+		if room := b.max - b.buf.Len(); room < len(p) {
+			if room < 0 {
+				room = 0
+			}
+
+			b.dropped += len(p) - room
+			p = p[:room]
+		}
+	}
+
+	b.buf.Write(p)
+
+	return n, nil
+}
+
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf == nil {
+		return ""
+	}
+
+	if b.dropped > 0 {
+		return fmt.Sprintf("%s\n... (%d bytes truncated)\n", b.buf.String(), b.dropped)
+	}
+
+	return b.buf.String()
+}
+
+// free puts the buffer back to bufferPool, the output is empty after that.
+func (b *outputBuffer) free() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf == nil {
+		return
+	}
+
+	if b.buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(b.buf)
+	}
+
+	b.buf = nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Categories of the failures of target hosts, see Result.Category.
+const (
+	CategoryDNS            = "dns"
+	CategoryDialTimeout    = "dial-timeout"
+	CategoryDial           = "dial"
+	CategoryAuth           = "auth"
+	CategoryHostKey        = "host-key"
+	CategoryCommandNonzero = "command-nonzero"
+	CategoryCommandTimeout = "command-timeout"
+	CategoryTransfer       = "transfer"
+	CategoryOther          = "other"
+)
+
+// categoryError is an error of which the category is known.
+type categoryError struct {
+	category string
+	err      error
+}
+
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categoryError) Unwrap() error {
+	return e.err
+}
+
+// withCategory sets the category of err if it has no category yet.
+func withCategory(err error, category string) error {
+	if err == nil {
+		return nil
+	}
+
+	var ce *categoryError
+	if errors.As(err, &ce) {
+		return err
+	}
+
+	return &categoryError{category: category, err: err}
+}
+
+// ErrorCategory returns the category of err, or CategoryOther if unknown.
+func ErrorCategory(err error) string {
+	var ce *categoryError
+	if errors.As(err, &ce) {
+		return ce.category
+	}
+
+	return CategoryOther
+}
+
+// dialCategory returns the category of the error of connecting target host.
+func dialCategory(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return CategoryDNS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CategoryDialTimeout
+	}
+
+	return CategoryDial
+}
+
+// handshakeCategory returns the category of the error of ssh handshake.
+func handshakeCategory(err error) string {
+	msg := err.Error()
+
+	switch {
+	case strings.Contains(msg, "unable to authenticate"):
+		return CategoryAuth
+	case strings.Contains(msg, "host key"):
+		return CategoryHostKey
+	}
+
+	return dialCategory(err)
+}
+
+// outputError is the error of the command that failed with output,
+// which is the message of it.
+type outputError struct {
+	output string
+	err    error
+}
+
+func (e *outputError) Error() string {
+	return e.output
+}
+
+func (e *outputError) Unwrap() error {
+	return e.err
+}
+
+// commandError returns the error of the command that failed with output.
+func commandError(err error, output string) error {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return withCategory(&outputError{output: output, err: err}, CategoryCommandNonzero)
+	}
+
+	return &outputError{output: output, err: err}
+}
+
+// exitCode returns the exit code of the failed command of err, or -1 if it did not exit,
+// e.g. failures of connecting target host.
+func exitCode(err error) int {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+
+	return -1
+}
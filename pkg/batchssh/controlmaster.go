@@ -0,0 +1,373 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+const controlMasterOK = "ok"
+
+// controlMaster keeps connections to target hosts for other gossh processes.
+type controlMaster struct {
+	client  *Client
+	resolve func(addr string) *HostConfig
+	config  *ssh.ServerConfig
+
+	mu         sync.Mutex
+	upstreams  map[string]*upstream
+	active     int
+	lastActive time.Time
+}
+
+type upstream struct {
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// ServeControlMaster keeps an authenticated connection to each target host
+// requested through the unix socket controlPath, like ControlMaster of
+// openssh, so that consecutive gossh invocations skip dialing and
+// authentication.
+//
+// Each request starts with a line of the target host, then the rest of the
+// local connection is served as an ssh server whose channels are forwarded
+// to the connection of the target host. The ssh server does not authenticate
+// clients, so the socket must be in a directory that only the user can access.
+//
+// resolve provides the connection settings of a target host, it can be nil.
+// It returns after there are no requests for the duration of persist.
+func (c *Client) ServeControlMaster(
+	controlPath string,
+	persist time.Duration,
+	resolve func(addr string) *HostConfig,
+) error {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		return err
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	if conn, err := net.Dial("unix", controlPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("control master '%s' is already running", controlPath)
+	}
+	_ = os.Remove(controlPath)
+
+	listener, err := net.Listen("unix", controlPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(controlPath)
+
+	m := &controlMaster{
+		client:     c,
+		resolve:    resolve,
+		config:     config,
+		upstreams:  make(map[string]*upstream),
+		lastActive: time.Now(),
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if m.idle() > persist {
+				listener.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+
+		go m.handle(conn)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.upstreams {
+		if u.client != nil {
+			u.client.Close()
+		}
+	}
+
+	return nil
+}
+
+func (m *controlMaster) handle(conn net.Conn) {
+	defer conn.Close()
+
+	m.setActive(1)
+	defer m.setActive(-1)
+
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	addr := strings.TrimSpace(line)
+
+	client, err := m.getUpstream(addr)
+	if err != nil {
+		fmt.Fprintf(conn, "%s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		return
+	}
+	fmt.Fprintf(conn, "%s\n", controlMasterOK)
+
+	serverConn, chans, reqs, err := ssh.NewServerConn(&bufferedConn{conn, reader}, m.config)
+	if err != nil {
+		log.Debugf("control master: handshake for %s failed: %s", addr, err)
+		return
+	}
+	defer serverConn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		go forwardChannel(client, newChannel)
+	}
+}
+
+// getUpstream returns the connection of the target host, and reconnects it
+// if the connection is broken.
+func (m *controlMaster) getUpstream(addr string) (*ssh.Client, error) {
+	m.mu.Lock()
+	u, ok := m.upstreams[addr]
+	if !ok {
+		u = &upstream{}
+		m.upstreams[addr] = u
+	}
+	m.mu.Unlock()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.client != nil {
+		if _, _, err := u.client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+			return u.client, nil
+		}
+
+		u.client.Close()
+		u.client = nil
+	}
+
+	// The target is 'user@addr' if the login user is specified for the host.
+	user := ""
+	if i := strings.LastIndex(addr, "@"); i != -1 {
+		user, addr = addr[:i], addr[i+1:]
+	}
+
+	var hostConfig *HostConfig
+	if m.resolve != nil {
+		hostConfig = m.resolve(addr)
+	}
+
+	if user != "" {
+		if hostConfig == nil {
+			hostConfig = &HostConfig{}
+		}
+		hostConfig.User = user
+	}
+
+	client, err := m.client.dial(addr, hostConfig)
+	if err != nil {
+		return nil, err
+	}
+	u.client = client
+
+	return client, nil
+}
+
+func (m *controlMaster) setActive(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.active += delta
+	m.lastActive = time.Now()
+}
+
+func (m *controlMaster) idle() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.active > 0 {
+		return 0
+	}
+
+	return time.Since(m.lastActive)
+}
+
+func forwardChannel(client *ssh.Client, newChannel ssh.NewChannel) {
+	remote, remoteReqs, err := client.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			_ = newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		}
+
+		return
+	}
+
+	local, localReqs, err := newChannel.Accept()
+	if err != nil {
+		remote.Close()
+		return
+	}
+
+	go func() {
+		_, _ = io.Copy(remote, local)
+		_ = remote.CloseWrite()
+	}()
+	go forwardRequests(remote, localReqs)
+
+	// Exit status is sent by requests before the remote channel is closed,
+	// so close the local channel after all of them are forwarded.
+	var wg sync.WaitGroup
+	//nolint:gomnd
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(local, remote)
+		_ = local.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(local.Stderr(), remote.Stderr())
+	}()
+	go func() {
+		defer wg.Done()
+		forwardRequests(local, remoteReqs)
+	}()
+	wg.Wait()
+
+	local.Close()
+	remote.Close()
+}
+
+func forwardRequests(dst ssh.Channel, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		ok, err := dst.SendRequest(req.Type, req.WantReply, req.Payload)
+		if err != nil {
+			ok = false
+		}
+
+		if req.WantReply {
+			_ = req.Reply(ok, nil)
+		}
+	}
+}
+
+// dialControlMaster gets connection of the target host from control master.
+func (c *Client) dialControlMaster(addr string) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("unix", c.ControlPath, c.ConnTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ConnTimeout > 0 {
+		// Control master may need to connect the target host first.
+		//nolint:gomnd
+		_ = conn.SetDeadline(time.Now().Add(2 * c.ConnTimeout))
+	}
+
+	reader := bufio.NewReader(conn)
+
+	target := addr
+	if hostConfig := c.HostConfigs[addr]; hostConfig != nil && hostConfig.User != "" {
+		target = hostConfig.User + "@" + addr
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", target); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if status = strings.TrimSpace(status); status != controlMasterOK {
+		conn.Close()
+		return nil, errors.New(status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	sshConfig := &ssh.ClientConfig{
+		User:    c.User,
+		Timeout: c.ConnTimeout,
+	}
+	//nolint:gosec
+	sshConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+
+	ncc, chans, reqs, err := ssh.NewClientConn(&bufferedConn{conn, reader}, addr, sshConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// bufferedConn reads from the buffered reader that may already hold data of conn.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
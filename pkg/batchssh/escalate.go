@@ -0,0 +1,159 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// Methods of running as other users, see Client.Escalate.
+const (
+	EscalateSudo = "sudo"
+	EscalateSu   = "su"
+	EscalateAuto = "auto"
+)
+
+// Escalations found by EscalateAuto on target hosts, see Result.Escalation.
+const (
+	EscalationSudoNoPasswd = "sudo-nopasswd"
+	EscalationSudoPasswd   = "sudo-password"
+	EscalationSu           = "su"
+)
+
+// suShell is executed by su as 'suShell -c COMMANDS' if SudoWrapper is not set.
+const suShell = "/bin/bash"
+
+// escalationRecorder keeps the escalation of each target host for the whole
+// task, and its zero value is ready to use.
+type escalationRecorder struct {
+	mu          sync.Mutex
+	escalations map[string]string
+}
+
+func (r *escalationRecorder) set(addr, escalation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.escalations == nil {
+		r.escalations = make(map[string]string)
+	}
+
+	r.escalations[addr] = escalation
+}
+
+func (r *escalationRecorder) get(addr string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.escalations[addr]
+}
+
+// ResolveEscalation finds the escalation of addr for running as runAs once,
+// it tries passwordless sudo, sudo with password and su in order if
+// Client.Escalate is EscalateAuto.
+func (c *Client) ResolveEscalation(addr, runAs string) error {
+	switch c.Escalate {
+	case EscalateSu:
+		c.escalations.set(addr, EscalationSu)
+		return nil
+	case EscalateAuto:
+	default:
+		return nil
+	}
+
+	if c.escalations.get(addr) != "" {
+		return nil
+	}
+
+	client, err := c.getClient(addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	probes := []struct {
+		escalation string
+		command    string
+	}{
+		// sudo -n fails at once instead of prompting if a password is required.
+		{EscalationSudoNoPasswd, "sudo -n -u " + runAs + " true"},
+		{EscalationSudoPasswd, c.sudoCommand(addr, runAs) + " -c true"},
+		{EscalationSu, c.suCommand(runAs) + " -c true"},
+	}
+
+	for _, probe := range probes {
+		// The escalation is set before probing, so that the password prompt of su is answered.
+		c.escalations.set(addr, probe.escalation)
+
+		session, err := client.NewSession()
+		if err != nil {
+			c.escalations.set(addr, "")
+			return err
+		}
+
+		_, err = c.executeCmd(addr, session, probe.command)
+		session.Close()
+
+		if err == nil {
+			log.Debugf("Escalation: %s runs as %s by %s", addr, runAs, probe.escalation)
+			return nil
+		}
+
+		log.Debugf("Escalation: %s can not run as %s by %s: %s", addr, runAs, probe.escalation, err)
+	}
+
+	c.escalations.set(addr, "")
+
+	return fmt.Errorf("can not run as %s by passwordless sudo, sudo with password or su", runAs)
+}
+
+// suCommand returns the su command line to which '-c COMMANDS' is appended.
+func (c *Client) suCommand(runAs string) string {
+	shell := suShell
+	if c.SudoWrapper != "" {
+		shell = c.SudoWrapper
+	}
+
+	return "su " + runAs + " -s " + shell
+}
+
+// suPassword is SuPassword if it is set, otherwise the password of login user.
+func (c *Client) suPassword() string {
+	if c.SuPassword != "" {
+		return c.SuPassword
+	}
+
+	return c.Password
+}
+
+// isSuPrompt reports whether the output ends with the password prompt of su,
+// e.g. 'Password: '.
+func isSuPrompt(output string) bool {
+	output = strings.TrimRight(output, " ")
+
+	return strings.HasSuffix(output, ":") && strings.Contains(strings.ToLower(output), "password")
+}
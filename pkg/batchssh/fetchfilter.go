@@ -0,0 +1,98 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/windvalley/gossh/pkg/util"
+)
+
+// skippedPrefix prefixes the files skipped by FetchFilter in the output of the
+// zipping command.
+const skippedPrefix = "gossh-skipped: "
+
+// FetchFilter filters the files to fetch, mostly in the dirs.
+type FetchFilter struct {
+	// MaxSize in bytes of each file, the larger files are skipped, 0 means no limit.
+	MaxSize int64
+	// Excludes are glob patterns of files/dirs, matching their names if without '/',
+	// otherwise their full paths.
+	Excludes []string
+}
+
+// empty reports whether f filters nothing.
+func (f *FetchFilter) empty() bool {
+	return f == nil || f.MaxSize == 0 && len(f.Excludes) == 0
+}
+
+// zipCommand returns the command zipping srcFiles into zipFile, which outputs
+// the files skipped by MaxSize, and is a literal inside of single quotes.
+func (f *FetchFilter) zipCommand(zipFile string, srcFiles []string) string {
+	src := strings.Join(srcFiles, " ")
+
+	if f.empty() {
+		return fmt.Sprintf("zip -r %s %s", zipFile, src)
+	}
+
+	var excludes []string
+	for _, e := range f.Excludes {
+		e = util.ShellDoubleQuote(strings.TrimSuffix(e, "/"))
+
+		// Files in the excluded dirs are excluded too.
+		if strings.Contains(e, "/") {
+			excludes = append(excludes, fmt.Sprintf(`! -path %s ! -path %s/"*"`, e, e))
+		} else {
+			excludes = append(excludes, fmt.Sprintf(`! -name %s ! -path "*/"%s/"*"`, e, e))
+		}
+	}
+
+	find := fmt.Sprintf("find %s ! -type d %s", src, strings.Join(excludes, " "))
+
+	if f.MaxSize == 0 {
+		return fmt.Sprintf("%s | zip -q %s -@", find, zipFile)
+	}
+
+	return fmt.Sprintf(
+		`%s -size +%dc | sed "s|^|%s|";%s ! -size +%dc | zip -q %s -@`,
+		find,
+		f.MaxSize,
+		skippedPrefix,
+		find,
+		f.MaxSize,
+		zipFile,
+	)
+}
+
+// skippedFiles returns the files skipped in the output of the zipping command.
+func skippedFiles(output string) []string {
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, skippedPrefix) {
+			files = append(files, strings.TrimPrefix(line, skippedPrefix))
+		}
+	}
+
+	return files
+}
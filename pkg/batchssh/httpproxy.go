@@ -0,0 +1,107 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HTTPProxy is a http proxy server, through which the ssh connections are
+// tunneled by the CONNECT method, e.g. the corporate http proxy.
+type HTTPProxy struct {
+	// Addr is host:port of the http proxy server.
+	Addr string
+	// User and Password are for basic auth, empty User means no auth.
+	User     string
+	Password string
+}
+
+// dial connects to addr through the http proxy, addr is resolved by the http proxy.
+func (p *HTTPProxy) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", p.Addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect to http proxy %s failed: %s", p.Addr, err)
+	}
+
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if p.User != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(p.User + ":" + p.Password))
+		req += "Proxy-Authorization: Basic " + auth + "\r\n"
+	}
+	req += "\r\n"
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("send CONNECT to http proxy %s failed: %s", p.Addr, err)
+	}
+
+	br := bufio.NewReader(conn)
+	//nolint:bodyclose
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read CONNECT response of http proxy %s failed: %s", p.Addr, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("http proxy %s refused to connect %s: %s", p.Addr, addr, resp.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	// The ssh server may send its banner right after the response,
+	// which is already in the buffer of br.
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// dialSSH connects to the ssh server addr through the http proxy.
+func (p *HTTPProxy) dialSSH(addr string, timeout time.Duration, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := p.dial(addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
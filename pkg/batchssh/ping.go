@@ -0,0 +1,62 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ping only dials and authenticates to the target host without executing
+// anything, and reports the server version banner and the latency.
+// Control master is not used, so that it reflects the current state of the host.
+func (c *Client) Ping(addr string) (string, error) {
+	start := time.Now()
+
+	client, err := c.dial(addr, c.HostConfigs[addr])
+	if err != nil {
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return "", fmt.Errorf("reachable, auth failed: %w", err)
+		}
+
+		return "", fmt.Errorf("unreachable: %w", err)
+	}
+	defer client.Close()
+
+	connect := time.Since(start)
+
+	// The round trip of a global request, which is answered by the server itself.
+	rttStart := time.Now()
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		return "", fmt.Errorf("reachable, auth ok, but no response from server: %w", err)
+	}
+	rtt := time.Since(rttStart)
+
+	return fmt.Sprintf(
+		"reachable, auth ok, latency: %s, connect: %s, server: %s",
+		rtt.Round(time.Microsecond),
+		connect.Round(time.Microsecond),
+		client.ServerVersion(),
+	), nil
+}
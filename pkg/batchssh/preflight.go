@@ -0,0 +1,166 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// preflightPush checks the destination directory before uploading, so that
+// pushing fails early with a clear message instead of failing mid-transfer.
+func (c *Client) preflightPush(client *ssh.Client, ftpC *sftp.Client, dstDir string, srcZipFiles []string) error {
+	info, err := ftpC.Stat(dstDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("preflight: destination directory '%s' not exist", dstDir)
+		}
+
+		return fmt.Errorf("preflight: stat destination directory '%s' failed: %w", dstDir, err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("preflight: destination '%s' is not a directory", dstDir)
+	}
+
+	probe := path.Join(dstDir, fmt.Sprintf(".gossh-preflight.%d", time.Now().UnixNano()))
+	file, err := ftpC.Create(probe)
+	if err != nil {
+		return fmt.Errorf("preflight: destination directory '%s' is not writable: %w", dstDir, err)
+	}
+	file.Close()
+
+	if err := ftpC.Remove(probe); err != nil {
+		log.Debugf("preflight: remove '%s' failed: %s", probe, err)
+	}
+
+	required, err := requiredSpace(srcZipFiles)
+	if err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+
+	available, err := c.availableSpace(client, ftpC, dstDir)
+	if err != nil {
+		log.Debugf("preflight: skip checking free space of '%s': %s", dstDir, err)
+		return nil
+	}
+
+	if required > available {
+		return fmt.Errorf(
+			"preflight: no enough space in '%s': %s required, %s available",
+			dstDir,
+			formatBytes(required),
+			formatBytes(available),
+		)
+	}
+
+	return nil
+}
+
+// requiredSpace is the size of the zip files and their extracted files,
+// which exist at the same time on target hosts before the zip files are removed.
+func requiredSpace(srcZipFiles []string) (uint64, error) {
+	var required uint64
+
+	for _, f := range srcZipFiles {
+		info, err := os.Stat(f)
+		if err != nil {
+			return 0, err
+		}
+		required += uint64(info.Size())
+
+		r, err := zip.OpenReader(f)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, file := range r.File {
+			required += file.UncompressedSize64
+		}
+		r.Close()
+	}
+
+	return required, nil
+}
+
+// availableSpace gets the free space of dir by sftp extension statvfs@openssh.com,
+// or by 'df' if the extension is not supported.
+func (c *Client) availableSpace(client *ssh.Client, ftpC *sftp.Client, dir string) (uint64, error) {
+	if stat, err := ftpC.StatVFS(dir); err == nil {
+		return stat.Frsize * stat.Bavail, nil
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	output, err := session.Output(fmt.Sprintf("df -Pk %s | tail -1", dir))
+	if err != nil {
+		return 0, err
+	}
+
+	// Filesystem 1024-blocks Used Available Capacity Mounted-on
+	fields := strings.Fields(string(output))
+	//nolint:gomnd
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected output of df: %s", output)
+	}
+
+	availableKB, err := strconv.ParseUint(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of df: %s", output)
+	}
+
+	//nolint:gomnd
+	return availableKB * 1024, nil
+}
+
+func formatBytes(n uint64) string {
+	//nolint:gomnd
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,228 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+const (
+	// proxyCheckInterval is how often the connection to a proxy server in use
+	// is checked by a keepalive request before handing it out.
+	proxyCheckInterval = 10 * time.Second
+
+	// proxyRetryInterval is how long an unreachable proxy server is skipped
+	// before it is connected again.
+	proxyRetryInterval = 30 * time.Second
+
+	// defaultKeepaliveTimeout is the timeout of keepalive requests if Client.ConnTimeout is not set.
+	defaultKeepaliveTimeout = 10 * time.Second
+)
+
+// ProxyPool distributes the connections to target hosts across proxy servers
+// in turn, skips the unreachable ones, and fails over to the next proxy server
+// if the one in use becomes unreachable while running.
+type ProxyPool struct {
+	members []*poolMember
+	next    uint32
+}
+
+// NewProxyPool returns the pool of proxyServers in format 'host[:port]', whose
+// port defaults to port, and each of them is connected on first use like Proxy.
+func NewProxyPool(proxyServers []string, user string, port int, auths []ssh.AuthMethod) *ProxyPool {
+	pool := &ProxyPool{}
+
+	for _, server := range proxyServers {
+		member := &poolMember{
+			server: server,
+			host:   server,
+			user:   user,
+			port:   port,
+			auths:  auths,
+		}
+
+		if host, p, err := net.SplitHostPort(server); err == nil {
+			if n, err := strconv.Atoi(p); err == nil {
+				member.host, member.port = host, n
+			}
+		}
+
+		pool.members = append(pool.members, member)
+	}
+
+	return pool
+}
+
+// dial connects remoteHost through the proxy servers in turn.
+func (p *ProxyPool) dial(c *Client, addr, remoteHost string) (net.Conn, error) {
+	start := int(atomic.AddUint32(&p.next, 1))
+
+	var errs []string
+	for i := range p.members {
+		m := p.members[(start+i)%len(p.members)]
+
+		proxy, err := m.get(c)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		conn, err := c.dialProxy(addr, proxy, remoteHost)
+		if err == nil {
+			return conn, nil
+		}
+
+		// The target host itself is unreachable if the proxy server is alive.
+		if m.alive(c, proxy) {
+			return nil, withCategory(err, dialCategory(err))
+		}
+
+		errs = append(errs, fmt.Sprintf("proxy %s: %s", m.server, err))
+	}
+
+	// The same errors are grouped in the summary whichever proxy server was tried first.
+	sort.Strings(errs)
+
+	return nil, withCategory(
+		fmt.Errorf("all proxy servers are unreachable: %s", strings.Join(errs, "; ")),
+		CategoryDial,
+	)
+}
+
+// poolMember is a proxy server of ProxyPool, whose Proxy is replaced by
+// a new one to reconnect after it became unreachable.
+type poolMember struct {
+	server string
+	host   string
+	user   string
+	port   int
+	auths  []ssh.AuthMethod
+
+	mu        sync.Mutex
+	proxy     *Proxy
+	err       error
+	downUntil time.Time
+	checkedAt time.Time
+}
+
+// get returns the connected proxy server, or the error if it is unreachable.
+func (m *poolMember) get(c *Client) (*Proxy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Now().Before(m.downUntil) {
+		return nil, m.err
+	}
+
+	if m.proxy == nil {
+		m.proxy = NewProxy(m.host, m.user, m.port, m.auths)
+		m.checkedAt = time.Now()
+	}
+
+	m.proxy.connect(c)
+	if m.proxy.Err != nil {
+		m.down(m.proxy.Err)
+		return nil, m.err
+	}
+
+	if time.Since(m.checkedAt) > proxyCheckInterval {
+		if err := keepalive(m.proxy.SSHClient, c.ConnTimeout); err != nil {
+			m.down(fmt.Errorf("proxy %s: %s", m.server, err))
+			return nil, m.err
+		}
+
+		m.checkedAt = time.Now()
+	}
+
+	return m.proxy, nil
+}
+
+// alive checks the proxy server by a keepalive request, and takes it down if it is unreachable.
+func (m *poolMember) alive(c *Client, proxy *Proxy) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// It has been taken down by others.
+	if m.proxy != proxy {
+		return false
+	}
+
+	if err := keepalive(proxy.SSHClient, c.ConnTimeout); err != nil {
+		m.down(fmt.Errorf("proxy %s: %s", m.server, err))
+		return false
+	}
+
+	m.checkedAt = time.Now()
+
+	return true
+}
+
+// down takes the proxy server out of the pool for proxyRetryInterval,
+// err should tell which proxy server it is.
+func (m *poolMember) down(err error) {
+	log.Warnf("%s, skip it for %s", err, proxyRetryInterval)
+
+	if m.proxy.SSHClient != nil {
+		m.proxy.SSHClient.Close()
+	}
+
+	m.proxy = nil
+	m.err = err
+	m.downUntil = time.Now().Add(proxyRetryInterval)
+}
+
+// keepalive sends a keepalive request on client, which fails if there is
+// no reply within timeout, e.g. the network to the server is down.
+func keepalive(client *ssh.Client, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultKeepaliveTimeout
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errCh <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-timer.C:
+		return errors.New("keepalive timed out")
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// sessionRecorder writes the output of a session in asciicast v2 format,
+// so that it can be replayed by 'asciinema play' with the original timing.
+type sessionRecorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	start time.Time
+}
+
+// recordHeader is the first line of an asciicast v2 file.
+type recordHeader struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+	Command   string `json:"command"`
+	Title     string `json:"title"`
+}
+
+// startRecording creates the record file of the session in RecordDir,
+// and returns nil if RecordDir is not set or the file can not be created.
+func (c *Client) startRecording(addr, command string) *sessionRecorder {
+	if c.RecordDir == "" {
+		return nil
+	}
+
+	//nolint:gomnd
+	if err := os.MkdirAll(c.RecordDir, 0755); err != nil {
+		log.Warnf("record session of '%s' failed: %s", addr, err)
+		return nil
+	}
+
+	file, err := createRecordFile(c.RecordDir, addr)
+	if err != nil {
+		log.Warnf("record session of '%s' failed: %s", addr, err)
+		return nil
+	}
+
+	start := time.Now()
+
+	//nolint:gomnd
+	header, _ := json.Marshal(recordHeader{
+		Version:   2,
+		Width:     100,
+		Height:    100,
+		Timestamp: start.Unix(),
+		Command:   command,
+		Title:     addr,
+	})
+	if _, err := fmt.Fprintf(file, "%s\n", header); err != nil {
+		log.Warnf("record session of '%s' failed: %s", addr, err)
+	}
+
+	return &sessionRecorder{file: file, start: start}
+}
+
+// createRecordFile creates '<addr>.cast' in dir, or '<addr>.<n>.cast' if it exists,
+// e.g. the rounds of watching, so that no record is ever overwritten.
+func createRecordFile(dir, addr string) (*os.File, error) {
+	name := addr + ".cast"
+
+	for n := 2; ; n++ {
+		//nolint:gomnd
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if !errors.Is(err, os.ErrExist) {
+			return file, err
+		}
+
+		name = fmt.Sprintf("%s.%d.cast", addr, n)
+	}
+}
+
+// record writes p as an output event, it is a no-op on nil recorder.
+func (r *sessionRecorder) record(p []byte) {
+	if r == nil || len(p) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+
+	event, _ := json.Marshal([]interface{}{time.Since(r.start).Seconds(), "o", string(p)})
+	_, _ = fmt.Fprintf(r.file, "%s\n", event)
+}
+
+// Close the record file, it is safe to be called more than once.
+func (r *sessionRecorder) Close() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// Replay writes the output events of the asciicast v2 record r to w with the
+// recorded timing divided by speed, idle time longer than maxIdle is cut to maxIdle
+// if maxIdle is greater than 0.
+func Replay(r io.Reader, w io.Writer, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	scanner := bufio.NewScanner(r)
+	//nolint:gomnd
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("empty record")
+	}
+
+	var header recordHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		return errors.New("not an asciicast v2 record")
+	}
+
+	last := 0.0
+	for scanner.Scan() {
+		var event []interface{}
+		//nolint:gomnd
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			return fmt.Errorf("invalid event: %s", scanner.Text())
+		}
+
+		elapsed, ok1 := event[0].(float64)
+		kind, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return fmt.Errorf("invalid event: %s", scanner.Text())
+		}
+
+		delay := time.Duration((elapsed - last) / speed * float64(time.Second))
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		last = elapsed
+
+		if kind != "o" {
+			continue
+		}
+
+		time.Sleep(delay)
+
+		if _, err := io.WriteString(w, data); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
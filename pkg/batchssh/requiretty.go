@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"sync"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// ptyRecorder keeps the target hosts on which sudo requires a tty(requiretty of
+// sudoers), the commands are executed with pty on them even if RawExec or
+// SeparateStderr is set, and its zero value is ready to use.
+type ptyRecorder struct {
+	mu    sync.Mutex
+	hosts map[string]bool
+}
+
+func (r *ptyRecorder) set(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hosts == nil {
+		r.hosts = make(map[string]bool)
+	}
+
+	r.hosts[addr] = true
+}
+
+func (r *ptyRecorder) get(addr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.hosts[addr]
+}
+
+// noPty reports whether the commands are executed without pty on addr.
+func (c *Client) noPty(addr string) bool {
+	return (c.RawExec || c.SeparateStderr || c.NoPty) && !c.ptyHosts.get(addr)
+}
+
+// requireTTY reports whether err is that sudo refuses to run without a tty on addr.
+func (c *Client) requireTTY(addr string, err error) bool {
+	if err == nil || !c.noPty(addr) {
+		return false
+	}
+
+	return containsAny(err.Error(), sudoRequireTTYMessages) ||
+		containsAny(c.stderrs.peek(addr), sudoRequireTTYMessages)
+}
+
+// withPtyRetry runs run, and runs it again with pty if sudo requires a tty on addr,
+// so that the hosts of mixed sudoers configurations do not fail partially.
+// The hosts are recorded, and later commands are executed with pty on them at once.
+func (c *Client) withPtyRetry(addr string, sudo bool, run func() (string, error)) (string, error) {
+	output, err := run()
+	if !sudo || !c.requireTTY(addr, err) {
+		return output, err
+	}
+
+	log.Warnf("%s: sudo requires a tty, retry with pty and stderr merged into stdout", addr)
+
+	c.ptyHosts.set(addr)
+	c.stderrs.pop(addr)
+
+	return run()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// sharedFiles loads each local file once for all target hosts instead of
+// reading it for every host, and its zero value is ready to use.
+type sharedFiles struct {
+	mu    sync.Mutex
+	files map[string]*sharedFile
+}
+
+type sharedFile struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// get returns the content of the local file name, which must not be modified.
+func (s *sharedFiles) get(name string) ([]byte, error) {
+	s.mu.Lock()
+	if s.files == nil {
+		s.files = make(map[string]*sharedFile)
+	}
+
+	f, ok := s.files[name]
+	if !ok {
+		f = &sharedFile{}
+		s.files[name] = f
+	}
+	s.mu.Unlock()
+
+	f.once.Do(func() {
+		f.data, f.err = loadFile(name)
+	})
+
+	return f.data, f.err
+}
+
+func loadFile(name string) ([]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		return []byte{}, nil
+	}
+
+	data, err := mmapFile(file, info.Size())
+	if err == nil {
+		return data, nil
+	}
+
+	log.Debugf("mmap '%s' failed, read it into memory: %s", name, err)
+
+	return ioutil.ReadAll(file)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"sync"
+)
+
+// Spread limits the concurrent target hosts of each group, e.g. availability zone or rack,
+// so that mass operations never take down too many hosts of a quorum-based service.
+type Spread struct {
+	// Groups maps target host to its group, hosts not in it are regarded as in group "".
+	Groups map[string]string
+	// MaxPerGroup is the max concurrent target hosts of each group, 0 means no limit.
+	MaxPerGroup int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// acquire waits for a slot of the group of addr, and returns the func that releases it.
+func (s *Spread) acquire(addr string) (release func()) {
+	if s == nil || s.MaxPerGroup <= 0 {
+		return func() {}
+	}
+
+	group := s.Groups[addr]
+
+	s.mu.Lock()
+	if s.slots == nil {
+		s.slots = make(map[string]chan struct{})
+	}
+	slot, ok := s.slots[group]
+	if !ok {
+		slot = make(chan struct{}, s.MaxPerGroup)
+		s.slots[group] = slot
+	}
+	s.mu.Unlock()
+
+	slot <- struct{}{}
+
+	return func() {
+		<-slot
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// noPtySudoPrompt is the password prompt of 'sudo -S' that is used without pty,
+// which is written to stderr.
+const noPtySudoPrompt = "[sudo] gossh password:"
+
+// stderrRecorder collects stderr of each target host if Client.SeparateStderr
+// is set, and its zero value is ready to use.
+type stderrRecorder struct {
+	mu      sync.Mutex
+	stderrs map[string]string
+}
+
+func (r *stderrRecorder) add(addr, stderr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stderrs == nil {
+		r.stderrs = make(map[string]string)
+	}
+
+	r.stderrs[addr] += stderr
+}
+
+// peek returns the stderr of addr.
+func (r *stderrRecorder) peek(addr string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stderrs[addr]
+}
+
+// pop returns and forgets the stderr of addr.
+func (r *stderrRecorder) pop(addr string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stderr := r.stderrs[addr]
+	delete(r.stderrs, addr)
+
+	return stderr
+}
+
+// sudoNoPtyCommand is sudoCommand that reads the password from stdin,
+// for the sessions without pty.
+func (c *Client) sudoNoPtyCommand(runAs string) string {
+	return fmt.Sprintf("%s -S -p '%s' %s", c.sudoEnvCommand(runAs), noPtySudoPrompt, c.sudoShell())
+}
+
+// executeNoPtyCmd executes command without pty, so that stderr is not merged
+// into stdout by the terminal, and the stderr is recorded for addr if
+// SeparateStderr is set, otherwise it is merged into stdout here.
+func (c *Client) executeNoPtyCmd(addr string, session *ssh.Session, command string) (string, error) {
+	w, err := session.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+
+	recorder := c.startRecording(addr, command)
+	defer recorder.Close()
+
+	output := newOutputBuffer(c.MaxOutputSize, recorder)
+	defer output.free()
+	errOutput := output
+	if c.SeparateStderr {
+		errOutput = newOutputBuffer(c.MaxOutputSize, recorder)
+		defer errOutput.free()
+	}
+	wrongPass := make(chan struct{})
+
+	stdoutDone := make(chan struct{})
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stdoutDone)
+		_, _ = io.Copy(output, stdout)
+	}()
+	go func() {
+		defer close(stderrDone)
+		c.handleStderr(w, stderr, errOutput, "", nil, wrongPass)
+	}()
+
+	if err := session.Start(command); err != nil {
+		return "", err
+	}
+
+	<-stdoutDone
+	<-stderrDone
+	err = session.Wait()
+
+	if c.SeparateStderr {
+		c.stderrs.add(addr, errOutput.String())
+	}
+
+	select {
+	case <-wrongPass:
+		return "", withCategory(errors.New("wrong sudo password"), CategoryAuth)
+	default:
+	}
+
+	if err != nil {
+		log.Debugf("'%s' executed failed: %s", command, err)
+		return "", commandError(err, output.String())
+	}
+
+	return output.String(), nil
+}
+
+// handleStderr copies stderr to out, gives the sudo password on the prompt of
+// 'sudo -S', and closes ready once readyMarker appears if it is not empty.
+func (c *Client) handleStderr(
+	w io.WriteCloser,
+	r io.Reader,
+	out io.Writer,
+	readyMarker string,
+	ready, wrongPass chan struct{},
+) {
+	sudoTimes := 0
+
+	// pending holds the tail that may be the beginning of the prompt or the marker.
+	pending := ""
+	keep := len(noPtySudoPrompt) + len(readyMarker)
+
+	//nolint:gomnd
+	buf := make([]byte, 2048)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			pending += string(buf[:n])
+
+			if strings.Contains(pending, noPtySudoPrompt) {
+				pending = strings.Replace(pending, noPtySudoPrompt, "", 1)
+				sudoTimes++
+
+				if sudoTimes > 1 {
+					close(wrongPass)
+					w.Close()
+					_, _ = io.Copy(io.Discard, r)
+					return
+				}
+
+				_, _ = w.Write([]byte(c.Password + "\n"))
+			}
+
+			if readyMarker != "" {
+				if i := strings.Index(pending, readyMarker+"\n"); i != -1 {
+					pending = pending[:i] + pending[i+len(readyMarker)+1:]
+					readyMarker = ""
+					close(ready)
+				}
+			}
+
+			if len(pending) > keep {
+				_, _ = io.WriteString(out, pending[:len(pending)-keep])
+				pending = pending[len(pending)-keep:]
+			}
+		}
+
+		if err != nil {
+			_, _ = io.WriteString(out, pending)
+			return
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// stdinReady is written to stderr by the remote side once sudo is done,
+// and then the script can be sent without being consumed by sudo.
+const stdinReady = "__GOSSH_STDIN_READY__"
+
+// ExecuteScriptByStdin pipes the script to 'bash -s' over the session stdin
+// rather than copying it to target host, so nothing is written to the disk of
+// target host. It needs no pty, and the sudo password is given by 'sudo -S'.
+func (c *Client) ExecuteScriptByStdin(addr, srcFile, lang, runAs string, sudo bool) (string, error) {
+	if strings.HasPrefix(srcFile, "~/") {
+		srcFile = strings.Replace(srcFile, "~", os.Getenv("HOME"), 1)
+	}
+
+	script, err := os.Open(srcFile)
+	if err != nil {
+		return "", err
+	}
+	defer script.Close()
+
+	client, err := c.getClient(addr)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	exportLang := setLang(session, lang)
+
+	command := exportLang + c.runPrefix() + "bash -s"
+	if sudo {
+		command = fmt.Sprintf(
+			"%s%s -c 'echo %s >&2;%sexec bash -s'",
+			exportLang,
+			c.sudoNoPtyCommand(runAs),
+			stdinReady,
+			c.runPrefix(),
+		)
+	}
+
+	defer c.timings.since(addr, phaseExec, time.Now())
+
+	return c.executeStdinCmd(addr, session, command, script, sudo)
+}
+
+// ExecuteCmdWithStdin executes command on remote host with content as its stdin,
+// so that the local stdin can be fanned out to the commands of target hosts.
+// Like ExecuteScriptByStdin, it needs no pty, and the sudo password is given by 'sudo -S'.
+func (c *Client) ExecuteCmdWithStdin(addr, command, lang, runAs string, sudo bool, content []byte) (string, error) {
+	client, err := c.getClient(addr)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	exportLang := setLang(session, lang)
+	command = c.runPrefix() + command
+
+	if sudo {
+		command = fmt.Sprintf("%s%s -c 'echo %s >&2;%s'", exportLang, c.sudoNoPtyCommand(runAs), stdinReady, command)
+	} else {
+		command = exportLang + command
+	}
+
+	defer c.timings.since(addr, phaseExec, time.Now())
+
+	return c.executeStdinCmd(addr, session, command, bytes.NewReader(content), sudo)
+}
+
+func (c *Client) executeStdinCmd(
+	addr string,
+	session *ssh.Session,
+	command string,
+	script io.Reader,
+	sudo bool,
+) (string, error) {
+	w, err := session.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+
+	recorder := c.startRecording(addr, command)
+	defer recorder.Close()
+
+	output := newOutputBuffer(c.MaxOutputSize, recorder)
+	defer output.free()
+	errOutput := output
+	if c.SeparateStderr {
+		errOutput = newOutputBuffer(c.MaxOutputSize, recorder)
+		defer errOutput.free()
+	}
+
+	ready := make(chan struct{})
+	readyMarker := stdinReady
+	if !sudo {
+		close(ready)
+		readyMarker = ""
+	}
+	wrongPass := make(chan struct{})
+
+	stdoutDone := make(chan struct{})
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stdoutDone)
+		_, _ = io.Copy(output, stdout)
+	}()
+	go func() {
+		defer close(stderrDone)
+		c.handleStderr(w, stderr, errOutput, readyMarker, ready, wrongPass)
+	}()
+
+	if err := session.Start(command); err != nil {
+		return "", err
+	}
+
+	select {
+	case <-ready:
+		if _, err := io.Copy(w, script); err != nil {
+			log.Debugf("send script to '%s' failed: %s", command, err)
+		}
+	case <-wrongPass:
+	case <-stderrDone:
+	}
+	w.Close()
+
+	<-stdoutDone
+	<-stderrDone
+	err = session.Wait()
+
+	if c.SeparateStderr {
+		c.stderrs.add(addr, errOutput.String())
+	}
+
+	select {
+	case <-wrongPass:
+		return "", withCategory(errors.New("wrong sudo password"), CategoryAuth)
+	default:
+	}
+
+	if err != nil {
+		log.Debugf("'%s' executed failed: %s", command, err)
+
+		// The session can not be retried with pty, which would consume the content of stdin.
+		if sudo && containsAny(errOutput.String(), sudoRequireTTYMessages) {
+			return "", withCategory(
+				errors.New("sudo requires a tty(requiretty) that can not be used with stdin"),
+				CategoryAuth,
+			)
+		}
+
+		return "", commandError(err, output.String())
+	}
+
+	return output.String(), nil
+}
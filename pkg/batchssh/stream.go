@@ -0,0 +1,114 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StreamCmd executes command on remote host like ExecuteCmd, but passes each
+// line of the output to onLine as soon as it arrives instead of returning the
+// output, for the commands that never end, e.g. 'tail -f'. The session is
+// closed after CommandTimeout if it is set.
+func (c *Client) StreamCmd(addr, command, lang, runAs string, sudo bool, onLine func(line string)) error {
+	client, err := c.getClient(addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	exportLang := setLang(session, lang)
+
+	if sudo {
+		command = fmt.Sprintf("%s%s -c '%s'", exportLang, c.sudoCommand(addr, runAs), command)
+	} else {
+		command = exportLang + command
+	}
+
+	// The command is hung up by the pty once the session is closed.
+	if err := c.requestPty(session); err != nil {
+		return err
+	}
+
+	w, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	out, isWrongPass := c.handleOutput(w, r, c.escalations.get(addr) == EscalationSu)
+
+	if err := session.Start(command); err != nil {
+		return err
+	}
+
+	if c.CommandTimeout > 0 {
+		timer := time.AfterFunc(c.CommandTimeout, func() { session.Close() })
+		defer timer.Stop()
+	}
+
+	pending := ""
+	emit := func(line string) {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "[sudo] ") {
+			onLine(line)
+		}
+	}
+
+	for v := range out {
+		pending += string(v)
+
+		lines := strings.Split(pending, "\n")
+		for _, line := range lines[:len(lines)-1] {
+			emit(line)
+		}
+		pending = lines[len(lines)-1]
+	}
+
+	if pending != "" {
+		emit(pending)
+	}
+
+	if <-isWrongPass {
+		return withCategory(errors.New("wrong sudo password"), CategoryAuth)
+	}
+
+	if err := session.Wait(); err != nil {
+		return commandError(err, "")
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// Messages of sudo by which CheckSudo tells why the escalation fails.
+var (
+	sudoRequireTTYMessages   = []string{"must have a tty", "no tty present"}
+	sudoPasswordMessages     = []string{"a password is required"}
+	sudoNotInSudoersMessages = []string{"not in the sudoers", "not allowed to", "may not run sudo"}
+)
+
+// CheckSudo checks whether the task can run as runAs on addr by sudo before
+// running it. It runs 'sudo -n -l' that neither prompts nor runs anything, and
+// then sudo with the password if one is required, and the error tells why the
+// escalation will fail, e.g. wrong password, not in sudoers or requiretty.
+func (c *Client) CheckSudo(addr, runAs string) (string, error) {
+	if err := c.ResolveEscalation(addr, runAs); err != nil {
+		return "", withCategory(err, CategoryAuth)
+	}
+
+	if c.escalations.get(addr) == EscalationSu {
+		if _, err := c.ExecuteCmd(addr, "true", "", runAs, true); err != nil {
+			return "", withCategory(fmt.Errorf("su failed: %w", err), CategoryAuth)
+		}
+
+		return "su ok", nil
+	}
+
+	// 'sudo -l COMMAND' succeeds if the command is allowed to run as runAs.
+	probe := "sudo -n -l -u " + runAs + " " + c.sudoShell()
+	_, err := c.ExecuteCmd(addr, probe, "", "", false)
+
+	// The task retries the host with pty, see withPtyRetry.
+	if c.requireTTY(addr, err) {
+		log.Warnf("%s: sudo requires a tty, the task will run with pty and stderr merged into stdout", addr)
+
+		c.ptyHosts.set(addr)
+		c.stderrs.pop(addr)
+		_, err = c.ExecuteCmd(addr, probe, "", "", false)
+	}
+
+	if err == nil {
+		return "passwordless sudo ok", nil
+	}
+
+	if !containsAny(err.Error(), sudoPasswordMessages) {
+		return "", sudoCheckError(err)
+	}
+
+	if _, err := c.ExecuteCmd(addr, "true", "", runAs, true); err != nil {
+		return "", sudoCheckError(err)
+	}
+
+	return "sudo with password ok", nil
+}
+
+// sudoCheckError explains the failure of sudo by its output.
+func sudoCheckError(err error) error {
+	message := strings.TrimSpace(err.Error())
+
+	switch {
+	case containsAny(message, sudoRequireTTYMessages):
+		err = fmt.Errorf("requiretty: sudo needs a tty: %s", message)
+	case containsAny(message, sudoNotInSudoersMessages):
+		err = fmt.Errorf("not in sudoers: %s", message)
+	case containsAny(message, sudoPasswordMessages):
+		err = errors.New("wrong password: a password is required, but no one is provided")
+	}
+
+	return withCategory(err, CategoryAuth)
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, v := range substrs {
+		if strings.Contains(s, v) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type phase int
+
+const (
+	phaseDNS phase = iota
+	phaseDial
+	phaseAuth
+	phaseExec
+	phaseTransfer
+)
+
+// Timings of the phases of a task on one target host.
+type Timings struct {
+	DNS      time.Duration `json:"dns"`
+	Dial     time.Duration `json:"dial"`
+	Auth     time.Duration `json:"auth"`
+	Exec     time.Duration `json:"exec"`
+	Transfer time.Duration `json:"transfer"`
+}
+
+// String ...
+func (t *Timings) String() string {
+	return fmt.Sprintf("dns=%s dial=%s auth=%s exec=%s transfer=%s",
+		t.DNS, t.Dial, t.Auth, t.Exec, t.Transfer)
+}
+
+// timingRecorder collects timings of each target host,
+// and its zero value is ready to use.
+type timingRecorder struct {
+	mu      sync.Mutex
+	timings map[string]*Timings
+}
+
+// since adds the time elapsed since start to the phase of addr.
+func (r *timingRecorder) since(addr string, p phase, start time.Time) {
+	d := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.timings == nil {
+		r.timings = make(map[string]*Timings)
+	}
+
+	t, ok := r.timings[addr]
+	if !ok {
+		t = &Timings{}
+		r.timings[addr] = t
+	}
+
+	switch p {
+	case phaseDNS:
+		t.DNS += d
+	case phaseDial:
+		t.Dial += d
+	case phaseAuth:
+		t.Auth += d
+	case phaseExec:
+		t.Exec += d
+	case phaseTransfer:
+		t.Transfer += d
+	}
+}
+
+// pop returns and forgets the timings of addr.
+func (r *timingRecorder) pop(addr string) *Timings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.timings[addr]
+	if !ok {
+		return &Timings{}
+	}
+
+	delete(r.timings, addr)
+
+	return t
+}
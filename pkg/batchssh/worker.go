@@ -0,0 +1,177 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package batchssh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/windvalley/gossh/pkg/log"
+)
+
+// worker runs the task on target hosts one after another, and is reused for
+// all the target hosts it receives, so that the goroutines and timers of a
+// batch are bounded by Concurrency rather than the number of target hosts.
+type worker struct {
+	client  *Client
+	sshTask Task
+
+	// runner runs the tasks if CommandTimeout is set, it is replaced only
+	// after a task timed out, since the task can not be interrupted.
+	runner *runner
+	timer  *time.Timer
+}
+
+func newWorker(c *Client, sshTask Task) *worker {
+	return &worker{client: c, sshTask: sshTask}
+}
+
+// work runs the task on the target hosts received from addrCh until it is closed.
+func (w *worker) work(addrCh <-chan string, resCh chan<- *Result) {
+	defer w.stop()
+
+	c := w.client
+
+	for addr := range addrCh {
+		// Waits for the slot of its group, and holds it until the task really
+		// finishes even if the command timed out.
+		release := c.Spread.acquire(addr)
+
+		c.ConnectRate.wait()
+
+		startTime := time.Now()
+
+		var result *Result
+		if c.CommandTimeout > 0 {
+			result = w.runWithTimeout(addr, release)
+		} else {
+			result = c.runTask(addr, w.sshTask, release)
+		}
+
+		result.StartTime = startTime
+		result.Duration = time.Since(startTime)
+		result.Timings = c.timings.pop(addr)
+		result.Stderr = c.stderrs.pop(addr)
+		result.Escalation = c.escalations.get(addr)
+		log.Debugf("Timing: %s %s", addr, result.Timings)
+
+		resCh <- result
+	}
+}
+
+func (w *worker) runWithTimeout(addr string, release func()) *Result {
+	c := w.client
+
+	if w.runner == nil {
+		w.runner = newRunner(c, w.sshTask)
+	}
+
+	w.runner.jobCh <- runnerJob{addr: addr, release: release}
+
+	if w.timer == nil {
+		w.timer = time.NewTimer(c.CommandTimeout)
+	} else {
+		w.timer.Reset(c.CommandTimeout)
+	}
+
+	select {
+	case result := <-w.runner.resCh:
+		if !w.timer.Stop() {
+			<-w.timer.C
+		}
+
+		return result
+	case <-w.timer.C:
+		// The runner exits once the timed out task finishes.
+		close(w.runner.jobCh)
+		w.runner = nil
+
+		return &Result{
+			Addr:   addr,
+			Status: FailedIdentifier,
+			Message: fmt.Sprintf(
+				"command timeout, timeout value: %d seconds",
+				c.CommandTimeout/time.Second,
+			),
+			Category: CategoryCommandTimeout,
+			ExitCode: -1,
+		}
+	}
+}
+
+func (w *worker) stop() {
+	if w.runner != nil {
+		close(w.runner.jobCh)
+	}
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+type runnerJob struct {
+	addr    string
+	release func()
+}
+
+// runner runs the jobs of a worker in one goroutine, so that the worker can
+// give up waiting for a job when the command timed out.
+type runner struct {
+	jobCh chan runnerJob
+
+	// resCh is buffered, so that the runner of a timed out job never blocks.
+	resCh chan *Result
+}
+
+func newRunner(c *Client, sshTask Task) *runner {
+	r := &runner{
+		jobCh: make(chan runnerJob),
+		resCh: make(chan *Result, 1),
+	}
+
+	go func() {
+		for job := range r.jobCh {
+			r.resCh <- c.runTask(job.addr, sshTask, job.release)
+		}
+	}()
+
+	return r
+}
+
+// runTask runs the task on the target host and releases its slot of Spread.
+func (c *Client) runTask(addr string, sshTask Task, release func()) *Result {
+	defer release()
+
+	output, err := sshTask.RunSSH(addr)
+	if err != nil {
+		return &Result{
+			Addr:     addr,
+			Status:   FailedIdentifier,
+			Message:  err.Error(),
+			Category: ErrorCategory(err),
+			ExitCode: exitCode(err),
+		}
+	}
+
+	return &Result{Addr: addr, Status: SuccessIdentifier, Message: output}
+}
@@ -25,6 +25,7 @@ package log
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
@@ -55,8 +56,15 @@ func newEntry(logger *Logger) *entry {
 }
 
 func (e *entry) print(colorName colorType) {
+	e.toSyslog()
+
 	e.Data["time"] = time.Now().Format(timeFormat)
 
+	out := e.Logger.Out
+	if e.Logger.MessageOut != nil && len(e.Data) <= 3 {
+		out = e.Logger.MessageOut
+	}
+
 	entry := ""
 	if e.Logger.JSONFormat {
 		entryByte, _ := json.Marshal(e.Data)
@@ -70,19 +78,27 @@ func (e *entry) print(colorName colorType) {
 				e.Data["msg"],
 			)
 		} else {
-			if e.Logger.Condense {
+			output := e.Data["output"]
+			if stderr, ok := e.Data["stderr"]; ok {
+				output = fmt.Sprintf("%s\nSTDERR >>\n%s", output, stderr)
+			}
+
+			switch {
+			case e.Logger.Oneline:
+				entry = onelineEntry(e.Data)
+			case e.Logger.Condense:
 				entry = fmt.Sprintf("%q,%q,%q,\"%s\"",
 					e.Data["hostname"],
 					e.Data["status"],
 					e.Data["time"],
-					e.Data["output"],
+					output,
 				)
-			} else {
+			default:
 				entry = fmt.Sprintf("%s | %s | %s >>\n%s\n",
 					e.Data["hostname"],
 					e.Data["time"],
 					e.Data["status"],
-					e.Data["output"],
+					output,
 				)
 			}
 		}
@@ -101,7 +117,50 @@ func (e *entry) print(colorName colorType) {
 		}
 	}
 
-	fmt.Fprintln(e.Logger.Out, entry)
+	fmt.Fprintln(out, entry)
+}
+
+// onelineEntry formats the result of a target host as 'hostname status exit_code first-line-of-output',
+// exit_code is '-' if the commands did not exit, and the first line is of stderr if output is empty.
+func onelineEntry(data Fields) string {
+	exitCode := "-"
+	if code, ok := data["exit_code"]; ok {
+		exitCode = fmt.Sprint(code)
+	}
+
+	output := strings.TrimSpace(fmt.Sprint(data["output"]))
+	if stderr, ok := data["stderr"]; ok && output == "" {
+		output = strings.TrimSpace(fmt.Sprint(stderr))
+	}
+
+	if i := strings.Index(output, "\n"); i != -1 {
+		output = strings.TrimSpace(output[:i])
+	}
+
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s %s", data["hostname"], data["status"], exitCode, output))
+}
+
+// toSyslog writes entry in json format to syslog, which adds time itself.
+func (e *entry) toSyslog() {
+	if e.Logger.Syslog == nil {
+		return
+	}
+
+	messageByte, _ := json.Marshal(e.Data)
+	message := string(messageByte)
+
+	switch e.Data["level"] {
+	case "DEBUG":
+		_ = e.Logger.Syslog.Debug(message)
+	case "INFO":
+		_ = e.Logger.Syslog.Info(message)
+	case "AUDIT":
+		_ = e.Logger.Syslog.Notice(message)
+	case "WARN":
+		_ = e.Logger.Syslog.Warning(message)
+	case "ERROR":
+		_ = e.Logger.Syslog.Err(message)
+	}
 }
 
 // Debugf ...
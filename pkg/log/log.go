@@ -34,6 +34,7 @@ var (
 	Infof  = std.Infof
 	Warnf  = std.Warnf
 	Errorf = std.Errorf
+	Audit  = std.Audit
 
 	WithFields = std.WithFields
 )
@@ -41,8 +42,41 @@ var (
 // std global
 var std = New()
 
+// InitOption ...
+type InitOption func(*initOptions)
+
+type initOptions struct {
+	maxSize    int
+	maxBackups int
+	maxAge     int
+	oneline    bool
+}
+
+// WithRotation rotates logfile when it reaches maxSize megabytes, and keeps at most
+// maxBackups rotated files not older than maxAge days, zero maxSize means no rotation.
+func WithRotation(maxSize, maxBackups, maxAge int) InitOption {
+	return func(o *initOptions) {
+		o.maxSize = maxSize
+		o.maxBackups = maxBackups
+		o.maxAge = maxAge
+	}
+}
+
+// WithOneline outputs each result of target hosts in one line, and writes the other
+// messages to stderr, so that stdout has exactly one line per target host.
+func WithOneline() InitOption {
+	return func(o *initOptions) {
+		o.oneline = true
+	}
+}
+
 // Init log
-func Init(logfile string, json, verbose, quiet, condense bool) {
+func Init(logfile string, json, verbose, quiet, condense bool, opts ...InitOption) {
+	options := &initOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	if verbose {
 		std.Verbose = true
 	}
@@ -55,25 +89,45 @@ func Init(logfile string, json, verbose, quiet, condense bool) {
 		std.Condense = true
 	}
 
+	// Where the messages other than the results of target hosts are written in oneline mode.
+	var messageOut io.Writer = os.Stderr
+
 	if logfile != "" {
-		//nolint:gomnd
-		file, err := os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		file, err := openLogFile(logfile, options)
 		if err != nil {
 			fmt.Printf("Failed to log to '%s'\n", logfile)
 			if quiet {
 				std.Out = io.Discard
+				messageOut = io.Discard
 			}
 		} else {
 			if !quiet {
 				mw := io.MultiWriter(os.Stdout, file)
 				std.Out = mw
+				messageOut = io.MultiWriter(messageOut, file)
 			} else {
 				std.Out = file
+				messageOut = file
 			}
 		}
 	} else {
 		if quiet {
 			std.Out = io.Discard
+			messageOut = io.Discard
 		}
 	}
+
+	if options.oneline {
+		std.Oneline = true
+		std.MessageOut = messageOut
+	}
+}
+
+func openLogFile(logfile string, options *initOptions) (io.Writer, error) {
+	if options.maxSize > 0 {
+		return NewRotateWriter(logfile, options.maxSize, options.maxBackups, options.maxAge)
+	}
+
+	//nolint:gomnd
+	return os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 }
@@ -32,13 +32,29 @@ type exitFunc func(int)
 // Fields ...
 type Fields map[string]interface{}
 
+// SyslogWriter writes messages with syslog severities, implemented by *syslog.Writer.
+type SyslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Notice(m string) error
+	Warning(m string) error
+	Err(m string) error
+}
+
 // Logger ...
 type Logger struct {
 	Out        io.Writer
 	Verbose    bool
 	JSONFormat bool
 	Condense   bool
+	// Oneline outputs each result of target hosts in one line
+	// 'hostname status exit_code first-line-of-output'.
+	Oneline bool
+	// MessageOut is where messages other than the results of target hosts
+	// are written, it is Out if nil.
+	MessageOut io.Writer
 	ExitFunc   exitFunc
+	Syslog     SyslogWriter
 }
 
 // New logger
@@ -82,3 +98,15 @@ func (l *Logger) Errorf(format string, args ...interface{}) {
 	entry := newEntry(l)
 	entry.Errorf(format, args...)
 }
+
+// Audit writes audit event only to syslog, do nothing if syslog is not enabled.
+func (l *Logger) Audit(fields Fields) {
+	if l.Syslog == nil {
+		return
+	}
+
+	entry := newEntry(l)
+	entry.Data = fields
+	entry.Data["level"] = "AUDIT"
+	entry.toSyslog()
+}
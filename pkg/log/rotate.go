@@ -0,0 +1,163 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	megabyte = 1024 * 1024
+
+	backupTimeFormat = "20060102-150405.000"
+)
+
+// RotateWriter is a file writer that rotates the file when it reaches maxSize,
+// and keeps at most maxBackups rotated files not older than maxAge.
+type RotateWriter struct {
+	filename   string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotateWriter returns a rotate writer, maxSize is in megabytes and maxAge is in days,
+// zero maxBackups or maxAge means no limit.
+func NewRotateWriter(filename string, maxSize, maxBackups, maxAge int) (*RotateWriter, error) {
+	w := &RotateWriter{
+		filename:   filename,
+		maxSize:    int64(maxSize) * megabyte,
+		maxBackups: maxBackups,
+		maxAge:     time.Duration(maxAge) * 24 * time.Hour,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Write ...
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+// Close ...
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+func (w *RotateWriter) open() error {
+	//nolint:gomnd
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+
+	return nil
+}
+
+func (w *RotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	backup := fmt.Sprintf("%s.%s", w.filename, time.Now().Format(backupTimeFormat))
+	if err := os.Rename(w.filename, backup); err != nil {
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.removeExpiredBackups()
+
+	return nil
+}
+
+func (w *RotateWriter) removeExpiredBackups() {
+	backups, err := filepath.Glob(w.filename + ".*")
+	if err != nil {
+		return
+	}
+
+	prefix := w.filename + "."
+	valid := backups[:0]
+	for _, v := range backups {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(v, prefix)); err == nil {
+			valid = append(valid, v)
+		}
+	}
+
+	// Newest first, the time format sorts lexically.
+	sort.Sort(sort.Reverse(sort.StringSlice(valid)))
+
+	for i, v := range valid {
+		expired := w.maxBackups > 0 && i >= w.maxBackups
+		if !expired && w.maxAge > 0 {
+			if info, err := os.Stat(v); err == nil && time.Since(info.ModTime()) > w.maxAge {
+				expired = true
+			}
+		}
+
+		if expired {
+			_ = os.Remove(v)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package sha512crypt implements the SHA-512 based crypt(3) of glibc('$6$'),
+// which is the password hash of /etc/shadow on most Linux distributions.
+package sha512crypt
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"hash"
+	"math/big"
+)
+
+const (
+	prefix  = "$6$"
+	rounds  = 5000
+	saltLen = 16
+)
+
+// itoa64 is the alphabet of crypt(3) base64.
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// byteOrder is the order of digest bytes encoded by groups of three.
+var byteOrder = [...][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+	{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+	{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+}
+
+// Generate hashes the password with a random salt, e.g. '$6$salt$hash'.
+func Generate(password string) (string, error) {
+	salt := make([]byte, saltLen)
+	max := big.NewInt(int64(len(itoa64)))
+	for i := range salt {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+
+		salt[i] = itoa64[n.Int64()]
+	}
+
+	return Crypt(password, string(salt)), nil
+}
+
+// Crypt hashes the password with the salt by the default 5000 rounds,
+// and only the first 16 characters of the salt are used.
+func Crypt(password, salt string) string {
+	if len(salt) > saltLen {
+		salt = salt[:saltLen]
+	}
+
+	p, s := []byte(password), []byte(salt)
+
+	b := sum(p, s, p)
+
+	h := sha512.New()
+	h.Write(p)
+	h.Write(s)
+	writeRepeated(h, b, len(p))
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(p)
+		}
+	}
+	a := h.Sum(nil)
+
+	h.Reset()
+	for i := 0; i < len(p); i++ {
+		h.Write(p)
+	}
+	pSeq := repeat(h.Sum(nil), len(p))
+
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(s)
+	}
+	sSeq := repeat(h.Sum(nil), len(s))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+
+		if i%2 != 0 {
+			h.Write(pSeq)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sSeq)
+		}
+		if i%7 != 0 {
+			h.Write(pSeq)
+		}
+		if i%2 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(pSeq)
+		}
+
+		c = h.Sum(nil)
+	}
+
+	encoded := make([]byte, 0, 86)
+	for _, o := range byteOrder {
+		encoded = encode24(encoded, c[o[0]], c[o[1]], c[o[2]], 4)
+	}
+	encoded = encode24(encoded, 0, 0, c[63], 2)
+
+	return prefix + salt + "$" + string(encoded)
+}
+
+func sum(parts ...[]byte) []byte {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+
+	return h.Sum(nil)
+}
+
+// writeRepeated writes n bytes that are b repeated.
+func writeRepeated(h hash.Hash, b []byte, n int) {
+	for ; n > len(b); n -= len(b) {
+		h.Write(b)
+	}
+	h.Write(b[:n])
+}
+
+// repeat returns n bytes that are b repeated.
+func repeat(b []byte, n int) []byte {
+	seq := make([]byte, 0, n)
+	for len(seq) < n {
+		if rest := n - len(seq); rest < len(b) {
+			return append(seq, b[:rest]...)
+		}
+		seq = append(seq, b...)
+	}
+
+	return seq
+}
+
+func encode24(dst []byte, b2, b1, b0 byte, n int) []byte {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for i := 0; i < n; i++ {
+		dst = append(dst, itoa64[w&0x3f])
+		w >>= 6
+	}
+
+	return dst
+}
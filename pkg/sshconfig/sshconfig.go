@@ -0,0 +1,341 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package sshconfig reads the OpenSSH client configuration file(ssh_config)
+// and resolves the settings that apply to a host.
+//
+// Only the keywords that gossh cares about are kept, other keywords are
+// ignored. 'Match' blocks are not supported and never match.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Keywords supported by gossh, in lower case.
+const (
+	keywordHost         = "host"
+	keywordMatch        = "match"
+	keywordInclude      = "include"
+	keywordHostName     = "hostname"
+	keywordUser         = "user"
+	keywordPort         = "port"
+	keywordIdentityFile = "identityfile"
+	keywordProxyJump    = "proxyjump"
+)
+
+// maxIncludeDepth is the same as the limit of openssh.
+const maxIncludeDepth = 16
+
+// HostSettings that apply to a host.
+type HostSettings struct {
+	HostName      string
+	User          string
+	Port          int
+	IdentityFiles []string
+	ProxyJump     string
+}
+
+// Config of ssh client.
+type Config struct {
+	blocks []*block
+}
+
+type block struct {
+	patterns []string
+	// match blocks are not supported, and their options never apply.
+	isMatch bool
+	options []option
+}
+
+type option struct {
+	keyword string
+	value   string
+}
+
+// ParseFile parses ssh config file, and 'Include' directives in it.
+func ParseFile(file string) (*Config, error) {
+	config := &Config{}
+
+	if err := config.parseFile(expandHome(file), []string{"*"}, 0); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Parse ssh config content from reader. 'Include' directives are resolved
+// relative to $HOME/.ssh.
+func Parse(r io.Reader) (*Config, error) {
+	config := &Config{}
+
+	if err := config.parse(r, []string{"*"}, 0); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Lookup settings for host alias. For each keyword the first obtained value
+// will be used, except 'IdentityFile' which can be specified multiple times.
+func (c *Config) Lookup(alias string) *HostSettings {
+	settings := &HostSettings{}
+
+	for _, b := range c.blocks {
+		if b.isMatch || !matchPatterns(b.patterns, alias) {
+			continue
+		}
+
+		for _, o := range b.options {
+			switch o.keyword {
+			case keywordHostName:
+				if settings.HostName == "" {
+					settings.HostName = strings.ReplaceAll(o.value, "%h", alias)
+				}
+			case keywordUser:
+				if settings.User == "" {
+					settings.User = o.value
+				}
+			case keywordPort:
+				if settings.Port == 0 {
+					settings.Port, _ = strconv.Atoi(o.value)
+				}
+			case keywordIdentityFile:
+				settings.IdentityFiles = append(settings.IdentityFiles, expandHome(o.value))
+			case keywordProxyJump:
+				if settings.ProxyJump == "" && o.value != "none" {
+					settings.ProxyJump = o.value
+				}
+			}
+		}
+	}
+
+	return settings
+}
+
+func (c *Config) parseFile(file string, patterns []string, depth int) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := c.parse(f, patterns, depth); err != nil {
+		return fmt.Errorf("parse '%s' failed: %w", file, err)
+	}
+
+	return nil
+}
+
+func (c *Config) parse(r io.Reader, patterns []string, depth int) error {
+	current := &block{patterns: patterns}
+	c.blocks = append(c.blocks, current)
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		keyword, args := splitLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		if len(args) == 0 {
+			return fmt.Errorf("line %d: missing argument for '%s'", lineNumber, keyword)
+		}
+
+		switch keyword {
+		case keywordHost:
+			current = &block{patterns: args}
+			c.blocks = append(c.blocks, current)
+		case keywordMatch:
+			current = &block{isMatch: true}
+			c.blocks = append(c.blocks, current)
+		case keywordInclude:
+			if current.isMatch {
+				continue
+			}
+
+			if err := c.include(args, current.patterns, depth); err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+
+			// Options after 'Include' still belong to the current block.
+			current = &block{patterns: current.patterns}
+			c.blocks = append(c.blocks, current)
+		default:
+			current.options = append(current.options, option{keyword: keyword, value: args[0]})
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (c *Config) include(files, patterns []string, depth int) error {
+	if depth >= maxIncludeDepth {
+		return fmt.Errorf("too many nested includes")
+	}
+
+	for _, file := range files {
+		file = expandHome(file)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(expandHome("~/.ssh"), file)
+		}
+
+		matches, err := filepath.Glob(file)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range matches {
+			if err := c.parseFile(m, patterns, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitLine returns the lower case keyword and the arguments of a line.
+// Both 'Keyword value' and 'Keyword=value' formats are supported.
+func splitLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end == -1 {
+		return strings.ToLower(line), nil
+	}
+
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+
+	return keyword, splitArgs(rest)
+}
+
+// splitArgs splits by blank characters, and double quotes can be used to
+// include blanks in an argument.
+func splitArgs(s string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		quoted  bool
+		hasArg  bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			hasArg = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+
+	if hasArg {
+		args = append(args, current.String())
+	}
+
+	return args
+}
+
+// matchPatterns reports whether host matches at least one of the patterns,
+// and does not match any negated pattern.
+func matchPatterns(patterns []string, host string) bool {
+	matched := false
+
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			if matchPattern(p[1:], host) {
+				return false
+			}
+
+			continue
+		}
+
+		if matchPattern(p, host) {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// matchPattern supports wildcards '*' and '?'.
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || !strings.EqualFold(pattern[:1], s[:1]) {
+				return false
+			}
+		}
+
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+
+	return s == ""
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err == nil {
+			return homeDir + path[1:]
+		}
+	}
+
+	return path
+}
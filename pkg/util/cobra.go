@@ -54,7 +54,7 @@ func CobraMarkHiddenGlobalFlags(command *cobra.Command, flags ...string) {
 // CobraMarkHiddenGlobalFlagsExcept the flags from params.
 func CobraMarkHiddenGlobalFlagsExcept(parentCommand *cobra.Command, unhiddenFlags ...string) {
 	parentCommand.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
-		if !contains(unhiddenFlags, flag.Name) {
+		if !ContainsStr(unhiddenFlags, flag.Name) {
 			flag.Hidden = true
 		}
 	})
@@ -70,13 +70,3 @@ func CobraAddSubCommandInOrder(rootCommand *cobra.Command, subcommands ...*cobra
 		cmd.Flags().SortFlags = false
 	}
 }
-
-func contains(items []string, i string) bool {
-	for _, v := range items {
-		if v == i {
-			return true
-		}
-	}
-
-	return false
-}
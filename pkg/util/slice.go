@@ -37,3 +37,14 @@ func RemoveDuplStr(strSlice []string) []string {
 
 	return set
 }
+
+// ContainsStr reports whether str is in strSlice.
+func ContainsStr(strSlice []string, str string) bool {
+	for _, v := range strSlice {
+		if v == str {
+			return true
+		}
+	}
+
+	return false
+}
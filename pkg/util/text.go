@@ -0,0 +1,89 @@
+/*
+Copyright © 2022 windvalley
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package util
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ansiEscapeRegexp matches the ANSI escape sequences, i.e. CSI sequences such as colors
+// and cursor movements, OSC sequences such as window titles, and the other two-byte ones.
+var ansiEscapeRegexp = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)?|\x1b[@-Z\\-_]`)
+
+// StripControl removes the ANSI escape sequences and control characters except
+// tabs and newlines from s, and the text of each line overwritten by carriage returns
+// or backspaces, e.g. progress bars, is reduced to what a terminal finally shows.
+func StripControl(s string) string {
+	s = ansiEscapeRegexp.ReplaceAllString(s, "")
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if j := strings.LastIndex(line, "\r"); j != -1 {
+			line = line[j+1:]
+		}
+
+		runes := make([]rune, 0, len(line))
+		for _, r := range line {
+			switch {
+			case r == '\b':
+				if len(runes) != 0 {
+					runes = runes[:len(runes)-1]
+				}
+			case r == '\t' || !unicode.IsControl(r):
+				runes = append(runes, r)
+			}
+		}
+
+		lines[i] = string(runes)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ParseSize parses the size in bytes with an optional binary unit of K, M, G or T,
+// and an optional suffix 'B', e.g. '512', '100M', '2GB'.
+func ParseSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+
+	var shift uint
+	if n := len(s); n != 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i != -1 {
+			//nolint:gomnd
+			shift = uint(i+1) * 10
+			s = s[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	return n << shift, nil
+}
@@ -26,12 +26,37 @@ import (
 	"archive/zip"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
 // Zip a dir or file.
 func Zip(pathToZip, zipName string) error {
+	return zipWithPrefix(pathToZip, zipName, "")
+}
+
+// ZipWithPath zips a dir or file like Zip, but the entries keep the path of
+// pathToZip by PreservedPath, e.g. 'dir/a/b.conf' instead of 'b.conf'.
+func ZipWithPath(pathToZip, zipName string) error {
+	preserved, _ := PreservedPath(pathToZip)
+
+	return zipWithPrefix(pathToZip, zipName, path.Dir(preserved))
+}
+
+// PreservedPath returns the path of file relative to the destination when its
+// path is preserved, i.e. the cleaned path without the leading '/', and ok is
+// false if it is not under its base, e.g. '../foo'.
+func PreservedPath(file string) (preserved string, ok bool) {
+	preserved = strings.TrimLeft(filepath.ToSlash(filepath.Clean(file)), "/")
+	if preserved == "" || preserved == "." || preserved == ".." || strings.HasPrefix(preserved, "../") {
+		return "", false
+	}
+
+	return preserved, true
+}
+
+func zipWithPrefix(pathToZip, zipName, prefix string) error {
 	file, err := os.Create(zipName)
 	if err != nil {
 		panic(err)
@@ -50,6 +75,9 @@ func Zip(pathToZip, zipName string) error {
 		}
 
 		relativePath := "./" + strings.TrimPrefix(fullpathFile, filepath.Dir(pathToZip))
+		if prefix != "" && prefix != "." {
+			relativePath = "./" + path.Join(prefix, filepath.ToSlash(relativePath))
+		}
 
 		srcFile, err := os.Open(fullpathFile)
 		if err != nil {